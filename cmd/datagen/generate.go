@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchserver"
+)
+
+var (
+	maleNames = []string{"Boyd", "Brooks", "Cruz", "Dillard", "Gonzalez", "Jennings", "Johns", "Owen", "Henderson",
+		"Whitley", "Christy", "Leann", "Beulah", "Allison", "Nicholson", "Clarke", "Hobbs", "Ramos", "Wells", "Parker"}
+	femaleNames = []string{"Hilda", "Rose", "Twila", "Cohen", "Nicole", "Kane", "Glenn", "Everett", "Annie", "Carly",
+		"Gates", "Terry", "Estella", "Wendy", "Lynette", "Marla", "Rosalind", "Bettie", "Marta", "Alma"}
+	lastNames = []string{"Wolf", "Mayer", "Carney", "Snow", "Guerrero", "Mays", "Davidson", "Fitzgerald", "Holt",
+		"Wilkerson", "Richardson", "Shepherd", "Hewitt", "Benson", "Trujillo", "Morrow", "Whitehead", "Rivers",
+		"Sanford", "Kinney", "Conrad", "Perry", "Vaughn", "Dale", "Odonnell", "Horne"}
+	words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipisicing elit sed do eiusmod tempor incididunt
+		ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip
+		ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat nulla pariatur
+		excepteur sint occaecat cupidatat non proident sunt culpa qui officia deserunt mollit anim id est laborum`)
+)
+
+// Options - каким получится датасет
+type Options struct {
+	Rows int
+	Seed int64
+	// доля женщин, от 0 до 1
+	Female float64
+	// возраст распределён нормально и обрезан до [MinAge, MaxAge]
+	AgeMean, AgeStdDev float64
+	MinAge, MaxAge     int
+	// сколько предложений в about
+	MinSentences, MaxSentences int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Rows:         1000,
+		Seed:         1,
+		Female:       0.5,
+		AgeMean:      35,
+		AgeStdDev:    12,
+		MinAge:       18,
+		MaxAge:       80,
+		MinSentences: 3,
+		MaxSentences: 8,
+	}
+}
+
+// Generator выдаёт пользователей по одному, одинаковые Options дают одинаковый датасет
+type Generator struct {
+	opts Options
+	rnd  *rand.Rand
+	next int
+}
+
+func NewGenerator(opts Options) *Generator {
+	return &Generator{opts: opts, rnd: rand.New(rand.NewSource(opts.Seed))}
+}
+
+// Next - следующий пользователь, false - все Rows уже выданы
+func (g *Generator) Next() (searchserver.Item, bool) {
+	if g.next >= g.opts.Rows {
+		return searchserver.Item{}, false
+	}
+	item := searchserver.Item{Id: g.next, Guid: g.guid(), Age: g.age(), LastName: pick(g.rnd, lastNames), About: g.about()}
+	if g.rnd.Float64() < g.opts.Female {
+		item.Gender, item.FirstName = "female", pick(g.rnd, femaleNames)
+	} else {
+		item.Gender, item.FirstName = "male", pick(g.rnd, maleNames)
+	}
+	g.next++
+	return item, true
+}
+
+func pick(rnd *rand.Rand, values []string) string {
+	return values[rnd.Intn(len(values))]
+}
+
+func (g *Generator) guid() string {
+	var b [16]byte
+	g.rnd.Read(b[:])
+	// uuid v4
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (g *Generator) age() int {
+	age := int(math.Round(g.rnd.NormFloat64()*g.opts.AgeStdDev + g.opts.AgeMean))
+	if age < g.opts.MinAge {
+		return g.opts.MinAge
+	}
+	if age > g.opts.MaxAge {
+		return g.opts.MaxAge
+	}
+	return age
+}
+
+func (g *Generator) about() string {
+	sentences := g.opts.MinSentences
+	if g.opts.MaxSentences > sentences {
+		sentences += g.rnd.Intn(g.opts.MaxSentences - sentences + 1)
+	}
+	var about strings.Builder
+	for i := 0; i < sentences; i++ {
+		if i > 0 {
+			about.WriteByte(' ')
+		}
+		length := 6 + g.rnd.Intn(10)
+		for j := 0; j < length; j++ {
+			word := pick(g.rnd, words)
+			if j == 0 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			} else {
+				about.WriteByte(' ')
+			}
+			about.WriteString(word)
+		}
+		about.WriteByte('.')
+	}
+	return about.String()
+}
+
+// Write пишет весь датасет в формате xml, ndjson/jsonl или csv, не держа его целиком в памяти
+func Write(w io.Writer, format string, g *Generator) error {
+	switch format {
+	case "xml":
+		return writeXML(w, g)
+	case "ndjson", "jsonl":
+		return writeNDJSON(w, g)
+	case "csv":
+		return writeCSV(w, g)
+	}
+	return fmt.Errorf("unknown format %q, expected xml, ndjson, jsonl or csv", format)
+}
+
+func writeXML(w io.Writer, g *Generator) error {
+	if _, err := io.WriteString(w, xml.Header+"<root>\n"); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("  ", "  ")
+	row := xml.StartElement{Name: xml.Name{Local: "row"}}
+	for item, ok := g.Next(); ok; item, ok = g.Next() {
+		if err := encoder.EncodeElement(item, row); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n</root>\n")
+	return err
+}
+
+func writeNDJSON(w io.Writer, g *Generator) error {
+	encoder := json.NewEncoder(w)
+	for item, ok := g.Next(); ok; item, ok = g.Next() {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, g *Generator) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "guid", "age", "first_name", "last_name", "gender", "about"})
+	for item, ok := g.Next(); ok; item, ok = g.Next() {
+		writer.Write([]string{strconv.Itoa(item.Id), item.Guid, strconv.Itoa(item.Age), item.FirstName, item.LastName, item.Gender, item.About})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchserver"
+)
+
+// сгенерированный датасет читается сервером в любом формате, валиден и одинаков при одном зерне
+func TestWrite(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Rows = 200
+	var expected []searchserver.Item
+	for _, format := range []string{"xml", "ndjson", "csv"} {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, NewGenerator(opts)); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		path := filepath.Join(t.TempDir(), "dataset."+format)
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		root, err := searchserver.LoadDataset(path)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if report := root.Validate(); len(report.Problems) > 0 || report.Rows != opts.Rows {
+			t.Errorf("%s: expected %d valid rows, got %+v", format, opts.Rows, report)
+		}
+		if expected == nil {
+			expected = root.Row
+		} else if !reflect.DeepEqual(root.Row, expected) {
+			t.Errorf("%s: dataset differs from xml", format)
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, "yaml", NewGenerator(opts)); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestGeneratorDistributions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Rows = 5000
+	opts.Female = 0.3
+	g := NewGenerator(opts)
+	female, ageSum := 0, 0
+	for item, ok := g.Next(); ok; item, ok = g.Next() {
+		if item.Age < opts.MinAge || item.Age > opts.MaxAge {
+			t.Fatalf("age %d out of range", item.Age)
+		}
+		if item.Gender == "female" {
+			female++
+		}
+		ageSum += item.Age
+	}
+	if share := float64(female) / float64(opts.Rows); share < 0.27 || share > 0.33 {
+		t.Errorf("expected about 30%% women, got %.2f", share)
+	}
+	if mean := float64(ageSum) / float64(opts.Rows); mean < 33 || mean > 37 {
+		t.Errorf("expected mean age about 35, got %.1f", mean)
+	}
+}
@@ -0,0 +1,49 @@
+// datagen генерирует датасет пользователей заданного размера для нагрузочных тестов searchserver и бенчмарков клиента
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	opts := DefaultOptions()
+	flag.IntVar(&opts.Rows, "n", opts.Rows, "сколько пользователей сгенерировать")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "зерно генератора, с одним зерном датасет одинаковый")
+	flag.Float64Var(&opts.Female, "female", opts.Female, "доля женщин, от 0 до 1")
+	flag.Float64Var(&opts.AgeMean, "age-mean", opts.AgeMean, "средний возраст")
+	flag.Float64Var(&opts.AgeStdDev, "age-stddev", opts.AgeStdDev, "разброс возраста")
+	flag.IntVar(&opts.MinAge, "min-age", opts.MinAge, "минимальный возраст")
+	flag.IntVar(&opts.MaxAge, "max-age", opts.MaxAge, "максимальный возраст")
+	flag.IntVar(&opts.MaxSentences, "max-sentences", opts.MaxSentences, "сколько предложений в about максимум")
+	output := flag.String("o", "", "куда записать датасет, пустой - stdout")
+	format := flag.String("format", "", "xml, ndjson, jsonl или csv, по умолчанию - по расширению -o, иначе xml")
+	flag.Parse()
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*output)), ".")
+		if *format == "" {
+			*format = "xml"
+		}
+	}
+	out := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+	if err := Write(buffered, *format, NewGenerator(opts)); err != nil {
+		log.Fatalf("cant generate dataset: %s", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		log.Fatalf("cant write dataset: %s", err)
+	}
+}
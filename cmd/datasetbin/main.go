@@ -0,0 +1,63 @@
+// datasetbin собирает бинарный датасет для searchserver --mmap из .xml, .csv, .ndjson или .jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"hw4/pkg/searchserver"
+)
+
+func main() {
+	output := flag.String("o", "dataset.bin", "куда записать бинарный датасет")
+	duplicates := flag.String("duplicates", searchserver.DuplicatesReject, "что делать с повторами id и guid: reject, keep-first или keep-last")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: datasetbin [-o dataset.bin] dataset.xml\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	root, err := searchserver.LoadDataset(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("cant load dataset %s: %s", flag.Arg(0), err)
+	}
+	dropped, err := root.Dedupe(*duplicates)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, problem := range dropped {
+		log.Printf("dropped %s", problem)
+	}
+	// сервер невалидный датасет всё равно не загрузит, так что не пишем его вовсе
+	if report := root.Validate(); len(report.Problems) > 0 {
+		for _, problem := range report.Problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		log.Fatalf("dataset %s: %d problems in %d rows", flag.Arg(0), len(report.Problems), report.Rows)
+	}
+	// пишем рядом и подменяем переименованием: отображённый в память файл на месте менять нельзя
+	tmp := *output + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := searchserver.WriteBinaryDataset(file, root); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		log.Fatalf("cant write %s: %s", *output, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		log.Fatal(err)
+	}
+	if err := os.Rename(tmp, *output); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d users written to %s", len(root.Row), *output)
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config - настройки сервера. Источники по возрастанию приоритета:
+// значения по умолчанию, файл конфига (yaml или toml), переменные окружения SEARCHSERVER_*, флаги
+type Config struct {
+	Addr            string `yaml:"addr" toml:"addr"`
+	Dataset         string `yaml:"dataset" toml:"dataset"`
+	DatasetChecksum string `yaml:"dataset_checksum" toml:"dataset_checksum"`
+	// ссылка на sha256 датасета, перечитывается при каждой загрузке
+	DatasetChecksumURL string   `yaml:"dataset_checksum_url" toml:"dataset_checksum_url"`
+	S3                 S3Config `yaml:"s3" toml:"s3"`
+	BaseDir            string   `yaml:"base_dir" toml:"base_dir"`
+	Index              string   `yaml:"index" toml:"index"`
+	SearchWorkers      int      `yaml:"search_workers" toml:"search_workers"`
+	// искать по встроенному демо-датасету, внешний датасет и базы не нужны
+	Demo bool `yaml:"demo" toml:"demo"`
+	// отображать бинарный датасет в память вместо чтения
+	Mmap            bool            `yaml:"mmap" toml:"mmap"`
+	Duplicates      string          `yaml:"duplicates" toml:"duplicates"`
+	SQLite          string          `yaml:"sqlite" toml:"sqlite"`
+	Postgres        PostgresConfig  `yaml:"postgres" toml:"postgres"`
+	Elasticsearch   ESConfig        `yaml:"elasticsearch" toml:"elasticsearch"`
+	Redis           RedisConfig     `yaml:"redis" toml:"redis"`
+	PageCache       PageCacheConfig `yaml:"page_cache" toml:"page_cache"`
+	Analytics       AnalyticsConfig `yaml:"analytics" toml:"analytics"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Token           string          `yaml:"token" toml:"token"`
+	MaxLimit        int             `yaml:"max_limit" toml:"max_limit"`
+	ShutdownTimeout Duration        `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	RequestTimeout  Duration        `yaml:"request_timeout" toml:"request_timeout"`
+	TLS             TLSConfig       `yaml:"tls" toml:"tls"`
+	HTTP            HTTPConfig      `yaml:"http" toml:"http"`
+	CORS            CORSConfig      `yaml:"cors" toml:"cors"`
+	Compression     CompressConfig  `yaml:"compression" toml:"compression"`
+	LogFormat       string          `yaml:"log_format" toml:"log_format"`
+	// поиски дольше этого пишутся в лог с параметрами и временем по этапам, 0 - не писать
+	SlowQuery Duration `yaml:"slow_query" toml:"slow_query"`
+	// перечитывать датасет через столько после последнего изменения файла, 0 - не следить за файлом
+	Watch Duration `yaml:"watch" toml:"watch"`
+	// перечитывать датасет с такой периодичностью, 0 - не перечитывать
+	RefreshInterval Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+	// токены нескольких клиентов: имя клиента -> токен
+	Tokens map[string]string `yaml:"tokens" toml:"tokens"`
+	// файл с токенами клиентов, по строке "имя токен", см. searchserver.LoadTokens
+	TokensFile string `yaml:"tokens_file" toml:"tokens_file"`
+	// scope клиентов по именам из Tokens, для Token - по имени default. Кому не задано - только search:read
+	Scopes map[string][]string `yaml:"scopes" toml:"scopes"`
+	// какие поля прятать от клиентов без scope pii:read: поле -> hide или mask, см. searchserver.FieldMask
+	FieldMask map[string]string `yaml:"field_mask" toml:"field_mask"`
+	// проверка JWT от внешнего провайдера
+	JWT JWTConfig `yaml:"jwt" toml:"jwt"`
+	// неизвестные параметры поиска - 400, а не только запись в логе
+	StrictParams bool `yaml:"strict_params" toml:"strict_params"`
+	// сколько записей отдавать, если limit в запросе не задан, 0 - все
+	DefaultLimit int `yaml:"default_limit" toml:"default_limit"`
+	// язык сортировки Name в BCP 47, например ru или de, пустой - побайтно
+	Collation string `yaml:"collation" toml:"collation"`
+	// язык разбора About на основы слов в BCP 47, en или ru, пустой - только поиск подстрок
+	Analyzer string `yaml:"analyzer" toml:"analyzer"`
+	// файл синонимов, строки вида bob=robert, пустой - без синонимов
+	Synonyms string `yaml:"synonyms" toml:"synonyms"`
+}
+
+// TLSConfig - сертификат и ключ, если заданы оба - сервер слушает https.
+// Вместо них сертификат можно получать у Let's Encrypt, см. AutocertConfig
+type TLSConfig struct {
+	CertFile string         `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string         `yaml:"key_file" toml:"key_file"`
+	Autocert AutocertConfig `yaml:"autocert" toml:"autocert"`
+}
+
+// AutocertConfig - сертификаты от Let's Encrypt, выпускаются и продлеваются сами. Если заданы домены - сервер
+// слушает https; Addr при этом должен быть доступен снаружи на 443, иначе Let's Encrypt не проверит домен
+type AutocertConfig struct {
+	// для каких доменов выпускать сертификаты, на остальные имена сервер не отвечает
+	Domains []string `yaml:"domains" toml:"domains"`
+	// почта для уведомлений Let's Encrypt, можно пустую
+	Email string `yaml:"email" toml:"email"`
+	// где хранить сертификаты между перезапусками, пустой - в пользовательском кэше
+	CacheDir string `yaml:"cache_dir" toml:"cache_dir"`
+	// адрес для http: проверки домена по http-01 и редиректа на https, пустой - не слушать http
+	HTTPAddr string `yaml:"http_addr" toml:"http_addr"`
+}
+
+// HTTPConfig - ограничения на соединения клиентов, чтобы медленные и зависшие клиенты
+// не держали горутины и соединения сколько угодно долго
+type HTTPConfig struct {
+	// сколько ждать заголовков запроса
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	// сколько ждать запроса целиком, с телом
+	ReadTimeout Duration `yaml:"read_timeout" toml:"read_timeout"`
+	// сколько максимум отвечать, считая от конца чтения заголовков; должен быть больше RequestTimeout
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+	// сколько держать keep-alive соединение без запросов
+	IdleTimeout    Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes int      `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// больше стольких байт тела POST-поиска не читать, на большее - 413; 0 - searchserver.DefaultMaxBodyBytes
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes"`
+}
+
+// CORSConfig - каким браузерным приложениям можно ходить в сервер напрямую, без origin - никаким
+type CORSConfig struct {
+	// "https://app.example.com", "https://*.example.com" или "*"
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	// пустой - searchserver.DefaultCORSHeaders
+	AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers"`
+	// сколько браузер может помнить ответ на preflight
+	MaxAge Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// CompressConfig - сжатие json-ответов в zstd или gzip для клиентов, которые это умеют
+type CompressConfig struct {
+	Disabled bool `yaml:"disabled" toml:"disabled"`
+	// ответы короче не сжимаются, 0 - searchserver.DefaultCompressMinSize
+	MinSize int `yaml:"min_size" toml:"min_size"`
+}
+
+// S3Config - откуда брать датасет по ссылке s3://. Ключи можно задать и стандартными AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, регион - AWS_REGION
+type S3Config struct {
+	Region          string `yaml:"region" toml:"region"`
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token" toml:"session_token"`
+}
+
+// PostgresConfig - база, в которой искать вместо датасета в памяти
+type PostgresConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn"`
+	// размер пула соединений, 0 - defaultPostgresMaxConns
+	MaxConns int `yaml:"max_conns" toml:"max_conns"`
+}
+
+// ESConfig - индекс Elasticsearch или OpenSearch, в котором искать вместо датасета
+type ESConfig struct {
+	URL      string `yaml:"url" toml:"url"`
+	Index    string `yaml:"index" toml:"index"`
+	APIKey   string `yaml:"api_key" toml:"api_key"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// RedisConfig - общий для реплик кэш результатов поиска
+type RedisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr"`
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+	// сколько хранить результат, 0 - defaultRedisTTL
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// PageCacheConfig - LRU готовых ответов в памяти сервера
+type PageCacheConfig struct {
+	// сколько ответов хранить, 0 - не кэшировать
+	Size int      `yaml:"size" toml:"size"`
+	TTL  Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// AnalyticsConfig - что ищут и по чему ничего не находится, для /admin/analytics
+type AnalyticsConfig struct {
+	// сколько разных строк поиска помнить, 0 - не считать
+	Size int `yaml:"size" toml:"size"`
+	// файл, в котором счётчики переживают перезапуск, пустой - только в памяти
+	File string `yaml:"file" toml:"file"`
+}
+
+// RateLimitConfig - сколько запросов можно делать с одного токена
+type RateLimitConfig struct {
+	// запросов в секунду в среднем, 0 - без ограничения
+	Rate float64 `yaml:"rate" toml:"rate"`
+	// сколько запросов можно сделать разом, 0 - один
+	Burst int `yaml:"burst" toml:"burst"`
+}
+
+// JWTConfig - какие JWT принимать. Если не заданы ни секрет, ни ключ - JWT не принимаются
+type JWTConfig struct {
+	// секрет для HS256
+	Secret string `yaml:"secret" toml:"secret"`
+	// pem-файл с открытым ключом или сертификатом провайдера для RS256
+	PublicKeyFile string `yaml:"public_key_file" toml:"public_key_file"`
+	// каким должен быть iss, пустой - любым
+	Issuer string `yaml:"issuer" toml:"issuer"`
+	// что должно быть в aud, пустой - не проверять
+	Audience string `yaml:"audience" toml:"audience"`
+	// допустимое расхождение часов с провайдером
+	Leeway Duration `yaml:"leeway" toml:"leeway"`
+}
+
+// Duration разбирается из строк вида "5s", "1m30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:            ":8080",
+		Dataset:         "dataset.xml",
+		ShutdownTimeout: Duration(5 * time.Second),
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(10 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			MaxHeaderBytes:    64 << 10,
+		},
+	}
+}
+
+const envPrefix = "SEARCHSERVER_"
+
+// LoadConfig собирает конфиг из всех источников. args - аргументы командной строки без имени программы
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := DefaultConfig()
+
+	fs := flag.NewFlagSet("searchserver", flag.ContinueOnError)
+	configPath := fs.String("config", "", "файл конфига, .yaml/.yml или .toml (env SEARCHSERVER_CONFIG)")
+	flags := DefaultConfig()
+	fs.StringVar(&flags.Addr, "addr", flags.Addr, "адрес, на котором слушать")
+	fs.StringVar(&flags.Dataset, "dataset", flags.Dataset, "путь до датасета с пользователями, .xml, .csv, .ndjson или .jsonl, или ссылка http(s):// или s3://")
+	fs.StringVar(&flags.DatasetChecksum, "dataset-checksum", flags.DatasetChecksum, "sha256 датасета по ссылке, скачанный с другой суммой не загружается")
+	fs.StringVar(&flags.DatasetChecksumURL, "dataset-checksum-url", flags.DatasetChecksumURL, "ссылка на sha256 датасета, читается при каждой загрузке, по умолчанию для http(s):// - ссылка на датасет + .sha256")
+	fs.StringVar(&flags.BaseDir, "base-dir", flags.BaseDir, "относительно чего искать датасет, по умолчанию рабочая директория")
+	fs.StringVar(&flags.Index, "index", flags.Index, "индекс по датасету в памяти: words или trigrams")
+	fs.IntVar(&flags.SearchWorkers, "search-workers", flags.SearchWorkers, "на сколько шардов делить поиск по датасету в памяти, 0 - по числу процессоров")
+	fs.BoolVar(&flags.Demo, "demo", flags.Demo, "искать по встроенному демо-датасету вместо --dataset")
+	fs.BoolVar(&flags.Mmap, "mmap", flags.Mmap, "отображать бинарный датасет (.bin) в память, процессы на одной машине делят его страницы")
+	fs.StringVar(&flags.Duplicates, "duplicates", flags.Duplicates, "что делать с повторами id и guid в датасете: reject, keep-first или keep-last")
+	fs.StringVar(&flags.SQLite, "sqlite", flags.SQLite, "искать в этой базе SQLite, пустую базу заполнить из датасета")
+	fs.StringVar(&flags.Postgres.DSN, "postgres", flags.Postgres.DSN, "искать в этой базе Postgres (dsn), пустую таблицу заполнить из датасета")
+	fs.IntVar(&flags.Postgres.MaxConns, "postgres-max-conns", flags.Postgres.MaxConns, "размер пула соединений к Postgres")
+	fs.StringVar(&flags.Elasticsearch.URL, "elasticsearch", flags.Elasticsearch.URL, "искать в Elasticsearch/OpenSearch по этому адресу")
+	fs.StringVar(&flags.Elasticsearch.Index, "elasticsearch-index", flags.Elasticsearch.Index, "индекс Elasticsearch с пользователями")
+	fs.StringVar(&flags.Redis.Addr, "redis", flags.Redis.Addr, "кэшировать результаты поиска в Redis по этому адресу")
+	fs.Var(durationFlag{&flags.Redis.TTL}, "redis-ttl", "сколько хранить результат в Redis")
+	fs.IntVar(&flags.PageCache.Size, "page-cache", flags.PageCache.Size, "сколько готовых ответов держать в памяти, 0 - не кэшировать")
+	fs.Var(durationFlag{&flags.PageCache.TTL}, "page-cache-ttl", "сколько хранить готовый ответ, 0 - до перезагрузки датасета")
+	fs.IntVar(&flags.Analytics.Size, "analytics", flags.Analytics.Size, "сколько разных строк поиска считать для /admin/analytics, 0 - не считать")
+	fs.StringVar(&flags.Analytics.File, "analytics-file", flags.Analytics.File, "файл, в котором аналитика поиска переживает перезапуск")
+	fs.Float64Var(&flags.RateLimit.Rate, "rate-limit", flags.RateLimit.Rate, "сколько запросов в секунду можно делать с одного токена, 0 - без ограничения")
+	fs.IntVar(&flags.RateLimit.Burst, "rate-limit-burst", flags.RateLimit.Burst, "сколько запросов с одного токена можно сделать разом")
+	fs.StringVar(&flags.Token, "token", flags.Token, "токен клиентов, пустой - подходит любой непустой")
+	fs.StringVar(&flags.TokensFile, "tokens-file", flags.TokensFile, "файл с токенами нескольких клиентов, по строке \"имя токен\"")
+	fs.StringVar(&flags.JWT.Secret, "jwt-secret", flags.JWT.Secret, "принимать JWT, подписанные HS256 этим секретом")
+	fs.StringVar(&flags.JWT.PublicKeyFile, "jwt-public-key", flags.JWT.PublicKeyFile, "принимать JWT, подписанные RS256, с открытым ключом из этого pem-файла")
+	fs.StringVar(&flags.JWT.Issuer, "jwt-issuer", flags.JWT.Issuer, "принимать только JWT с таким iss")
+	fs.StringVar(&flags.JWT.Audience, "jwt-audience", flags.JWT.Audience, "принимать только JWT с таким aud")
+	fs.Var(durationFlag{&flags.JWT.Leeway}, "jwt-leeway", "допустимое расхождение часов с провайдером JWT при проверке exp и nbf")
+	fs.Func("field-mask", "какие поля прятать от клиентов без scope pii:read, например About=mask,Age=hide", func(value string) error {
+		var err error
+		flags.FieldMask, err = parsePairs(value)
+		return err
+	})
+	fs.IntVar(&flags.MaxLimit, "max-limit", flags.MaxLimit, "больше стольких записей за раз не отдавать, 0 - без ограничения")
+	fs.IntVar(&flags.DefaultLimit, "default-limit", flags.DefaultLimit, "сколько записей отдавать без limit в запросе, 0 - все")
+	fs.BoolVar(&flags.StrictParams, "strict-params", flags.StrictParams, "отвечать 400 на неизвестные параметры поиска")
+	fs.Var(durationFlag{&flags.ShutdownTimeout}, "shutdown-timeout", "сколько ждать завершения запросов при остановке")
+	fs.Var(durationFlag{&flags.RequestTimeout}, "request-timeout", "сколько максимум искать на запрос, дольше - 503, 0 - без ограничения")
+	fs.Var(durationFlag{&flags.SlowQuery}, "slow-query", "писать в лог поиски дольше этого с временем по этапам, 0 - не писать")
+	fs.Var(durationFlag{&flags.HTTP.ReadHeaderTimeout}, "read-header-timeout", "сколько ждать заголовков запроса")
+	fs.Var(durationFlag{&flags.HTTP.ReadTimeout}, "read-timeout", "сколько ждать запроса целиком")
+	fs.Var(durationFlag{&flags.HTTP.WriteTimeout}, "write-timeout", "сколько максимум отвечать на запрос")
+	fs.Var(durationFlag{&flags.HTTP.IdleTimeout}, "idle-timeout", "сколько держать простаивающее keep-alive соединение")
+	fs.IntVar(&flags.HTTP.MaxHeaderBytes, "max-header-bytes", flags.HTTP.MaxHeaderBytes, "максимальный размер заголовков запроса")
+	fs.IntVar(&flags.HTTP.MaxBodyBytes, "max-body-bytes", flags.HTTP.MaxBodyBytes, "максимальный размер тела POST-поиска, 0 - 64 КБ")
+	fs.StringVar(&flags.TLS.CertFile, "tls-cert", flags.TLS.CertFile, "файл сертификата для https")
+	fs.StringVar(&flags.TLS.KeyFile, "tls-key", flags.TLS.KeyFile, "файл ключа для https")
+	fs.Func("autocert-domains", "получать сертификаты Let's Encrypt для этих доменов (через запятую) и слушать https", func(value string) error {
+		flags.TLS.Autocert.Domains = splitList(value)
+		return nil
+	})
+	fs.StringVar(&flags.TLS.Autocert.Email, "autocert-email", flags.TLS.Autocert.Email, "почта для уведомлений Let's Encrypt")
+	fs.StringVar(&flags.TLS.Autocert.CacheDir, "autocert-cache", flags.TLS.Autocert.CacheDir, "где хранить сертификаты Let's Encrypt")
+	fs.StringVar(&flags.TLS.Autocert.HTTPAddr, "autocert-http-addr", flags.TLS.Autocert.HTTPAddr, "адрес для проверки домена по http и редиректа на https, например :80")
+	fs.Func("cors-origins", "с каких origin (через запятую) браузерам можно ходить в сервер, * - с любых", func(value string) error {
+		flags.CORS.AllowedOrigins = splitList(value)
+		return nil
+	})
+	fs.Func("cors-headers", "какие заголовки (через запятую) браузерам можно присылать", func(value string) error {
+		flags.CORS.AllowedHeaders = splitList(value)
+		return nil
+	})
+	fs.Var(durationFlag{&flags.CORS.MaxAge}, "cors-max-age", "сколько браузер может помнить ответ на preflight")
+	fs.BoolVar(&flags.Compression.Disabled, "no-compress", flags.Compression.Disabled, "не сжимать ответы")
+	fs.IntVar(&flags.Compression.MinSize, "compress-min-size", flags.Compression.MinSize, "ответы короче стольких байт не сжимать")
+	fs.StringVar(&flags.Collation, "collation", flags.Collation, "язык сортировки Name, например ru или de, пустой - побайтно")
+	fs.StringVar(&flags.Analyzer, "analyzer", flags.Analyzer, "язык разбора About на основы слов: en или ru, пустой - только поиск подстрок")
+	fs.StringVar(&flags.Synonyms, "synonyms", flags.Synonyms, "файл синонимов для query, строки вида bob=robert")
+	fs.StringVar(&flags.LogFormat, "log-format", flags.LogFormat, "формат логов: json (по умолчанию) или text")
+	fs.Var(durationFlag{&flags.Watch}, "watch", "перечитывать датасет через столько после изменения файла, 0 - не следить")
+	fs.Var(durationFlag{&flags.RefreshInterval}, "refresh-interval", "перечитывать (или заново скачивать) датасет с такой периодичностью, 0 - не перечитывать")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configPath == "" {
+		*configPath, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if err := applyEnv(&cfg, lookupEnv); err != nil {
+		return cfg, err
+	}
+
+	// флаги перетирают остальное, только если их задали явно
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = flags.Addr
+		case "dataset":
+			cfg.Dataset = flags.Dataset
+		case "dataset-checksum":
+			cfg.DatasetChecksum = flags.DatasetChecksum
+		case "dataset-checksum-url":
+			cfg.DatasetChecksumURL = flags.DatasetChecksumURL
+		case "base-dir":
+			cfg.BaseDir = flags.BaseDir
+		case "index":
+			cfg.Index = flags.Index
+		case "search-workers":
+			cfg.SearchWorkers = flags.SearchWorkers
+		case "demo":
+			cfg.Demo = flags.Demo
+		case "mmap":
+			cfg.Mmap = flags.Mmap
+		case "duplicates":
+			cfg.Duplicates = flags.Duplicates
+		case "sqlite":
+			cfg.SQLite = flags.SQLite
+		case "postgres":
+			cfg.Postgres.DSN = flags.Postgres.DSN
+		case "postgres-max-conns":
+			cfg.Postgres.MaxConns = flags.Postgres.MaxConns
+		case "elasticsearch":
+			cfg.Elasticsearch.URL = flags.Elasticsearch.URL
+		case "elasticsearch-index":
+			cfg.Elasticsearch.Index = flags.Elasticsearch.Index
+		case "redis":
+			cfg.Redis.Addr = flags.Redis.Addr
+		case "redis-ttl":
+			cfg.Redis.TTL = flags.Redis.TTL
+		case "page-cache":
+			cfg.PageCache.Size = flags.PageCache.Size
+		case "page-cache-ttl":
+			cfg.PageCache.TTL = flags.PageCache.TTL
+		case "analytics":
+			cfg.Analytics.Size = flags.Analytics.Size
+		case "analytics-file":
+			cfg.Analytics.File = flags.Analytics.File
+		case "rate-limit":
+			cfg.RateLimit.Rate = flags.RateLimit.Rate
+		case "rate-limit-burst":
+			cfg.RateLimit.Burst = flags.RateLimit.Burst
+		case "token":
+			cfg.Token = flags.Token
+		case "tokens-file":
+			cfg.TokensFile = flags.TokensFile
+		case "jwt-secret":
+			cfg.JWT.Secret = flags.JWT.Secret
+		case "jwt-public-key":
+			cfg.JWT.PublicKeyFile = flags.JWT.PublicKeyFile
+		case "jwt-issuer":
+			cfg.JWT.Issuer = flags.JWT.Issuer
+		case "jwt-audience":
+			cfg.JWT.Audience = flags.JWT.Audience
+		case "jwt-leeway":
+			cfg.JWT.Leeway = flags.JWT.Leeway
+		case "field-mask":
+			cfg.FieldMask = flags.FieldMask
+		case "max-limit":
+			cfg.MaxLimit = flags.MaxLimit
+		case "default-limit":
+			cfg.DefaultLimit = flags.DefaultLimit
+		case "strict-params":
+			cfg.StrictParams = flags.StrictParams
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = flags.ShutdownTimeout
+		case "request-timeout":
+			cfg.RequestTimeout = flags.RequestTimeout
+		case "slow-query":
+			cfg.SlowQuery = flags.SlowQuery
+		case "autocert-domains":
+			cfg.TLS.Autocert.Domains = flags.TLS.Autocert.Domains
+		case "autocert-email":
+			cfg.TLS.Autocert.Email = flags.TLS.Autocert.Email
+		case "autocert-cache":
+			cfg.TLS.Autocert.CacheDir = flags.TLS.Autocert.CacheDir
+		case "autocert-http-addr":
+			cfg.TLS.Autocert.HTTPAddr = flags.TLS.Autocert.HTTPAddr
+		case "read-header-timeout":
+			cfg.HTTP.ReadHeaderTimeout = flags.HTTP.ReadHeaderTimeout
+		case "read-timeout":
+			cfg.HTTP.ReadTimeout = flags.HTTP.ReadTimeout
+		case "write-timeout":
+			cfg.HTTP.WriteTimeout = flags.HTTP.WriteTimeout
+		case "idle-timeout":
+			cfg.HTTP.IdleTimeout = flags.HTTP.IdleTimeout
+		case "max-header-bytes":
+			cfg.HTTP.MaxHeaderBytes = flags.HTTP.MaxHeaderBytes
+		case "max-body-bytes":
+			cfg.HTTP.MaxBodyBytes = flags.HTTP.MaxBodyBytes
+		case "tls-cert":
+			cfg.TLS.CertFile = flags.TLS.CertFile
+		case "tls-key":
+			cfg.TLS.KeyFile = flags.TLS.KeyFile
+		case "cors-origins":
+			cfg.CORS.AllowedOrigins = flags.CORS.AllowedOrigins
+		case "cors-headers":
+			cfg.CORS.AllowedHeaders = flags.CORS.AllowedHeaders
+		case "cors-max-age":
+			cfg.CORS.MaxAge = flags.CORS.MaxAge
+		case "no-compress":
+			cfg.Compression.Disabled = flags.Compression.Disabled
+		case "compress-min-size":
+			cfg.Compression.MinSize = flags.Compression.MinSize
+		case "collation":
+			cfg.Collation = flags.Collation
+		case "analyzer":
+			cfg.Analyzer = flags.Analyzer
+		case "synonyms":
+			cfg.Synonyms = flags.Synonyms
+		case "log-format":
+			cfg.LogFormat = flags.LogFormat
+		case "watch":
+			cfg.Watch = flags.Watch
+		case "refresh-interval":
+			cfg.RefreshInterval = flags.RefreshInterval
+		}
+	})
+	return cfg, nil
+}
+
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cant read config: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unknown config format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("cant parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	// стандартные переменные AWS, SEARCHSERVER_S3_* важнее них
+	aws := map[string]*string{
+		"AWS_REGION":            &cfg.S3.Region,
+		"AWS_ACCESS_KEY_ID":     &cfg.S3.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY": &cfg.S3.SecretAccessKey,
+		"AWS_SESSION_TOKEN":     &cfg.S3.SessionToken,
+	}
+	for name, field := range aws {
+		if value, ok := lookupEnv(name); ok {
+			*field = value
+		}
+	}
+	strs := map[string]*string{
+		"ADDR":                   &cfg.Addr,
+		"DATASET":                &cfg.Dataset,
+		"BASE_DIR":               &cfg.BaseDir,
+		"DATASET_CHECKSUM":       &cfg.DatasetChecksum,
+		"DATASET_CHECKSUM_URL":   &cfg.DatasetChecksumURL,
+		"S3_REGION":              &cfg.S3.Region,
+		"S3_ENDPOINT":            &cfg.S3.Endpoint,
+		"S3_ACCESS_KEY_ID":       &cfg.S3.AccessKeyID,
+		"S3_SECRET_ACCESS_KEY":   &cfg.S3.SecretAccessKey,
+		"S3_SESSION_TOKEN":       &cfg.S3.SessionToken,
+		"INDEX":                  &cfg.Index,
+		"DUPLICATES":             &cfg.Duplicates,
+		"SQLITE":                 &cfg.SQLite,
+		"POSTGRES":               &cfg.Postgres.DSN,
+		"ELASTICSEARCH":          &cfg.Elasticsearch.URL,
+		"ELASTICSEARCH_INDEX":    &cfg.Elasticsearch.Index,
+		"ELASTICSEARCH_API_KEY":  &cfg.Elasticsearch.APIKey,
+		"ELASTICSEARCH_USERNAME": &cfg.Elasticsearch.Username,
+		"ELASTICSEARCH_PASSWORD": &cfg.Elasticsearch.Password,
+		"REDIS":                  &cfg.Redis.Addr,
+		"REDIS_PASSWORD":         &cfg.Redis.Password,
+		"TOKEN":                  &cfg.Token,
+		"TOKENS_FILE":            &cfg.TokensFile,
+		"ANALYTICS_FILE":         &cfg.Analytics.File,
+		"JWT_SECRET":             &cfg.JWT.Secret,
+		"JWT_PUBLIC_KEY":         &cfg.JWT.PublicKeyFile,
+		"JWT_ISSUER":             &cfg.JWT.Issuer,
+		"JWT_AUDIENCE":           &cfg.JWT.Audience,
+		"TLS_CERT":               &cfg.TLS.CertFile,
+		"TLS_KEY":                &cfg.TLS.KeyFile,
+		"LOG_FORMAT":             &cfg.LogFormat,
+		"COLLATION":              &cfg.Collation,
+		"ANALYZER":               &cfg.Analyzer,
+		"SYNONYMS":               &cfg.Synonyms,
+		"AUTOCERT_EMAIL":         &cfg.TLS.Autocert.Email,
+		"AUTOCERT_CACHE":         &cfg.TLS.Autocert.CacheDir,
+		"AUTOCERT_HTTP_ADDR":     &cfg.TLS.Autocert.HTTPAddr,
+	}
+	for name, field := range strs {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			*field = value
+		}
+	}
+	if value, ok := lookupEnv(envPrefix + "TOKENS"); ok {
+		// имя:токен через запятую
+		cfg.Tokens = map[string]string{}
+		for _, item := range splitList(value) {
+			name, token, ok := strings.Cut(item, ":")
+			if !ok || name == "" || token == "" {
+				return fmt.Errorf("invalid %sTOKENS: expected name:token, got %q", envPrefix, item)
+			}
+			cfg.Tokens[name] = token
+		}
+	}
+	if value, ok := lookupEnv(envPrefix + "SCOPES"); ok {
+		// имя=scope через запятую, несколько scope у клиента - через пробел
+		cfg.Scopes = map[string][]string{}
+		for _, item := range splitList(value) {
+			name, scopes, ok := strings.Cut(item, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid %sSCOPES: expected name=scopes, got %q", envPrefix, item)
+			}
+			cfg.Scopes[name] = strings.Fields(scopes)
+		}
+	}
+	if value, ok := lookupEnv(envPrefix + "FIELD_MASK"); ok {
+		mask, err := parsePairs(value)
+		if err != nil {
+			return fmt.Errorf("invalid %sFIELD_MASK: %w", envPrefix, err)
+		}
+		cfg.FieldMask = mask
+	}
+	lists := map[string]*[]string{
+		"AUTOCERT_DOMAINS": &cfg.TLS.Autocert.Domains,
+		"CORS_ORIGINS":     &cfg.CORS.AllowedOrigins,
+		"CORS_HEADERS":     &cfg.CORS.AllowedHeaders,
+	}
+	for name, field := range lists {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			*field = splitList(value)
+		}
+	}
+	ints := map[string]*int{
+		"MAX_LIMIT":          &cfg.MaxLimit,
+		"DEFAULT_LIMIT":      &cfg.DefaultLimit,
+		"POSTGRES_MAX_CONNS": &cfg.Postgres.MaxConns,
+		"REDIS_DB":           &cfg.Redis.DB,
+		"PAGE_CACHE":         &cfg.PageCache.Size,
+		"ANALYTICS":          &cfg.Analytics.Size,
+		"SEARCH_WORKERS":     &cfg.SearchWorkers,
+		"RATE_LIMIT_BURST":   &cfg.RateLimit.Burst,
+		"MAX_HEADER_BYTES":   &cfg.HTTP.MaxHeaderBytes,
+		"MAX_BODY_BYTES":     &cfg.HTTP.MaxBodyBytes,
+		"COMPRESS_MIN_SIZE":  &cfg.Compression.MinSize,
+	}
+	for name, field := range ints {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", envPrefix, name, err)
+			}
+			*field = parsed
+		}
+	}
+	floats := map[string]*float64{
+		"RATE_LIMIT": &cfg.RateLimit.Rate,
+	}
+	for name, field := range floats {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", envPrefix, name, err)
+			}
+			*field = parsed
+		}
+	}
+	bools := map[string]*bool{
+		"DEMO":          &cfg.Demo,
+		"MMAP":          &cfg.Mmap,
+		"NO_COMPRESS":   &cfg.Compression.Disabled,
+		"STRICT_PARAMS": &cfg.StrictParams,
+	}
+	for name, field := range bools {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s%s: %w", envPrefix, name, err)
+			}
+			*field = parsed
+		}
+	}
+	durations := map[string]*Duration{
+		"SHUTDOWN_TIMEOUT":    &cfg.ShutdownTimeout,
+		"REQUEST_TIMEOUT":     &cfg.RequestTimeout,
+		"SLOW_QUERY":          &cfg.SlowQuery,
+		"READ_HEADER_TIMEOUT": &cfg.HTTP.ReadHeaderTimeout,
+		"READ_TIMEOUT":        &cfg.HTTP.ReadTimeout,
+		"WRITE_TIMEOUT":       &cfg.HTTP.WriteTimeout,
+		"IDLE_TIMEOUT":        &cfg.HTTP.IdleTimeout,
+		"WATCH":               &cfg.Watch,
+		"REFRESH_INTERVAL":    &cfg.RefreshInterval,
+		"REDIS_TTL":           &cfg.Redis.TTL,
+		"PAGE_CACHE_TTL":      &cfg.PageCache.TTL,
+		"JWT_LEEWAY":          &cfg.JWT.Leeway,
+		"CORS_MAX_AGE":        &cfg.CORS.MaxAge,
+	}
+	for name, field := range durations {
+		if value, ok := lookupEnv(envPrefix + name); ok {
+			if err := field.UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("invalid %s%s: %w", envPrefix, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitList разбирает список через запятую, пустые элементы пропускаются
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePairs разбирает список имя=значение через запятую
+func parsePairs(value string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, item := range splitList(value) {
+		name, pairValue, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", item)
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(pairValue)
+	}
+	return pairs, nil
+}
+
+type durationFlag struct {
+	d *Duration
+}
+
+func (f durationFlag) String() string {
+	if f.d == nil {
+		return ""
+	}
+	return time.Duration(*f.d).String()
+}
+
+func (f durationFlag) Set(value string) error {
+	return f.d.UnmarshalText([]byte(value))
+}
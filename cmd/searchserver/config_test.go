@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func envFrom(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("cant write %s: %s", path, err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	yamlPath := writeFile(t, "config.yaml", `
+addr: ":9000"
+dataset: /data/users.xml
+token: from-file
+max_limit: 50
+tokens:
+  mobile: m-secret
+scopes:
+  mobile: [search:read, pii:read]
+field_mask:
+  About: mask
+compression:
+  min_size: 4096
+shutdown_timeout: 10s
+postgres:
+  dsn: postgres://localhost/users
+  max_conns: 4
+tls:
+  cert_file: /tls/cert.pem
+  key_file: /tls/key.pem
+`)
+	tomlPath := writeFile(t, "config.toml", `
+addr = ":9001"
+dataset = "users.xml"
+base_dir = "/data"
+max_limit = 40
+collation = "de"
+analyzer = "en"
+synonyms = "/etc/searchserver/synonyms.txt"
+shutdown_timeout = "1m"
+request_timeout = "3s"
+slow_query = "250ms"
+watch = "2s"
+refresh_interval = "10m"
+
+[http]
+read_header_timeout = "2s"
+write_timeout = "1m"
+
+[redis]
+addr = "localhost:6379"
+ttl = "30s"
+
+[cors]
+allowed_origins = ["https://app.example.com"]
+max_age = "10m"
+
+[jwt]
+public_key_file = "/etc/sso/key.pem"
+issuer = "https://sso.example.com"
+`)
+
+	cases := []struct {
+		Args     []string
+		Env      map[string]string
+		Expected Config
+	}{
+		{
+			Expected: DefaultConfig(),
+		},
+		{
+			Args: []string{"-config", yamlPath},
+			Expected: Config{
+				Addr:            ":9000",
+				Dataset:         "/data/users.xml",
+				Token:           "from-file",
+				Tokens:          map[string]string{"mobile": "m-secret"},
+				Scopes:          map[string][]string{"mobile": {"search:read", "pii:read"}},
+				FieldMask:       map[string]string{"About": "mask"},
+				Compression:     CompressConfig{MinSize: 4096},
+				MaxLimit:        50,
+				ShutdownTimeout: Duration(10 * time.Second),
+				TLS:             TLSConfig{CertFile: "/tls/cert.pem", KeyFile: "/tls/key.pem"},
+				Postgres:        PostgresConfig{DSN: "postgres://localhost/users", MaxConns: 4},
+				HTTP:            DefaultConfig().HTTP,
+			},
+		},
+		{
+			Env: map[string]string{"SEARCHSERVER_CONFIG": tomlPath},
+			Expected: Config{
+				Addr:            ":9001",
+				Dataset:         "users.xml",
+				BaseDir:         "/data",
+				MaxLimit:        40,
+				Collation:       "de",
+				Analyzer:        "en",
+				Synonyms:        "/etc/searchserver/synonyms.txt",
+				ShutdownTimeout: Duration(time.Minute),
+				RequestTimeout:  Duration(3 * time.Second),
+				SlowQuery:       Duration(250 * time.Millisecond),
+				Watch:           Duration(2 * time.Second),
+				RefreshInterval: Duration(10 * time.Minute),
+				Redis:           RedisConfig{Addr: "localhost:6379", TTL: Duration(30 * time.Second)},
+				JWT:             JWTConfig{PublicKeyFile: "/etc/sso/key.pem", Issuer: "https://sso.example.com"},
+				CORS:            CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: Duration(10 * time.Minute)},
+				HTTP: HTTPConfig{
+					ReadHeaderTimeout: Duration(2 * time.Second),
+					ReadTimeout:       Duration(10 * time.Second),
+					WriteTimeout:      Duration(time.Minute),
+					IdleTimeout:       Duration(2 * time.Minute),
+					MaxHeaderBytes:    64 << 10,
+				},
+			},
+		},
+		{
+			// файл < окружение < флаги
+			Args: []string{"-config", yamlPath, "-max-limit", "30", "-shutdown-timeout", "2s", "-base-dir", "/srv", "-page-cache", "100", "-analytics", "1000", "-demo", "-duplicates", "keep-first", "-log-format", "text", "-idle-timeout", "30s", "-autocert-domains", "a.example.com, b.example.com", "-rate-limit-burst", "20", "-jwt-audience", "searchserver", "-field-mask", "Age=hide, About=mask", "-cors-headers", "AccessToken", "-no-compress"},
+			Env: map[string]string{
+				"SEARCHSERVER_BASE_DIR":             "/opt",
+				"SEARCHSERVER_SQLITE":               "/data/users.db",
+				"SEARCHSERVER_POSTGRES_MAX_CONNS":   "8",
+				"SEARCHSERVER_ELASTICSEARCH":        "http://es:9200",
+				"SEARCHSERVER_ELASTICSEARCH_INDEX":  "users",
+				"SEARCHSERVER_INDEX":                "trigrams",
+				"SEARCHSERVER_PAGE_CACHE":           "10",
+				"SEARCHSERVER_ANALYTICS":            "500",
+				"SEARCHSERVER_ANALYTICS_FILE":       "/var/lib/searchserver/analytics.json",
+				"SEARCHSERVER_SEARCH_WORKERS":       "2",
+				"SEARCHSERVER_MMAP":                 "true",
+				"SEARCHSERVER_DATASET_CHECKSUM":     "abc",
+				"SEARCHSERVER_DATASET_CHECKSUM_URL": "https://example.com/users.xml.sha256",
+				"SEARCHSERVER_S3_ENDPOINT":          "http://minio:9000",
+				"SEARCHSERVER_S3_ACCESS_KEY_ID":     "minio-key",
+				"AWS_ACCESS_KEY_ID":                 "aws-key",
+				"AWS_SECRET_ACCESS_KEY":             "aws-secret",
+				"AWS_REGION":                        "eu-west-1",
+				"SEARCHSERVER_PAGE_CACHE_TTL":       "1m",
+				"SEARCHSERVER_WATCH":                "300ms",
+				"SEARCHSERVER_TOKEN":                "from-env",
+				"SEARCHSERVER_MAX_LIMIT":            "20",
+				"SEARCHSERVER_DEFAULT_LIMIT":        "25",
+				"SEARCHSERVER_ADDR":                 ":9100",
+				"SEARCHSERVER_LOG_FORMAT":           "json",
+				"SEARCHSERVER_COLLATION":            "ru",
+				"SEARCHSERVER_ANALYZER":             "ru",
+				"SEARCHSERVER_REQUEST_TIMEOUT":      "500ms",
+				"SEARCHSERVER_SLOW_QUERY":           "1s",
+				"SEARCHSERVER_IDLE_TIMEOUT":         "1m",
+				"SEARCHSERVER_READ_TIMEOUT":         "3s",
+				"SEARCHSERVER_MAX_HEADER_BYTES":     "4096",
+				"SEARCHSERVER_MAX_BODY_BYTES":       "8192",
+				"SEARCHSERVER_AUTOCERT_DOMAINS":     "env.example.com",
+				"SEARCHSERVER_AUTOCERT_CACHE":       "/var/cache/certs",
+				"SEARCHSERVER_RATE_LIMIT":           "2.5",
+				"SEARCHSERVER_RATE_LIMIT_BURST":     "5",
+				"SEARCHSERVER_TOKENS":               "web:w-secret, cli:c-secret",
+				"SEARCHSERVER_TOKENS_FILE":          "/etc/searchserver/tokens",
+				"SEARCHSERVER_SCOPES":               "web=search:read, cli=admin search:read",
+				"SEARCHSERVER_FIELD_MASK":           "Name=hide",
+				"SEARCHSERVER_CORS_ORIGINS":         "https://a.example.com,https://*.example.org",
+				"SEARCHSERVER_CORS_HEADERS":         "Authorization",
+				"SEARCHSERVER_COMPRESS_MIN_SIZE":    "512",
+				"SEARCHSERVER_JWT_SECRET":           "jwt-secret",
+				"SEARCHSERVER_JWT_AUDIENCE":         "other",
+				"SEARCHSERVER_JWT_LEEWAY":           "30s",
+				"SEARCHSERVER_STRICT_PARAMS":        "true",
+			},
+			Expected: Config{
+				Addr:               ":9100",
+				Dataset:            "/data/users.xml",
+				BaseDir:            "/srv",
+				Index:              "trigrams",
+				SearchWorkers:      2,
+				Mmap:               true,
+				Demo:               true,
+				Duplicates:         "keep-first",
+				DatasetChecksum:    "abc",
+				DatasetChecksumURL: "https://example.com/users.xml.sha256",
+				S3:                 S3Config{Region: "eu-west-1", Endpoint: "http://minio:9000", AccessKeyID: "minio-key", SecretAccessKey: "aws-secret"},
+				SQLite:             "/data/users.db",
+				Postgres:           PostgresConfig{DSN: "postgres://localhost/users", MaxConns: 8},
+				Elasticsearch:      ESConfig{URL: "http://es:9200", Index: "users"},
+				PageCache:          PageCacheConfig{Size: 100, TTL: Duration(time.Minute)},
+				Analytics:          AnalyticsConfig{Size: 1000, File: "/var/lib/searchserver/analytics.json"},
+				RateLimit:          RateLimitConfig{Rate: 2.5, Burst: 20},
+				Token:              "from-env",
+				Tokens:             map[string]string{"web": "w-secret", "cli": "c-secret"},
+				TokensFile:         "/etc/searchserver/tokens",
+				Scopes:             map[string][]string{"web": {"search:read"}, "cli": {"admin", "search:read"}},
+				FieldMask:          map[string]string{"Age": "hide", "About": "mask"},
+				CORS:               CORSConfig{AllowedOrigins: []string{"https://a.example.com", "https://*.example.org"}, AllowedHeaders: []string{"AccessToken"}},
+				Compression:        CompressConfig{Disabled: true, MinSize: 512},
+				JWT:                JWTConfig{Secret: "jwt-secret", Audience: "searchserver", Leeway: Duration(30 * time.Second)},
+				MaxLimit:           30,
+				StrictParams:       true,
+				DefaultLimit:       25,
+				Collation:          "ru",
+				Analyzer:           "ru",
+				ShutdownTimeout:    Duration(2 * time.Second),
+				Watch:              Duration(300 * time.Millisecond),
+				LogFormat:          "text",
+				RequestTimeout:     Duration(500 * time.Millisecond),
+				SlowQuery:          Duration(time.Second),
+				HTTP: HTTPConfig{
+					ReadHeaderTimeout: Duration(5 * time.Second),
+					ReadTimeout:       Duration(3 * time.Second),
+					WriteTimeout:      Duration(30 * time.Second),
+					IdleTimeout:       Duration(30 * time.Second),
+					MaxHeaderBytes:    4096,
+					MaxBodyBytes:      8192,
+				},
+				TLS: TLSConfig{CertFile: "/tls/cert.pem", KeyFile: "/tls/key.pem", Autocert: AutocertConfig{
+					Domains:  []string{"a.example.com", "b.example.com"},
+					CacheDir: "/var/cache/certs",
+				}},
+			},
+		},
+	}
+
+	for caseNum, testCase := range cases {
+		cfg, err := LoadConfig(testCase.Args, envFrom(testCase.Env))
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, testCase.Expected) {
+			t.Errorf("[%d] wrong config, expected %+v, got %+v", caseNum, testCase.Expected, cfg)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	cases := []struct {
+		Args []string
+		Env  map[string]string
+	}{
+		{Args: []string{"-config", writeFile(t, "config.ini", "addr=:1")}},
+		{Args: []string{"-config", writeFile(t, "config.yaml", "max_limit: [")}},
+		{Args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}},
+		{Env: map[string]string{"SEARCHSERVER_MAX_LIMIT": "many"}},
+		{Env: map[string]string{"SEARCHSERVER_DEFAULT_LIMIT": "ten"}},
+		{Env: map[string]string{"SEARCHSERVER_SHUTDOWN_TIMEOUT": "soon"}},
+		{Args: []string{"-shutdown-timeout", "soon"}},
+		{Env: map[string]string{"SEARCHSERVER_WATCH": "often"}},
+		{Env: map[string]string{"SEARCHSERVER_RATE_LIMIT": "fast"}},
+		{Env: map[string]string{"SEARCHSERVER_TOKENS": "web"}},
+		{Env: map[string]string{"SEARCHSERVER_SCOPES": "web"}},
+		{Env: map[string]string{"SEARCHSERVER_FIELD_MASK": "About"}},
+		{Args: []string{"-field-mask", "=hide"}},
+		{Env: map[string]string{"SEARCHSERVER_CORS_MAX_AGE": "forever"}},
+		{Env: map[string]string{"SEARCHSERVER_NO_COMPRESS": "maybe"}},
+		{Env: map[string]string{"SEARCHSERVER_STRICT_PARAMS": "sometimes"}},
+		{Env: map[string]string{"SEARCHSERVER_JWT_LEEWAY": "soon"}},
+		{Args: []string{"-refresh-interval", "hourly"}},
+		{Env: map[string]string{"SEARCHSERVER_POSTGRES_MAX_CONNS": "many"}},
+		{Env: map[string]string{"SEARCHSERVER_REDIS_TTL": "forever"}},
+		{Env: map[string]string{"SEARCHSERVER_MMAP": "maybe"}},
+	}
+	for caseNum, testCase := range cases {
+		if _, err := LoadConfig(testCase.Args, envFrom(testCase.Env)); err == nil {
+			t.Errorf("[%d] expected error", caseNum)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// searchserver - поисковый сервис по датасету пользователей
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"hw4/pkg/searchserver"
+)
+
+func main() {
+	cfg, err := LoadConfig(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatalf("config: %s", err)
+	}
+	logger, err := newLogger(cfg.LogFormat, os.Stderr)
+	if err != nil {
+		log.Fatalf("config: %s", err)
+	}
+	// log.Printf тоже уходит в logger
+	slog.SetDefault(logger)
+
+	server := &searchserver.Server{
+		DatasetPath:        cfg.Dataset,
+		DatasetChecksum:    cfg.DatasetChecksum,
+		DatasetChecksumURL: cfg.DatasetChecksumURL,
+		S3:                 searchserver.S3Config(cfg.S3),
+		BaseDir:            cfg.BaseDir,
+		Token:              cfg.Token,
+		MaxLimit:           cfg.MaxLimit,
+		MaxBodyBytes:       int64(cfg.HTTP.MaxBodyBytes),
+		DefaultLimit:       cfg.DefaultLimit,
+		StrictParams:       cfg.StrictParams,
+		RequestTimeout:     time.Duration(cfg.RequestTimeout),
+		SlowQueryThreshold: time.Duration(cfg.SlowQuery),
+		Index:              cfg.Index,
+		SearchWorkers:      cfg.SearchWorkers,
+		MapDataset:         cfg.Mmap,
+		Demo:               cfg.Demo,
+		Duplicates:         cfg.Duplicates,
+		Metrics:            searchserver.NewMetrics(),
+	}
+	if server.Tokens, server.Scopes, err = clientTokens(cfg); err != nil {
+		log.Fatalf("tokens: %s", err)
+	}
+	server.FieldMask = searchserver.FieldMask(cfg.FieldMask)
+	if err := server.FieldMask.Validate(); err != nil {
+		log.Fatalf("field mask: %s", err)
+	}
+	if server.JWT, err = jwtValidator(cfg.JWT); err != nil {
+		log.Fatalf("jwt: %s", err)
+	}
+	if cfg.Collation != "" {
+		if server.Collation, err = searchserver.NewCollation(cfg.Collation); err != nil {
+			log.Fatalf("collation: %s", err)
+		}
+	}
+	if cfg.Analyzer != "" {
+		if server.Analyzer, err = searchserver.NewAnalyzer(cfg.Analyzer); err != nil {
+			log.Fatalf("analyzer: %s", err)
+		}
+	}
+	if cfg.Synonyms != "" {
+		if server.Synonyms, err = searchserver.LoadSynonyms(cfg.Synonyms); err != nil {
+			log.Fatalf("synonyms: %s", err)
+		}
+	}
+	server.Cache = openCache(cfg)
+	if cfg.RateLimit.Rate > 0 {
+		server.RateLimit = &searchserver.RateLimiter{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst}
+	}
+	if cfg.PageCache.Size > 0 {
+		server.PageCache = &searchserver.PageCache{Size: cfg.PageCache.Size, TTL: time.Duration(cfg.PageCache.TTL)}
+	}
+	if cfg.Analytics.Size > 0 {
+		server.Analytics = &searchserver.Analytics{Size: cfg.Analytics.Size, Path: cfg.Analytics.File}
+		if err := server.Analytics.Load(); err != nil {
+			log.Fatalf("analytics: %s", err)
+		}
+		go saveAnalytics(server.Analytics)
+	}
+	var storage searchserver.Storage
+	if cfg.Demo {
+		log.Printf("demo mode: serving embedded dataset")
+	} else if storage, err = openStorage(cfg, server); err != nil {
+		log.Fatalf("storage: %s", err)
+	}
+	if storage != nil {
+		server.Storage = storage
+	} else {
+		// битый или отсутствующий датасет лучше увидеть сразу, а не на первом запросе
+		if err := server.Reload(); err != nil {
+			log.Fatalf("cant load dataset %s: %s", server.DatasetFile(), err)
+		}
+		for _, problem := range server.ReloadStatus().Dropped {
+			log.Printf("dataset %s: dropped %s", server.DatasetFile(), problem)
+		}
+		go reloadOnSIGHUP(server)
+		// за датасетом по ссылке следить нельзя, его перечитывает только SIGHUP
+		if cfg.Watch > 0 && !cfg.Demo && !searchserver.IsRemoteDataset(server.DatasetFile()) {
+			go watchDataset(server, time.Duration(cfg.Watch))
+		}
+		if cfg.RefreshInterval > 0 && !cfg.Demo {
+			go refreshDataset(server, time.Duration(cfg.RefreshInterval))
+		}
+	}
+
+	drainer := &searchserver.Drainer{Handler: server}
+	var handler http.Handler = drainer
+	if !cfg.Compression.Disabled {
+		handler = &searchserver.Compress{Handler: handler, MinSize: cfg.Compression.MinSize}
+	}
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		handler = &searchserver.CORS{
+			Handler:        handler,
+			AllowedOrigins: cfg.CORS.AllowedOrigins,
+			AllowedHeaders: cfg.CORS.AllowedHeaders,
+			MaxAge:         time.Duration(cfg.CORS.MaxAge),
+		}
+	}
+	srv := newHTTPServer(cfg, &searchserver.AccessLog{Handler: handler, Logger: logger})
+	if cfg.HTTP.WriteTimeout > 0 && cfg.RequestTimeout >= cfg.HTTP.WriteTimeout {
+		log.Printf("request timeout %s is not less than write timeout %s, slow searches will be cut without a response",
+			time.Duration(cfg.RequestTimeout), time.Duration(cfg.HTTP.WriteTimeout))
+	}
+
+	stopped := make(chan int)
+	go func() {
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("got %s, draining %d in-flight searches for up to %s", sig, drainer.InFlight(), time.Duration(cfg.ShutdownTimeout))
+
+		// повторный сигнал - выходим, не дожидаясь запросов
+		go func() {
+			<-signals
+			log.Printf("second signal, exiting immediately")
+			os.Exit(1)
+		}()
+
+		code := shutdown(srv, drainer, time.Duration(cfg.ShutdownTimeout))
+		if server.Analytics != nil {
+			if err := server.Analytics.Save(); err != nil {
+				log.Printf("save analytics %s: %s", cfg.Analytics.File, err)
+			}
+		}
+		stopped <- code
+	}()
+
+	version, commit := searchserver.BuildVersion()
+	log.Printf("searchserver %s (%s) listening on %s", version, commit, cfg.Addr)
+	if err = listen(cfg, srv); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("listen: %s", err)
+	}
+	os.Exit(<-stopped)
+}
+
+// reloadOnSIGHUP перечитывает датасет по SIGHUP, при ошибке продолжаем работать со старыми данными
+func reloadOnSIGHUP(server *searchserver.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := server.Reload(); err != nil {
+			log.Printf("reload %s failed, keep serving old dataset: %s", server.DatasetFile(), err)
+			continue
+		}
+		log.Printf("dataset %s reloaded", server.DatasetFile())
+	}
+}
+
+// watchDataset перечитывает датасет, когда файл меняется
+func watchDataset(server *searchserver.Server, debounce time.Duration) {
+	err := server.Watch(context.Background(), debounce, func(err error) {
+		if err != nil {
+			log.Printf("reload %s failed, keep serving old dataset: %s", server.DatasetFile(), err)
+			return
+		}
+		log.Printf("dataset %s changed and reloaded", server.DatasetFile())
+	})
+	if err != nil {
+		log.Printf("dataset watcher stopped: %s", err)
+	}
+}
+
+// refreshDataset перечитывает датасет по таймеру
+func refreshDataset(server *searchserver.Server, interval time.Duration) {
+	server.Refresh(context.Background(), interval, func(err error) {
+		if err != nil {
+			log.Printf("refresh %s failed, keep serving old dataset: %s", server.DatasetFile(), err)
+		}
+	})
+}
+
+// analyticsSaveInterval - как часто сохранять аналитику поиска в файл, чтобы упавший сервер потерял немного
+const analyticsSaveInterval = time.Minute
+
+// saveAnalytics сохраняет аналитику поиска по таймеру
+func saveAnalytics(analytics *searchserver.Analytics) {
+	analytics.Run(context.Background(), analyticsSaveInterval, func(err error) {
+		if err != nil {
+			log.Printf("save analytics %s: %s", analytics.Path, err)
+		}
+	})
+}
+
+// shutdown перестаёт принимать соединения и новые поиски, ждёт текущие до таймаута,
+// после чего рвёт оставшиеся соединения. Возвращает код выхода
+func shutdown(srv *http.Server, drainer *searchserver.Drainer, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	srv.SetKeepAlivesEnabled(false)
+	drained := make(chan error, 1)
+	go func() {
+		drained <- drainer.Drain(ctx)
+	}()
+	err := srv.Shutdown(ctx)
+	if drainErr := <-drained; err == nil {
+		err = drainErr
+	}
+	if err != nil {
+		log.Printf("shutdown: %s, %d searches aborted", err, drainer.InFlight())
+		srv.Close()
+		return 1
+	}
+	log.Printf("shutdown complete")
+	return 0
+}
+
+// clientTokens - токены и scope клиентов из конфига вместе с заданными в TokensFile
+func clientTokens(cfg Config) (map[string]string, map[string][]string, error) {
+	tokens, scopes := map[string]string{}, map[string][]string{}
+	for name, token := range cfg.Tokens {
+		tokens[name] = token
+	}
+	for name, clientScopes := range cfg.Scopes {
+		scopes[name] = clientScopes
+	}
+	if cfg.TokensFile != "" {
+		fromFile, fileScopes, err := searchserver.LoadTokens(cfg.TokensFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, token := range fromFile {
+			if _, ok := tokens[name]; ok {
+				return nil, nil, fmt.Errorf("client %q has tokens both in config and in %s", name, cfg.TokensFile)
+			}
+			tokens[name] = token
+		}
+		for name, clientScopes := range fileScopes {
+			scopes[name] = clientScopes
+		}
+	}
+	return tokens, scopes, nil
+}
+
+// jwtValidator - проверка JWT по конфигу, nil - если не заданы ни секрет, ни ключ
+func jwtValidator(cfg JWTConfig) (*searchserver.JWT, error) {
+	if cfg.Secret == "" && cfg.PublicKeyFile == "" {
+		return nil, nil
+	}
+	validator := &searchserver.JWT{
+		Secret:   []byte(cfg.Secret),
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+		Leeway:   time.Duration(cfg.Leeway),
+	}
+	if cfg.PublicKeyFile != "" {
+		key, err := searchserver.LoadRSAPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		validator.PublicKey = key
+	}
+	return validator, nil
+}
+
+// newHTTPServer - сервер с ограничениями из cfg.HTTP: без них медленный клиент держит соединение сколько угодно
+func newHTTPServer(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.HTTP.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.HTTP.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.HTTP.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.HTTP.IdleTimeout),
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+	}
+}
+
+// newLogger - логгер в формате json или text, пустой формат - json
+func newLogger(format string, w io.Writer) (*slog.Logger, error) {
+	switch format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected json or text", format)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"hw4/pkg/searchserver"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRedisTTL - сколько хранить результат в Redis, если не задано
+const defaultRedisTTL = time.Minute
+
+// defaultPostgresMaxConns - размер пула соединений к Postgres, если он не задан
+const defaultPostgresMaxConns = 10
+
+// sqlStorage - хранилище в базе, которое умеет создать таблицу и залить в неё датасет
+type sqlStorage interface {
+	searchserver.Storage
+	Init(ctx context.Context) error
+	Count(ctx context.Context) (int, error)
+	Import(ctx context.Context, root searchserver.Root) error
+}
+
+// openStorage открывает базу из конфига. nil без ошибки - база не настроена, ищем по датасету в памяти.
+// Пустая база заполняется датасетом server
+func openStorage(cfg Config, server *searchserver.Server) (searchserver.Storage, error) {
+	configured := 0
+	for _, backend := range []string{cfg.SQLite, cfg.Postgres.DSN, cfg.Elasticsearch.URL} {
+		if backend != "" {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, errors.New("sqlite, postgres and elasticsearch are mutually exclusive")
+	}
+	switch {
+	case cfg.Elasticsearch.URL != "":
+		if cfg.Elasticsearch.Index == "" {
+			return nil, errors.New("elasticsearch index is not set")
+		}
+		return &searchserver.ElasticsearchStorage{
+			URL:      cfg.Elasticsearch.URL,
+			Index:    cfg.Elasticsearch.Index,
+			APIKey:   cfg.Elasticsearch.APIKey,
+			Username: cfg.Elasticsearch.Username,
+			Password: cfg.Elasticsearch.Password,
+			Client:   &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case cfg.SQLite != "":
+		db, err := sql.Open("sqlite3", cfg.SQLite)
+		if err != nil {
+			return nil, err
+		}
+		return prepareStorage(db, &searchserver.SQLiteStorage{DB: db}, "sqlite "+cfg.SQLite, server)
+	case cfg.Postgres.DSN != "":
+		db, err := sql.Open("pgx", cfg.Postgres.DSN)
+		if err != nil {
+			return nil, err
+		}
+		maxConns := cfg.Postgres.MaxConns
+		if maxConns <= 0 {
+			maxConns = defaultPostgresMaxConns
+		}
+		db.SetMaxOpenConns(maxConns)
+		db.SetMaxIdleConns(maxConns)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+		return prepareStorage(db, &searchserver.PostgresStorage{DB: db}, "postgres", server)
+	}
+	return nil, nil
+}
+
+// openCache подключает кэш из конфига. nil - кэш не настроен
+func openCache(cfg Config) searchserver.Cache {
+	if cfg.Redis.Addr == "" {
+		return nil
+	}
+	ttl := time.Duration(cfg.Redis.TTL)
+	if ttl <= 0 {
+		ttl = defaultRedisTTL
+	}
+	// недоступный Redis не должен надолго задерживать поиск
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Redis.Addr,
+		Password:     cfg.Redis.Password,
+		DB:           cfg.Redis.DB,
+		DialTimeout:  time.Second,
+		ReadTimeout:  200 * time.Millisecond,
+		WriteTimeout: 200 * time.Millisecond,
+		MaxRetries:   -1,
+	})
+	return &searchserver.RedisCache{Client: client, TTL: ttl}
+}
+
+// prepareStorage создаёт таблицу и, если она пустая, заливает в неё датасет
+func prepareStorage(db *sql.DB, storage sqlStorage, name string, server *searchserver.Server) (searchserver.Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := db.PingContext(ctx)
+	if err == nil {
+		err = storage.Init(ctx)
+	}
+	count := 0
+	if err == nil {
+		count, err = storage.Count(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if count > 0 {
+		log.Printf("serving %d users from %s", count, name)
+		return storage, nil
+	}
+
+	dataset := server.DatasetFile()
+	root, err := server.ReadDataset()
+	if err == nil {
+		err = storage.Import(ctx, root)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cant import dataset %s into %s: %w", dataset, name, err)
+	}
+	log.Printf("imported %d users from %s into %s", len(root.Row), dataset, name)
+	return storage, nil
+}
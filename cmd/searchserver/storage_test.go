@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"hw4/pkg/searchserver"
+)
+
+func TestOpenStorage(t *testing.T) {
+	dataset := filepath.Join("..", "..", "dataset.xml")
+
+	storage, err := openStorage(DefaultConfig(), datasetServer(dataset))
+	if err != nil || storage != nil {
+		t.Errorf("expected no storage without database, got %v (%v)", storage, err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.SQLite = filepath.Join(t.TempDir(), "users.db")
+	cfg.Postgres.DSN = "postgres://localhost/users"
+	if _, err := openStorage(cfg, datasetServer(dataset)); err == nil {
+		t.Error("expected error for sqlite and postgres together")
+	}
+
+	cfg.Postgres.DSN = ""
+	cfg.SQLite = ""
+	cfg.Elasticsearch.URL = "http://localhost:9200"
+	if _, err := openStorage(cfg, datasetServer(dataset)); err == nil {
+		t.Error("expected error for elasticsearch without index")
+	}
+	cfg.Elasticsearch.Index = "users"
+	if storage, err := openStorage(cfg, datasetServer(dataset)); err != nil || storage == nil {
+		t.Errorf("expected elasticsearch storage, got %v (%v)", storage, err)
+	}
+	cfg.Elasticsearch = ESConfig{}
+	cfg.SQLite = filepath.Join(t.TempDir(), "users.db")
+
+	// пустая база заполняется из датасета, дальше датасет уже не нужен
+	cfg.Postgres.DSN = ""
+	missing := filepath.Join(t.TempDir(), "missing.xml")
+	if _, err := openStorage(cfg, datasetServer(missing)); err == nil {
+		t.Fatal("expected error for empty database and missing dataset")
+	}
+	for caseNum, path := range []string{dataset, missing} {
+		storage, err := openStorage(cfg, datasetServer(path))
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", caseNum, err)
+		}
+		count, err := storage.(sqlStorage).Count(context.Background())
+		if err != nil || count != 35 {
+			t.Errorf("[%d] expected 35 users, got %d (%v)", caseNum, count, err)
+		}
+	}
+}
+
+func datasetServer(path string) *searchserver.Server {
+	return &searchserver.Server{DatasetPath: path}
+}
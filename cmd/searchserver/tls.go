@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// listen слушает https с сертификатом из файлов или от Let's Encrypt, если они заданы, иначе http
+func listen(cfg Config, srv *http.Server) error {
+	autocertOn := len(cfg.TLS.Autocert.Domains) > 0
+	filesOn := cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != ""
+	switch {
+	case autocertOn && filesOn:
+		return errors.New("tls cert files and autocert domains are mutually exclusive")
+	case autocertOn:
+		manager, err := newAutocertManager(cfg.TLS.Autocert)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		if cfg.TLS.Autocert.HTTPAddr != "" {
+			go serveACMEChallenge(cfg, manager)
+		}
+		return srv.ListenAndServeTLS("", "")
+	case filesOn:
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		return srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+// newAutocertManager - выпуск и продление сертификатов Let's Encrypt только для доменов из cfg
+func newAutocertManager(cfg AutocertConfig) (*autocert.Manager, error) {
+	cacheDir := cfg.CacheDir
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(userCache, "searchserver", "autocert")
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      cfg.Email,
+	}, nil
+}
+
+// serveACMEChallenge отвечает на проверки домена по http-01, остальные запросы отправляет на https
+func serveACMEChallenge(cfg Config, manager *autocert.Manager) {
+	srv := &http.Server{
+		Addr:              cfg.TLS.Autocert.HTTPAddr,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: time.Duration(cfg.HTTP.ReadHeaderTimeout),
+		IdleTimeout:       time.Duration(cfg.HTTP.IdleTimeout),
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("autocert http listener on %s stopped: %s", srv.Addr, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewAutocertManager(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "certs")
+	manager, err := newAutocertManager(AutocertConfig{Domains: []string{"search.example.com"}, Email: "ops@example.com", CacheDir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Host    string
+		Allowed bool
+	}{
+		{Host: "search.example.com", Allowed: true},
+		{Host: "example.com"},
+		{Host: "evil.example.org"},
+	}
+	for caseNum, item := range cases {
+		err := manager.HostPolicy(context.Background(), item.Host)
+		if (err == nil) != item.Allowed {
+			t.Errorf("[%d] %s: expected allowed %v, got %v", caseNum, item.Host, item.Allowed, err)
+		}
+	}
+	if manager.Email != "ops@example.com" {
+		t.Errorf("expected email to be passed, got %q", manager.Email)
+	}
+
+	// кэш - каталог на диске, сертификаты переживают перезапуск
+	if err := manager.Cache.Put(context.Background(), "key", []byte("cert")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "key")); err != nil {
+		t.Errorf("expected certificate in cache dir: %s", err)
+	}
+}
+
+func TestListenRejectsBothTLSSources(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TLS = TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", Autocert: AutocertConfig{Domains: []string{"search.example.com"}}}
+	if err := listen(cfg, &http.Server{}); err == nil {
+		t.Error("expected error for cert files together with autocert")
+	}
+}
@@ -0,0 +1,78 @@
+package searchclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// AggregatePath - ручка агрегатов по найденным пользователям во внешней системе
+const AggregatePath = "/aggregate"
+
+// AggregateRequest - по каким пользователям считать агрегаты
+type AggregateRequest struct {
+	// фильтр как у поиска: Query, Gender, AgeMin/AgeMax, IDs, IdFrom/IdTo, Fuzziness, IgnoreAccents и Params.
+	// Страницы, сортировка, Fields и Highlight агрегатам не нужны и не отправляются
+	Filter SearchRequest
+	// ширина корзины гистограммы возраста в годах, 0 - сколько сервер берёт по умолчанию
+	AgeInterval int
+}
+
+// Values возвращает GET-параметры запроса агрегатов
+func (req AggregateRequest) Values() url.Values {
+	params := filterValues(req.Filter)
+	if req.AgeInterval > 0 {
+		params.Set("age_interval", strconv.Itoa(req.AgeInterval))
+	}
+	return params
+}
+
+// filterValues - GET-параметры фильтра поиска без страниц, сортировки и того, что меняет вид ответа
+func filterValues(filter SearchRequest) url.Values {
+	params := filter.Values()
+	for _, key := range []string{"limit", "offset", "order_field", "order_by", "fields", "highlight", "facets", "age_interval", "group_by", "group_limit"} {
+		params.Del(key)
+	}
+	return params
+}
+
+// Aggregations - агрегаты по всем найденным пользователям, а не по одной странице
+type Aggregations struct {
+	// сколько пользователей нашлось
+	Total int `json:"Total"`
+	// сколько нашлось пользователей каждого пола: GenderMale и GenderFemale есть всегда, другие - если встретились
+	ByGender map[string]int `json:"ByGender"`
+	// гистограмма возраста по возрастанию, от корзины самого младшего до корзины самого старшего, пустые между ними тоже есть
+	AgeHistogram []AgeBucket `json:"AgeHistogram"`
+	// возраст найденных, nil - если никого не нашлось
+	Age *AgeStats `json:"Age,omitempty"`
+}
+
+// AgeBucket - корзина гистограммы возраста: From включительно, To - нет
+type AgeBucket struct {
+	From  int `json:"From"`
+	To    int `json:"To"`
+	Count int `json:"Count"`
+}
+
+// AgeStats - самый младший, самый старший и средний возраст
+type AgeStats struct {
+	Min int     `json:"Min"`
+	Max int     `json:"Max"`
+	Avg float64 `json:"Avg"`
+}
+
+// Aggregate считает агрегаты через GET /aggregate: число пользователей по полу, гистограмму и min/max/avg возраста
+// по всем, кто подходит под req.Filter, без перебора страниц. Если FieldMask внешней системы прячет
+// от токена без pii:read Age или Gender, она отказывает с ErrForbidden
+func (srv *SearchClient) Aggregate(ctx context.Context, req AggregateRequest) (*Aggregations, error) {
+	if req.AgeInterval < 0 {
+		return nil, countError(fmt.Errorf("age interval must not be negative"))
+	}
+	aggs := &Aggregations{}
+	if err := srv.getJSON(ctx, AggregatePath, req.Values(), aggs, nil); err != nil {
+		return nil, countError(err)
+	}
+	return aggs, nil
+}
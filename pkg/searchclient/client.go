@@ -0,0 +1,1147 @@
+// Package searchclient - клиент к SearchServer: поиск пользователей во внешней системе
+package searchclient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var client = &http.Client{Timeout: time.Second}
+
+type User struct {
+	Id int
+	// внешний идентификатор пользователя, в отличие от Id не меняется между выгрузками
+	Guid   string `json:",omitempty"`
+	Name   string
+	Age    int
+	About  string
+	Gender string
+	// релевантность запросу, приходит только при сортировке по OrderFieldScore
+	Score float64 `json:",omitempty"`
+	// "Name" и "About" с найденным, обёрнутым в <em></em>, только с SearchRequest.Highlight и только поля,
+	// в которых что-то нашлось. About - фрагментом вокруг первого совпадения
+	Highlight map[string]string `json:",omitempty"`
+}
+
+type SearchResponse struct {
+	Users    []User
+	NextPage bool
+	// true, если SearchServer был недоступен и результат взят из офлайн-кэша
+	Stale bool
+	// сколько всего пользователей подходит под запрос, приходит только в API v2, иначе 0
+	Total int
+	// фасеты по всем найденным, если их просили через SearchRequest.Facets, иначе nil
+	Facets *Aggregations
+	// группы найденных, если их просили через SearchRequest.GroupBy, тогда Users пустой
+	Groups []Group
+}
+
+// Group - группа найденных пользователей: значение поля группировки, сколько в ней нашлось и первые из них
+type Group struct {
+	Key   string `json:"Key"`
+	Count int    `json:"Count"`
+	Users []User `json:"Users"`
+}
+
+// SearchResponseV2 - ответ API v2: пользователи завёрнуты в объект вместе с общим количеством
+type SearchResponseV2 struct {
+	Users  []User        `json:"users"`
+	Total  int           `json:"total"`
+	Facets *Aggregations `json:"facets,omitempty"`
+	Groups []Group       `json:"groups,omitempty"`
+}
+
+// версии API внешней системы, пустая версия - старые урлы без префикса, они работают как v1
+const (
+	APIVersion1 = "v1"
+	APIVersion2 = "v2"
+)
+
+// SearchErrorResponse - тело ответа SearchServer с ошибкой, одно на все ошибки
+type SearchErrorResponse struct {
+	Error ErrorDetails `json:"error"`
+}
+
+// ErrorDetails - что пошло не так: код из Code*, текст, параметр запроса, если ошибка в нём, и id запроса для поиска в логах
+type ErrorDetails struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// legacyErrorResponse - тело ошибки от старых версий SearchServer
+type legacyErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// Problem - ошибка в формате RFC 7807 (application/problem+json)
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// расширения RFC 7807, те же, что в ErrorDetails
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+const ProblemContentType = "application/problem+json"
+
+// машиночитаемые коды ошибок, которые SearchServer кладёт в поле code
+const (
+	CodeBadToken      = "BAD_TOKEN"
+	CodeBadOrderField = "BAD_ORDER_FIELD"
+	CodeBadOrderBy    = "BAD_ORDER_BY"
+	CodeBadLimit      = "BAD_LIMIT"
+	CodeBadOffset     = "BAD_OFFSET"
+	CodeBadBody       = "BAD_BODY"
+	CodeNotFound      = "NOT_FOUND"
+	CodeUnavailable   = "UNAVAILABLE"
+	CodeRateLimited   = "RATE_LIMITED"
+	CodeForbidden     = "FORBIDDEN"
+	CodeInternal      = "INTERNAL"
+	CodeUnknownParam  = "UNKNOWN_PARAM"
+	CodeBadFilter     = "BAD_FILTER"
+	CodeBadFields     = "BAD_FIELDS"
+	CodeBadQuery      = "BAD_QUERY"
+)
+
+var (
+	ErrBadAccessToken = errors.New("Bad AccessToken")
+	ErrServerFatal    = errors.New("SearchServer fatal error")
+	ErrBadOrderField  = errors.New("bad order field")
+	ErrBadOrderBy     = errors.New("bad order by")
+	ErrBadLimit       = errors.New("bad limit")
+	ErrBadOffset      = errors.New("bad offset")
+	ErrBadBody        = errors.New("bad request body")
+	ErrNotFound       = errors.New("not found")
+	ErrUnavailable    = errors.New("SearchServer unavailable")
+	ErrRateLimited    = errors.New("SearchServer rate limit exceeded")
+	ErrForbidden      = errors.New("AccessToken has no required scope")
+	ErrUnknownParam   = errors.New("unknown query parameter")
+	ErrBadFilter      = errors.New("bad filter")
+	ErrBadFields      = errors.New("bad fields")
+	ErrBadQuery       = errors.New("bad query")
+
+	codeErrors = map[string]error{
+		CodeBadToken:      ErrBadAccessToken,
+		CodeBadOrderField: ErrBadOrderField,
+		CodeBadOrderBy:    ErrBadOrderBy,
+		CodeBadLimit:      ErrBadLimit,
+		CodeBadOffset:     ErrBadOffset,
+		CodeBadBody:       ErrBadBody,
+		CodeNotFound:      ErrNotFound,
+		CodeUnavailable:   ErrUnavailable,
+		CodeRateLimited:   ErrRateLimited,
+		CodeForbidden:     ErrForbidden,
+		CodeInternal:      ErrServerFatal,
+		CodeUnknownParam:  ErrUnknownParam,
+		CodeBadFilter:     ErrBadFilter,
+		CodeBadFields:     ErrBadFields,
+		CodeBadQuery:      ErrBadQuery,
+	}
+)
+
+// фазы запроса, на которых может случиться таймаут
+const (
+	TimeoutPhaseConnect        = "connect"
+	TimeoutPhaseTLSHandshake   = "tls handshake"
+	TimeoutPhaseResponseHeader = "response header"
+	TimeoutPhaseAttempt        = "attempt"
+	TimeoutPhaseCall           = "call"
+)
+
+// TimeoutError - таймаут запроса во внешнюю систему, Phase говорит, на каком этапе он случился
+type TimeoutError struct {
+	Phase  string
+	Params string
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Phase == TimeoutPhaseAttempt {
+		return fmt.Sprintf("timeout for %s", e.Params)
+	}
+	return fmt.Sprintf("%s timeout for %s", e.Phase, e.Params)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// timeoutPhase определяет фазу таймаута, пустая строка - это не таймаут
+func timeoutPhase(ctx context.Context, err error) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return TimeoutPhaseCall
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return ""
+	}
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return TimeoutPhaseConnect
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		return TimeoutPhaseTLSHandshake
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return TimeoutPhaseResponseHeader
+	}
+	return TimeoutPhaseAttempt
+}
+
+// SearchError - ошибка, которую вернула внешняя система. Проверять её стоит через errors.Is
+// с одной из Err* переменных, а не по тексту
+type SearchError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// параметр запроса, из-за которого ошибка, и id запроса на сервере, если сервер их прислал
+	Field     string
+	RequestID string
+	// заполняется, если сервер ответил в формате application/problem+json
+	Problem *Problem
+	// через сколько можно повторить запрос, если сервер прислал Retry-After
+	RetryAfter time.Duration
+}
+
+func (e *SearchError) Error() string {
+	return e.Message
+}
+
+func (e *SearchError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// ErrorResponseDecodeError возвращается, когда не удалось разобрать json с ошибкой от внешней системы.
+// Хранит код ответа и тело как есть, чтобы было видно, что на самом деле прислал сервер
+type ErrorResponseDecodeError struct {
+	StatusCode int
+	Body       []byte
+	Err        error
+}
+
+// в текст ошибки попадает только начало тела, полностью оно лежит в Body
+const maxErrorBodyInMessage = 512
+
+func (e *ErrorResponseDecodeError) Error() string {
+	body := e.Body
+	if len(body) > maxErrorBodyInMessage {
+		body = body[:maxErrorBodyInMessage]
+	}
+	return fmt.Sprintf("cant unpack error json: %s (status %d, body %q)", e.Err, e.StatusCode, body)
+}
+
+func (e *ErrorResponseDecodeError) Unwrap() error {
+	return e.Err
+}
+
+const DefaultMaxURLLength = 2048
+
+const DefaultAuthHeader = "AccessToken"
+
+const DefaultMaxRedirects = 10
+
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+
+	ErrorBadOrderField = `OrderField invalid`
+
+	// OrderFieldScore - сортировка по релевантности запросу, с OrderByAsIs лучшие совпадения первыми
+	OrderFieldScore = "_score"
+)
+
+// значения SearchRequest.Gender
+const (
+	GenderAny    = "any"
+	GenderMale   = "male"
+	GenderFemale = "female"
+)
+
+// значения SearchRequest.GroupBy
+const (
+	// группы по полу, ключ - значение Gender
+	GroupByGender = "gender"
+	// группы по десятилетиям возраста, ключ - "20-29"
+	GroupByAgeDecade = "age_decade"
+)
+
+type SearchRequest struct {
+	Limit      int
+	Offset     int    // Можно учесть после сортировки
+	Query      string // слова и фразы в кавычках, которые ищутся в Name или About, можно собрать через QueryExpr
+	OrderField string
+	OrderBy    int
+	// сортировка сразу по нескольким полям, если задана - OrderField и OrderBy не используются.
+	// В GET-параметры не помещается, поэтому с ней запрос всегда уходит POST-ом на /search
+	Sort []SortKey
+	// только GenderMale или GenderFemale, пустой или GenderAny - любой
+	Gender string
+	// границы возраста включительно, 0 - без границы
+	AgeMin int
+	AgeMax int
+	// только пользователи с этими Id, пустой - любые
+	IDs []int
+	// границы Id включительно, 0 - без границы
+	IdFrom int
+	IdTo   int
+	// какие поля пользователя нужны: "Id", "Guid", "Name", "Age", "About", "Gender", пустой - все.
+	// Id приходит всегда, остальные поля у User остаются пустыми
+	Fields []string
+	// сколько опечаток прощать в словах Query без кавычек, до 2: с 1 "Boid" находит "Boyd"; 0 - искать как написано
+	Fuzziness int
+	// подсветить найденное в User.Highlight
+	Highlight bool
+	// искать без учёта диакритики: "muller" находит "Müller". Регистр не учитывается и без этого
+	IgnoreAccents bool
+	// вместе со страницей отдать фасеты по всем найденным: число по полу и гистограмму возраста, только в API v2
+	Facets bool
+	// ширина корзины гистограммы возраста в фасетах, 0 - сколько сервер берёт по умолчанию
+	FacetAgeInterval int
+	// вместо страницы отдать найденных группами: GroupByGender или GroupByAgeDecade, только в API v2.
+	// Limit и Offset тогда не используются
+	GroupBy string
+	// сколько первых по сортировке пользователей отдать в каждой группе, 0 - только число
+	GroupLimit int
+	// дополнительные GET-параметры, уходят во внешнюю систему как есть, стандартные параметры ими не перетираются
+	Params url.Values
+}
+
+// SortKey - одно поле сортировки, OrderBy - одна из констант OrderBy*
+type SortKey struct {
+	Field   string `json:"field"`
+	OrderBy int    `json:"order_by"`
+}
+
+// SearchRequestBody - тело POST-запроса к внешней системе, поля те же, что и в GET-параметрах
+type SearchRequestBody struct {
+	Limit         int       `json:"limit"`
+	Offset        int       `json:"offset"`
+	Query         string    `json:"query"`
+	OrderField    string    `json:"order_field"`
+	OrderBy       int       `json:"order_by"`
+	Sort          []SortKey `json:"sort,omitempty"`
+	Gender        string    `json:"gender,omitempty"`
+	AgeMin        int       `json:"age_min,omitempty"`
+	AgeMax        int       `json:"age_max,omitempty"`
+	IDs           []int     `json:"ids,omitempty"`
+	IdFrom        int       `json:"id_from,omitempty"`
+	IdTo          int       `json:"id_to,omitempty"`
+	Fields        []string  `json:"fields,omitempty"`
+	Fuzziness     int       `json:"fuzziness,omitempty"`
+	Highlight     bool      `json:"highlight,omitempty"`
+	IgnoreAccents bool      `json:"ignore_accents,omitempty"`
+	Facets        bool      `json:"facets,omitempty"`
+	AgeInterval   int       `json:"age_interval,omitempty"`
+	GroupBy       string    `json:"group_by,omitempty"`
+	GroupLimit    int       `json:"group_limit,omitempty"`
+}
+
+// Body возвращает тело POST-запроса, Params в него не попадают - они всегда уходят в урле
+func (req SearchRequest) Body() SearchRequestBody {
+	return SearchRequestBody{
+		Limit:         req.Limit,
+		Offset:        req.Offset,
+		Query:         req.Query,
+		OrderField:    req.OrderField,
+		OrderBy:       req.OrderBy,
+		Sort:          req.Sort,
+		Gender:        req.Gender,
+		AgeMin:        req.AgeMin,
+		AgeMax:        req.AgeMax,
+		IDs:           req.IDs,
+		IdFrom:        req.IdFrom,
+		IdTo:          req.IdTo,
+		Fields:        req.Fields,
+		Fuzziness:     req.Fuzziness,
+		Highlight:     req.Highlight,
+		IgnoreAccents: req.IgnoreAccents,
+		Facets:        req.Facets,
+		AgeInterval:   req.FacetAgeInterval,
+		GroupBy:       req.GroupBy,
+		GroupLimit:    req.GroupLimit,
+	}
+}
+
+// параметры, которые при POST-запросе уходят в теле
+var bodyParams = map[string]bool{"limit": true, "offset": true, "query": true, "order_field": true, "order_by": true}
+
+// Values возвращает GET-параметры запроса как есть, без нормализации limit
+func (req SearchRequest) Values() url.Values {
+	params := url.Values{}
+	for key, values := range req.Params {
+		params[key] = append([]string(nil), values...)
+	}
+	params.Set("limit", strconv.Itoa(req.Limit))
+	params.Set("offset", strconv.Itoa(req.Offset))
+	params.Set("query", req.Query)
+	params.Set("order_field", req.OrderField)
+	params.Set("order_by", strconv.Itoa(req.OrderBy))
+	// фильтры уходят, только если заданы: старые версии SearchServer о них не знают
+	if req.Gender != "" {
+		params.Set("gender", req.Gender)
+	}
+	if req.AgeMin != 0 {
+		params.Set("age_min", strconv.Itoa(req.AgeMin))
+	}
+	if req.AgeMax != 0 {
+		params.Set("age_max", strconv.Itoa(req.AgeMax))
+	}
+	if len(req.IDs) > 0 {
+		ids := make([]string, len(req.IDs))
+		for i, id := range req.IDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		params.Set("ids", strings.Join(ids, ","))
+	}
+	if req.IdFrom != 0 {
+		params.Set("id_from", strconv.Itoa(req.IdFrom))
+	}
+	if req.IdTo != 0 {
+		params.Set("id_to", strconv.Itoa(req.IdTo))
+	}
+	if len(req.Fields) > 0 {
+		params.Set("fields", strings.Join(req.Fields, ","))
+	}
+	if req.Fuzziness != 0 {
+		params.Set("fuzziness", strconv.Itoa(req.Fuzziness))
+	}
+	if req.Highlight {
+		params.Set("highlight", "true")
+	}
+	if req.IgnoreAccents {
+		params.Set("ignore_accents", "true")
+	}
+	if req.Facets {
+		params.Set("facets", "true")
+		if req.FacetAgeInterval != 0 {
+			params.Set("age_interval", strconv.Itoa(req.FacetAgeInterval))
+		}
+	}
+	if req.GroupBy != "" {
+		params.Set("group_by", req.GroupBy)
+		if req.GroupLimit != 0 {
+			params.Set("group_limit", strconv.Itoa(req.GroupLimit))
+		}
+	}
+	return params
+}
+
+// encodeQuery кодирует параметры как url.Values.Encode, но пробел отдаёт как %20, а не +,
+// чтобы его одинаково понимали все серверы и прокси. Сам + при этом уже закодирован как %2B
+func encodeQuery(params url.Values) string {
+	return strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+type SearchClient struct {
+	// токен, по которому происходит авторизация на внешней системе, уходит туда через хедер.
+	// Задаётся до первого запроса, потом его заменяет только сам клиент после OnUnauthorized.
+	// Пока идут запросы, поле напрямую не читают и не меняют, текущий токен отдаёт Token
+	AccessToken string
+	// урл внешней системы, куда идти
+	URL string
+	// хедер, в котором уходит токен, по умолчанию DefaultAuthHeader
+	AuthHeader string
+	// схема перед токеном, например "Bearer" для Authorization: Bearer <token>. По умолчанию токен уходит как есть
+	AuthScheme string
+	// вызывается, когда внешняя система ответила 401. Если вернёт новый токен без ошибки -
+	// он сохранится в AccessToken, а запрос будет повторён один раз
+	OnUnauthorized func() (string, error)
+	tokenMu        sync.RWMutex
+	// одновременные 401 спрашивают новый токен по очереди, см. refreshToken
+	refreshMu sync.Mutex
+
+	// сколько редиректов проходить, 0 - DefaultMaxRedirects, отрицательное значение - не ходить по редиректам совсем
+	MaxRedirects int
+	// запрещать редиректы на другой хост
+	ForbidCrossHostRedirects bool
+	// не отправлять токен в запросы, на которые нас средиректили
+	StripAuthOnRedirect bool
+
+	// куки от балансировщиков перед внешней системой (sticky-сессии) сохраняются между запросами, если задан.
+	// Обычно это cookiejar.New(nil)
+	Jar http.CookieJar
+
+	// свой способ устанавливать соединения - закрепить IP, пойти через нужный интерфейс и т.п.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// свой DNS-резолвер, например для split-horizon DNS. Не используется, если задан DialContext
+	Resolver *net.Resolver
+
+	// таймаут на установку TCP-соединения
+	ConnectTimeout time.Duration
+	// таймаут на TLS-рукопожатие
+	TLSHandshakeTimeout time.Duration
+	// сколько ждать заголовков ответа после отправки запроса
+	ResponseHeaderTimeout time.Duration
+	// таймаут на одну попытку целиком, 0 - как у общего client
+	AttemptTimeout time.Duration
+	// общий дедлайн на вызов FindUsers вместе с повторами
+	CallTimeout time.Duration
+
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+	// если внешняя система недоступна - отдаём последний успешный результат по этому же запросу вместо ошибки
+	OfflineMode bool
+	// сколько последних запросов помнить для OfflineMode, 0 - DefaultOfflineCacheSize
+	OfflineCacheSize int
+	// просить у внешней системы ошибки в формате RFC 7807
+	ProblemJSON bool
+	// если урл запроса получается длиннее - поиск уходит POST-ом с json-телом, чтобы не упереться в 414 на прокси.
+	// 0 - DefaultMaxURLLength, отрицательное значение - всегда GET
+	MaxURLLength int
+	// версия API внешней системы: APIVersion1, APIVersion2 или пусто для урлов без версии
+	APIVersion string
+	// всегда искать POST-запросом с json-телом на /search
+	UseJSON bool
+	// если задан - сюда пишутся полные исходящие запросы и входящие ответы, токен при этом скрывается
+	Debug io.Writer
+
+	offlineMu    sync.Mutex
+	offlineCache map[string]*list.Element
+	offlineOrder *list.List
+}
+
+// DefaultOfflineCacheSize - сколько ответов OfflineMode помнит без OfflineCacheSize
+const DefaultOfflineCacheSize = 100
+
+// счётчики клиента, публикуются через expvar как "searchclient"
+var (
+	clientStats = expvar.NewMap("searchclient")
+	errorStats  = new(expvar.Map).Init()
+)
+
+func init() {
+	clientStats.Set("errors", errorStats)
+	clientStats.Set("recent", expvar.Func(func() any { return GetRecentStats() }))
+}
+
+// Stats - снимок счётчиков всех SearchClient в процессе, с запуска (GetStats) или за RecentStatsWindow (GetRecentStats)
+type Stats struct {
+	// отправленные запросы, включая повторы
+	Requests int64
+	// повторы после обновления токена
+	Retries int64
+	// ответы, отданные из офлайн-кэша
+	CacheHits int64
+	// ошибки по видам: timeout, network, auth, server, rate_limited, bad_request, decode, not_found, other
+	Errors map[string]int64
+}
+
+// GetStats возвращает текущие значения счётчиков
+func GetStats() Stats {
+	stats := Stats{
+		Requests:  statValue(clientStats, "requests"),
+		Retries:   statValue(clientStats, "retries"),
+		CacheHits: statValue(clientStats, "cache_hits"),
+		Errors:    map[string]int64{},
+	}
+	errorStats.Do(func(kv expvar.KeyValue) {
+		stats.Errors[kv.Key] = kv.Value.(*expvar.Int).Value()
+	})
+	return stats
+}
+
+func statValue(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// errorKind - вид ошибки для счётчиков
+func errorKind(err error) string {
+	var (
+		timeoutErr *TimeoutError
+		searchErr  *SearchError
+		decodeErr  *ErrorResponseDecodeError
+		notFound   *NotFoundError
+		netErr     net.Error
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return "not_found"
+	case errors.As(err, &timeoutErr):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "other"
+	case errors.As(err, &netErr):
+		// внешняя система недоступна: соединение не установилось или оборвалось
+		return "network"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	case errors.As(err, &searchErr) && (searchErr.Code == CodeBadToken || searchErr.Code == CodeForbidden):
+		return "auth"
+	case errors.As(err, &searchErr) && (searchErr.Code == CodeInternal || searchErr.Code == CodeUnavailable):
+		return "server"
+	case errors.As(err, &searchErr) && searchErr.Code == CodeRateLimited:
+		return "rate_limited"
+	case errors.As(err, &searchErr):
+		return "bad_request"
+	}
+	return "other"
+}
+
+// FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
+func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext - FindUsers с контекстом, отмена контекста прерывает запрос и повторы
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	result, err := srv.findUsers(ctx, req)
+	return result, countError(err)
+}
+
+// countError учитывает ошибку публичного метода в счётчиках errors по её виду и отдаёт её же
+func countError(err error) error {
+	if err != nil {
+		kind := errorKind(err)
+		errorStats.Add(kind, 1)
+		recentStats.addError(time.Now(), kind)
+	}
+	return err
+}
+
+// FindUsersByIDs достаёт пользователей с известными Id, по возрастанию Id. Страницы по 25 листаются сами,
+// Id, которых во внешней системе нет, просто не попадают в ответ
+func (srv *SearchClient) FindUsersByIDs(ctx context.Context, ids []int) ([]User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var users []User
+	for offset := 0; ; offset += 25 {
+		resp, err := srv.FindUsersContext(ctx, SearchRequest{
+			Limit:      25,
+			Offset:     offset,
+			OrderField: "Id",
+			OrderBy:    OrderByAsc,
+			IDs:        ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, resp.Users...)
+		if !resp.NextPage {
+			return users, nil
+		}
+	}
+}
+
+func (srv *SearchClient) findUsers(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	if srv.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.CallTimeout)
+		defer cancel()
+	}
+
+	origReq := req
+	stale := srv.Token()
+	searcherReq, req, err := srv.newRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	searcherParams := req.Values()
+
+	resp, body, err := srv.do(ctx, searcherReq)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && srv.refreshToken(stale) {
+		// токен обновили - повторяем запрос один раз, уже с новым
+		countStat("retries")
+		if searcherReq, _, err = srv.newRequest(origReq); err != nil {
+			return nil, err
+		}
+		resp, body, err = srv.do(ctx, searcherReq)
+	}
+	if err != nil {
+		// старый ответ - только если до сервера не достучаться. Тому, кто сам отменил запрос
+		// или упёрся в CallTimeout, нужна ошибка
+		if cached := srv.offlineResult(searcherParams.Encode()); cached != nil && unreachable(ctx, err) {
+			countStat("cache_hits")
+			return cached, nil
+		}
+		if phase := timeoutPhase(ctx, err); phase != "" {
+			return nil, &TimeoutError{Phase: phase, Params: searcherParams.Encode(), Err: err}
+		}
+		return nil, fmt.Errorf("unknown error %w", err)
+	}
+
+	if err := responseError(resp, body, req.OrderField); err != nil {
+		return nil, err
+	}
+
+	result := SearchResponse{}
+	data := []User{}
+	if srv.APIVersion == APIVersion2 {
+		envelope := SearchResponseV2{}
+		err = json.Unmarshal(body, &envelope)
+		data, result.Total, result.Facets, result.Groups = envelope.Users, envelope.Total, envelope.Facets, envelope.Groups
+	} else {
+		err = json.Unmarshal(body, &data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cant unpack result json: %s", err)
+	}
+
+	if len(data) == req.Limit {
+		result.NextPage = true
+		result.Users = data[0 : len(data)-1]
+	} else {
+		result.Users = data[0:len(data)]
+	}
+	srv.storeOfflineResult(searcherParams.Encode(), &result)
+
+	return &result, err
+}
+
+// responseError - ошибка по коду ответа внешней системы, nil - ответ не про ошибку
+// или код незнакомый и тело не problem+json.
+// orderField нужен только для текста ошибки BAD_ORDER_FIELD
+func responseError(resp *http.Response, body []byte, orderField string) error {
+	var searchErr *SearchError
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: CodeBadToken, Message: "Bad AccessToken"}
+	case http.StatusForbidden:
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: CodeForbidden, Message: "AccessToken has no required scope"}
+	case http.StatusInternalServerError:
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: CodeInternal, Message: "SearchServer fatal error"}
+	case http.StatusServiceUnavailable:
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: CodeUnavailable, Message: "SearchServer unavailable"}
+	case http.StatusTooManyRequests:
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: CodeRateLimited, Message: "SearchServer rate limit exceeded"}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			searchErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	case http.StatusBadRequest:
+		errResp, problem, err := decodeErrorResponse(resp, body)
+		if err != nil {
+			return &ErrorResponseDecodeError{StatusCode: resp.StatusCode, Body: body, Err: err}
+		}
+		details := errResp.Error
+		// старые версии SearchServer не присылают code
+		if details.Code == "" && details.Message == "ErrorBadOrderField" {
+			details.Code = CodeBadOrderField
+		}
+		searchErr = &SearchError{StatusCode: resp.StatusCode, Code: details.Code, Field: details.Field, RequestID: details.RequestID, Problem: problem}
+		switch _, known := codeErrors[details.Code]; {
+		case details.Code == CodeBadOrderField:
+			searchErr.Message = fmt.Sprintf("OrderField %s invalid", orderField)
+		case known:
+			searchErr.Message = fmt.Sprintf("bad request error: %s", details.Message)
+		default:
+			searchErr.Message = fmt.Sprintf("unknown bad request error: %s", details.Message)
+		}
+		return searchErr
+	}
+	if searchErr != nil {
+		// тело тут не обязательно, но если сервер его прислал - из него видно, какой запрос искать в логах
+		if errResp, problem, err := decodeErrorResponse(resp, body); err == nil {
+			searchErr.Field, searchErr.RequestID, searchErr.Problem = errResp.Error.Field, errResp.Error.RequestID, problem
+		}
+		return searchErr
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	// про остальные коды клиент ничего не знает, но problem+json сам говорит, что это ошибка и какая
+	if errResp, problem, err := decodeErrorResponse(resp, body); err == nil && problem != nil {
+		details := errResp.Error
+		message := details.Message
+		if message == "" {
+			message = problem.Title
+		}
+		return &SearchError{StatusCode: resp.StatusCode, Code: details.Code, Field: details.Field, RequestID: details.RequestID, Problem: problem,
+			Message: fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, message)}
+	}
+	return nil
+}
+
+const redactedToken = "REDACTED"
+
+func (srv *SearchClient) debugf(format string, args ...interface{}) {
+	if srv.Debug != nil {
+		fmt.Fprintf(srv.Debug, format, args...)
+	}
+}
+
+// dumpRequest пишет запрос в Debug, заменяя токен на заглушку
+func (srv *SearchClient) dumpRequest(req *http.Request) {
+	if srv.Debug == nil {
+		return
+	}
+	redacted := req.Clone(req.Context())
+	if redacted.Header.Get(srv.authHeader()) != "" {
+		redacted.Header.Set(srv.authHeader(), redactedToken)
+	}
+	dump, err := httputil.DumpRequestOut(redacted, true)
+	if err != nil {
+		srv.debugf("--> cant dump request: %s\n\n", err)
+		return
+	}
+	srv.debugf("--> request\n%s\n\n", dump)
+}
+
+// dumpResponse пишет ответ в Debug, тело передаётся отдельно, потому что оно уже вычитано
+func (srv *SearchClient) dumpResponse(resp *http.Response, body []byte) {
+	if srv.Debug == nil {
+		return
+	}
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		srv.debugf("<-- cant dump response: %s\n\n", err)
+		return
+	}
+	srv.debugf("<-- response\n%s%s\n\n", dump, body)
+}
+
+// decodeErrorResponse разбирает тело ошибки в обычном формате, в старом и в формате application/problem+json
+func decodeErrorResponse(resp *http.Response, body []byte) (SearchErrorResponse, *Problem, error) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == ProblemContentType {
+		problem := &Problem{}
+		if err := json.Unmarshal(body, problem); err != nil {
+			return SearchErrorResponse{}, nil, err
+		}
+		details := ErrorDetails{Code: problem.Code, Message: problem.Detail, Field: problem.Field, RequestID: problem.RequestID}
+		return SearchErrorResponse{Error: details}, problem, nil
+	}
+	errResp := SearchErrorResponse{}
+	err := json.Unmarshal(body, &errResp)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field == "error" {
+		legacy := legacyErrorResponse{}
+		if err = json.Unmarshal(body, &legacy); err == nil {
+			errResp.Error = ErrorDetails{Code: legacy.Code, Message: legacy.Error}
+		}
+	}
+	return errResp, nil, err
+}
+
+// do отправляет запрос и вычитывает тело ответа
+func (srv *SearchClient) do(ctx context.Context, searcherReq *http.Request) (*http.Response, []byte, error) {
+	searcherReq = searcherReq.WithContext(ctx)
+	countStat("requests")
+	srv.dumpRequest(searcherReq)
+	resp, err := srv.getHTTPClient().Do(searcherReq)
+	if err != nil {
+		srv.debugf("<-- error: %s\n\n", err)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	srv.dumpResponse(resp, body)
+	return resp, body, err
+}
+
+// getHTTPClient лениво собирает http-клиент под настройки SearchClient, за основу берётся общий client
+func (srv *SearchClient) getHTTPClient() *http.Client {
+	srv.httpClientOnce.Do(func() {
+		httpClient := *client
+		httpClient.CheckRedirect = srv.checkRedirect
+		httpClient.Jar = srv.Jar
+		if srv.AttemptTimeout > 0 {
+			httpClient.Timeout = srv.AttemptTimeout
+		}
+		if srv.DialContext != nil || srv.Resolver != nil || srv.ConnectTimeout > 0 ||
+			srv.TLSHandshakeTimeout > 0 || srv.ResponseHeaderTimeout > 0 {
+			httpClient.Transport = srv.newTransport()
+		}
+		srv.httpClient = &httpClient
+	})
+	return srv.httpClient
+}
+
+// newTransport клонирует стандартный транспорт, подменяя в нём установку соединений и таймауты
+func (srv *SearchClient) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if srv.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = srv.TLSHandshakeTimeout
+	}
+	transport.ResponseHeaderTimeout = srv.ResponseHeaderTimeout
+
+	dial := srv.DialContext
+	if dial == nil {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  srv.Resolver,
+		}
+		dial = dialer.DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if srv.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, srv.ConnectTimeout)
+			defer cancel()
+		}
+		conn, err := dial(ctx, network, addr)
+		// ошибки установки соединения всегда отдаём как net.OpError, чтобы по ним можно было понять фазу
+		var opErr *net.OpError
+		if err != nil && !errors.As(err, &opErr) {
+			err = &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		return conn, err
+	}
+	return transport
+}
+
+func (srv *SearchClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := srv.MaxRedirects
+	switch {
+	case maxRedirects == 0:
+		maxRedirects = DefaultMaxRedirects
+	case maxRedirects < 0:
+		maxRedirects = 0
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if srv.ForbidCrossHostRedirects && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("redirect to other host %s forbidden", req.URL.Host)
+	}
+	if srv.StripAuthOnRedirect {
+		req.Header.Del(srv.authHeader())
+	}
+	return nil
+}
+
+// Token - текущий токен: AccessToken или тот, что вернул OnUnauthorized
+func (srv *SearchClient) Token() string {
+	srv.tokenMu.RLock()
+	defer srv.tokenMu.RUnlock()
+	return srv.AccessToken
+}
+
+// refreshToken спрашивает у приложения новый токен через OnUnauthorized, возвращает true, если токен обновился.
+// stale - токен, на который пришёл 401. Одновременные 401 ждут друг друга, и если токен уже заменили,
+// новый у приложения не спрашивается - повторить запрос можно с текущим
+func (srv *SearchClient) refreshToken(stale string) bool {
+	if srv.OnUnauthorized == nil {
+		return false
+	}
+	srv.refreshMu.Lock()
+	defer srv.refreshMu.Unlock()
+	if srv.Token() != stale {
+		return true
+	}
+	token, err := srv.OnUnauthorized()
+	if err != nil {
+		srv.debugf("token refresh failed: %s\n\n", err)
+		return false
+	}
+	srv.tokenMu.Lock()
+	srv.AccessToken = token
+	srv.tokenMu.Unlock()
+	return true
+}
+
+// NewRequest собирает запрос во внешнюю систему ровно так, как его отправил бы FindUsers, но не отправляет.
+// Пригодится, чтобы посмотреть урл и хедеры или отправить запрос своим транспортом
+func (srv *SearchClient) NewRequest(req SearchRequest) (*http.Request, error) {
+	searcherReq, _, err := srv.newRequest(req)
+	return searcherReq, err
+}
+
+// newRequest проверяет параметры и собирает запрос, вместе с ним возвращает нормализованный SearchRequest
+func (srv *SearchClient) newRequest(req SearchRequest) (*http.Request, SearchRequest, error) {
+	if req.Limit < 0 {
+		return nil, req, fmt.Errorf("limit must be > 0")
+	}
+	if req.Limit > 25 {
+		req.Limit = 25
+	}
+	if req.Offset < 0 {
+		return nil, req, fmt.Errorf("offset must be > 0")
+	}
+	if req.Facets && srv.APIVersion != APIVersion2 {
+		return nil, req, fmt.Errorf("facets need api version %s", APIVersion2)
+	}
+	if req.FacetAgeInterval < 0 {
+		return nil, req, fmt.Errorf("facet age interval must not be negative")
+	}
+	if req.GroupBy != "" && srv.APIVersion != APIVersion2 {
+		return nil, req, fmt.Errorf("group by needs api version %s", APIVersion2)
+	}
+	if req.GroupLimit < 0 {
+		return nil, req, fmt.Errorf("group limit must not be negative")
+	}
+
+	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
+	req.Limit++
+
+	searcherURL, err := url.Parse(srv.URL)
+	if err != nil {
+		return nil, req, fmt.Errorf("cant create request: %s", err)
+	}
+	switch srv.APIVersion {
+	case "":
+	case APIVersion1, APIVersion2:
+		searcherURL.Path = strings.TrimSuffix(searcherURL.Path, "/") + "/" + srv.APIVersion
+	default:
+		return nil, req, fmt.Errorf("unsupported api version %q", srv.APIVersion)
+	}
+	// параметры, которые уже есть в урле внешней системы, сохраняем
+	baseParams := searcherURL.Query()
+	searcherParams := url.Values{}
+	for key, values := range baseParams {
+		searcherParams[key] = values
+	}
+	for key, values := range req.Values() {
+		searcherParams[key] = values
+	}
+	searcherURL.RawQuery = encodeQuery(searcherParams)
+
+	maxURLLength := srv.MaxURLLength
+	if maxURLLength == 0 {
+		maxURLLength = DefaultMaxURLLength
+	}
+	if srv.UseJSON || len(req.Sort) > 0 {
+		searcherURL.Path = strings.TrimSuffix(searcherURL.Path, "/") + "/search"
+		return srv.newPostRequest(searcherURL, baseParams, req)
+	}
+	if maxURLLength > 0 && len(searcherURL.String()) > maxURLLength {
+		return srv.newPostRequest(searcherURL, baseParams, req)
+	}
+
+	searcherReq, err := http.NewRequest("GET", searcherURL.String(), nil)
+	if err != nil {
+		return nil, req, fmt.Errorf("cant create request: %s", err)
+	}
+	srv.setHeaders(searcherReq)
+	return searcherReq, req, nil
+}
+
+// newPostRequest собирает POST-запрос: стандартные параметры уходят в json-теле, в урле остаются только
+// параметры самой внешней системы и Params
+func (srv *SearchClient) newPostRequest(searcherURL *url.URL, baseParams url.Values, req SearchRequest) (*http.Request, SearchRequest, error) {
+	for key, values := range req.Params {
+		if !bodyParams[key] {
+			baseParams[key] = values
+		}
+	}
+	searcherURL.RawQuery = encodeQuery(baseParams)
+
+	body, err := json.Marshal(req.Body())
+	if err != nil {
+		return nil, req, fmt.Errorf("cant pack request json: %s", err)
+	}
+	searcherReq, err := http.NewRequest("POST", searcherURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, req, fmt.Errorf("cant create request: %s", err)
+	}
+	searcherReq.Header.Set("Content-Type", "application/json")
+	srv.setHeaders(searcherReq)
+	return searcherReq, req, nil
+}
+
+func (srv *SearchClient) authHeader() string {
+	if srv.AuthHeader == "" {
+		return DefaultAuthHeader
+	}
+	return srv.AuthHeader
+}
+
+func (srv *SearchClient) setHeaders(searcherReq *http.Request) {
+	token := srv.Token()
+	if srv.AuthScheme != "" {
+		token = srv.AuthScheme + " " + token
+	}
+	searcherReq.Header.Add(srv.authHeader(), token)
+	if srv.ProblemJSON {
+		searcherReq.Header.Set("Accept", ProblemContentType+", application/json")
+	}
+}
+
+// unreachable - запрос не дошёл до внешней системы или оборвался по дороге: соединение не установилось
+// или разорвано, попытка не уложилась в свой таймаут. Отмена и дедлайн ctx сюда не относятся
+func unreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var (
+		opErr  *net.OpError
+		netErr net.Error
+	)
+	return errors.As(err, &opErr) || (errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// offlineEntry - ответ, запомненный для OfflineMode
+type offlineEntry struct {
+	key    string
+	result SearchResponse
+}
+
+// offlineResult возвращает копию закэшированного ответа, помеченную как устаревшая, если офлайн-режим включен
+func (srv *SearchClient) offlineResult(key string) *SearchResponse {
+	if !srv.OfflineMode {
+		return nil
+	}
+	srv.offlineMu.Lock()
+	defer srv.offlineMu.Unlock()
+	element, ok := srv.offlineCache[key]
+	if !ok {
+		return nil
+	}
+	srv.offlineOrder.MoveToFront(element)
+	cached := &element.Value.(*offlineEntry).result
+	result := *cached
+	result.Users = append([]User(nil), cached.Users...)
+	result.Stale = true
+	return &result
+}
+
+// storeOfflineResult запоминает ответ, вытесняя самый давно использованный, если запомнено уже OfflineCacheSize
+func (srv *SearchClient) storeOfflineResult(key string, result *SearchResponse) {
+	if !srv.OfflineMode {
+		return
+	}
+	size := srv.OfflineCacheSize
+	if size <= 0 {
+		size = DefaultOfflineCacheSize
+	}
+	srv.offlineMu.Lock()
+	defer srv.offlineMu.Unlock()
+	if srv.offlineCache == nil {
+		srv.offlineCache = map[string]*list.Element{}
+		srv.offlineOrder = list.New()
+	}
+	entry := &offlineEntry{key: key, result: *result}
+	entry.result.Users = append([]User(nil), result.Users...)
+	if element, ok := srv.offlineCache[key]; ok {
+		element.Value = entry
+		srv.offlineOrder.MoveToFront(element)
+		return
+	}
+	srv.offlineCache[key] = srv.offlineOrder.PushFront(entry)
+	for srv.offlineOrder.Len() > size {
+		oldest := srv.offlineOrder.Back()
+		srv.offlineOrder.Remove(oldest)
+		delete(srv.offlineCache, oldest.Value.(*offlineEntry).key)
+	}
+}
@@ -0,0 +1,2096 @@
+package searchclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hw4/pkg/searchclient"
+	"hw4/pkg/searchserver"
+)
+
+// датасет лежит в корне репозитория
+var SearchServer = (&searchserver.Server{DatasetPath: filepath.Join("..", "..", "dataset.xml")}).ServeHTTP
+
+type TestCaseSearchClient struct {
+	Request          searchclient.SearchRequest
+	ExpectedResponse *searchclient.SearchResponse
+}
+
+func TestSearchClient(t *testing.T) {
+	cases := []TestCaseSearchClient{
+		{
+			Request: searchclient.SearchRequest{
+				Limit:      1,
+				Offset:     0,
+				Query:      "Boyd Wolf",
+				OrderField: "Id",
+				OrderBy:    -1,
+			},
+			ExpectedResponse: &searchclient.SearchResponse{
+				Users: []searchclient.User{
+					{
+						Id:     0,
+						Guid:   "1a6fa827-62f1-45f6-b579-aaead2b47169",
+						Name:   "Boyd Wolf",
+						Age:    22,
+						About:  "Nulla cillum enim voluptate consequat laborum esse excepteur occaecat commodo nostrud excepteur ut cupidatat. Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia. Consequat anim eiusmod amet commodo eiusmod deserunt culpa. Ea sit dolore nostrud cillum proident nisi mollit est Lorem pariatur. Lorem aute officia deserunt dolor nisi aliqua consequat nulla nostrud ipsum irure id deserunt dolore. Minim reprehenderit nulla exercitation labore ipsum.\n",
+						Gender: "male",
+					},
+				},
+				NextPage: false,
+			},
+		},
+		{
+			Request: searchclient.SearchRequest{
+				Limit:      2,
+				Offset:     0,
+				Query:      "",
+				OrderField: "Id",
+				OrderBy:    -1,
+			},
+			ExpectedResponse: &searchclient.SearchResponse{
+				Users: []searchclient.User{
+					{
+						Id:     0,
+						Guid:   "1a6fa827-62f1-45f6-b579-aaead2b47169",
+						Name:   "Boyd Wolf",
+						Age:    22,
+						About:  "Nulla cillum enim voluptate consequat laborum esse excepteur occaecat commodo nostrud excepteur ut cupidatat. Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia. Consequat anim eiusmod amet commodo eiusmod deserunt culpa. Ea sit dolore nostrud cillum proident nisi mollit est Lorem pariatur. Lorem aute officia deserunt dolor nisi aliqua consequat nulla nostrud ipsum irure id deserunt dolore. Minim reprehenderit nulla exercitation labore ipsum.\n",
+						Gender: "male",
+					},
+					{
+						Id:     1,
+						Guid:   "46c06b5e-dd08-4e26-bf85-b15d280e5e07",
+						Name:   "Hilda Mayer",
+						Age:    21,
+						About:  "Sit commodo consectetur minim amet ex. Elit aute mollit fugiat labore sint ipsum dolor cupidatat qui reprehenderit. Eu nisi in exercitation culpa sint aliqua nulla nulla proident eu. Nisi reprehenderit anim cupidatat dolor incididunt laboris mollit magna commodo ex. Cupidatat sit id aliqua amet nisi et voluptate voluptate commodo ex eiusmod et nulla velit.\n",
+						Gender: "female",
+					},
+				},
+				NextPage: true,
+			},
+		},
+
+		{
+			Request: searchclient.SearchRequest{
+				Limit:      26,
+				Offset:     0,
+				Query:      "Boyd Wolf",
+				OrderField: "Id",
+				OrderBy:    -1,
+			},
+			ExpectedResponse: &searchclient.SearchResponse{
+				Users: []searchclient.User{
+					{
+						Id:     0,
+						Guid:   "1a6fa827-62f1-45f6-b579-aaead2b47169",
+						Name:   "Boyd Wolf",
+						Age:    22,
+						About:  "Nulla cillum enim voluptate consequat laborum esse excepteur occaecat commodo nostrud excepteur ut cupidatat. Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia. Consequat anim eiusmod amet commodo eiusmod deserunt culpa. Ea sit dolore nostrud cillum proident nisi mollit est Lorem pariatur. Lorem aute officia deserunt dolor nisi aliqua consequat nulla nostrud ipsum irure id deserunt dolore. Minim reprehenderit nulla exercitation labore ipsum.\n",
+						Gender: "male",
+					},
+				},
+				NextPage: false,
+			},
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	for caseNum, testCase := range cases {
+		c := &searchclient.SearchClient{
+			AccessToken: "123",
+			URL:         ts.URL,
+		}
+		resp, err := c.FindUsers(testCase.Request)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %#v", caseNum, err)
+		}
+
+		if !reflect.DeepEqual(resp, testCase.ExpectedResponse) {
+			t.Errorf("[%d] wrong result, expected %#v, got %#v", caseNum, testCase.ExpectedResponse, resp)
+		}
+	}
+}
+
+type SearchServerErrors struct {
+	Request     searchclient.SearchRequest
+	ErrorString string
+	IsError     bool
+	Is          error
+}
+
+func TestSearchServerErrors(t *testing.T) {
+	cases := []SearchServerErrors{
+		{
+			Request: searchclient.SearchRequest{
+				Limit:      -1,
+				Offset:     0,
+				Query:      "Boyd Wolf",
+				OrderField: "Id",
+				OrderBy:    -1,
+			},
+			IsError:     true,
+			ErrorString: "limit must be > 0",
+		}, {
+			Request: searchclient.SearchRequest{
+				Limit:      0,
+				Offset:     -1,
+				Query:      "Boyd Wolf",
+				OrderField: "Id",
+				OrderBy:    -1,
+			},
+			IsError:     true,
+			ErrorString: "offset must be > 0",
+		}, {
+			Request: searchclient.SearchRequest{
+				Limit:      1,
+				Offset:     1,
+				Query:      "",
+				OrderField: "Id",
+				OrderBy:    -2,
+			},
+			IsError:     true,
+			ErrorString: "bad request error: invalid order: -2, expected -1 (asc), 1 (desc) or 0 (as is), missing order_by means 0",
+			Is:          searchclient.ErrBadOrderBy,
+		},
+		{
+			Request: searchclient.SearchRequest{
+				Limit:      1,
+				Offset:     0,
+				Query:      "",
+				OrderField: "About",
+				OrderBy:    -1,
+			},
+			IsError:     true,
+			ErrorString: "OrderField About invalid",
+			Is:          searchclient.ErrBadOrderField,
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	for caseNum, testCase := range cases {
+		c := &searchclient.SearchClient{
+			AccessToken: "123",
+			URL:         ts.URL,
+		}
+		_, err := c.FindUsers(testCase.Request)
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error, got nil", caseNum)
+			} else if err.Error() != testCase.ErrorString {
+				t.Errorf("[%d] wrong error, expected %s, got %s", caseNum, testCase.ErrorString, err.Error())
+			} else if testCase.Is != nil && !errors.Is(err, testCase.Is) {
+				t.Errorf("[%d] expected error to match %v, got %#v", caseNum, testCase.Is, err)
+			}
+		}
+	}
+}
+
+func TestFindUsersBadAccessTokenError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		URL: ts.URL,
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+	expectedError := "Bad AccessToken"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error: %s, got: %s", expectedError, err.Error())
+	}
+	if !errors.Is(err, searchclient.ErrBadAccessToken) {
+		t.Errorf("Expected searchclient.ErrBadAccessToken, got %#v", err)
+	}
+}
+func TestFindUsersInternalServerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+	}
+
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+
+	expectedError := "SearchServer fatal error"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error: %s, got: %s", expectedError, err.Error())
+	}
+	if !errors.Is(err, searchclient.ErrServerFatal) {
+		t.Errorf("Expected searchclient.ErrServerFatal, got %#v", err)
+	}
+}
+
+func TestFindUsersJsonError(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		errorResponse := 123
+		json.NewEncoder(w).Encode(errorResponse)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		URL: ts.URL,
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+	expectedError := "cant unpack error json: json: cannot unmarshal number into Go value of type searchclient.SearchErrorResponse (status 400, body \"123\\n\")"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error: %s, got: %s", expectedError, err.Error())
+	}
+	var decodeErr *searchclient.ErrorResponseDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected *searchclient.ErrorResponseDecodeError, got %T", err)
+	}
+	if decodeErr.StatusCode != http.StatusBadRequest || string(decodeErr.Body) != "123\n" {
+		t.Errorf("Wrong raw response: status %d, body %q", decodeErr.StatusCode, decodeErr.Body)
+	}
+}
+
+func TestFindUsersJsonResultError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(123)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		URL: ts.URL,
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+	expectedError := "cant unpack result json: json: cannot unmarshal number into Go value of type []searchclient.User"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error: %s, got: %s", expectedError, err.Error())
+	}
+}
+
+func TestFindUsersTimeoutError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1 * time.Second)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+	}
+
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+
+	if err == nil {
+		t.Error("Expected timeout error, got nil")
+	}
+
+	expectedError := "timeout for limit=11&offset=0&order_by=0&order_field=&query=test"
+	if err.Error() != expectedError {
+		t.Errorf("Expected error: %s, got: %s", expectedError, err.Error())
+	}
+}
+
+func TestFindUsersConnectionError(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+	}
+
+	_, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:  10,
+		Offset: 0,
+		Query:  "test",
+	})
+
+	if err == nil {
+		t.Error("Expected connection error, got nil")
+	}
+
+	expectedErrorPrefix := "unknown error"
+	if !strings.HasPrefix(err.Error(), expectedErrorPrefix) {
+		t.Errorf("Expected error to start with: %s, got: %s", expectedErrorPrefix, err.Error())
+	}
+}
+
+func TestFindUsersOfflineMode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+		OfflineMode: true,
+	}
+	req := searchclient.SearchRequest{
+		Limit:      1,
+		Offset:     0,
+		Query:      "Boyd Wolf",
+		OrderField: "Id",
+		OrderBy:    -1,
+	}
+
+	fresh, err := client.FindUsers(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fresh.Stale {
+		t.Error("fresh result must not be stale")
+	}
+
+	ts.Close()
+
+	cached, err := client.FindUsers(req)
+	if err != nil {
+		t.Fatalf("expected cached result, got error: %s", err)
+	}
+	if !cached.Stale {
+		t.Error("cached result must be stale")
+	}
+	if !reflect.DeepEqual(cached.Users, fresh.Users) {
+		t.Errorf("wrong cached users, expected %#v, got %#v", fresh.Users, cached.Users)
+	}
+
+	req.Query = "Hilda"
+	_, err = client.FindUsers(req)
+	if err == nil || !strings.HasPrefix(err.Error(), "unknown error") {
+		t.Errorf("expected unknown error for uncached query, got %v", err)
+	}
+}
+
+func TestFindUsersOfflineModeCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, OfflineMode: true}
+	req := searchclient.SearchRequest{Limit: 1, Query: "Boyd Wolf"}
+	if _, err := client.FindUsers(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// сервер доступен, но вызывающему ответ уже не нужен - кэш тут ни при чём
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := client.FindUsersContext(ctx, req)
+	if !errors.Is(err, context.Canceled) || result != nil {
+		t.Errorf("expected context.Canceled, got %v, %v", result, err)
+	}
+}
+
+func TestFindUsersOfflineCacheSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, OfflineMode: true, OfflineCacheSize: 2}
+	queries := []string{"Boyd", "Hilda", "Boyd", "Owen"}
+	for _, query := range queries {
+		if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: query}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	ts.Close()
+
+	// Hilda вытеснена как самая давно использованная
+	cases := []struct {
+		Query  string
+		Cached bool
+	}{
+		{Query: "Boyd", Cached: true},
+		{Query: "Owen", Cached: true},
+		{Query: "Hilda", Cached: false},
+	}
+	for caseNum, item := range cases {
+		result, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: item.Query})
+		if item.Cached && (err != nil || !result.Stale) {
+			t.Errorf("[%d] expected cached result for %s, got %v, %v", caseNum, item.Query, result, err)
+		}
+		if !item.Cached && err == nil {
+			t.Errorf("[%d] expected %s to be evicted", caseNum, item.Query)
+		}
+	}
+}
+
+func TestFindUsersErrorCodes(t *testing.T) {
+	cases := []struct {
+		Response    string
+		ErrorString string
+		Is          error
+		Field       string
+		RequestID   string
+	}{
+		// старый формат, без code
+		{
+			Response:    `{"error": "ErrorBadOrderField"}`,
+			ErrorString: "OrderField About invalid",
+			Is:          searchclient.ErrBadOrderField,
+		},
+		{
+			Response:    `{"error": "whatever", "code": "BAD_ORDER_FIELD"}`,
+			ErrorString: "OrderField About invalid",
+			Is:          searchclient.ErrBadOrderField,
+		},
+		{
+			Response:    `{"error": {"code": "BAD_ORDER_FIELD", "message": "cant sort by field \"About\"", "field": "order_field", "request_id": "req-1"}}`,
+			ErrorString: "OrderField About invalid",
+			Is:          searchclient.ErrBadOrderField,
+			Field:       "order_field",
+			RequestID:   "req-1",
+		},
+		{
+			Response:    `{"error": {"code": "BAD_LIMIT", "message": "invalid limit value", "field": "limit"}}`,
+			ErrorString: "bad request error: invalid limit value",
+			Is:          searchclient.ErrBadLimit,
+			Field:       "limit",
+		},
+		{
+			Response:    `{"error": "invalid offset value", "code": "BAD_OFFSET"}`,
+			ErrorString: "bad request error: invalid offset value",
+			Is:          searchclient.ErrBadOffset,
+		},
+		{
+			Response:    `{"error": {"code": "SOMETHING_NEW", "message": "something new"}}`,
+			ErrorString: "unknown bad request error: something new",
+		},
+	}
+
+	for caseNum, testCase := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, testCase.Response)
+		}))
+		client := &searchclient.SearchClient{
+			AccessToken: "valid-token",
+			URL:         ts.URL,
+		}
+		_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, OrderField: "About"})
+		ts.Close()
+
+		var searchErr *searchclient.SearchError
+		if !errors.As(err, &searchErr) {
+			t.Errorf("[%d] expected *searchclient.SearchError, got %#v", caseNum, err)
+			continue
+		}
+		if err.Error() != testCase.ErrorString {
+			t.Errorf("[%d] wrong error, expected %s, got %s", caseNum, testCase.ErrorString, err.Error())
+		}
+		if testCase.Is != nil && !errors.Is(err, testCase.Is) {
+			t.Errorf("[%d] expected error to match %v, got %#v", caseNum, testCase.Is, err)
+		}
+		if searchErr.Field != testCase.Field || searchErr.RequestID != testCase.RequestID {
+			t.Errorf("[%d] expected field %q and request id %q, got %q and %q", caseNum, testCase.Field, testCase.RequestID, searchErr.Field, searchErr.RequestID)
+		}
+	}
+}
+
+func TestFindUsersProblemJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+		ProblemJSON: true,
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, OrderField: "About", OrderBy: searchclient.OrderByAsc})
+	if !errors.Is(err, searchclient.ErrBadOrderField) {
+		t.Fatalf("Expected searchclient.ErrBadOrderField, got %#v", err)
+	}
+	var searchErr *searchclient.SearchError
+	if !errors.As(err, &searchErr) || searchErr.Problem == nil {
+		t.Fatalf("Expected problem details, got %#v", err)
+	}
+	expected := &searchclient.Problem{
+		Type:     "urn:searchserver:error:" + searchclient.CodeBadOrderField,
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   `cant sort by field "About"`,
+		Instance: "/?limit=2&offset=0&order_by=-1&order_field=About&query=",
+		Code:     searchclient.CodeBadOrderField,
+		Field:    "order_field",
+	}
+	if !reflect.DeepEqual(searchErr.Problem, expected) {
+		t.Errorf("Wrong problem, expected %#v, got %#v", expected, searchErr.Problem)
+	}
+}
+
+func TestFindUsersProblemJSONStatuses(t *testing.T) {
+	cases := []struct {
+		Status  int
+		Code    string
+		Message string
+		Is      error
+	}{
+		{Status: http.StatusInternalServerError, Code: searchclient.CodeInternal, Message: "SearchServer fatal error", Is: searchclient.ErrServerFatal},
+		{Status: http.StatusServiceUnavailable, Code: searchclient.CodeUnavailable, Message: "SearchServer unavailable", Is: searchclient.ErrUnavailable},
+		// незнакомый код - текст берётся из problem+json
+		{Status: http.StatusBadGateway, Code: "UPSTREAM", Message: "unexpected status 502: upstream is down"},
+		{Status: http.StatusConflict, Code: "CONFLICT", Message: "unexpected status 409: upstream is down"},
+	}
+	for caseNum, item := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", searchclient.ProblemContentType)
+			w.WriteHeader(item.Status)
+			json.NewEncoder(w).Encode(searchclient.Problem{Title: http.StatusText(item.Status), Status: item.Status, Detail: "upstream is down", Code: item.Code, RequestID: "req-1"})
+		}))
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+		_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+		ts.Close()
+
+		var searchErr *searchclient.SearchError
+		if !errors.As(err, &searchErr) {
+			t.Errorf("[%d] expected SearchError, got %#v", caseNum, err)
+			continue
+		}
+		if searchErr.Problem == nil || searchErr.Problem.Code != item.Code || searchErr.RequestID != "req-1" {
+			t.Errorf("[%d] expected problem details, got %#v", caseNum, searchErr)
+		}
+		if searchErr.StatusCode != item.Status || searchErr.Message != item.Message {
+			t.Errorf("[%d] expected %d %q, got %d %q", caseNum, item.Status, item.Message, searchErr.StatusCode, searchErr.Message)
+		}
+		if item.Is != nil && !errors.Is(err, item.Is) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, item.Is, err)
+		}
+	}
+}
+
+func TestFindUsersDebugDump(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	dump := &bytes.Buffer{}
+	client := &searchclient.SearchClient{
+		AccessToken: "secret-token",
+		URL:         ts.URL,
+		Debug:       dump,
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "Boyd Wolf", OrderField: "Id", OrderBy: searchclient.OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out := dump.String()
+	for _, expected := range []string{
+		"--> request\nGET /?limit=2&offset=0&order_by=-1&order_field=Id&query=Boyd%20Wolf HTTP/1.1",
+		"Accesstoken: REDACTED",
+		"<-- response\nHTTP/1.1 200 OK",
+		`"Name":"Boyd Wolf"`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("debug dump does not contain %q:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "secret-token") {
+		t.Errorf("debug dump leaks token:\n%s", out)
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         "http://search.local/users",
+		ProblemJSON: true,
+	}
+	req, err := client.NewRequest(searchclient.SearchRequest{Limit: 30, Offset: 5, Query: "Boyd", OrderField: "Age", OrderBy: searchclient.OrderByDesc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedURL := "http://search.local/users?limit=26&offset=5&order_by=1&order_field=Age&query=Boyd"
+	if req.Method != http.MethodGet || req.URL.String() != expectedURL {
+		t.Errorf("wrong request, expected GET %s, got %s %s", expectedURL, req.Method, req.URL)
+	}
+	if req.Header.Get("AccessToken") != "valid-token" {
+		t.Errorf("wrong AccessToken header: %q", req.Header.Get("AccessToken"))
+	}
+	if req.Header.Get("Accept") != searchclient.ProblemContentType+", application/json" {
+		t.Errorf("wrong Accept header: %q", req.Header.Get("Accept"))
+	}
+
+	if _, err := client.NewRequest(searchclient.SearchRequest{Limit: -1}); err == nil || err.Error() != "limit must be > 0" {
+		t.Errorf("expected limit error, got %v", err)
+	}
+
+	client.URL = "http://bad host"
+	if _, err := client.NewRequest(searchclient.SearchRequest{Limit: 1}); err == nil || !strings.HasPrefix(err.Error(), "cant create request") {
+		t.Errorf("expected request creation error, got %v", err)
+	}
+}
+
+func TestNewRequestQueryEncoding(t *testing.T) {
+	cases := []struct {
+		URL      string
+		Request  searchclient.SearchRequest
+		Expected string
+	}{
+		{
+			URL:      "http://search.local/",
+			Request:  searchclient.SearchRequest{Query: "Boyd Wolf & co+"},
+			Expected: "limit=1&offset=0&order_by=0&order_field=&query=Boyd%20Wolf%20%26%20co%2B",
+		},
+		{
+			URL:      "http://search.local/",
+			Request:  searchclient.SearchRequest{Query: "Бойд=Вульф?"},
+			Expected: "limit=1&offset=0&order_by=0&order_field=&query=%D0%91%D0%BE%D0%B9%D0%B4%3D%D0%92%D1%83%D0%BB%D1%8C%D1%84%3F",
+		},
+		{
+			URL:      "http://search.local/?api_key=abc",
+			Request:  searchclient.SearchRequest{Query: "x"},
+			Expected: "api_key=abc&limit=1&offset=0&order_by=0&order_field=&query=x",
+		},
+		{
+			URL: "http://search.local/",
+			Request: searchclient.SearchRequest{
+				Query:  "x",
+				Params: url.Values{"trace": {"on"}, "limit": {"100"}},
+			},
+			Expected: "limit=1&offset=0&order_by=0&order_field=&query=x&trace=on",
+		},
+	}
+
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{URL: testCase.URL}
+		req, err := client.NewRequest(testCase.Request)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if req.URL.RawQuery != testCase.Expected {
+			t.Errorf("[%d] wrong query, expected %s, got %s", caseNum, testCase.Expected, req.URL.RawQuery)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "boyd wolf", OrderBy: searchclient.OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(resp.Users) != 1 || resp.Users[0].Name != "Boyd Wolf" {
+		t.Errorf("expected Boyd Wolf, got %#v", resp.Users)
+	}
+}
+
+func TestFindUsersLongQueryFallsBackToPost(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken:  "valid-token",
+		URL:          ts.URL,
+		MaxURLLength: 100,
+	}
+
+	short, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "Boyd", OrderField: "Id", OrderBy: searchclient.OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	long, err := client.FindUsers(searchclient.SearchRequest{
+		Limit:      1,
+		Query:      "Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia.",
+		OrderField: "Id",
+		OrderBy:    searchclient.OrderByAsc,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(methods, []string{http.MethodGet, http.MethodPost}) {
+		t.Errorf("wrong methods, expected GET then POST, got %v", methods)
+	}
+	if !reflect.DeepEqual(long, short) {
+		t.Errorf("POST search must find the same user, expected %#v, got %#v", short, long)
+	}
+
+	_, err = client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: strings.Repeat("x", 100), OrderField: "About"})
+	if !errors.Is(err, searchclient.ErrBadOrderField) {
+		t.Errorf("expected searchclient.ErrBadOrderField from POST search, got %#v", err)
+	}
+}
+
+func TestNewRequestPost(t *testing.T) {
+	client := &searchclient.SearchClient{
+		AccessToken:  "valid-token",
+		URL:          "http://search.local/?api_key=abc",
+		MaxURLLength: 50,
+	}
+	req, err := client.NewRequest(searchclient.SearchRequest{
+		Limit:  1,
+		Query:  "a long enough query",
+		Params: url.Values{"trace": {"on"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if req.Method != http.MethodPost || req.URL.RawQuery != "api_key=abc&trace=on" {
+		t.Errorf("wrong request, got %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("Content-Type") != "application/json" || req.Header.Get("AccessToken") != "valid-token" {
+		t.Errorf("wrong headers: %v", req.Header)
+	}
+	var body searchclient.SearchRequestBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		t.Fatalf("cant decode body: %s", err)
+	}
+	expected := searchclient.SearchRequestBody{Limit: 2, Query: "a long enough query"}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("wrong body, expected %#v, got %#v", expected, body)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", resp.StatusCode)
+	}
+
+	badBody, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader("{"))
+	badBody.Header.Set("AccessToken", "valid-token")
+	resp, err = http.DefaultClient.Do(badBody)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var errResp searchserver.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || errResp.Error.Code != searchclient.CodeBadBody {
+		t.Errorf("expected 400 %s, got %d %#v", searchclient.CodeBadBody, resp.StatusCode, errResp)
+	}
+}
+
+func TestFindUsersJSONMultiSort(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+		UseJSON:     true,
+	}
+	resp, err := client.FindUsers(searchclient.SearchRequest{
+		Limit: 25,
+		Sort: []searchclient.SortKey{
+			{Field: "Age", OrderBy: searchclient.OrderByDesc},
+			{Field: "Id", OrderBy: searchclient.OrderByAsc},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"POST /search"}) {
+		t.Errorf("expected POST /search, got %v", paths)
+	}
+	if len(resp.Users) != 25 || !resp.NextPage {
+		t.Fatalf("expected full page with next page, got %d users, next page %v", len(resp.Users), resp.NextPage)
+	}
+	for i := 1; i < len(resp.Users); i++ {
+		prev, cur := resp.Users[i-1], resp.Users[i]
+		if prev.Age < cur.Age || (prev.Age == cur.Age && prev.Id > cur.Id) {
+			t.Errorf("wrong order at %d: %#v before %#v", i, prev, cur)
+		}
+	}
+
+	for caseNum, sortKey := range []searchclient.SortKey{{Field: "About", OrderBy: searchclient.OrderByAsc}, {Field: "Age", OrderBy: 5}} {
+		_, err = client.FindUsers(searchclient.SearchRequest{Limit: 1, Sort: []searchclient.SortKey{sortKey}})
+		var searchErr *searchclient.SearchError
+		if !errors.As(err, &searchErr) || searchErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("[%d] expected bad request error, got %#v", caseNum, err)
+		}
+	}
+}
+
+func TestFindUsersAuthHeader(t *testing.T) {
+	var headers []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		AuthHeader    string
+		AuthScheme    string
+		Header        string
+		Expected      string
+		ExpectedError error
+	}{
+		{
+			Header:   "AccessToken",
+			Expected: "token",
+		},
+		{
+			AuthHeader: "Authorization",
+			AuthScheme: "Bearer",
+			Header:     "Authorization",
+			Expected:   "Bearer token",
+		},
+		{
+			AuthHeader:    "Authorization",
+			AuthScheme:    "Basic",
+			Header:        "Authorization",
+			Expected:      "Basic token",
+			ExpectedError: searchclient.ErrBadAccessToken,
+		},
+	}
+
+	for caseNum, testCase := range cases {
+		headers = nil
+		client := &searchclient.SearchClient{
+			AccessToken: "token",
+			URL:         ts.URL,
+			AuthHeader:  testCase.AuthHeader,
+			AuthScheme:  testCase.AuthScheme,
+		}
+		_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, OrderBy: searchclient.OrderByAsc})
+		if testCase.ExpectedError == nil && err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+		}
+		if testCase.ExpectedError != nil && !errors.Is(err, testCase.ExpectedError) {
+			t.Errorf("[%d] expected %v, got %#v", caseNum, testCase.ExpectedError, err)
+		}
+		if len(headers) != 1 || headers[0].Get(testCase.Header) != testCase.Expected {
+			t.Errorf("[%d] expected %s: %s, got %v", caseNum, testCase.Header, testCase.Expected, headers)
+		}
+	}
+}
+
+func TestFindUsersTokenRefresh(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("AccessToken") != "fresh" {
+			searchserver.JSONError(w, r, "Bad AccessToken", searchclient.CodeBadToken, http.StatusUnauthorized)
+			return
+		}
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		NewToken      string
+		RefreshError  error
+		UseJSON       bool
+		ExpectedError error
+		Requests      int
+	}{
+		{NewToken: "fresh", Requests: 2},
+		{NewToken: "fresh", UseJSON: true, Requests: 2},
+		{NewToken: "still-stale", ExpectedError: searchclient.ErrBadAccessToken, Requests: 2},
+		{RefreshError: errors.New("no token"), ExpectedError: searchclient.ErrBadAccessToken, Requests: 1},
+	}
+
+	for caseNum, testCase := range cases {
+		requests = 0
+		refreshes := 0
+		client := &searchclient.SearchClient{
+			AccessToken: "stale",
+			URL:         ts.URL,
+			UseJSON:     testCase.UseJSON,
+			OnUnauthorized: func() (string, error) {
+				refreshes++
+				return testCase.NewToken, testCase.RefreshError
+			},
+		}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "Boyd Wolf", OrderBy: searchclient.OrderByAsc})
+		if testCase.ExpectedError != nil {
+			if !errors.Is(err, testCase.ExpectedError) {
+				t.Errorf("[%d] expected %v, got %#v", caseNum, testCase.ExpectedError, err)
+			}
+		} else if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+		} else if len(resp.Users) != 1 || resp.Users[0].Id != 0 {
+			t.Errorf("[%d] wrong users: %#v", caseNum, resp.Users)
+		}
+		if refreshes != 1 || requests != testCase.Requests {
+			t.Errorf("[%d] expected 1 refresh and %d requests, got %d and %d", caseNum, testCase.Requests, refreshes, requests)
+		}
+		if testCase.RefreshError == nil && client.Token() != testCase.NewToken {
+			t.Errorf("[%d] token was not updated: %s", caseNum, client.Token())
+		}
+	}
+}
+
+func TestTokenRefreshOnce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("AccessToken") != "fresh" {
+			searchserver.JSONError(w, r, "Bad AccessToken", searchclient.CodeBadToken, http.StatusUnauthorized)
+			return
+		}
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	var refreshes atomic.Int32
+	client := &searchclient.SearchClient{
+		AccessToken: "stale",
+		URL:         ts.URL,
+		OnUnauthorized: func() (string, error) {
+			refreshes.Add(1)
+			// пока токен обновляется, 401 успевают получить и остальные запросы
+			time.Sleep(20 * time.Millisecond)
+			return "fresh", nil
+		},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetUser(context.Background(), 0); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := refreshes.Load(); got != 1 {
+		t.Errorf("expected one token refresh for concurrent 401, got %d", got)
+	}
+}
+
+func TestFindUsersRedirectPolicy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer target.Close()
+	balancer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+r.URL.RequestURI(), http.StatusFound)
+	}))
+	defer balancer.Close()
+
+	cases := []struct {
+		MaxRedirects             int
+		ForbidCrossHostRedirects bool
+		StripAuthOnRedirect      bool
+		ExpectedError            string
+	}{
+		{},
+		{MaxRedirects: 1},
+		{MaxRedirects: -1, ExpectedError: "stopped after 0 redirects"},
+		{ForbidCrossHostRedirects: true, ExpectedError: "redirect to other host"},
+		{StripAuthOnRedirect: true, ExpectedError: "Bad AccessToken"},
+	}
+
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{
+			AccessToken:              "valid-token",
+			URL:                      balancer.URL,
+			MaxRedirects:             testCase.MaxRedirects,
+			ForbidCrossHostRedirects: testCase.ForbidCrossHostRedirects,
+			StripAuthOnRedirect:      testCase.StripAuthOnRedirect,
+		}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "Boyd Wolf", OrderBy: searchclient.OrderByAsc})
+		if testCase.ExpectedError == "" {
+			if err != nil {
+				t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			} else if len(resp.Users) != 1 {
+				t.Errorf("[%d] wrong users: %#v", caseNum, resp.Users)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), testCase.ExpectedError) {
+			t.Errorf("[%d] expected error containing %q, got %v", caseNum, testCase.ExpectedError, err)
+		}
+	}
+}
+
+func TestFindUsersCookieJar(t *testing.T) {
+	var sessions []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("lb_session")
+		if err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "lb_session", Value: "backend-2", Path: "/"})
+			sessions = append(sessions, "")
+		} else {
+			sessions = append(sessions, cookie.Value)
+		}
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cant create cookie jar: %s", err)
+	}
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         ts.URL,
+		Jar:         jar,
+	}
+	for offset := 0; offset < 3; offset++ {
+		if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Offset: offset, OrderBy: searchclient.OrderByAsc}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	expected := []string{"", "backend-2", "backend-2"}
+	if !reflect.DeepEqual(sessions, expected) {
+		t.Errorf("wrong sessions, expected %v, got %v", expected, sessions)
+	}
+}
+
+func TestFindUsersCustomDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	var dialed []string
+	dialer := &net.Dialer{}
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         "http://search.internal.example/",
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return dialer.DialContext(ctx, network, ts.Listener.Addr().String())
+		},
+		// резолвер не должен использоваться, если задан DialContext
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				t.Error("resolver must not be used with custom DialContext")
+				return nil, errors.New("no dns")
+			},
+		},
+	}
+	resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "Boyd Wolf", OrderBy: searchclient.OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(resp.Users) != 1 || resp.Users[0].Name != "Boyd Wolf" {
+		t.Errorf("wrong users: %#v", resp.Users)
+	}
+	if !reflect.DeepEqual(dialed, []string{"search.internal.example:80"}) {
+		t.Errorf("wrong dialed addresses: %v", dialed)
+	}
+}
+
+func TestFindUsersCustomResolver(t *testing.T) {
+	var lookups int
+	client := &searchclient.SearchClient{
+		AccessToken: "valid-token",
+		URL:         "http://search.internal.example/",
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				lookups++
+				return nil, errors.New("no dns")
+			},
+		},
+	}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+	if err == nil || !strings.HasPrefix(err.Error(), "unknown error") {
+		t.Errorf("expected unknown error, got %v", err)
+	}
+	if lookups == 0 {
+		t.Error("custom resolver was not used")
+	}
+}
+
+func TestFindUsersTimeoutPhases(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	// принимает соединения, но никогда не отвечает на TLS-рукопожатие
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen: %s", err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	blockingDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	cases := []struct {
+		URL           string
+		Client        func(*searchclient.SearchClient)
+		ExpectedPhase string
+	}{
+		{
+			URL: slow.URL,
+			Client: func(c *searchclient.SearchClient) {
+				c.DialContext = blockingDial
+				c.ConnectTimeout = 50 * time.Millisecond
+			},
+			ExpectedPhase: searchclient.TimeoutPhaseConnect,
+		},
+		{
+			URL:           "https://" + silent.Addr().String(),
+			Client:        func(c *searchclient.SearchClient) { c.TLSHandshakeTimeout = 50 * time.Millisecond },
+			ExpectedPhase: searchclient.TimeoutPhaseTLSHandshake,
+		},
+		{
+			URL:           slow.URL,
+			Client:        func(c *searchclient.SearchClient) { c.ResponseHeaderTimeout = 50 * time.Millisecond },
+			ExpectedPhase: searchclient.TimeoutPhaseResponseHeader,
+		},
+		{
+			URL:           slow.URL,
+			Client:        func(c *searchclient.SearchClient) { c.AttemptTimeout = 50 * time.Millisecond },
+			ExpectedPhase: searchclient.TimeoutPhaseAttempt,
+		},
+		{
+			URL:           slow.URL,
+			Client:        func(c *searchclient.SearchClient) { c.CallTimeout = 50 * time.Millisecond },
+			ExpectedPhase: searchclient.TimeoutPhaseCall,
+		},
+	}
+
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{
+			AccessToken: "valid-token",
+			URL:         testCase.URL,
+		}
+		testCase.Client(client)
+
+		_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+		var timeoutErr *searchclient.TimeoutError
+		if !errors.As(err, &timeoutErr) {
+			t.Errorf("[%d] expected *searchclient.TimeoutError, got %#v", caseNum, err)
+			continue
+		}
+		if timeoutErr.Phase != testCase.ExpectedPhase {
+			t.Errorf("[%d] wrong phase, expected %s, got %s (%s)", caseNum, testCase.ExpectedPhase, timeoutErr.Phase, err)
+		}
+	}
+}
+
+func TestFindUsersContextCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.FindUsersContext(ctx, searchclient.SearchRequest{Limit: 1})
+	if err == nil || !strings.HasPrefix(err.Error(), "unknown error") || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("AccessToken") == "stale" {
+			searchserver.JSONError(w, r, "Bad AccessToken", searchclient.CodeBadToken, http.StatusUnauthorized)
+			return
+		}
+		SearchServer(w, r)
+	}))
+
+	before, recentBefore := searchclient.GetStats(), searchclient.GetRecentStats()
+	client := &searchclient.SearchClient{
+		AccessToken: "stale",
+		URL:         ts.URL,
+		OfflineMode: true,
+		OnUnauthorized: func() (string, error) {
+			return "fresh", nil
+		},
+	}
+	req := searchclient.SearchRequest{Limit: 1, OrderBy: searchclient.OrderByAsc}
+	if _, err := client.FindUsers(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, OrderField: "About"}); err == nil {
+		t.Fatal("expected bad order field error")
+	}
+	ts.Close()
+	if _, err := client.FindUsers(req); err != nil {
+		t.Fatalf("expected cached result, got %s", err)
+	}
+	if _, err := client.FindUsers(searchclient.SearchRequest{Limit: -1}); err == nil {
+		t.Fatal("expected limit error")
+	}
+	after, recentAfter := searchclient.GetStats(), searchclient.GetRecentStats()
+
+	statsDeltas := func(before, after searchclient.Stats) map[string]int64 {
+		return map[string]int64{
+			"requests":           after.Requests - before.Requests,
+			"retries":            after.Retries - before.Retries,
+			"cache_hits":         after.CacheHits - before.CacheHits,
+			"errors.bad_request": after.Errors["bad_request"] - before.Errors["bad_request"],
+			"errors.other":       after.Errors["other"] - before.Errors["other"],
+			"errors.auth":        after.Errors["auth"] - before.Errors["auth"],
+		}
+	}
+	deltas := statsDeltas(before, after)
+	expected := map[string]int64{
+		"requests":           4,
+		"retries":            1,
+		"cache_hits":         1,
+		"errors.bad_request": 1,
+		"errors.other":       1,
+		"errors.auth":        0,
+	}
+	if !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("wrong counters, expected %v, got %v", expected, deltas)
+	}
+	// тест укладывается в окно, так что за последние минуты насчитано столько же
+	if recent := statsDeltas(recentBefore, recentAfter); !reflect.DeepEqual(recent, expected) {
+		t.Errorf("wrong recent counters, expected %v, got %v", expected, recent)
+	}
+
+	published := expvar.Get("searchclient")
+	if published == nil || !strings.Contains(published.String(), `"requests"`) {
+		t.Errorf("counters are not published via expvar: %v", published)
+	}
+	if published == nil || !strings.Contains(published.String(), `"recent"`) {
+		t.Errorf("recent counters are not published via expvar: %v", published)
+	}
+}
+
+func TestClientStatsNetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	before := searchclient.GetRecentStats()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 1}); err == nil {
+		t.Fatal("expected connection error")
+	}
+	after := searchclient.GetRecentStats()
+	if got := after.Errors["network"] - before.Errors["network"]; got != 1 {
+		t.Errorf("expected 1 network error, got %d", got)
+	}
+	if got := after.Errors["other"] - before.Errors["other"]; got != 0 {
+		t.Errorf("expected refused connection not to count as other, got %d", got)
+	}
+}
+
+func TestSearchServerOpenAPISpec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("wrong response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatalf("cant decode spec: %s", err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("wrong openapi version: %s", spec.OpenAPI)
+	}
+	for _, path := range []string{"/", "/search", "/openapi.json"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec does not describe %s", path)
+		}
+	}
+}
+
+func TestFindUsersAPIVersions(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		APIVersion    string
+		UseJSON       bool
+		ExpectedPath  string
+		ExpectedTotal int
+	}{
+		{APIVersion: "", ExpectedPath: "GET /", ExpectedTotal: 0},
+		{APIVersion: searchclient.APIVersion1, ExpectedPath: "GET /v1", ExpectedTotal: 0},
+		{APIVersion: searchclient.APIVersion2, ExpectedPath: "GET /v2", ExpectedTotal: 35},
+		{APIVersion: searchclient.APIVersion2, UseJSON: true, ExpectedPath: "POST /v2/search", ExpectedTotal: 35},
+	}
+
+	for caseNum, testCase := range cases {
+		paths = nil
+		client := &searchclient.SearchClient{
+			AccessToken: "valid-token",
+			URL:         ts.URL,
+			APIVersion:  testCase.APIVersion,
+			UseJSON:     testCase.UseJSON,
+		}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, OrderField: "Id", OrderBy: searchclient.OrderByAsc})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, []string{testCase.ExpectedPath}) {
+			t.Errorf("[%d] expected %s, got %v", caseNum, testCase.ExpectedPath, paths)
+		}
+		if len(resp.Users) != 1 || resp.Users[0].Name != "Boyd Wolf" || !resp.NextPage {
+			t.Errorf("[%d] wrong response: %#v", caseNum, resp)
+		}
+		if resp.Total != testCase.ExpectedTotal {
+			t.Errorf("[%d] wrong total, expected %d, got %d", caseNum, testCase.ExpectedTotal, resp.Total)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: "v3"}
+	if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 1}); err == nil || err.Error() != `unsupported api version "v3"` {
+		t.Errorf("expected unsupported version error, got %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/v3/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown version, got %d", resp.StatusCode)
+	}
+}
+
+func TestFindUsersServiceUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searchserver.JSONError(w, r, "server is shutting down", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+	if !errors.Is(err, searchclient.ErrUnavailable) || err.Error() != "SearchServer unavailable" {
+		t.Errorf("expected ErrUnavailable, got %#v", err)
+	}
+}
+
+func TestFindUsersRateLimited(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		searchserver.JSONError(w, r, "rate limit exceeded", searchclient.CodeRateLimited, http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+	var searchErr *searchclient.SearchError
+	if !errors.Is(err, searchclient.ErrRateLimited) || !errors.As(err, &searchErr) || searchErr.RetryAfter != 3*time.Second {
+		t.Errorf("expected ErrRateLimited with retry after 3s, got %#v", err)
+	}
+}
+
+func TestFindUsersForbidden(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searchserver.JSONError(w, r, "token has no search:read scope", searchclient.CodeForbidden, http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	client := &searchclient.SearchClient{AccessToken: "write-only-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1})
+	if !errors.Is(err, searchclient.ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %#v", err)
+	}
+}
+
+func TestFindUsersGender(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		Gender   string
+		UseJSON  bool
+		Expected int
+	}{
+		{Gender: searchclient.GenderFemale, Expected: 11},
+		{Gender: searchclient.GenderMale, UseJSON: true, Expected: 24},
+		{Gender: searchclient.GenderAny, Expected: 35},
+		{Gender: "", UseJSON: true, Expected: 35},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 25, OrderField: "Id", OrderBy: searchclient.OrderByAsc, Gender: testCase.Gender})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		expected := min(testCase.Expected, 25)
+		if len(resp.Users) != expected {
+			t.Errorf("[%d] expected %d users, got %d", caseNum, expected, len(resp.Users))
+		}
+		for _, user := range resp.Users {
+			if testCase.Gender != "" && testCase.Gender != searchclient.GenderAny && user.Gender != testCase.Gender {
+				t.Errorf("[%d] expected only %s, got %#v", caseNum, testCase.Gender, user)
+			}
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Gender: "robot"})
+	var searchErr *searchclient.SearchError
+	if !errors.Is(err, searchclient.ErrBadFilter) || !errors.As(err, &searchErr) || searchErr.Field != "gender" {
+		t.Errorf("expected bad gender filter, got %#v", err)
+	}
+}
+
+func TestFindUsersAgeRange(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		AgeMin   int
+		AgeMax   int
+		UseJSON  bool
+		Expected int
+	}{
+		{AgeMin: 30, AgeMax: 40, Expected: 22},
+		{AgeMin: 30, AgeMax: 40, UseJSON: true, Expected: 22},
+		{AgeMax: 25, Expected: 6},
+		{AgeMin: 37, UseJSON: true, Expected: 5},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 25, OrderField: "Age", OrderBy: searchclient.OrderByAsc, AgeMin: testCase.AgeMin, AgeMax: testCase.AgeMax})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if len(resp.Users) != testCase.Expected {
+			t.Errorf("[%d] expected %d users, got %d", caseNum, testCase.Expected, len(resp.Users))
+		}
+		for _, user := range resp.Users {
+			if user.Age < testCase.AgeMin || (testCase.AgeMax != 0 && user.Age > testCase.AgeMax) {
+				t.Errorf("[%d] expected age in [%d, %d], got %#v", caseNum, testCase.AgeMin, testCase.AgeMax, user)
+			}
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, AgeMin: 40, AgeMax: 30})
+	var searchErr *searchclient.SearchError
+	if !errors.Is(err, searchclient.ErrBadFilter) || !errors.As(err, &searchErr) || searchErr.Field != "age_max" {
+		t.Errorf("expected bad age range, got %#v", err)
+	}
+}
+
+func TestFindUsersByIDs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	var many, expectedMany []int
+	for id := 30; id >= 0; id-- {
+		many = append(many, id)
+		expectedMany = append([]int{id}, expectedMany...)
+	}
+	cases := []struct {
+		IDs      []int
+		UseJSON  bool
+		Expected []int
+	}{
+		{IDs: []int{9, 1, 5}, Expected: []int{1, 5, 9}},
+		{IDs: []int{9, 1, 5, 999}, UseJSON: true, Expected: []int{1, 5, 9}},
+		// больше одной страницы
+		{IDs: many, Expected: expectedMany},
+		{IDs: nil, Expected: nil},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		users, err := client.FindUsersByIDs(context.Background(), testCase.IDs)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		var ids []int
+		for _, user := range users {
+			ids = append(ids, user.Id)
+		}
+		if !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, ids)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 10, OrderField: "Id", OrderBy: searchclient.OrderByAsc, IdFrom: 20, IdTo: 22})
+	if err != nil || len(resp.Users) != 3 || resp.Users[0].Id != 20 || resp.Users[2].Id != 22 {
+		t.Errorf("expected users 20-22, got %v %v", resp, err)
+	}
+	_, err = client.FindUsersByIDs(context.Background(), []int{-1})
+	if !errors.Is(err, searchclient.ErrBadFilter) {
+		t.Errorf("expected ErrBadFilter, got %#v", err)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		Id         int
+		APIVersion string
+		Expected   string
+		NotFound   bool
+	}{
+		{Id: 7, Expected: "Leann Travis"},
+		{Id: 0, APIVersion: searchclient.APIVersion2, Expected: "Boyd Wolf"},
+		{Id: 999, NotFound: true},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: testCase.APIVersion}
+		user, err := client.GetUser(context.Background(), testCase.Id)
+		if testCase.NotFound {
+			var notFound *searchclient.NotFoundError
+			if !errors.As(err, &notFound) || notFound.Id != testCase.Id || !errors.Is(err, searchclient.ErrNotFound) {
+				t.Errorf("[%d] expected NotFoundError, got %#v", caseNum, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if user.Id != testCase.Id || user.Name != testCase.Expected {
+			t.Errorf("[%d] expected user %d %s, got %#v", caseNum, testCase.Id, testCase.Expected, user)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "", URL: ts.URL}
+	if _, err := client.GetUser(context.Background(), 7); !errors.Is(err, searchclient.ErrBadAccessToken) {
+		t.Errorf("expected ErrBadAccessToken, got %#v", err)
+	}
+}
+
+func TestGetUserByGuid(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+
+	user, err := client.GetUserByGuid(context.Background(), "f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb")
+	if err != nil || user.Id != 7 || user.Name != "Leann Travis" || user.Guid != "f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb" {
+		t.Errorf("expected user 7, got %#v %v", user, err)
+	}
+
+	_, err = client.GetUserByGuid(context.Background(), "no-such-guid")
+	var notFound *searchclient.NotFoundError
+	if !errors.As(err, &notFound) || notFound.Guid != "no-such-guid" || err.Error() != "user with guid no-such-guid not found" {
+		t.Errorf("expected NotFoundError, got %#v", err)
+	}
+
+	if _, err := client.GetUserByGuid(context.Background(), ""); err == nil {
+		t.Error("expected error for empty guid")
+	}
+}
+
+func TestGetUserByGuidEscaping(t *testing.T) {
+	var gotPath, gotQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		SearchServer(w, r)
+	}))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+
+	// guid уходит одним сегментом пути и не добавляет параметров
+	for caseNum, guid := range []string{"a/b", "x?limit=1", "x#y", "../7", "100%"} {
+		_, err := client.GetUserByGuid(context.Background(), guid)
+		var notFound *searchclient.NotFoundError
+		if !errors.As(err, &notFound) || notFound.Guid != guid {
+			t.Errorf("[%d] expected NotFoundError for %q, got %#v", caseNum, guid, err)
+		}
+		if gotPath != searchclient.UsersGuidPath+guid || gotQuery != "" {
+			t.Errorf("[%d] expected path %q, got %q?%s", caseNum, searchclient.UsersGuidPath+guid, gotPath, gotQuery)
+		}
+	}
+
+	for caseNum, guid := range []string{".", ".."} {
+		gotPath = ""
+		if _, err := client.GetUserByGuid(context.Background(), guid); err == nil || gotPath != "" {
+			t.Errorf("[%d] expected %q to be rejected without request, got %v", caseNum, guid, err)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		Prefix     string
+		Limit      int
+		APIVersion string
+		Expected   []searchclient.Suggestion
+	}{
+		{Prefix: "bo", Expected: []searchclient.Suggestion{{Name: "Boyd Wolf", Count: 1}}},
+		{Prefix: "Boyd W", APIVersion: searchclient.APIVersion2, Expected: []searchclient.Suggestion{{Name: "Boyd Wolf", Count: 1}}},
+		{Prefix: "ma", Limit: 2, Expected: []searchclient.Suggestion{{Name: "Henderson Maxwell", Count: 1}, {Name: "Hilda Mayer", Count: 1}}},
+		{Prefix: "zzz", Expected: []searchclient.Suggestion{}},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: testCase.APIVersion}
+		suggestions, err := client.Suggest(context.Background(), testCase.Prefix, testCase.Limit)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(suggestions, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, suggestions)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	if _, err := client.Suggest(context.Background(), "", 0); err == nil {
+		t.Error("expected error for empty prefix")
+	}
+	if _, err := client.Suggest(context.Background(), "bo", -1); err != nil {
+		t.Errorf("expected default limit for negative limit, got %s", err)
+	}
+	client = &searchclient.SearchClient{AccessToken: "", URL: ts.URL}
+	if _, err := client.Suggest(context.Background(), "bo", 0); !errors.Is(err, searchclient.ErrBadAccessToken) {
+		t.Errorf("expected ErrBadAccessToken, got %#v", err)
+	}
+
+	// сервер без датасета в памяти подсказок не отдаёт
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != searchclient.SuggestPath || r.URL.Query().Get("prefix") != "bo" || r.URL.Query().Get("tenant") != "a" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		searchserver.JSONError(w, r, "suggest needs the dataset in memory", searchclient.CodeNotFound, http.StatusNotFound)
+	}))
+	defer external.Close()
+	client = &searchclient.SearchClient{AccessToken: "valid-token", URL: external.URL + "?tenant=a"}
+	if _, err := client.Suggest(context.Background(), "bo", 0); !errors.Is(err, searchclient.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %#v", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+
+	all, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if all.Total != 35 || all.ByGender[searchclient.GenderMale]+all.ByGender[searchclient.GenderFemale] != 35 || all.Age == nil {
+		t.Errorf("expected aggregations over all 35 users, got %+v", all)
+	}
+
+	// агрегаты совпадают с тем, что находит поиск с тем же фильтром
+	filter := searchclient.SearchRequest{Query: "nulla", Gender: searchclient.GenderFemale, AgeMin: 25, Limit: 25, OrderField: "Id"}
+	aggs, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{Filter: filter, AgeInterval: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp, err := client.FindUsers(filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	counted := 0
+	for _, bucket := range aggs.AgeHistogram {
+		if bucket.To-bucket.From != 5 {
+			t.Errorf("expected 5 year buckets, got %+v", bucket)
+		}
+		counted += bucket.Count
+	}
+	if aggs.Total != len(resp.Users) || counted != aggs.Total || aggs.ByGender[searchclient.GenderFemale] != aggs.Total || aggs.ByGender[searchclient.GenderMale] != 0 {
+		t.Errorf("expected aggregations over %d users, got %+v", len(resp.Users), aggs)
+	}
+	for _, user := range resp.Users {
+		if user.Age < aggs.Age.Min || user.Age > aggs.Age.Max {
+			t.Errorf("user %d age %d is out of %+v", user.Id, user.Age, aggs.Age)
+		}
+	}
+
+	if _, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{Filter: searchclient.SearchRequest{Gender: "other"}}); !errors.Is(err, searchclient.ErrBadFilter) {
+		t.Errorf("expected ErrBadFilter, got %#v", err)
+	}
+	if _, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{AgeInterval: -1}); err == nil {
+		t.Error("expected error for negative age interval")
+	}
+	client = &searchclient.SearchClient{AccessToken: "", URL: ts.URL}
+	if _, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{}); !errors.Is(err, searchclient.ErrBadAccessToken) {
+		t.Errorf("expected ErrBadAccessToken, got %#v", err)
+	}
+}
+
+func TestFindUsersFacets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	for caseNum, useJSON := range []bool{false, true} {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: searchclient.APIVersion2, UseJSON: useJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Query: "nulla", Limit: 3, Facets: true, FacetAgeInterval: 5})
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", caseNum, err)
+		}
+		if resp.Facets == nil || resp.Facets.Total != resp.Total || len(resp.Users) != 3 || resp.Total <= 3 {
+			t.Fatalf("[%d] expected facets over all %d users, got %+v", caseNum, resp.Total, resp.Facets)
+		}
+		if bucket := resp.Facets.AgeHistogram[0]; bucket.To-bucket.From != 5 {
+			t.Errorf("[%d] expected 5 year buckets, got %+v", caseNum, bucket)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: searchclient.APIVersion2}
+	resp, err := client.FindUsers(searchclient.SearchRequest{Query: "nulla", Limit: 3})
+	if err != nil || resp.Facets != nil {
+		t.Errorf("expected no facets without Facets, got %+v %v", resp, err)
+	}
+	// в v1 ответ - массив, фасеты в нём не передать
+	client = &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	if _, err := client.FindUsers(searchclient.SearchRequest{Limit: 3, Facets: true}); err == nil {
+		t.Error("expected error for facets in api v1")
+	}
+}
+
+func TestFindUsersGroupBy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	for caseNum, useJSON := range []bool{false, true} {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: searchclient.APIVersion2, UseJSON: useJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{
+			OrderField: "Id",
+			OrderBy:    searchclient.OrderByAsc,
+			GroupBy:    searchclient.GroupByGender,
+			GroupLimit: 2,
+		})
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", caseNum, err)
+		}
+		if len(resp.Groups) != 2 || resp.Total != 35 || len(resp.Users) != 0 {
+			t.Fatalf("[%d] expected two groups of 35 users, got %+v", caseNum, resp)
+		}
+		counted := 0
+		for _, group := range resp.Groups {
+			counted += group.Count
+			if len(group.Users) != 2 || group.Users[0].Id > group.Users[1].Id {
+				t.Errorf("[%d] expected first two users by Id, got %+v", caseNum, group.Users)
+			}
+			for _, user := range group.Users {
+				if user.Gender != group.Key {
+					t.Errorf("[%d] user %d is %s, expected %s", caseNum, user.Id, user.Gender, group.Key)
+				}
+			}
+		}
+		if counted != resp.Total {
+			t.Errorf("[%d] expected counts to sum up to %d, got %d", caseNum, resp.Total, counted)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: searchclient.APIVersion2}
+	if _, err := client.FindUsers(searchclient.SearchRequest{GroupBy: "name"}); !errors.Is(err, searchclient.ErrBadQuery) {
+		t.Errorf("expected ErrBadQuery, got %#v", err)
+	}
+	client = &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	if _, err := client.FindUsers(searchclient.SearchRequest{GroupBy: searchclient.GroupByAgeDecade}); err == nil {
+		t.Error("expected error for group by in api v1")
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+
+	genders, err := client.Distinct(context.Background(), searchclient.DistinctRequest{Field: searchclient.DistinctGender})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	aggs, err := client.Aggregate(context.Background(), searchclient.AggregateRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []searchclient.DistinctValue{
+		{Value: searchclient.GenderFemale, Count: aggs.ByGender[searchclient.GenderFemale]},
+		{Value: searchclient.GenderMale, Count: aggs.ByGender[searchclient.GenderMale]},
+	}
+	if !reflect.DeepEqual(genders, expected) {
+		t.Errorf("expected %v, got %v", expected, genders)
+	}
+
+	filter := searchclient.SearchRequest{Query: "nulla", Gender: searchclient.GenderMale, Limit: 25}
+	ages, err := client.Distinct(context.Background(), searchclient.DistinctRequest{Field: searchclient.DistinctAge, Filter: filter})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp, err := client.FindUsers(filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	counts := map[string]int{}
+	for _, user := range resp.Users {
+		counts[strconv.Itoa(user.Age)]++
+	}
+	if len(ages) != len(counts) {
+		t.Errorf("expected %d ages, got %v", len(counts), ages)
+	}
+	for i, value := range ages {
+		if counts[value.Value] != value.Count {
+			t.Errorf("expected %d users aged %s, got %d", counts[value.Value], value.Value, value.Count)
+		}
+		if i > 0 {
+			prev, _ := strconv.Atoi(ages[i-1].Value)
+			if age, _ := strconv.Atoi(value.Value); age <= prev {
+				t.Errorf("expected ages in ascending order, got %v", ages)
+			}
+		}
+	}
+
+	if _, err := client.Distinct(context.Background(), searchclient.DistinctRequest{Field: "Name"}); !errors.Is(err, searchclient.ErrBadFields) {
+		t.Errorf("expected ErrBadFields, got %#v", err)
+	}
+	if _, err := client.Distinct(context.Background(), searchclient.DistinctRequest{}); err == nil {
+		t.Error("expected error for empty field")
+	}
+}
+
+func TestAggregateRequestValues(t *testing.T) {
+	req := searchclient.AggregateRequest{
+		Filter:      searchclient.SearchRequest{Query: "wolf", Gender: searchclient.GenderMale, Limit: 10, Offset: 5, OrderField: "Age", Fields: []string{"Id"}, Highlight: true, Facets: true, FacetAgeInterval: 3, GroupBy: searchclient.GroupByGender},
+		AgeInterval: 5,
+	}
+	expected := url.Values{"query": {"wolf"}, "gender": {"male"}, "age_interval": {"5"}}
+	if got := req.Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestFindUsersFields(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		UseJSON bool
+	}{
+		{UseJSON: false},
+		{UseJSON: true},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 2, OrderField: "Id", OrderBy: searchclient.OrderByAsc, Fields: []string{"Name", "Age"}})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		expected := []searchclient.User{{Id: 0, Name: "Boyd Wolf", Age: 22}, {Id: 1, Name: "Hilda Mayer", Age: 21}}
+		if !reflect.DeepEqual(resp.Users, expected) {
+			t.Errorf("[%d] expected %#v, got %#v", caseNum, expected, resp.Users)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Fields: []string{"Password"}})
+	if !errors.Is(err, searchclient.ErrBadFields) {
+		t.Errorf("expected ErrBadFields, got %#v", err)
+	}
+}
+
+func TestFindUsersFuzziness(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		UseJSON   bool
+		Fuzziness int
+		Expected  []int
+	}{
+		{UseJSON: false, Fuzziness: 0, Expected: []int{}},
+		{UseJSON: false, Fuzziness: 1, Expected: []int{0}},
+		{UseJSON: true, Fuzziness: 1, Expected: []int{0}},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 10, Query: "Boid Wolf", Fuzziness: testCase.Fuzziness})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		ids := []int{}
+		for _, user := range resp.Users {
+			ids = append(ids, user.Id)
+		}
+		if !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, ids)
+		}
+	}
+
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+	_, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "boid", Fuzziness: 5})
+	var searchErr *searchclient.SearchError
+	if !errors.Is(err, searchclient.ErrBadQuery) || !errors.As(err, &searchErr) || searchErr.Field != "fuzziness" {
+		t.Errorf("expected ErrBadQuery for fuzziness, got %#v", err)
+	}
+}
+
+func TestFindUsersOrderByScore(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	for caseNum, useJSON := range []bool{false, true} {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: useJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 5, Query: "boyd OR nulla", OrderField: searchclient.OrderFieldScore})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if len(resp.Users) != 5 || resp.Users[0].Id != 0 || !resp.NextPage {
+			t.Errorf("[%d] expected Boyd first of more than 5 users, got %+v", caseNum, resp)
+			continue
+		}
+		for i, user := range resp.Users {
+			if user.Score <= 0 || (i > 0 && user.Score > resp.Users[i-1].Score) {
+				t.Errorf("[%d] expected positive scores best first, got %+v", caseNum, resp.Users)
+				break
+			}
+		}
+	}
+}
+
+func TestFindUsersIgnoreAccents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	cases := []struct {
+		UseJSON       bool
+		IgnoreAccents bool
+		Expected      []int
+	}{
+		{UseJSON: false, IgnoreAccents: false, Expected: []int{}},
+		{UseJSON: false, IgnoreAccents: true, Expected: []int{0}},
+		{UseJSON: true, IgnoreAccents: true, Expected: []int{0}},
+	}
+	for caseNum, testCase := range cases {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: testCase.UseJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 10, Query: "BÖYD Wölf", IgnoreAccents: testCase.IgnoreAccents})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		ids := []int{}
+		for _, user := range resp.Users {
+			ids = append(ids, user.Id)
+		}
+		if !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, ids)
+		}
+	}
+}
+
+func TestFindUsersHighlight(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+
+	for caseNum, useJSON := range []bool{false, true} {
+		client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, UseJSON: useJSON}
+		resp, err := client.FindUsers(searchclient.SearchRequest{Limit: 1, Query: "wolf", OrderField: "Id", OrderBy: searchclient.OrderByAsc, Highlight: true})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		expected := map[string]string{"Name": "Boyd <em>Wolf</em>"}
+		if len(resp.Users) != 1 || !reflect.DeepEqual(resp.Users[0].Highlight, expected) {
+			t.Errorf("[%d] expected highlight %v, got %+v", caseNum, expected, resp.Users)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	client := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL, APIVersion: searchclient.APIVersion2}
+
+	filter := searchclient.SearchRequest{Gender: searchclient.GenderFemale, Fields: []string{"Id", "Gender"}}
+	sample, err := client.Sample(context.Background(), searchclient.SampleRequest{N: 4, Filter: filter})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(sample.Users) != 4 || sample.Total != 11 || sample.Seed == 0 {
+		t.Fatalf("expected 4 of 11 users with seed, got %+v", sample)
+	}
+	for _, user := range sample.Users {
+		if user.Gender != searchclient.GenderFemale || user.Name != "" {
+			t.Errorf("expected female user with Id and Gender only, got %+v", user)
+		}
+	}
+	repeated, err := client.Sample(context.Background(), searchclient.SampleRequest{N: 4, Seed: sample.Seed, Filter: filter})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(repeated, sample) {
+		t.Errorf("expected the same sample for seed %d, got %+v and %+v", sample.Seed, sample, repeated)
+	}
+
+	if _, err := client.Sample(context.Background(), searchclient.SampleRequest{N: -1}); err == nil {
+		t.Error("expected error for negative n")
+	}
+	if _, err := client.Sample(context.Background(), searchclient.SampleRequest{Filter: searchclient.SearchRequest{Fields: []string{"Password"}}}); !errors.Is(err, searchclient.ErrBadFields) {
+		t.Errorf("expected ErrBadFields, got %#v", err)
+	}
+}
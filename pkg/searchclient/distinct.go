@@ -0,0 +1,51 @@
+package searchclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// DistinctPath - ручка разных значений поля во внешней системе
+const DistinctPath = "/distinct"
+
+// поля, разные значения которых отдаёт /distinct
+const (
+	DistinctGender = "Gender"
+	DistinctAge    = "Age"
+)
+
+// DistinctRequest - значения какого поля нужны и среди каких пользователей
+type DistinctRequest struct {
+	// DistinctGender или DistinctAge
+	Field string
+	// фильтр как у AggregateRequest, пустой - все пользователи
+	Filter SearchRequest
+}
+
+// Values возвращает GET-параметры запроса разных значений
+func (req DistinctRequest) Values() url.Values {
+	params := filterValues(req.Filter)
+	params.Set("field", req.Field)
+	return params
+}
+
+// DistinctValue - значение поля и у скольких найденных пользователей оно такое. Возраст приходит строкой
+type DistinctValue struct {
+	Value string `json:"Value"`
+	Count int    `json:"Count"`
+}
+
+// Distinct отдаёт разные значения поля среди найденных через GET /distinct, например для выпадающего
+// списка фильтра, без перебора страниц. Значения идут по порядку поля: пол по алфавиту, возраст по возрастанию.
+// Если FieldMask внешней системы прячет поле от токена без pii:read, она отказывает с ErrForbidden
+func (srv *SearchClient) Distinct(ctx context.Context, req DistinctRequest) ([]DistinctValue, error) {
+	if req.Field == "" {
+		return nil, countError(fmt.Errorf("field must not be empty"))
+	}
+	var values []DistinctValue
+	if err := srv.getJSON(ctx, DistinctPath, req.Values(), &values, nil); err != nil {
+		return nil, countError(err)
+	}
+	return values, nil
+}
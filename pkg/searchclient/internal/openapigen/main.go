@@ -0,0 +1,454 @@
+// openapigen генерирует OpenAPI 3 описание API SearchServer по структурам пакетов searchclient и searchserver,
+// чтобы спека не расходилась с кодом. Запускается через go generate в pkg/searchclient
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"hw4/pkg/searchclient"
+	"hw4/pkg/searchserver"
+)
+
+type object = map[string]interface{}
+
+func main() {
+	out := flag.String("o", "openapi.json", "куда записать спеку")
+	flag.Parse()
+
+	spec, err := generate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, spec, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// generate собирает спеку, ключи в json сортируются, поэтому результат стабилен
+func generate() ([]byte, error) {
+	schemas := object{}
+	for _, v := range []interface{}{
+		searchclient.User{},
+		searchclient.SearchRequestBody{},
+		searchclient.SearchResponseV2{},
+		searchclient.SortKey{},
+		searchclient.SearchErrorResponse{},
+		searchclient.ErrorDetails{},
+		searchclient.Problem{},
+		searchclient.Suggestion{},
+		searchclient.Aggregations{},
+		searchclient.AgeBucket{},
+		searchclient.AgeStats{},
+		searchclient.Group{},
+		searchclient.DistinctValue{},
+		searchclient.SampleResponse{},
+		searchserver.StatsResponse{},
+		searchserver.IndexStats{},
+		searchserver.AnalyticsResponse{},
+		searchserver.QueryStats{},
+	} {
+		t := reflect.TypeOf(v)
+		schemas[t.Name()] = structSchema(t)
+	}
+	// остальные поля пользователя сервер может спрятать от клиентов без pii:read, см. searchserver.FieldMask
+	schemas["User"].(object)["required"] = []string{"Id"}
+
+	errorResponses := object{
+		"400": response("Неверные параметры поиска", "#/components/schemas/SearchErrorResponse"),
+		"401": response("Неверный токен", "#/components/schemas/SearchErrorResponse"),
+		"403": response("У токена нет нужного scope", "#/components/schemas/SearchErrorResponse"),
+		"429": response("Слишком много запросов с этого токена, повторить можно через Retry-After секунд", "#/components/schemas/SearchErrorResponse"),
+		"500": response("Внутренняя ошибка SearchServer", "#/components/schemas/SearchErrorResponse"),
+		"503": response("SearchServer останавливается или не уложился во время запроса", "#/components/schemas/SearchErrorResponse"),
+	}
+	usersResponse := object{
+		"description": "Найденные пользователи",
+		"content": object{
+			"application/json": object{
+				"schema": object{"type": "array", "items": ref("#/components/schemas/User")},
+			},
+		},
+	}
+
+	envelopeResponse := object{
+		"description": "Найденные пользователи и их общее количество",
+		"content": object{
+			"application/json": object{"schema": ref("#/components/schemas/SearchResponseV2")},
+		},
+	}
+	security := []object{{"AccessToken": []string{}}, {"Bearer": []string{}}}
+	findUsers := func(operationID string, ok object) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters":  queryParameters(reflect.TypeOf(searchclient.SearchRequestBody{})),
+				"responses":   merge(object{"200": ok}, errorResponses),
+				"security":    security,
+			},
+		}
+	}
+	findUsersJSON := func(operationID string, ok object) object {
+		return object{
+			"post": object{
+				"operationId": operationID,
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/json": object{"schema": ref("#/components/schemas/SearchRequestBody")},
+					},
+				},
+				"responses": merge(object{"200": ok}, errorResponses, object{
+					"413": response("Тело запроса больше, чем сервер согласен читать", "#/components/schemas/SearchErrorResponse"),
+				}),
+				"security": security,
+			},
+		}
+	}
+	// getUser - ручка одного пользователя, param - параметр пути, по которому он ищется
+	getUser := func(operationID, param, paramType, notFound string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters": []object{
+					{"name": param, "in": "path", "required": true, "schema": object{"type": paramType}},
+				},
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Пользователь",
+						"content": object{
+							"application/json": object{"schema": ref("#/components/schemas/User")},
+						},
+					},
+					"404": response(notFound, "#/components/schemas/SearchErrorResponse"),
+				}),
+				"security": security,
+			},
+		}
+	}
+	getUserByID := func(operationID string) object {
+		return getUser(operationID, "id", "integer", "Пользователя с таким Id нет")
+	}
+	getUserByGuid := func(operationID string) object {
+		return getUser(operationID, "guid", "string", "Пользователя с таким Guid нет")
+	}
+
+	suggest := func(operationID string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters": []object{
+					{"name": "prefix", "in": "query", "required": true, "schema": object{"type": "string"}},
+					{"name": "limit", "in": "query", "schema": object{"type": "integer"}},
+				},
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Имена, у которых какое-то слово начинается с prefix, самые частые первыми",
+						"content": object{
+							"application/json": object{
+								"schema": object{"type": "array", "items": ref("#/components/schemas/Suggestion")},
+							},
+						},
+					},
+					"404": response("Подсказок нет: датасет не в памяти", "#/components/schemas/SearchErrorResponse"),
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	// filterParams - фильтры поиска без страниц и сортировки, как у /aggregate, /distinct и /sample
+	filterParams := func(extra ...object) []object {
+		params := []object{}
+		for _, param := range []struct{ name, typ string }{
+			{"query", "string"}, {"gender", "string"}, {"age_min", "integer"}, {"age_max", "integer"},
+			{"ids", "string"}, {"id_from", "integer"}, {"id_to", "integer"}, {"fuzziness", "integer"},
+			{"ignore_accents", "boolean"},
+		} {
+			params = append(params, object{"name": param.name, "in": "query", "schema": object{"type": param.typ}})
+		}
+		return append(params, extra...)
+	}
+	aggregate := func(operationID string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters":  filterParams(object{"name": "age_interval", "in": "query", "schema": object{"type": "integer"}}),
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Агрегаты по всем найденным пользователям",
+						"content": object{
+							"application/json": object{"schema": ref("#/components/schemas/Aggregations")},
+						},
+					},
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	distinct := func(operationID string) object {
+		field := object{
+			"name":     "field",
+			"in":       "query",
+			"required": true,
+			"schema":   object{"type": "string", "enum": []string{searchclient.DistinctGender, searchclient.DistinctAge}},
+		}
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters":  filterParams(field),
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Разные значения поля среди найденных по порядку поля",
+						"content": object{
+							"application/json": object{
+								"schema": object{"type": "array", "items": ref("#/components/schemas/DistinctValue")},
+							},
+						},
+					},
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	sample := func(operationID string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters": filterParams(
+					object{"name": "n", "in": "query", "schema": object{"type": "integer", "minimum": 1}},
+					object{"name": "seed", "in": "query", "schema": object{"type": "integer", "format": "int64"}},
+					object{"name": "fields", "in": "query", "schema": object{"type": "string"}},
+				),
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Случайные найденные пользователи и зерно, с которым выборку можно повторить",
+						"content": object{
+							"application/json": object{"schema": ref("#/components/schemas/SampleResponse")},
+						},
+					},
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	stats := func(operationID string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters": []object{
+					{"name": "age_interval", "in": "query", "schema": object{"type": "integer"}},
+				},
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Сколько записей, насколько они свежие и как распределён возраст",
+						"content": object{
+							"application/json": object{"schema": ref("#/components/schemas/StatsResponse")},
+						},
+					},
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	analytics := func(operationID string) object {
+		return object{
+			"get": object{
+				"operationId": operationID,
+				"parameters": []object{
+					{"name": "limit", "in": "query", "schema": object{"type": "integer", "minimum": 1}},
+				},
+				"responses": merge(errorResponses, object{
+					"200": object{
+						"description": "Сколько было поисков, самые частые строки поиска и строки без результатов, только для scope admin",
+						"content": object{
+							"application/json": object{"schema": ref("#/components/schemas/AnalyticsResponse")},
+						},
+					},
+					"404": response("Аналитика поиска выключена", "#/components/schemas/SearchErrorResponse"),
+				}),
+				"security": security,
+			},
+		}
+	}
+
+	spec := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "SearchServer API",
+			"version": "1.0.0",
+		},
+		"paths": object{
+			"/":                                     findUsers("findUsers", usersResponse),
+			"/search":                               findUsersJSON("findUsersJSON", usersResponse),
+			"/v1":                                   findUsers("findUsersV1", usersResponse),
+			"/v1/search":                            findUsersJSON("findUsersJSONV1", usersResponse),
+			"/v2":                                   findUsers("findUsersV2", envelopeResponse),
+			"/v2/search":                            findUsersJSON("findUsersJSONV2", envelopeResponse),
+			searchclient.UsersPath + "{id}":         getUserByID("getUser"),
+			"/v1" + searchclient.UsersPath + "{id}": getUserByID("getUserV1"),
+			"/v2" + searchclient.UsersPath + "{id}": getUserByID("getUserV2"),
+			searchclient.UsersGuidPath + "{guid}":   getUserByGuid("getUserByGuid"),
+			"/v1" + searchclient.UsersGuidPath + "{guid}": getUserByGuid("getUserByGuidV1"),
+			"/v2" + searchclient.UsersGuidPath + "{guid}": getUserByGuid("getUserByGuidV2"),
+			searchclient.SuggestPath:                      suggest("suggest"),
+			"/v1" + searchclient.SuggestPath:              suggest("suggestV1"),
+			"/v2" + searchclient.SuggestPath:              suggest("suggestV2"),
+			searchclient.AggregatePath:                    aggregate("aggregate"),
+			"/v1" + searchclient.AggregatePath:            aggregate("aggregateV1"),
+			"/v2" + searchclient.AggregatePath:            aggregate("aggregateV2"),
+			searchclient.DistinctPath:                     distinct("distinct"),
+			"/v1" + searchclient.DistinctPath:             distinct("distinctV1"),
+			"/v2" + searchclient.DistinctPath:             distinct("distinctV2"),
+			searchclient.SamplePath:                       sample("sample"),
+			"/v1" + searchclient.SamplePath:               sample("sampleV1"),
+			"/v2" + searchclient.SamplePath:               sample("sampleV2"),
+			searchserver.StatsPath:                        stats("stats"),
+			"/v1" + searchserver.StatsPath:                stats("statsV1"),
+			"/v2" + searchserver.StatsPath:                stats("statsV2"),
+			searchserver.AnalyticsPath:                    analytics("analytics"),
+			"/v1" + searchserver.AnalyticsPath:            analytics("analyticsV1"),
+			"/v2" + searchserver.AnalyticsPath:            analytics("analyticsV2"),
+			"/openapi.json": object{
+				"get": object{
+					"operationId": "openAPISpec",
+					"responses": object{
+						"200": object{"description": "Эта спека"},
+					},
+				},
+			},
+		},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"AccessToken": object{"type": "apiKey", "in": "header", "name": searchclient.DefaultAuthHeader},
+				"Bearer":      object{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func ref(path string) object {
+	return object{"$ref": path}
+}
+
+func response(description, schemaRef string) object {
+	return object{
+		"description": description,
+		"content": object{
+			"application/json":              object{"schema": ref(schemaRef)},
+			searchclient.ProblemContentType: object{"schema": ref("#/components/schemas/Problem")},
+		},
+	}
+}
+
+func merge(objects ...object) object {
+	result := object{}
+	for _, o := range objects {
+		for k, v := range o {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// jsonName возвращает имя поля в json и признак omitempty, как их видит encoding/json
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(opts, "omitempty")
+}
+
+func structSchema(t reflect.Type) object {
+	properties := object{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name, omitempty := jsonName(field)
+		properties[name] = typeSchema(field.Type)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	schema := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func typeSchema(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return object{"type": "integer"}
+	case reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Slice:
+		return object{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return object{"type": "string", "format": "date-time"}
+		}
+		return ref("#/components/schemas/" + t.Name())
+	}
+	panic(fmt.Sprintf("openapigen: unsupported type %s", t))
+}
+
+// queryParameters описывает GET-параметры по полям тела запроса. Списки простых значений в урле идут
+// через запятую (ids=1,2,3), список ключей сортировки - повторяющимся параметром sort=Age:1&sort=Name:-1
+func queryParameters(t reflect.Type) []object {
+	var params []object
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		schema := typeSchema(field.Type)
+		if schema["$ref"] != nil {
+			continue
+		}
+		name, _ := jsonName(field)
+		param := object{
+			"name":   name,
+			"in":     "query",
+			"schema": schema,
+		}
+		if field.Type.Kind() == reflect.Slice {
+			param["explode"] = false
+			if field.Type.Elem().Kind() == reflect.Struct {
+				param["schema"] = object{"type": "array", "items": object{"type": "string", "example": "Age:1"}}
+				param["explode"] = true
+			}
+		}
+		params = append(params, param)
+	}
+	return params
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSpecIsUpToDate(t *testing.T) {
+	spec, err := generate()
+	if err != nil {
+		t.Fatalf("cant generate spec: %s", err)
+	}
+	committed, err := os.ReadFile("../../openapi.json")
+	if err != nil {
+		t.Fatalf("cant read committed spec: %s", err)
+	}
+	if !bytes.Equal(spec, committed) {
+		t.Error("openapi.json is out of date, run go generate ./pkg/searchclient")
+	}
+}
+
+func TestSpecSearchParameters(t *testing.T) {
+	data, err := generate()
+	if err != nil {
+		t.Fatalf("cant generate spec: %s", err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name    string `json:"name"`
+				Explode *bool  `json:"explode"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("cant decode spec: %s", err)
+	}
+	explode := map[string]bool{}
+	for _, param := range spec.Paths["/"]["get"].Parameters {
+		if param.Explode != nil {
+			explode[param.Name] = *param.Explode
+		}
+	}
+	// списки через запятую, ключи сортировки - повторяющимся параметром
+	expected := map[string]bool{"ids": false, "fields": false, "sort": true}
+	if !reflect.DeepEqual(explode, expected) {
+		t.Errorf("expected list parameters %v, got %v", expected, explode)
+	}
+}
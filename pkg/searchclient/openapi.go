@@ -0,0 +1,12 @@
+package searchclient
+
+import (
+	_ "embed"
+)
+
+//go:generate go run ./internal/openapigen -o openapi.json
+
+// OpenAPISpec - описание API внешней системы в формате OpenAPI 3, генерируется по структурам этого пакета
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
@@ -0,0 +1,95 @@
+package searchclient
+
+import "strings"
+
+// QueryExpr - выражение языка запросов SearchServer, собирается через Term, Name, About, And, Or и Not,
+// а String() даёт строку для SearchRequest.Query, в которой уже расставлены кавычки и скобки:
+//
+//	searchclient.And(searchclient.Term("wolf"), searchclient.Not(searchclient.Name("mayer"))).String()
+//	// wolf AND NOT name:mayer
+type QueryExpr struct {
+	op       string
+	field    string
+	text     string
+	children []QueryExpr
+}
+
+// операторы, как их пишет SearchServer
+const (
+	queryAnd = "AND"
+	queryOr  = "OR"
+	queryNot = "NOT"
+)
+
+// Term - слово или фраза в Name или About. Текст с пробелами уходит фразой в кавычках и ищется целиком
+func Term(text string) QueryExpr {
+	return QueryExpr{text: text}
+}
+
+// Name - слово или фраза только в Name
+func Name(text string) QueryExpr {
+	return QueryExpr{field: "name", text: text}
+}
+
+// About - слово или фраза только в About
+func About(text string) QueryExpr {
+	return QueryExpr{field: "about", text: text}
+}
+
+// And - должны совпасть все выражения. Без выражений - пустой запрос, под который подходят все
+func And(exprs ...QueryExpr) QueryExpr {
+	return joinExprs(queryAnd, exprs)
+}
+
+// Or - должно совпасть хотя бы одно выражение
+func Or(exprs ...QueryExpr) QueryExpr {
+	return joinExprs(queryOr, exprs)
+}
+
+// Not - выражение не должно совпасть
+func Not(expr QueryExpr) QueryExpr {
+	return QueryExpr{op: queryNot, children: []QueryExpr{expr}}
+}
+
+func joinExprs(op string, exprs []QueryExpr) QueryExpr {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return QueryExpr{op: op, children: exprs}
+}
+
+// String - выражение строкой для SearchRequest.Query
+func (e QueryExpr) String() string {
+	switch e.op {
+	case "":
+		prefix := ""
+		if e.field != "" {
+			prefix = e.field + ":"
+		}
+		return prefix + quoteQueryText(e.text)
+	case queryNot:
+		return queryNot + " " + e.children[0].operand()
+	}
+	parts := make([]string, len(e.children))
+	for i, child := range e.children {
+		parts[i] = child.operand()
+	}
+	return strings.Join(parts, " "+e.op+" ")
+}
+
+// operand - выражение как операнд оператора, AND и OR в скобках
+func (e QueryExpr) operand() string {
+	if e.op == queryAnd || e.op == queryOr {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// quoteQueryText оставляет простое слово как есть, а текст с пробелами, кавычками, скобками, двоеточием
+// или совпадающий с оператором берёт в кавычки, экранируя кавычки и обратные слэши
+func quoteQueryText(text string) string {
+	if text != "" && text != queryAnd && text != queryOr && text != queryNot && !strings.ContainsAny(text, " \t\n\r\"\\():") {
+		return text
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
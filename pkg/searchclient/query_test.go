@@ -0,0 +1,59 @@
+package searchclient_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestQueryExpr(t *testing.T) {
+	term := searchclient.Term
+	cases := []struct {
+		Expr     searchclient.QueryExpr
+		Expected string
+	}{
+		{Expr: term("wolf"), Expected: "wolf"},
+		{Expr: term("Boyd Wolf"), Expected: `"Boyd Wolf"`},
+		{Expr: searchclient.Name("Boyd Wolf"), Expected: `name:"Boyd Wolf"`},
+		{Expr: searchclient.And(term("wolf")), Expected: "wolf"},
+		{Expr: searchclient.And(term("wolf"), term("male"), searchclient.Not(term("mayer"))), Expected: "wolf AND male AND NOT mayer"},
+		{Expr: searchclient.And(searchclient.Or(searchclient.Name("boyd"), term("hilda")), searchclient.Not(searchclient.About("nulla cillum"))), Expected: `(name:boyd OR hilda) AND NOT about:"nulla cillum"`},
+		{Expr: searchclient.Not(searchclient.Or(term("a"), term("b"))), Expected: "NOT (a OR b)"},
+		{Expr: searchclient.Or(term(`say "AND"`), term(`back\slash`), term("AND"), term("id:5")), Expected: `"say \"AND\"" OR "back\\slash" OR "AND" OR "id:5"`},
+		{Expr: searchclient.And(), Expected: ""},
+	}
+	for caseNum, testCase := range cases {
+		if got := testCase.Expr.String(); got != testCase.Expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestFindUsersQueryExpr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer ts.Close()
+	c := &searchclient.SearchClient{AccessToken: "valid-token", URL: ts.URL}
+
+	query := searchclient.Or(searchclient.Name("boyd wolf"), searchclient.And(searchclient.Name("hilda"), searchclient.About("nulla")))
+	resp, err := c.FindUsers(searchclient.SearchRequest{Query: query.String(), Limit: 10, OrderField: "Id", OrderBy: searchclient.OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ids := []int{}
+	for _, user := range resp.Users {
+		ids = append(ids, user.Id)
+	}
+	if !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Errorf("expected users [0 1], got %v", ids)
+	}
+
+	_, err = c.FindUsers(searchclient.SearchRequest{Query: "wolf AND (mayer", Limit: 10})
+	var searchErr *searchclient.SearchError
+	if !errors.Is(err, searchclient.ErrBadQuery) || !errors.As(err, &searchErr) || searchErr.Field != "query" {
+		t.Errorf("expected bad query error, got %#v", err)
+	}
+}
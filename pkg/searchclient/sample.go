@@ -0,0 +1,59 @@
+package searchclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SamplePath - ручка случайной выборки пользователей во внешней системе
+const SamplePath = "/sample"
+
+// SampleRequest - сколько случайных пользователей нужно и из каких
+type SampleRequest struct {
+	// размер выборки, 0 - сколько сервер берёт по умолчанию. Больше максимума сервера урезается до него
+	N int
+	// зерно генератора, с тем же зерном по тем же данным выборка повторяется. 0 - случайное,
+	// какое взял сервер, придёт в SampleResponse.Seed
+	Seed int64
+	// фильтр как у AggregateRequest, пустой - все пользователи. Filter.Fields выбирает поля пользователей
+	Filter SearchRequest
+}
+
+// Values возвращает GET-параметры запроса выборки
+func (req SampleRequest) Values() url.Values {
+	params := filterValues(req.Filter)
+	if req.N > 0 {
+		params.Set("n", strconv.Itoa(req.N))
+	}
+	if req.Seed != 0 {
+		params.Set("seed", strconv.FormatInt(req.Seed, 10))
+	}
+	if len(req.Filter.Fields) > 0 {
+		params.Set("fields", strings.Join(req.Filter.Fields, ","))
+	}
+	return params
+}
+
+// SampleResponse - случайные пользователи в случайном порядке, сколько было из кого выбирать и с каким зерном
+type SampleResponse struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+	Seed  int64  `json:"seed"`
+}
+
+// Sample отдаёт случайных пользователей среди подходящих под req.Filter через GET /sample, для выборочных
+// проверок и демо. Выборку можно повторить, передав Seed из ответа. Поля, которые FieldMask внешней системы
+// прячет от токена без pii:read, приходят пустыми, как в поиске
+func (srv *SearchClient) Sample(ctx context.Context, req SampleRequest) (*SampleResponse, error) {
+	if req.N < 0 {
+		return nil, countError(fmt.Errorf("n must not be negative"))
+	}
+	sample := &SampleResponse{}
+	if err := srv.getJSON(ctx, SamplePath, req.Values(), sample, nil); err != nil {
+		return nil, countError(err)
+	}
+	return sample, nil
+}
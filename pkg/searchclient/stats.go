@@ -0,0 +1,96 @@
+package searchclient
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentStatsWindow - за какое последнее время считает GetRecentStats. Окно сдвигается шагами по recentStatsStep
+const RecentStatsWindow = 5 * time.Minute
+
+const recentStatsStep = 10 * time.Second
+
+// recentStats - счётчики всех SearchClient в процессе за RecentStatsWindow, публикуются в expvar как searchclient.recent
+var recentStats = newRollingStats(RecentStatsWindow, recentStatsStep)
+
+// GetRecentStats возвращает счётчики за последние RecentStatsWindow: в отличие от GetStats,
+// по ним видно, что происходит сейчас, а не с запуска процесса
+func GetRecentStats() Stats {
+	return recentStats.snapshot(time.Now())
+}
+
+// countStat увеличивает счётчик name и с запуска процесса, и в окне
+func countStat(name string) {
+	clientStats.Add(name, 1)
+	recentStats.add(time.Now(), name)
+}
+
+// statsBucket - счётчики за один шаг окна, начиная со start
+type statsBucket struct {
+	start time.Time
+	stats Stats
+}
+
+// rollingStats - кольцо корзин по step на окно window. Корзина, до которой кольцо дошло на следующем круге,
+// обнуляется, так что память не растёт, а старые события сами выпадают из окна
+type rollingStats struct {
+	mu      sync.Mutex
+	step    time.Duration
+	buckets []statsBucket
+}
+
+func newRollingStats(window, step time.Duration) *rollingStats {
+	return &rollingStats{step: step, buckets: make([]statsBucket, window/step)}
+}
+
+// bucket - корзина для момента now, оставшаяся с прошлого круга обнуляется. Вызывается под mu
+func (r *rollingStats) bucket(now time.Time) *statsBucket {
+	start := now.Truncate(r.step)
+	b := &r.buckets[int(start.UnixNano()/int64(r.step))%len(r.buckets)]
+	if !b.start.Equal(start) {
+		*b = statsBucket{start: start, stats: Stats{Errors: map[string]int64{}}}
+	}
+	return b
+}
+
+// add учитывает событие name: requests, retries или cache_hits
+func (r *rollingStats) add(now time.Time, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := &r.bucket(now).stats
+	switch name {
+	case "requests":
+		stats.Requests++
+	case "retries":
+		stats.Retries++
+	case "cache_hits":
+		stats.CacheHits++
+	}
+}
+
+// addError учитывает ошибку вида kind, см. errorKind
+func (r *rollingStats) addError(now time.Time, kind string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bucket(now).stats.Errors[kind]++
+}
+
+// snapshot складывает корзины, которые попадают в окно, заканчивающееся в now
+func (r *rollingStats) snapshot(now time.Time) Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	since := now.Truncate(r.step).Add(-r.step * time.Duration(len(r.buckets)-1))
+	sum := Stats{Errors: map[string]int64{}}
+	for _, b := range r.buckets {
+		if b.start.Before(since) || b.start.After(now) {
+			continue
+		}
+		sum.Requests += b.stats.Requests
+		sum.Retries += b.stats.Retries
+		sum.CacheHits += b.stats.CacheHits
+		for kind, count := range b.stats.Errors {
+			sum.Errors[kind] += count
+		}
+	}
+	return sum
+}
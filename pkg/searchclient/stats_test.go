@@ -0,0 +1,49 @@
+package searchclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollingStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := newRollingStats(time.Minute, 10*time.Second)
+	stats.add(start, "requests")
+	stats.add(start.Add(5*time.Second), "requests")
+	stats.addError(start.Add(5*time.Second), "network")
+	stats.add(start.Add(30*time.Second), "retries")
+	stats.add(start.Add(55*time.Second), "cache_hits")
+
+	cases := []struct {
+		now      time.Time
+		expected Stats
+	}{
+		{
+			now:      start.Add(59 * time.Second),
+			expected: Stats{Requests: 2, Retries: 1, CacheHits: 1, Errors: map[string]int64{"network": 1}},
+		},
+		{
+			// первая корзина вышла из окна
+			now:      start.Add(70 * time.Second),
+			expected: Stats{Retries: 1, CacheHits: 1, Errors: map[string]int64{}},
+		},
+		{
+			now:      start.Add(2 * time.Minute),
+			expected: Stats{Errors: map[string]int64{}},
+		},
+	}
+	for caseNum, item := range cases {
+		got := stats.snapshot(item.now)
+		if got.Requests != item.expected.Requests || got.Retries != item.expected.Retries ||
+			got.CacheHits != item.expected.CacheHits || len(got.Errors) != len(item.expected.Errors) ||
+			got.Errors["network"] != item.expected.Errors["network"] {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, item.expected, got)
+		}
+	}
+
+	// корзина с прошлого круга обнуляется, а не копит счётчики дальше
+	stats.add(start.Add(time.Minute), "requests")
+	if got := stats.snapshot(start.Add(time.Minute)); got.Requests != 1 || got.Retries != 1 {
+		t.Errorf("expected reused bucket to be reset, got %+v", got)
+	}
+}
@@ -0,0 +1,41 @@
+package searchclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// SuggestPath - ручка подсказок имён во внешней системе
+const SuggestPath = "/suggest"
+
+// Suggestion - имя для подсказки при вводе и сколько пользователей с таким именем
+type Suggestion struct {
+	Name  string `json:"Name"`
+	Count int    `json:"Count"`
+}
+
+// Suggest - подсказки для поля ввода через GET /suggest: до limit имён, у которых какое-то слово начинается
+// с prefix, сначала самые частые. limit <= 0 - сколько сервер отдаёт по умолчанию.
+// Токену без pii:read внешняя система может отказать, если прячет от него имена, а внешняя система
+// без датасета в памяти отвечает ошибкой с ErrNotFound
+func (srv *SearchClient) Suggest(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	if prefix == "" {
+		return nil, countError(fmt.Errorf("prefix must not be empty"))
+	}
+	params := url.Values{"prefix": {prefix}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var suggestions []Suggestion
+	// подсказки есть только у датасета в памяти
+	notAvailable := func(requestID string) error {
+		return &SearchError{StatusCode: http.StatusNotFound, Code: CodeNotFound, Message: "suggest is not available", RequestID: requestID}
+	}
+	if err := srv.getJSON(ctx, SuggestPath, params, &suggestions, notAvailable); err != nil {
+		return nil, countError(err)
+	}
+	return suggestions, nil
+}
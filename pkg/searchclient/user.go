@@ -0,0 +1,170 @@
+package searchclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NotFoundError - во внешней системе нет пользователя с таким Id или Guid. errors.Is(err, ErrNotFound) для неё тоже срабатывает
+type NotFoundError struct {
+	Id int
+	// Guid, если искали по нему, тогда Id не заполнен
+	Guid string
+	// id запроса в логах SearchServer, если он его прислал
+	RequestID string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Guid != "" {
+		return fmt.Sprintf("user with guid %s not found", e.Guid)
+	}
+	return fmt.Sprintf("user %d not found", e.Id)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// GetUser достаёт одного пользователя по Id через GET /users/{id}, без поиска и фильтрации на своей стороне.
+// Если такого пользователя нет - *NotFoundError
+func (srv *SearchClient) GetUser(ctx context.Context, id int) (*User, error) {
+	user, err := srv.getUser(ctx, UsersPath+strconv.Itoa(id), &NotFoundError{Id: id})
+	return user, countError(err)
+}
+
+// GetUserByGuid - GetUser по Guid через GET /users/guid/{guid}: Guid из датасета, в отличие от Id,
+// не меняется между выгрузками, поэтому хранить у себя лучше его. Если такого пользователя нет - *NotFoundError
+func (srv *SearchClient) GetUserByGuid(ctx context.Context, guid string) (*User, error) {
+	switch guid {
+	case "":
+		return nil, fmt.Errorf("guid must not be empty")
+	case ".", "..":
+		// точки экранировать нечем, а по пути они уводят на другую ручку
+		return nil, fmt.Errorf("invalid guid %q", guid)
+	}
+	user, err := srv.getUser(ctx, UsersGuidPath+url.PathEscape(guid), &NotFoundError{Guid: guid})
+	return user, countError(err)
+}
+
+// getUser запрашивает ручку path, на 404 отдаёт notFound с id запроса
+func (srv *SearchClient) getUser(ctx context.Context, path string, notFound *NotFoundError) (*User, error) {
+	user := &User{}
+	err := srv.getJSON(ctx, path, nil, user, func(requestID string) error {
+		notFound.RequestID = requestID
+		return notFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ручки одного пользователя во внешней системе: UsersPath+Id и UsersGuidPath+Guid
+const (
+	UsersPath     = "/users/"
+	UsersGuidPath = UsersPath + "guid/"
+)
+
+// endpointURL - урл ручки path с учётом версии API, к параметрам, которые уже есть в URL, добавляются params.
+// path уже экранирован: значения из него не должны менять, в какую ручку уходит запрос
+func (srv *SearchClient) endpointURL(path string, params url.Values) (string, error) {
+	endpointURL, err := url.Parse(srv.URL)
+	if err != nil {
+		return "", fmt.Errorf("cant create request: %s", err)
+	}
+	switch srv.APIVersion {
+	case "":
+	case APIVersion1, APIVersion2:
+		endpointURL.Path = strings.TrimSuffix(endpointURL.Path, "/") + "/" + srv.APIVersion
+	default:
+		return "", fmt.Errorf("unsupported api version %q", srv.APIVersion)
+	}
+	rawPath := strings.TrimSuffix(endpointURL.EscapedPath(), "/") + path
+	if endpointURL.Path, err = url.PathUnescape(rawPath); err != nil {
+		return "", fmt.Errorf("cant create request: %s", err)
+	}
+	endpointURL.RawPath = rawPath
+	if len(params) > 0 {
+		query := endpointURL.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		endpointURL.RawQuery = encodeQuery(query)
+	}
+	return endpointURL.String(), nil
+}
+
+// getJSON - GET ручки path с params и таймаутом CallTimeout, ответ разбирается в out. Если notFound задан,
+// 404 отдаётся его ошибкой, в него передаётся id запроса из тела ответа
+func (srv *SearchClient) getJSON(ctx context.Context, path string, params url.Values, out interface{}, notFound func(requestID string) error) error {
+	if srv.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.CallTimeout)
+		defer cancel()
+	}
+	endpointURL, err := srv.endpointURL(path, params)
+	if err != nil {
+		return err
+	}
+	// в TimeoutError - параметры запроса, а у ручек без параметров - сама ручка
+	name := encodeQuery(params)
+	if name == "" {
+		name = path
+	}
+	resp, body, err := srv.get(ctx, endpointURL, name)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound && notFound != nil {
+		var requestID string
+		if errResp, _, err := decodeErrorResponse(resp, body); err == nil {
+			requestID = errResp.Error.RequestID
+		}
+		return notFound(requestID)
+	}
+	if err := responseError(resp, body, ""); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("cant unpack result json: %s", err)
+	}
+	return nil
+}
+
+// get - GET по урлу ручки с заголовками клиента, на 401 один раз повторяется с новым токеном.
+// Ответ с ошибкой не разбирается, name - что запрашивали, для TimeoutError
+func (srv *SearchClient) get(ctx context.Context, endpointURL, name string) (*http.Response, []byte, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", endpointURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cant create request: %s", err)
+		}
+		srv.setHeaders(req)
+		return req, nil
+	}
+	stale := srv.Token()
+	req, err := newRequest()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, body, err := srv.do(ctx, req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && srv.refreshToken(stale) {
+		countStat("retries")
+		if req, err = newRequest(); err != nil {
+			return nil, nil, err
+		}
+		resp, body, err = srv.do(ctx, req)
+	}
+	if err != nil {
+		if phase := timeoutPhase(ctx, err); phase != "" {
+			return nil, nil, &TimeoutError{Phase: phase, Params: name, Err: err}
+		}
+		return nil, nil, fmt.Errorf("unknown error %w", err)
+	}
+	return resp, body, nil
+}
@@ -0,0 +1,143 @@
+package searchserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader - заголовок с id запроса. Пришедший от клиента или прокси id сохраняется,
+// иначе AccessLog заводит новый; в ответе id есть всегда
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen - более длинный id от клиента заменяется своим, чтобы не раздувать логи
+const maxRequestIDLen = 128
+
+// redactedParams - параметры, значения которых в лог не попадают
+var redactedParams = map[string]bool{
+	"token": true, "accesstoken": true, "access_token": true, "api_key": true, "apikey": true,
+	"key": true, "password": true, "secret": true, "jwt": true,
+}
+
+// AccessLog пишет в Logger по структурной записи на каждый запрос: метод, путь, параметры
+// без секретов, код ответа, время, сколько пользователей отдано, имя клиента и id запроса
+type AccessLog struct {
+	Handler http.Handler
+	// пустой - slog.Default()
+	Logger *slog.Logger
+}
+
+// accessEntry - то, что о запросе может рассказать только обработчик
+type accessEntry struct {
+	requestID string
+	// имя клиента по токену, пустое - токен не проверялся или подходит любой
+	client string
+	// сколько пользователей на странице и всего, results < 0 - поиска не было
+	results int
+	total   int
+	// параметры, которые сервер не понял и проигнорировал
+	unknownParams []string
+}
+
+type accessEntryKey struct{}
+
+// RequestID - id запроса, которому принадлежит ctx, пустой - запрос пришёл не через AccessLog
+func RequestID(ctx context.Context) string {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		return entry.requestID
+	}
+	return ""
+}
+
+// noteClient сообщает AccessLog, чей токен прислан
+func noteClient(ctx context.Context, client string) {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.client = client
+	}
+}
+
+// noteUnknownParams сообщает AccessLog, какие параметры сервер проигнорировал
+func noteUnknownParams(ctx context.Context, names []string) {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.unknownParams = names
+	}
+}
+
+// noteResults сообщает AccessLog, сколько пользователей отдано в ответе
+func noteResults(ctx context.Context, results, total int) {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.results, entry.total = results, total
+	}
+}
+
+func (a *AccessLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	entry := &accessEntry{requestID: r.Header.Get(RequestIDHeader), results: -1}
+	if entry.requestID == "" || len(entry.requestID) > maxRequestIDLen || !printable(entry.requestID) {
+		entry.requestID = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, entry.requestID)
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	a.Handler.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+	logger := a.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	if recorder.status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String("request_id", entry.requestID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("query", redactQuery(r.URL.Query())),
+		slog.Int("status", recorder.status),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int64("bytes", recorder.bytes),
+		slog.String("remote", r.RemoteAddr),
+	}
+	if entry.client != "" {
+		attrs = append(attrs, slog.String("client", entry.client))
+	}
+	if entry.results >= 0 {
+		attrs = append(attrs, slog.Int("results", entry.results), slog.Int("total", entry.total))
+	}
+	if len(entry.unknownParams) > 0 {
+		attrs = append(attrs, slog.String("unknown_params", strings.Join(entry.unknownParams, ",")))
+		level = max(level, slog.LevelWarn)
+	}
+	logger.LogAttrs(r.Context(), level, "request", attrs...)
+}
+
+// redactQuery - параметры запроса для лога, значения секретных заменены на REDACTED
+func redactQuery(params url.Values) string {
+	for key := range params {
+		if redactedParams[strings.ToLower(key)] {
+			params[key] = []string{"REDACTED"}
+		}
+	}
+	return params.Encode()
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// printable - в строке только видимые ASCII-символы, такой id не сломает ни лог, ни заголовок
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
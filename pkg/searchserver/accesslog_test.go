@@ -0,0 +1,95 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	handler := &AccessLog{
+		Handler: &Server{DatasetPath: datasetPath},
+		Logger:  slog.New(slog.NewJSONHandler(&out, nil)),
+	}
+	cases := []struct {
+		Target          string
+		RequestID       string
+		ExpectedStatus  int
+		ExpectedQuery   string
+		ExpectedResults interface{}
+		ExpectedLevel   string
+		ExpectedUnknown interface{}
+	}{
+		{Target: "/?query=boyd&order_by=-1&limit=1", RequestID: "req-1", ExpectedStatus: http.StatusOK,
+			ExpectedQuery: "limit=1&order_by=-1&query=boyd", ExpectedResults: 1.0, ExpectedLevel: "INFO"},
+		// токен в параметрах сервер не понимает - это видно в логе, но сам токен нет
+		{Target: "/?query=boyd&order_by=-1&limit=1&token=secret&ordr_by=1", ExpectedStatus: http.StatusOK,
+			ExpectedQuery: "limit=1&order_by=-1&ordr_by=1&query=boyd&token=REDACTED", ExpectedResults: 1.0, ExpectedLevel: "WARN", ExpectedUnknown: "ordr_by,token"},
+		{Target: "/?order_field=About", ExpectedStatus: http.StatusBadRequest,
+			ExpectedQuery: "order_field=About", ExpectedLevel: "INFO"},
+		// id с пробелами и переводами строк заменяется своим
+		{Target: "/healthz", RequestID: "bad id", ExpectedStatus: http.StatusOK, ExpectedLevel: "INFO"},
+	}
+	for caseNum, testCase := range cases {
+		out.Reset()
+		req := authorizedRequest(testCase.Target)
+		if testCase.RequestID != "" {
+			req.Header.Set(RequestIDHeader, testCase.RequestID)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Errorf("[%d] cant decode log record %q: %s", caseNum, out.String(), err)
+			continue
+		}
+		requestID := rec.Header().Get(RequestIDHeader)
+		if testCase.RequestID == "req-1" && requestID != "req-1" {
+			t.Errorf("[%d] expected request id to be kept, got %q", caseNum, requestID)
+		}
+		if testCase.RequestID != "req-1" && (len(requestID) != 32 || strings.Contains(requestID, " ")) {
+			t.Errorf("[%d] expected generated request id, got %q", caseNum, requestID)
+		}
+		if record["request_id"] != requestID {
+			t.Errorf("[%d] expected logged request id %q, got %v", caseNum, requestID, record["request_id"])
+		}
+		if record["status"] != float64(testCase.ExpectedStatus) || record["method"] != http.MethodGet || record["level"] != testCase.ExpectedLevel {
+			t.Errorf("[%d] unexpected record %v", caseNum, record)
+		}
+		if record["query"] != testCase.ExpectedQuery {
+			t.Errorf("[%d] expected query %q, got %v", caseNum, testCase.ExpectedQuery, record["query"])
+		}
+		if record["results"] != testCase.ExpectedResults {
+			t.Errorf("[%d] expected results %v, got %v", caseNum, testCase.ExpectedResults, record["results"])
+		}
+		if record["unknown_params"] != testCase.ExpectedUnknown {
+			t.Errorf("[%d] expected unknown params %v, got %v", caseNum, testCase.ExpectedUnknown, record["unknown_params"])
+		}
+		if _, ok := record["duration"]; !ok {
+			t.Errorf("[%d] expected duration in record %v", caseNum, record)
+		}
+	}
+}
+
+func TestAccessLogServerError(t *testing.T) {
+	var out bytes.Buffer
+	handler := &AccessLog{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if RequestID(r.Context()) == "" {
+				t.Error("expected request id in handler context")
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+		Logger: slog.New(slog.NewJSONHandler(&out, nil)),
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(out.String(), `"level":"ERROR"`) {
+		t.Errorf("expected error level for 500, got %s", out.String())
+	}
+}
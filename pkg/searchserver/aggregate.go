@@ -0,0 +1,207 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// DefaultAgeInterval - ширина корзины гистограммы возраста без age_interval
+const DefaultAgeInterval = 10
+
+// Aggregator - хранилище, которое считает агрегаты на своей стороне, не отдавая всех найденных.
+// Остальные хранилища отдают серверу всех найденных, и он считает сам
+type Aggregator interface {
+	Aggregate(ctx context.Context, query Query, ageInterval int) (searchclient.Aggregations, error)
+}
+
+// aggregation копит агрегаты по записям по одной
+type aggregation struct {
+	interval int
+	total    int
+	byGender map[string]int
+	ages     map[int]int
+	min, max int
+	sum      int
+}
+
+func newAggregation(ageInterval int) *aggregation {
+	return &aggregation{
+		interval: ageInterval,
+		byGender: map[string]int{searchclient.GenderMale: 0, searchclient.GenderFemale: 0},
+		ages:     map[int]int{},
+	}
+}
+
+func (a *aggregation) add(item *Item) {
+	if a.total == 0 || item.Age < a.min {
+		a.min = item.Age
+	}
+	if a.total == 0 || item.Age > a.max {
+		a.max = item.Age
+	}
+	a.total++
+	a.sum += item.Age
+	a.byGender[genderKey(item.Gender)]++
+	a.ages[ageBucket(item.Age, a.interval)]++
+}
+
+// genderKey - ключ byGender, не ссылающийся на строки записи. Присваивание по ключу-строке подменяет
+// в карте и сам ключ, а строки отображённого снимка живут, только пока жив файл, карта же уходит в ответ
+func genderKey(gender string) string {
+	switch gender {
+	case searchclient.GenderMale:
+		return searchclient.GenderMale
+	case searchclient.GenderFemale:
+		return searchclient.GenderFemale
+	}
+	return strings.Clone(gender)
+}
+
+func (a *aggregation) result() searchclient.Aggregations {
+	aggs := searchclient.Aggregations{Total: a.total, ByGender: a.byGender, AgeHistogram: []searchclient.AgeBucket{}}
+	if a.total == 0 {
+		return aggs
+	}
+	for from := ageBucket(a.min, a.interval); from <= a.max; from += a.interval {
+		aggs.AgeHistogram = append(aggs.AgeHistogram, searchclient.AgeBucket{From: from, To: from + a.interval, Count: a.ages[from]})
+	}
+	aggs.Age = &searchclient.AgeStats{Min: a.min, Max: a.max, Avg: float64(a.sum) / float64(a.total)}
+	return aggs
+}
+
+// ageBucket - начало корзины гистограммы, в которую попадает возраст
+func ageBucket(age, interval int) int {
+	return age - age%interval
+}
+
+// ParseAgeInterval разбирает age_interval, пустой - DefaultAgeInterval
+func ParseAgeInterval(value string) (int, error) {
+	if value == "" {
+		return DefaultAgeInterval, nil
+	}
+	interval, err := strconv.Atoi(value)
+	if err != nil || interval <= 0 {
+		return 0, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid age_interval: %s, expected positive number", value), Field: "age_interval"}
+	}
+	return interval, nil
+}
+
+// ParseFacets разбирает facets и age_interval поиска: 0 - без фасетов, иначе ширина корзины гистограммы возраста
+func ParseFacets(params url.Values) (int, error) {
+	value := params.Get("facets")
+	if value == "" {
+		return 0, nil
+	}
+	facets, err := strconv.ParseBool(value)
+	if err != nil {
+		return 0, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid facets: %s, expected true or false", value), Field: "facets"}
+	}
+	if !facets {
+		return 0, nil
+	}
+	return ParseAgeInterval(params.Get("age_interval"))
+}
+
+// Aggregate считает агрегаты по найденным записям текущего снимка, записи при этом не копируются
+func (m *MemoryStorage) Aggregate(ctx context.Context, query Query, ageInterval int) (searchclient.Aggregations, error) {
+	snapshot, base, err := m.view(query)
+	if err != nil {
+		return searchclient.Aggregations{}, err
+	}
+	defer runtime.KeepAlive(base)
+	// порядок агрегатам не важен
+	query.Sort = nil
+	positions, err := snapshot.sorted(ctx, query, m.Workers, nil, nil)
+	if err != nil {
+		return searchclient.Aggregations{}, err
+	}
+	aggs := newAggregation(ageInterval)
+	for _, pos := range positions {
+		aggs.add(&snapshot.rows[pos])
+	}
+	return aggs.result(), nil
+}
+
+// aggregate считает агрегаты через Aggregator хранилища, а если его нет - по всем найденным записям
+func (s *Server) aggregate(ctx context.Context, query Query, ageInterval int) (searchclient.Aggregations, error) {
+	query.Sort, query.Offset, query.Limit = nil, 0, -1
+	var storage Storage = s.Storage
+	if storage == nil {
+		if _, err := s.loadDataset(); err != nil {
+			return searchclient.Aggregations{}, err
+		}
+		storage = &MemoryStorage{Store: &s.store, Workers: s.SearchWorkers, Analyzer: s.Analyzer}
+	}
+	if aggregator, ok := storage.(Aggregator); ok {
+		return aggregator.Aggregate(ctx, query, ageInterval)
+	}
+	page, err := storage.Search(ctx, query)
+	if err != nil {
+		return searchclient.Aggregations{}, err
+	}
+	if len(page.Users) < page.Total {
+		return searchclient.Aggregations{}, &ServerError{
+			Code:    searchclient.CodeBadQuery,
+			Message: fmt.Sprintf("storage returned %d of %d users, narrow the filter to aggregate", len(page.Users), page.Total),
+		}
+	}
+	aggs := newAggregation(ageInterval)
+	for i := range page.Users {
+		aggs.add(&page.Users[i])
+	}
+	return aggs.result(), nil
+}
+
+// serveAggregate - GET /aggregate?gender=male&age_interval=5: число по полу, гистограмма и min/max/avg возраста
+// по всем записям, которые нашёл бы поиск с теми же query и фильтрами
+func (s *Server) serveAggregate(w http.ResponseWriter, r *http.Request, mask FieldMask) {
+	// по агрегатам над одним Id спрятанное поле легко узнать
+	if mask["Age"] != "" || mask["Gender"] != "" {
+		JSONError(w, r, "token has no "+ScopePIIRead+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+		return
+	}
+	params := r.URL.Query()
+	query, err := ParseQuery(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	query.Synonyms = s.Synonyms
+	ageInterval, err := ParseAgeInterval(params.Get("age_interval"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	aggs, err := s.aggregate(ctx, query, ageInterval)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			JSONError(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "search timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	noteResults(r.Context(), 0, aggs.Total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aggs)
+}
@@ -0,0 +1,312 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestAggregation(t *testing.T) {
+	aggs := newAggregation(10)
+	for _, item := range []Item{
+		{Age: 21, Gender: "male"},
+		{Age: 29, Gender: "female"},
+		{Age: 45, Gender: "male"},
+		{Age: 40, Gender: "male"},
+	} {
+		aggs.add(&item)
+	}
+	expected := searchclient.Aggregations{
+		Total:    4,
+		ByGender: map[string]int{"male": 3, "female": 1},
+		AgeHistogram: []searchclient.AgeBucket{
+			{From: 20, To: 30, Count: 2},
+			{From: 30, To: 40, Count: 0},
+			{From: 40, To: 50, Count: 2},
+		},
+		Age: &searchclient.AgeStats{Min: 21, Max: 45, Avg: 33.75},
+	}
+	if got := aggs.result(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	empty := searchclient.Aggregations{ByGender: map[string]int{"male": 0, "female": 0}, AgeHistogram: []searchclient.AgeBucket{}}
+	if got := newAggregation(5).result(); !reflect.DeepEqual(got, empty) {
+		t.Errorf("expected %+v, got %+v", empty, got)
+	}
+}
+
+// агрегаты отображённого снимка переживают его: ключи ByGender не ссылаются на файл
+func TestMemoryAggregateMapped(t *testing.T) {
+	root, path := writeBinary(t)
+	var store Store
+	if _, err := store.SwapMapped(path, IndexWords); err != nil {
+		t.Fatal(err)
+	}
+	aggs, err := (&MemoryStorage{Store: &store}).Aggregate(context.Background(), Query{Limit: -1}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain Store
+	plain.Swap(root)
+	expected, err := (&MemoryStorage{Store: &plain}).Aggregate(context.Background(), Query{Limit: -1}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Swap(root)
+	runtime.GC()
+	runtime.GC()
+	if !reflect.DeepEqual(aggs, expected) {
+		t.Errorf("expected %+v after unmapping, got %+v", expected, aggs)
+	}
+}
+
+func TestParseAgeInterval(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected int
+		IsError  bool
+	}{
+		{Value: "", Expected: DefaultAgeInterval},
+		{Value: "5", Expected: 5},
+		{Value: "0", IsError: true},
+		{Value: "-3", IsError: true},
+		{Value: "ten", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		interval, err := ParseAgeInterval(testCase.Value)
+		if testCase.IsError != (err != nil) || interval != testCase.Expected {
+			t.Errorf("[%d] expected %d (error %v), got %d %v", caseNum, testCase.Expected, testCase.IsError, interval, err)
+		}
+	}
+}
+
+func TestServerAggregate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Boyd</first_name><last_name>Wolf</last_name><age>22</age><gender>male</gender><about>Nulla cillum</about></row>
+		<row><id>2</id><first_name>Hilda</first_name><last_name>Mayer</last_name><age>21</age><gender>female</gender><about>Sit commodo</about></row>
+		<row><id>3</id><first_name>Brooks</first_name><last_name>Aguilar</last_name><age>34</age><gender>male</gender><about>Nulla magna</about></row>
+		<row><id>4</id><first_name>Beth</first_name><last_name>Wynn</last_name><age>31</age><gender>female</gender><about>Proident</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		DatasetPath: path,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"Age": MaskHide},
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Expected searchclient.Aggregations
+	}{
+		{
+			Target: "/aggregate",
+			Token:  "s-secret",
+			Status: http.StatusOK,
+			Expected: searchclient.Aggregations{
+				Total:        4,
+				ByGender:     map[string]int{"male": 2, "female": 2},
+				AgeHistogram: []searchclient.AgeBucket{{From: 20, To: 30, Count: 2}, {From: 30, To: 40, Count: 2}},
+				Age:          &searchclient.AgeStats{Min: 21, Max: 34, Avg: 27},
+			},
+		},
+		{
+			Target: "/v2/aggregate?query=nulla&age_interval=5",
+			Token:  "s-secret",
+			Status: http.StatusOK,
+			Expected: searchclient.Aggregations{
+				Total:        2,
+				ByGender:     map[string]int{"male": 2, "female": 0},
+				AgeHistogram: []searchclient.AgeBucket{{From: 20, To: 25, Count: 1}, {From: 25, To: 30, Count: 0}, {From: 30, To: 35, Count: 1}},
+				Age:          &searchclient.AgeStats{Min: 22, Max: 34, Avg: 28},
+			},
+		},
+		{
+			// страницы и сортировка на агрегаты не влияют
+			Target: "/aggregate?gender=female&age_min=25&limit=1&offset=1&order_field=Age",
+			Token:  "s-secret",
+			Status: http.StatusOK,
+			Expected: searchclient.Aggregations{
+				Total:        1,
+				ByGender:     map[string]int{"male": 0, "female": 1},
+				AgeHistogram: []searchclient.AgeBucket{{From: 30, To: 40, Count: 1}},
+				Age:          &searchclient.AgeStats{Min: 31, Max: 31, Avg: 31},
+			},
+		},
+		{
+			Target:   "/aggregate?query=nothing",
+			Token:    "s-secret",
+			Status:   http.StatusOK,
+			Expected: searchclient.Aggregations{ByGender: map[string]int{"male": 0, "female": 0}, AgeHistogram: []searchclient.AgeBucket{}},
+		},
+		{Target: "/aggregate?age_interval=0", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/aggregate?gender=other", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/aggregate?query=nulla%20AND", Token: "s-secret", Status: http.StatusBadRequest},
+		// возраст спрятан от токена без pii:read, по агрегатам его не узнать
+		{Target: "/aggregate?ids=1", Token: "r-secret", Status: http.StatusForbidden},
+		{Target: "/aggregate", Token: "bad", Status: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status != http.StatusOK {
+			continue
+		}
+		var aggs searchclient.Aggregations
+		if err := json.Unmarshal(rec.Body.Bytes(), &aggs); err != nil {
+			t.Fatalf("[%d] cant decode aggregations: %s", caseNum, err)
+		}
+		if !reflect.DeepEqual(aggs, testCase.Expected) {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, testCase.Expected, aggs)
+		}
+	}
+}
+
+func TestSQLiteAggregateMatchesMemory(t *testing.T) {
+	memory := &Server{DatasetPath: datasetPath}
+	backend := &Server{Storage: newSQLiteStorage(t)}
+	for caseNum, target := range []string{
+		"/aggregate",
+		"/aggregate?query=nulla&age_interval=3",
+		"/aggregate?gender=male&age_min=30",
+		"/aggregate?ids=1,5,9",
+	} {
+		expected, got := httptest.NewRecorder(), httptest.NewRecorder()
+		memory.ServeHTTP(expected, authorizedRequest(target))
+		backend.ServeHTTP(got, authorizedRequest(target))
+		if expected.Code != http.StatusOK || got.Body.String() != expected.Body.String() {
+			t.Errorf("[%d] %s: expected %s, got %d %s", caseNum, target, expected.Body, got.Code, got.Body)
+		}
+	}
+}
+
+// truncatedStorage отдаёт одну запись из многих, как Elasticsearch за пределами окна
+type truncatedStorage struct{}
+
+func (truncatedStorage) Search(ctx context.Context, query Query) (Page, error) {
+	return Page{Users: []Item{{Id: 1, Age: 20}}, Total: 20000}, nil
+}
+
+func TestServerAggregateTruncated(t *testing.T) {
+	s := &Server{Storage: truncatedStorage{}}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/aggregate"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for partial results, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestElasticsearchAggregate(t *testing.T) {
+	var gotBody string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Write([]byte(`{"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},"aggregations":{
+			"gender":{"buckets":[{"key":"male","doc_count":2},{"key":"female","doc_count":1}]},
+			"age_histogram":{"buckets":[{"key":20.0,"doc_count":2},{"key":30.0,"doc_count":0},{"key":40.0,"doc_count":1}]},
+			"age":{"count":3,"min":21.0,"max":40.0,"avg":27.666666666666668}
+		}}`))
+	}))
+	defer es.Close()
+
+	storage := &ElasticsearchStorage{URL: es.URL, Index: "users"}
+	aggs, err := storage.Aggregate(context.Background(), Query{Query: "wolf", Limit: -1}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := searchclient.Aggregations{
+		Total:        3,
+		ByGender:     map[string]int{"male": 2, "female": 1},
+		AgeHistogram: []searchclient.AgeBucket{{From: 20, To: 30, Count: 2}, {From: 30, To: 40, Count: 0}, {From: 40, To: 50, Count: 1}},
+		Age:          &searchclient.AgeStats{Min: 21, Max: 40, Avg: 27.666666666666668},
+	}
+	if !reflect.DeepEqual(aggs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, aggs)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(gotBody), &body); err != nil || body["size"] != 0.0 || body["aggs"] == nil || body["sort"] != nil {
+		t.Errorf("unexpected request body %s", gotBody)
+	}
+}
+
+func TestServerFacets(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"Gender": MaskRedact},
+	}
+	cases := []struct {
+		Target string
+		Token  string
+		Status int
+		Facets bool
+	}{
+		{Target: "/v2/?query=nulla&limit=2&facets=true", Token: "s-secret", Status: http.StatusOK, Facets: true},
+		{Target: "/v2/?gender=male&facets=1&age_interval=5&fields=Id", Token: "s-secret", Status: http.StatusOK, Facets: true},
+		{Target: "/v2/?query=nulla&facets=false", Token: "s-secret", Status: http.StatusOK},
+		{Target: "/v2/?query=nulla", Token: "s-secret", Status: http.StatusOK},
+		{Target: "/v2/?facets=maybe", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/v2/?facets=true&age_interval=0", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/?facets=true", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/v2/?facets=true", Token: "r-secret", Status: http.StatusForbidden},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status != http.StatusOK {
+			continue
+		}
+		var resp searchclient.SearchResponseV2
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("[%d] cant decode response: %s", caseNum, err)
+		}
+		if !testCase.Facets {
+			if resp.Facets != nil {
+				t.Errorf("[%d] expected no facets, got %+v", caseNum, resp.Facets)
+			}
+			continue
+		}
+		// фасеты считаются по всем найденным, а не по странице, и совпадают с /aggregate
+		target := strings.Replace(strings.Replace(testCase.Target, "/v2/?", "/aggregate?", 1), "facets=", "ignored=", 1)
+		aggReq := httptest.NewRequest(http.MethodGet, target, nil)
+		aggReq.Header.Set("AccessToken", testCase.Token)
+		aggRec := httptest.NewRecorder()
+		s.ServeHTTP(aggRec, aggReq)
+		var expected searchclient.Aggregations
+		if err := json.Unmarshal(aggRec.Body.Bytes(), &expected); err != nil {
+			t.Fatalf("[%d] cant decode aggregations %s: %s", caseNum, aggRec.Body, err)
+		}
+		if resp.Facets == nil || !reflect.DeepEqual(*resp.Facets, expected) || resp.Facets.Total != resp.Total {
+			t.Errorf("[%d] expected facets %+v of %d users, got %+v", caseNum, expected, resp.Total, resp.Facets)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package searchserver
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hw4/pkg/searchclient"
+)
+
+// AnalyticsPath - ручка аналитики поиска, только для ScopeAdmin
+const AnalyticsPath = "/admin/analytics"
+
+// DefaultAnalyticsSize - сколько разных строк поиска помнит Analytics, если Size не задан
+const DefaultAnalyticsSize = 10000
+
+// сколько строк отдавать в каждом списке /admin/analytics: если limit не задан и самое большое
+const (
+	DefaultAnalyticsLimit = 20
+	MaxAnalyticsLimit     = 1000
+)
+
+// Analytics считает в памяти, что ищут и по чему ничего не находится. Строки поиска сравниваются без учёта
+// регистра и лишних пробелов. С Path счётчики переживают перезапуск: Load читает их при старте, Save сохраняет
+type Analytics struct {
+	// сколько разных строк поиска помнить, 0 - DefaultAnalyticsSize. Когда места нет, вытесняется самая редкая
+	Size int
+	// файл для Save и Load, пустой - только в памяти
+	Path string
+
+	mu    sync.Mutex
+	state analyticsState
+	// строка поиска после normalizeQuery -> её счётчики
+	queries map[string]*analyticsEntry
+	// те же счётчики кучей, на вершине - кандидат на вытеснение
+	rarest analyticsHeap
+}
+
+// analyticsEntry - счётчики строки поиска и её место в analyticsHeap
+type analyticsEntry struct {
+	QueryStats
+	index int
+}
+
+// analyticsHeap - куча для container/heap: сверху самая редкая строка, из равных - самая давняя.
+// Счётчики только растут, поэтому после Record строку достаточно опустить через heap.Fix
+type analyticsHeap []*analyticsEntry
+
+func (h analyticsHeap) Len() int { return len(h) }
+
+func (h analyticsHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	return a.Count < b.Count || a.Count == b.Count && a.LastSeen.Before(b.LastSeen)
+}
+
+func (h analyticsHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *analyticsHeap) Push(x any) {
+	entry := x.(*analyticsEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *analyticsHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// analyticsState - счётчики Analytics, как они лежат в файле
+type analyticsState struct {
+	Since              time.Time    `json:"since"`
+	Searches           int          `json:"searches"`
+	ZeroResultSearches int          `json:"zero_result_searches"`
+	Queries            []QueryStats `json:"queries,omitempty"`
+}
+
+// QueryStats - сколько раз искали строку, сколько раз ничего не нашлось и когда искали последний раз
+type QueryStats struct {
+	Query       string    `json:"query"`
+	Count       int       `json:"count"`
+	ZeroResults int       `json:"zero_results"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// AnalyticsResponse - тело ответа /admin/analytics
+type AnalyticsResponse struct {
+	// с какого момента считается, переживает перезапуск вместе с файлом
+	Since time.Time `json:"since"`
+	// сколько было поисков, в том числе только по фильтрам, и сколько из них ничего не нашли
+	Searches           int `json:"searches"`
+	ZeroResultSearches int `json:"zero_result_searches"`
+	// самые частые строки поиска
+	TopQueries []QueryStats `json:"top_queries"`
+	// строки, по которым чаще всего ничего не находилось
+	ZeroResultQueries []QueryStats `json:"zero_result_queries"`
+}
+
+// normalizeQuery - строка поиска без регистра и лишних пробелов, "Nulla  sit" и "nulla sit" - один запрос
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+func (a *Analytics) init() {
+	if a.queries == nil {
+		a.queries = map[string]*analyticsEntry{}
+		a.state.Since = time.Now().UTC()
+	}
+}
+
+// Record учитывает поиск query, который нашёл total пользователей. Поиски без строки поиска
+// попадают только в общие числа
+func (a *Analytics) Record(query string, total int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.init()
+	a.state.Searches++
+	if total == 0 {
+		a.state.ZeroResultSearches++
+	}
+	key := normalizeQuery(query)
+	if key == "" {
+		return
+	}
+	entry, ok := a.queries[key]
+	if !ok {
+		a.evict(a.size() - 1)
+		entry = &analyticsEntry{QueryStats: QueryStats{Query: key}}
+		a.queries[key] = entry
+		heap.Push(&a.rarest, entry)
+	}
+	entry.Count++
+	if total == 0 {
+		entry.ZeroResults++
+	}
+	entry.LastSeen = time.Now().UTC()
+	heap.Fix(&a.rarest, entry.index)
+}
+
+func (a *Analytics) size() int {
+	if a.Size <= 0 {
+		return DefaultAnalyticsSize
+	}
+	return a.Size
+}
+
+// evict вытесняет самые редкие строки, из равных - самые давние, пока их не останется keep
+func (a *Analytics) evict(keep int) {
+	for len(a.rarest) > keep {
+		entry := heap.Pop(&a.rarest).(*analyticsEntry)
+		delete(a.queries, entry.Query)
+	}
+}
+
+// Report - общие числа и по limit самых частых строк поиска и строк без результатов
+func (a *Analytics) Report(limit int) AnalyticsResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.init()
+	resp := AnalyticsResponse{
+		Since:              a.state.Since,
+		Searches:           a.state.Searches,
+		ZeroResultSearches: a.state.ZeroResultSearches,
+		TopQueries:         []QueryStats{},
+		ZeroResultQueries:  []QueryStats{},
+	}
+	for _, entry := range a.queries {
+		resp.TopQueries = append(resp.TopQueries, entry.QueryStats)
+		if entry.ZeroResults > 0 {
+			resp.ZeroResultQueries = append(resp.ZeroResultQueries, entry.QueryStats)
+		}
+	}
+	sort.Slice(resp.TopQueries, func(i, j int) bool {
+		a, b := resp.TopQueries[i], resp.TopQueries[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Query < b.Query
+	})
+	sort.Slice(resp.ZeroResultQueries, func(i, j int) bool {
+		a, b := resp.ZeroResultQueries[i], resp.ZeroResultQueries[j]
+		return a.ZeroResults > b.ZeroResults || a.ZeroResults == b.ZeroResults && a.Query < b.Query
+	})
+	resp.TopQueries = resp.TopQueries[:min(limit, len(resp.TopQueries))]
+	resp.ZeroResultQueries = resp.ZeroResultQueries[:min(limit, len(resp.ZeroResultQueries))]
+	return resp
+}
+
+// Load читает счётчики из Path вместо текущих. Файла ещё нет - начинаем с нуля.
+// Если в файле строк больше Size, самые редкие отбрасываются
+func (a *Analytics) Load() error {
+	if a.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state analyticsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("cant parse analytics %s: %w", a.Path, err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queries = make(map[string]*analyticsEntry, len(state.Queries))
+	a.rarest = make(analyticsHeap, 0, len(state.Queries))
+	for _, stats := range state.Queries {
+		entry := &analyticsEntry{QueryStats: stats, index: len(a.rarest)}
+		a.queries[stats.Query] = entry
+		a.rarest = append(a.rarest, entry)
+	}
+	heap.Init(&a.rarest)
+	a.evict(a.size())
+	state.Queries = nil
+	a.state = state
+	if a.state.Since.IsZero() {
+		a.state.Since = time.Now().UTC()
+	}
+	return nil
+}
+
+// Save сохраняет счётчики в Path. Пишет во временный файл рядом и переименовывает,
+// чтобы упавший посреди записи сервер не оставил битый файл. Строки поиска бывают личными данными,
+// поэтому файл читает только владелец
+func (a *Analytics) Save() error {
+	if a.Path == "" {
+		return nil
+	}
+	a.mu.Lock()
+	a.init()
+	state := a.state
+	state.Queries = make([]QueryStats, 0, len(a.queries))
+	for _, entry := range a.queries {
+		state.Queries = append(state.Queries, entry.QueryStats)
+	}
+	a.mu.Unlock()
+	sort.Slice(state.Queries, func(i, j int) bool { return state.Queries[i].Query < state.Queries[j].Query })
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := a.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.Path)
+}
+
+// Run сохраняет счётчики через Save раз в interval, результат каждого сохранения отдаётся в onSave.
+// Работает, пока не отменят ctx
+func (a *Analytics) Run(ctx context.Context, interval time.Duration, onSave func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			onSave(a.Save())
+		}
+	}
+}
+
+// ParseAnalyticsLimit разбирает limit, пустой - DefaultAnalyticsLimit, больше MaxAnalyticsLimit - MaxAnalyticsLimit
+func ParseAnalyticsLimit(value string) (int, error) {
+	if value == "" {
+		return DefaultAnalyticsLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, &ServerError{Code: searchclient.CodeBadLimit, Message: fmt.Sprintf("invalid limit: %s, expected positive number", value), Field: "limit"}
+	}
+	return min(limit, MaxAnalyticsLimit), nil
+}
+
+// serveAnalytics - GET /admin/analytics?limit=20: сколько было поисков, самые частые строки поиска и строки,
+// по которым ничего не нашлось. Только для токенов с ScopeAdmin, строки поиска бывают личными данными
+func (s *Server) serveAnalytics(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	if s.Analytics == nil {
+		JSONError(w, r, "search analytics are disabled", searchclient.CodeNotFound, http.StatusNotFound)
+		return
+	}
+	limit, err := ParseAnalyticsLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadLimit, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.Analytics.Report(limit), http.StatusOK)
+}
@@ -0,0 +1,175 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// queryCounts - строки поиска и сколько раз их искали и сколько раз ничего не нашли, без времени
+func queryCounts(stats []QueryStats) [][3]any {
+	counts := [][3]any{}
+	for _, query := range stats {
+		counts = append(counts, [3]any{query.Query, query.Count, query.ZeroResults})
+	}
+	return counts
+}
+
+func TestAnalytics(t *testing.T) {
+	analytics := &Analytics{Size: 3}
+	for _, search := range []struct {
+		Query string
+		Total int
+	}{
+		{"nulla", 5}, {"Nulla ", 4}, {"  NULLA", 0}, {"boyd  wolf", 1}, {"Boyd Wolf", 1},
+		{"zzz", 0}, {"", 0}, {"", 35},
+		// места на 3 строки, вытесняется самая редкая - zzz
+		{"sit", 2},
+	} {
+		analytics.Record(search.Query, search.Total)
+	}
+	cases := []struct {
+		Limit    int
+		Top      [][3]any
+		NoResult [][3]any
+	}{
+		{Limit: 10, Top: [][3]any{{"nulla", 3, 1}, {"boyd wolf", 2, 0}, {"sit", 1, 0}}, NoResult: [][3]any{{"nulla", 3, 1}}},
+		{Limit: 1, Top: [][3]any{{"nulla", 3, 1}}, NoResult: [][3]any{{"nulla", 3, 1}}},
+	}
+	for caseNum, testCase := range cases {
+		report := analytics.Report(testCase.Limit)
+		if report.Searches != 9 || report.ZeroResultSearches != 3 || report.Since.IsZero() {
+			t.Errorf("[%d] expected 9 searches with 3 empty, got %+v", caseNum, report)
+		}
+		if top := queryCounts(report.TopQueries); !reflect.DeepEqual(top, testCase.Top) {
+			t.Errorf("[%d] expected top %v, got %v", caseNum, testCase.Top, top)
+		}
+		if noResult := queryCounts(report.ZeroResultQueries); !reflect.DeepEqual(noResult, testCase.NoResult) {
+			t.Errorf("[%d] expected zero result %v, got %v", caseNum, testCase.NoResult, noResult)
+		}
+	}
+}
+
+func TestAnalyticsSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.json")
+	// файла ещё нет - начинаем с нуля
+	saved := &Analytics{Path: path}
+	if err := saved.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	saved.Record("nulla", 0)
+	saved.Record("nulla", 3)
+	saved.Record("", 1)
+	if err := saved.Save(); err != nil {
+		t.Fatalf("cant save: %s", err)
+	}
+	// строки поиска бывают личными данными
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected file readable only by owner, got %v %v", info.Mode(), err)
+	}
+
+	loaded := &Analytics{Path: path}
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("cant load: %s", err)
+	}
+	loaded.Record("sit", 0)
+	report, expected := loaded.Report(10), saved.Report(10)
+	if report.Searches != 4 || report.ZeroResultSearches != 2 || !report.Since.Equal(expected.Since) {
+		t.Errorf("expected counters to survive restart, got %+v, saved %+v", report, expected)
+	}
+	if top := queryCounts(report.TopQueries); !reflect.DeepEqual(top, [][3]any{{"nulla", 2, 1}, {"sit", 1, 1}}) {
+		t.Errorf("unexpected top queries %v", top)
+	}
+
+	// в файле строк больше, чем помещается: остаётся самая частая
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("cant save: %s", err)
+	}
+	trimmed := &Analytics{Path: path, Size: 1}
+	if err := trimmed.Load(); err != nil {
+		t.Fatalf("cant load: %s", err)
+	}
+	if top := queryCounts(trimmed.Report(10).TopQueries); !reflect.DeepEqual(top, [][3]any{{"nulla", 2, 1}}) {
+		t.Errorf("expected analytics trimmed to size, got %v", top)
+	}
+	trimmed.Record("sit", 0)
+	if top := queryCounts(trimmed.Report(10).TopQueries); !reflect.DeepEqual(top, [][3]any{{"sit", 1, 1}}) {
+		t.Errorf("expected new query to replace the only one, got %v", top)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Analytics{Path: path}).Load(); err == nil {
+		t.Error("expected error for broken file")
+	}
+	// без Path сохранять некуда
+	if err := (&Analytics{}).Save(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestServerAnalytics(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "ops": "o-secret"},
+		Scopes:      map[string][]string{"ops": {ScopeAdmin}},
+		Analytics:   &Analytics{},
+	}
+	for _, target := range []string{"/?query=nulla", "/v2/search?query=Nulla&limit=1", "/?query=nothing", "/?gender=male", "/aggregate?query=sit", "/?query=nulla&age_min=x"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("AccessToken", "r-secret")
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	cases := []struct {
+		Target string
+		Token  string
+		Status int
+	}{
+		{Target: "/admin/analytics", Token: "o-secret", Status: http.StatusOK},
+		{Target: "/v1/admin/analytics?limit=1", Token: "o-secret", Status: http.StatusOK},
+		{Target: "/admin/analytics?limit=0", Token: "o-secret", Status: http.StatusBadRequest},
+		{Target: "/admin/analytics", Token: "r-secret", Status: http.StatusForbidden},
+		{Target: "/admin/analytics", Token: "bad", Status: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/analytics", nil)
+	req.Header.Set("AccessToken", "o-secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var report AnalyticsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("cant decode analytics %s: %s", rec.Body, err)
+	}
+	// считаются только поиски, которые дошли до ответа
+	if report.Searches != 4 || report.ZeroResultSearches != 1 {
+		t.Errorf("expected 4 searches with 1 empty, got %+v", report)
+	}
+	if top := queryCounts(report.TopQueries); !reflect.DeepEqual(top, [][3]any{{"nulla", 2, 0}, {"nothing", 1, 1}}) {
+		t.Errorf("unexpected top queries %v", top)
+	}
+	if noResult := queryCounts(report.ZeroResultQueries); !reflect.DeepEqual(noResult, [][3]any{{"nothing", 1, 1}}) {
+		t.Errorf("unexpected zero result queries %v", noResult)
+	}
+
+	disabled := &Server{DatasetPath: datasetPath, Token: "token", Scopes: map[string][]string{DefaultClientName: {ScopeAdmin}}}
+	rec = httptest.NewRecorder()
+	disabled.ServeHTTP(rec, authorizedRequest("/admin/analytics"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without analytics, got %d", rec.Code)
+	}
+}
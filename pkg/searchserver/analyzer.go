@@ -0,0 +1,195 @@
+package searchserver
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// analyzedSeparator отделяет в aboutLower снимка с Analyzer сам текст от основ его слов.
+// В тексте запроса его не бывает, поэтому фраза не найдётся наполовину в тексте, наполовину в основах
+const analyzedSeparator = "\x00"
+
+// Analyzer разбирает About на слова по правилам языка: слова приводятся к основе, а стоп-слова
+// вроде "the" и "и" выбрасываются. Тогда "studies" находит "studied", а "книгами" - "книга".
+// Стеммеры лёгкие, как light_* в Elasticsearch: отрезают частые окончания и не знают исключений.
+// Работает для датасета в памяти, внешние хранилища анализируют текст сами
+type Analyzer struct {
+	base      string
+	stopWords map[string]bool
+	stemmer   func(word string) string
+}
+
+// NewAnalyzer - анализатор для языка в виде BCP 47, есть en и ru
+func NewAnalyzer(locale string) (*Analyzer, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid analyzer language %q: %w", locale, err)
+	}
+	base, _ := tag.Base()
+	switch base.String() {
+	case "en":
+		return &Analyzer{base: "en", stopWords: englishStopWords, stemmer: stemEnglish}, nil
+	case "ru":
+		return &Analyzer{base: "ru", stopWords: russianStopWords, stemmer: stemRussian}, nil
+	}
+	return nil, fmt.Errorf("no analyzer for language %q, expected en or ru", locale)
+}
+
+func (a *Analyzer) String() string {
+	return a.base
+}
+
+// stem - основа слова после foldCase, стоп-слово - пустая строка
+func (a *Analyzer) stem(word string) string {
+	if a.stopWords[word] {
+		return ""
+	}
+	return a.stemmer(word)
+}
+
+// analyze - основы слов текста после foldCase без стоп-слов, через пробел и с пробелами по краям,
+// чтобы основа искалась подстрокой " основа " только целиком
+func (a *Analyzer) analyze(text string) string {
+	var b strings.Builder
+	b.WriteString(" ")
+	for _, word := range splitWords(text) {
+		if stem := a.stem(word); stem != "" {
+			b.WriteString(stem)
+			b.WriteString(" ")
+		}
+	}
+	return b.String()
+}
+
+// analyzed - дерево, в котором слово без кавычек находится ещё и по основе в About, а стоп-слова
+// под AND больше не обязательны. Имена не анализируются, фразы в кавычках ищутся как есть
+func (n *queryNode) analyzed(a *Analyzer) *queryNode {
+	if n == nil {
+		return nil
+	}
+	if n.Op == "" {
+		words := splitWords(n.Term.Text)
+		if n.Term.Phrase || n.Term.Field == "Name" || len(words) != 1 {
+			return n
+		}
+		stem := a.stem(words[0])
+		if stem == "" {
+			return n
+		}
+		return &queryNode{Op: queryOr, Children: []*queryNode{n, {Term: queryTerm{Field: "About", Text: " " + stem + " "}}}}
+	}
+	node := &queryNode{Op: n.Op}
+	for _, child := range n.Children {
+		if n.Op == queryAnd && child.isStopWord(a) {
+			continue
+		}
+		node.Children = append(node.Children, child.analyzed(a))
+	}
+	// из одних стоп-слов запрос не пустеет, они ищутся как написаны
+	if len(node.Children) == 0 {
+		return n
+	}
+	if len(node.Children) == 1 && n.Op != queryNot {
+		return node.Children[0]
+	}
+	return node
+}
+
+// isStopWord - терм из одного стоп-слова без кавычек
+func (n *queryNode) isStopWord(a *Analyzer) bool {
+	if n.Op != "" || n.Term.Phrase || n.Term.Field == "Name" {
+		return false
+	}
+	words := splitWords(n.Term.Text)
+	return len(words) == 1 && a.stopWords[words[0]]
+}
+
+// stemEnglish отрезает окончания множественного числа, -ing, -ed, -ly и немое e:
+// "studies", "studied" и "study" дают "study", "hoping", "hopes" и "hope" - "hop"
+func stemEnglish(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ies") + "y"
+	case hasAnySuffix(word, "ches", "shes", "xes", "zes"):
+		word = strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s") && !hasAnySuffix(word, "ss", "us", "is") && len(word) > 3:
+		word = strings.TrimSuffix(word, "s")
+	}
+	switch {
+	case strings.HasSuffix(word, "ied") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ied") + "y"
+	case strings.HasSuffix(word, "ing") && hasVowel(strings.TrimSuffix(word, "ing")) && len(word) > 5:
+		word = undouble(strings.TrimSuffix(word, "ing"))
+	case strings.HasSuffix(word, "ed") && hasVowel(strings.TrimSuffix(word, "ed")) && len(word) > 4:
+		word = undouble(strings.TrimSuffix(word, "ed"))
+	case strings.HasSuffix(word, "ly") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ly")
+	}
+	if strings.HasSuffix(word, "e") && len(word) > 3 {
+		word = strings.TrimSuffix(word, "e")
+	}
+	return word
+}
+
+// undouble убирает удвоенную согласную на конце: "runn" - "run"
+func undouble(word string) string {
+	if n := len(word); n >= 2 && word[n-1] == word[n-2] && strings.IndexByte("bdfgmnprt", word[n-1]) >= 0 {
+		return word[:n-1]
+	}
+	return word
+}
+
+func hasVowel(word string) bool {
+	return strings.ContainsAny(word, "aeiouy")
+}
+
+func hasAnySuffix(word string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// russianEndings - окончания существительных, прилагательных и глаголов, длинные раньше коротких
+var russianEndings = []string{
+	"иями", "ями", "ами", "ого", "его", "ому", "ему", "ыми", "ими", "ией", "ать", "ять", "ить", "еть",
+	"ешь", "ишь", "ой", "ей", "ий", "ый", "ая", "яя", "ое", "ее", "ие", "ые", "ом", "ем", "ам", "ям",
+	"ах", "ях", "ов", "ев", "ию", "ью", "ия", "ья", "ет", "ит", "ут", "ют", "ат", "ят", "ла", "ло", "ли",
+	"а", "я", "о", "е", "ы", "и", "у", "ю", "ь", "й",
+}
+
+// stemRussian отрезает одно окончание из russianEndings, если от слова остаётся хотя бы три буквы:
+// "книгами", "книгой" и "книга" дают "книг"
+func stemRussian(word string) string {
+	for _, ending := range russianEndings {
+		if strings.HasSuffix(word, ending) && utf8.RuneCountInString(word)-utf8.RuneCountInString(ending) >= 3 {
+			return strings.TrimSuffix(word, ending)
+		}
+	}
+	return word
+}
+
+// стоп-слова, как в стандартных списках Lucene
+var (
+	englishStopWords = stopWords("a an and are as at be but by for if in into is it no not of on or such " +
+		"that the their then there these they this to was will with")
+	russianStopWords = stopWords("а без более бы был была были было быть в вам вас весь во вот все всего всех вы где да " +
+		"даже для до его ее если есть еще же за здесь и из или им их к как ко когда кто ли либо мне может мы на " +
+		"надо наш не него нее нет ни них но ну о об однако он она они оно от очень по под при с со так также " +
+		"такой там те тем то того тоже той только том ты у уже хотя чего чей чем что чтобы чье чья эта эти это я")
+)
+
+func stopWords(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,145 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewAnalyzer(t *testing.T) {
+	cases := []struct {
+		Locale   string
+		Expected string
+		IsError  bool
+	}{
+		{Locale: "en", Expected: "en"},
+		{Locale: "en-GB", Expected: "en"},
+		{Locale: "ru-RU", Expected: "ru"},
+		{Locale: "de", IsError: true},
+		{Locale: "not a language", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		analyzer, err := NewAnalyzer(testCase.Locale)
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error for %q", caseNum, testCase.Locale)
+			}
+			continue
+		}
+		if err != nil || analyzer.String() != testCase.Expected {
+			t.Errorf("[%d] expected %s, got %v %v", caseNum, testCase.Expected, analyzer, err)
+		}
+	}
+}
+
+func TestAnalyzerStem(t *testing.T) {
+	en, _ := NewAnalyzer("en")
+	ru, _ := NewAnalyzer("ru")
+	cases := []struct {
+		Analyzer *Analyzer
+		Words    []string
+		Expected string
+	}{
+		{Analyzer: en, Words: []string{"study", "studies", "studied"}, Expected: "study"},
+		{Analyzer: en, Words: []string{"hope", "hopes", "hoped", "hoping"}, Expected: "hop"},
+		{Analyzer: en, Words: []string{"run", "runs", "running"}, Expected: "run"},
+		{Analyzer: en, Words: []string{"box", "boxes"}, Expected: "box"},
+		{Analyzer: en, Words: []string{"class", "classes"}, Expected: "class"},
+		{Analyzer: en, Words: []string{"the", "and", "with"}, Expected: ""},
+		{Analyzer: ru, Words: []string{"книга", "книги", "книгой", "книгами"}, Expected: "книг"},
+		{Analyzer: ru, Words: []string{"красный", "красная", "красного"}, Expected: "красн"},
+		{Analyzer: ru, Words: []string{"и", "что", "только"}, Expected: ""},
+	}
+	for caseNum, testCase := range cases {
+		for _, word := range testCase.Words {
+			if got := testCase.Analyzer.stem(word); got != testCase.Expected {
+				t.Errorf("[%d] %s: expected %q, got %q", caseNum, word, testCase.Expected, got)
+			}
+		}
+	}
+	if got := en.analyze("the boxes and the studies"); got != " box study " {
+		t.Errorf("expected stems without stop words, got %q", got)
+	}
+}
+
+func TestAnalyzedTree(t *testing.T) {
+	en, _ := NewAnalyzer("en")
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{Query: "studies", Expected: `OR("studies", about:" study ")`},
+		{Query: "name:studies", Expected: `name:"studies"`},
+		{Query: `"the studies"`, Expected: `PHRASE("the studies")`},
+		{Query: "the studies", Expected: `OR("studies", about:" study ")`},
+		{Query: "the AND a", Expected: `AND("the", "a")`},
+		{Query: "the OR studies", Expected: `OR("the", OR("studies", about:" study "))`},
+		{Query: "wolf NOT studies", Expected: `AND(OR("wolf", about:" wolf "), NOT(OR("studies", about:" study ")))`},
+	}
+	for caseNum, testCase := range cases {
+		tree, err := ParseSearchQuery(testCase.Query)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %s", caseNum, err)
+		}
+		if got := tree.analyzed(en).String(); got != testCase.Expected {
+			t.Errorf("[%d] %s: expected %s, got %s", caseNum, testCase.Query, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerAnalyzer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Anna</first_name><last_name>Studies</last_name><about>She studied the classes of boxes</about></row>
+		<row><id>2</id><first_name>John</first_name><last_name>Hope</last_name><about>Hoping for a study</about></row>
+		<row><id>3</id><first_name>Иван</first_name><last_name>Петров</last_name><about>Читает книги</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	en, _ := NewAnalyzer("en")
+	ru, _ := NewAnalyzer("ru")
+	cases := []struct {
+		Analyzer *Analyzer
+		Query    string
+		Expected []int
+	}{
+		{Analyzer: nil, Query: "studies", Expected: []int{1}},
+		{Analyzer: en, Query: "studies", Expected: []int{1, 2}},
+		{Analyzer: en, Query: "about:hopes", Expected: []int{2}},
+		{Analyzer: en, Query: "name:hopes", Expected: []int{}},
+		{Analyzer: nil, Query: "with box", Expected: []int{}},
+		{Analyzer: en, Query: "with box", Expected: []int{1}},
+		{Analyzer: en, Query: `"studies the"`, Expected: []int{}},
+		{Analyzer: en, Query: "study NOT hoped", Expected: []int{1}},
+		{Analyzer: ru, Query: "книгами", Expected: []int{3}},
+		{Analyzer: ru, Query: "только книгой", Expected: []int{3}},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		for caseNum, testCase := range cases {
+			s := &Server{DatasetPath: path, Index: index, Analyzer: testCase.Analyzer}
+			params := url.Values{"query": {testCase.Query}, "order_field": {"Id"}, "order_by": {"-1"}}
+			code, users := search(t, s, "token", params.Encode())
+			if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %v (status %d)", index, caseNum, testCase.Query, testCase.Expected, userIds(users), code)
+			}
+		}
+	}
+
+	s := &Server{DatasetPath: path, Analyzer: en}
+	_, users := search(t, s, "token", "query=studies&highlight=true&order_field=Id&order_by=-1")
+	expected := []map[string]string{
+		{"Name": "Anna <em>Studies</em>", "About": "She <em>studied</em> the classes of boxes"},
+		{"About": "Hoping for a <em>study</em>"},
+	}
+	if len(users) != 2 || !reflect.DeepEqual(users[0].Highlight, expected[0]) || !reflect.DeepEqual(users[1].Highlight, expected[1]) {
+		t.Errorf("expected stems highlighted in About, got %+v", users)
+	}
+	// по основам ищется и без учёта диакритики
+	if _, users := search(t, s, "token", "query=st%C3%BCdies&ignore_accents=true&order_field=Id&order_by=-1"); !reflect.DeepEqual(userIds(users), []int{1, 2}) {
+		t.Errorf("expected stems with ignore_accents, got %v", userIds(users))
+	}
+}
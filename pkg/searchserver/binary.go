@@ -0,0 +1,124 @@
+package searchserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// Бинарный датасет (.bin) - записи уже после prepare, в виде, который можно читать прямо из
+// отображённого в память файла без разбора и копирования:
+//
+//	магия binaryMagic, число записей uint32,
+//	записи фиксированной длины: id и age int64, затем binaryStrings пар (смещение, длина) uint32 на строки,
+//	строки всех записей подряд, смещения считаются от начала строк.
+//
+// Все числа little endian
+const (
+	binaryMagic   = "SSUSERS1"
+	binaryStrings = 8
+	binaryRecord  = 16 + binaryStrings*8
+	binaryHeader  = len(binaryMagic) + 4
+)
+
+// binaryFields - строки записи в том порядке, в каком они лежат в файле
+func binaryFields(item *Item) [binaryStrings]*string {
+	return [binaryStrings]*string{&item.Guid, &item.FirstName, &item.LastName, &item.Name,
+		&item.About, &item.Gender, &item.nameLower, &item.aboutLower}
+}
+
+// WriteBinaryDataset пишет датасет в бинарном формате, его потом можно открыть через LoadDataset или Store.SwapMapped
+func WriteBinaryDataset(w io.Writer, root Root) error {
+	if uint64(len(root.Row)) > math.MaxUint32 {
+		return fmt.Errorf("too many rows for binary dataset: %d", len(root.Row))
+	}
+	rows := make([]Item, len(root.Row))
+	copy(rows, root.Row)
+
+	buffered := bufio.NewWriter(w)
+	header := make([]byte, binaryHeader)
+	copy(header, binaryMagic)
+	binary.LittleEndian.PutUint32(header[len(binaryMagic):], uint32(len(rows)))
+	buffered.Write(header)
+
+	record := make([]byte, binaryRecord)
+	offset := uint64(0)
+	for i := range rows {
+		rows[i].prepare()
+		binary.LittleEndian.PutUint64(record[0:], uint64(rows[i].Id))
+		binary.LittleEndian.PutUint64(record[8:], uint64(rows[i].Age))
+		for k, field := range binaryFields(&rows[i]) {
+			if offset+uint64(len(*field)) > math.MaxUint32 {
+				return errors.New("binary dataset strings exceed 4GB")
+			}
+			binary.LittleEndian.PutUint32(record[16+k*8:], uint32(offset))
+			binary.LittleEndian.PutUint32(record[20+k*8:], uint32(len(*field)))
+			offset += uint64(len(*field))
+		}
+		buffered.Write(record)
+	}
+	for i := range rows {
+		for _, field := range binaryFields(&rows[i]) {
+			buffered.WriteString(*field)
+		}
+	}
+	return buffered.Flush()
+}
+
+// decodeBinary разбирает бинарный датасет. Строки записей не копируются, а смотрят прямо в data,
+// поэтому data нельзя менять, пока живут записи. Записи готовы, prepare для них не нужен
+func decodeBinary(data []byte) ([]Item, error) {
+	if len(data) < binaryHeader || string(data[:len(binaryMagic)]) != binaryMagic {
+		return nil, errors.New("not a binary dataset")
+	}
+	count := int(binary.LittleEndian.Uint32(data[len(binaryMagic):]))
+	if (len(data)-binaryHeader)/binaryRecord < count {
+		return nil, fmt.Errorf("binary dataset is truncated: %d rows expected", count)
+	}
+	blob := data[binaryHeader+count*binaryRecord:]
+	rows := make([]Item, count)
+	for i := range rows {
+		record := data[binaryHeader+i*binaryRecord:]
+		rows[i].Id = int(int64(binary.LittleEndian.Uint64(record[0:])))
+		rows[i].Age = int(int64(binary.LittleEndian.Uint64(record[8:])))
+		for k, field := range binaryFields(&rows[i]) {
+			offset := uint64(binary.LittleEndian.Uint32(record[16+k*8:]))
+			length := uint64(binary.LittleEndian.Uint32(record[20+k*8:]))
+			if offset+length > uint64(len(blob)) {
+				return nil, fmt.Errorf("binary dataset row %d: string out of bounds", i)
+			}
+			if length > 0 {
+				*field = unsafe.String(&blob[offset], int(length))
+			}
+		}
+		rows[i].pos = i
+	}
+	return rows, nil
+}
+
+// DecodeBinary читает бинарный датасет целиком в память
+func (r *Root) DecodeBinary(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	rows, err := decodeBinary(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse binary dataset: %w", err)
+	}
+	r.Row = rows
+	return nil
+}
+
+// detach копирует строки записи, чтобы она не ссылалась на отображённый файл снимка
+func (item *Item) detach() {
+	for _, field := range binaryFields(item) {
+		*field = strings.Clone(*field)
+	}
+}
@@ -0,0 +1,115 @@
+package searchserver
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// writeBinary собирает бинарный датасет из dataset.xml во временной директории
+func writeBinary(t *testing.T) (Root, string) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteBinaryDataset(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root, path
+}
+
+func TestBinaryDatasetRoundTrip(t *testing.T) {
+	root, path := writeBinary(t)
+	loaded, err := LoadDataset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromXML, fromBinary Store
+	expected := fromXML.Swap(root).Root()
+	got := fromBinary.Swap(loaded).Root()
+	if !reflect.DeepEqual(got.Row, expected.Row) {
+		t.Errorf("binary dataset differs from xml: %d vs %d rows", len(got.Row), len(expected.Row))
+	}
+}
+
+func TestDecodeBinaryErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBinaryDataset(&buf, Root{Row: []Item{{Id: 1, FirstName: "Jane", About: "long enough"}}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	cases := [][]byte{
+		nil,
+		[]byte("<root></root>"),
+		// обрезанные записи и обрезанные строки
+		data[:binaryHeader+binaryRecord-1],
+		data[:len(data)-1],
+	}
+	for caseNum, input := range cases {
+		if _, err := decodeBinary(input); err == nil {
+			t.Errorf("[%d] expected error", caseNum)
+		}
+	}
+	if rows, err := decodeBinary(data); err != nil || len(rows) != 1 || rows[0].Name != "Jane " {
+		t.Errorf("expected one prepared row, got %+v, %v", rows, err)
+	}
+}
+
+// отображённый датасет ищет так же, как прочитанный, а отданные записи не ссылаются на файл
+func TestStoreSwapMapped(t *testing.T) {
+	root, path := writeBinary(t)
+	var mapped, loaded Store
+	snapshot, err := mapped.SwapMapped(path, IndexWords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := loaded.Swap(root)
+	for _, query := range []string{"", "boyd", "nulla", "xyz"} {
+		for _, fields := range [][]SortField{nil, {{Field: "Name", Order: 1}}} {
+			got, err := snapshot.Sorted(query, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := expected.Sorted(query, fields)
+			if !reflect.DeepEqual(got.Row, want.Row) {
+				t.Errorf("%q %v: mapped search differs", query, fields)
+			}
+		}
+	}
+
+	detached := snapshot.Search("boyd").Row
+	mapped.Swap(root)
+	snapshot = nil
+	runtime.GC()
+	runtime.GC()
+	if len(detached) != 1 || detached[0].Name != "Boyd Wolf" {
+		t.Errorf("expected Boyd Wolf after unmapping, got %+v", detached)
+	}
+
+	if _, err := mapped.SwapMapped(datasetPath, IndexWords); err == nil {
+		t.Error("expected error for xml dataset")
+	}
+}
+
+func TestServerMapDataset(t *testing.T) {
+	_, path := writeBinary(t)
+	mapped := &Server{DatasetPath: path, MapDataset: true}
+	plain := &Server{DatasetPath: datasetPath}
+	for _, target := range []string{"/?query=nulla&order_by=1&order_field=Age&limit=5", "/v2/?query=boyd&order_by=-1"} {
+		got, expected := httptest.NewRecorder(), httptest.NewRecorder()
+		mapped.ServeHTTP(got, authorizedRequest(target))
+		plain.ServeHTTP(expected, authorizedRequest(target))
+		if got.Code != expected.Code || got.Body.String() != expected.Body.String() {
+			t.Errorf("%s: expected %d %s, got %d %s", target, expected.Code, expected.Body, got.Code, got.Body)
+		}
+	}
+}
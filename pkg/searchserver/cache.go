@@ -0,0 +1,57 @@
+package searchserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Cache - кэш результатов поиска. Промахи и ошибки кэша не ломают поиск: Server просто идёт в Storage
+type Cache interface {
+	Get(ctx context.Context, key string) (Page, bool)
+	Set(ctx context.Context, key string, page Page)
+}
+
+// QueryKey - ключ кэша для запроса. Строка поиска берётся в каноническом виде: регистр слов и лишние скобки
+// не важны, поэтому одинаковые по смыслу запросы дают одинаковый ключ, а "a AND b" и "a and b" - разные
+func QueryKey(query Query) string {
+	query.Query = query.searchTree().String()
+	data, _ := json.Marshal(query)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedUser - Item вместе с Name и Score, которые в json у Item не попадают
+type cachedUser struct {
+	Item
+	Name  string  `json:"name"`
+	Score float64 `json:"score,omitempty"`
+}
+
+type cachedPage struct {
+	Users []cachedUser `json:"users"`
+	Total int          `json:"total"`
+}
+
+func encodePage(page Page) ([]byte, error) {
+	cached := cachedPage{Users: make([]cachedUser, len(page.Users)), Total: page.Total}
+	for i, item := range page.Users {
+		cached.Users[i] = cachedUser{Item: item, Name: item.Name, Score: item.Score}
+	}
+	return json.Marshal(cached)
+}
+
+func decodePage(data []byte) (Page, error) {
+	var cached cachedPage
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return Page{}, err
+	}
+	page := Page{Users: make([]Item, len(cached.Users)), Total: cached.Total}
+	for i, user := range cached.Users {
+		page.Users[i] = user.Item
+		page.Users[i].Name = user.Name
+		page.Users[i].Score = user.Score
+	}
+	return page, nil
+}
@@ -0,0 +1,61 @@
+package searchserver
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation - сортировка Name по правилам языка, а не побайтно: "Ä" в немецком рядом с "A",
+// "Ё" в русском рядом с "Е", а не после "я". Работает для датасета в памяти, внешние хранилища
+// сортируют по-своему
+type Collation struct {
+	tag language.Tag
+}
+
+// NewCollation - сортировка для языка в виде BCP 47: "ru", "de", "sv", "und" - общие правила Unicode
+func NewCollation(locale string) (*Collation, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collation locale %q: %w", locale, err)
+	}
+	return &Collation{tag: tag}, nil
+}
+
+func (c *Collation) String() string {
+	return c.tag.String()
+}
+
+// nameIndex - индекс по Name для c, nil c - побайтный. Строится при первом обращении и живёт, пока жив снимок
+func (s *Snapshot) nameIndex(c *Collation) *sortIndex {
+	if c == nil {
+		return s.sorts["Name"]
+	}
+	s.collatedMu.Lock()
+	defer s.collatedMu.Unlock()
+	index, ok := s.collated[c.String()]
+	if !ok {
+		index = newCollatedIndex(s.rows, c)
+		if s.collated == nil {
+			s.collated = map[string]*sortIndex{}
+		}
+		s.collated[c.String()] = index
+	}
+	return index
+}
+
+// newCollatedIndex сравнивает не сами имена, а их ключи сортировки: ключ считается один раз на запись,
+// а сравнивать ключи - то же самое, что сравнивать имена по правилам языка
+func newCollatedIndex(rows []Item, c *Collation) *sortIndex {
+	collator := collate.New(c.tag)
+	var buf collate.Buffer
+	keys := make([][]byte, len(rows))
+	for i := range rows {
+		keys[i] = collator.KeyFromString(&buf, rows[i].Name)
+	}
+	return newSortIndex(rows, func(a, b *Item) int {
+		return bytes.Compare(keys[a.pos], keys[b.pos])
+	})
+}
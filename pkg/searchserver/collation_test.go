@@ -0,0 +1,63 @@
+package searchserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	content := "id,first_name,last_name\n1,Яна,Doe\n2,Ёжик,Doe\n3,Егор,Doe\n4,Жанна,Doe\n5,anna,Doe\n6,Bob,Doe\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Locale   string
+		Query    string
+		Expected []int
+	}{
+		// побайтно: заглавные латинские раньше строчных, Ё (U+0401) раньше всей остальной кириллицы
+		{Locale: "", Query: "order_field=Name&order_by=-1", Expected: []int{6, 5, 2, 3, 4, 1}},
+		{Locale: "ru", Query: "order_field=Name&order_by=-1", Expected: []int{5, 6, 3, 2, 4, 1}},
+		{Locale: "ru", Query: "order_field=Name&order_by=1", Expected: []int{1, 4, 2, 3, 6, 5}},
+		{Locale: "und", Query: "sort=Name:-1&limit=3&offset=2", Expected: []int{3, 2, 4}},
+		// остальные поля collation не трогает
+		{Locale: "ru", Query: "order_field=Id&order_by=1", Expected: []int{6, 5, 4, 3, 2, 1}},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: path}
+		if testCase.Locale != "" {
+			collation, err := NewCollation(testCase.Locale)
+			if err != nil {
+				t.Fatalf("[%d] unexpected error: %s", caseNum, err)
+			}
+			s.Collation = collation
+		}
+		code, users := search(t, s, "token", testCase.Query)
+		if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %d %v", caseNum, testCase.Expected, code, userIds(users))
+		}
+	}
+
+	if _, err := NewCollation("not a locale!"); err == nil {
+		t.Error("expected error for invalid locale")
+	}
+}
+
+func TestCollationIndexBuiltOnReload(t *testing.T) {
+	collation, _ := NewCollation("de")
+	s := &Server{DatasetPath: datasetPath, Collation: collation}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := s.store.Snapshot()
+	snapshot.collatedMu.Lock()
+	_, ok := snapshot.collated["de"]
+	snapshot.collatedMu.Unlock()
+	if !ok {
+		t.Error("expected collated Name index to be built on reload")
+	}
+}
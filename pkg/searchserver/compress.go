@@ -0,0 +1,185 @@
+package searchserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"hw4/pkg/searchclient"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressMinSize - ответы короче этого, если MinSize не задан, не сжимаются: выигрыш меньше накладных расходов
+const DefaultCompressMinSize = 1024
+
+// Compress сжимает json-ответы Handler в zstd или gzip, смотря что клиент указал в Accept-Encoding
+// (если подходят оба - zstd). Ответы, которые обработчик уже сжал сам, не трогаются
+type Compress struct {
+	Handler http.Handler
+	// ответы короче стольких байт отдаются как есть, 0 - DefaultCompressMinSize
+	MinSize int
+}
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}
+	zstdPool = sync.Pool{New: func() any {
+		// по энкодеру на ответ, параллельность внутри одного ответа не нужна
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}}
+)
+
+func (c *Compress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" || r.Method == http.MethodHead {
+		c.Handler.ServeHTTP(w, r)
+		return
+	}
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+	defer cw.close()
+	c.Handler.ServeHTTP(cw, r)
+}
+
+// negotiateEncoding выбирает zstd или gzip по Accept-Encoding, пустая строка - не сжимать
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if (name != "zstd" && name != "gzip") || q <= 0 {
+			continue
+		}
+		// при равном q zstd: быстрее и сжимает лучше
+		if q > bestQ || (q == bestQ && name == "zstd") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter копит начало ответа, пока не станет ясно, что он длиннее minSize, и тогда начинает сжимать
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+
+	buf         []byte
+	wroteHeader bool
+	// решили не сжимать - пишем напрямую
+	passthrough bool
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if !w.compressible() {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.minSize {
+		return len(data), nil
+	}
+	if err := w.startEncoding(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// compressible - сжимаем только json с телом, и только если обработчик не сжал его сам
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || w.status < http.StatusOK ||
+		w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, searchclient.ProblemContentType)
+}
+
+func (w *compressWriter) startEncoding() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	switch w.encoding {
+	case "zstd":
+		encoder := zstdPool.Get().(*zstd.Encoder)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	default:
+		encoder := gzipPool.Get().(*gzip.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	}
+	_, err := w.encoder.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// close дописывает сжатый поток или, если ответ так и не дорос до minSize, отдаёт накопленное как есть
+func (w *compressWriter) close() {
+	if w.passthrough {
+		return
+	}
+	if w.encoder == nil {
+		if !w.wroteHeader {
+			// обработчик ничего не написал
+			return
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf)
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *zstd.Encoder:
+		encoder.Reset(nil)
+		zstdPool.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(nil)
+		gzipPool.Put(encoder)
+	}
+}
+
+// Unwrap даёт http.ResponseController добраться до исходного ResponseWriter
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
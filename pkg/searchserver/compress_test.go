@@ -0,0 +1,107 @@
+package searchserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		Accept   string
+		Expected string
+	}{
+		{Accept: "", Expected: ""},
+		{Accept: "gzip", Expected: "gzip"},
+		{Accept: "gzip, deflate, br, zstd", Expected: "zstd"},
+		{Accept: "zstd;q=0.5, gzip", Expected: "gzip"},
+		{Accept: "zstd;q=0, gzip;q=0", Expected: ""},
+		{Accept: "GZIP;q=0.8", Expected: "gzip"},
+		{Accept: "identity, br", Expected: ""},
+		{Accept: "gzip;q=oops", Expected: ""},
+	}
+	for caseNum, testCase := range cases {
+		if got := negotiateEncoding(testCase.Accept); got != testCase.Expected {
+			t.Errorf("[%d] expected %q, got %q", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	long := `[{"About":"` + strings.Repeat("lorem ipsum ", 200) + `"}]`
+	short := `{"short":true}`
+	respond := func(contentType, encoding, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			if encoding != "" {
+				w.Header().Set("Content-Encoding", encoding)
+			}
+			// по кусочкам, чтобы порог пересекался посреди записи
+			for i := 0; i < len(body); i += 100 {
+				io.WriteString(w, body[i:min(i+100, len(body))])
+			}
+		})
+	}
+	cases := []struct {
+		Handler          http.Handler
+		Accept           string
+		ExpectedEncoding string
+		ExpectedBody     string
+	}{
+		{Handler: respond("application/json", "", long), Accept: "gzip", ExpectedEncoding: "gzip", ExpectedBody: long},
+		{Handler: respond("application/json", "", long), Accept: "gzip, zstd", ExpectedEncoding: "zstd", ExpectedBody: long},
+		{Handler: respond("application/problem+json", "", long), Accept: "gzip", ExpectedEncoding: "gzip", ExpectedBody: long},
+		{Handler: respond("application/json", "", long), Accept: "", ExpectedEncoding: "", ExpectedBody: long},
+		{Handler: respond("application/json", "", short), Accept: "gzip", ExpectedEncoding: "", ExpectedBody: short},
+		{Handler: respond("text/plain", "", long), Accept: "gzip", ExpectedEncoding: "", ExpectedBody: long},
+		// уже сжатое обработчиком, как /metrics, второй раз не сжимается
+		{Handler: respond("application/json", "identity", long), Accept: "gzip", ExpectedEncoding: "identity", ExpectedBody: long},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", testCase.Accept)
+		rec := httptest.NewRecorder()
+		(&Compress{Handler: testCase.Handler}).ServeHTTP(rec, req)
+
+		encoding := rec.Header().Get("Content-Encoding")
+		if encoding != testCase.ExpectedEncoding {
+			t.Errorf("[%d] expected encoding %q, got %q", caseNum, testCase.ExpectedEncoding, encoding)
+			continue
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("[%d] expected Vary: Accept-Encoding, got %q", caseNum, rec.Header().Get("Vary"))
+		}
+		var reader io.Reader = rec.Body
+		switch encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = gz
+		case "zstd":
+			zr, err := zstd.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			reader = zr
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			t.Errorf("[%d] cant decode body: %s", caseNum, err)
+			continue
+		}
+		if encoding != "" && encoding != "identity" && rec.Body.Len() >= len(long) {
+			t.Errorf("[%d] expected compressed body, got %d bytes", caseNum, rec.Body.Len())
+		}
+		if string(body) != testCase.ExpectedBody {
+			t.Errorf("[%d] body damaged: %q", caseNum, body)
+		}
+	}
+}
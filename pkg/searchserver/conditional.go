@@ -0,0 +1,64 @@
+package searchserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// searchETag - ETag ответа на поиск: sha256 загруженного датасета вместе с нормализованным запросом (cacheKey),
+// поэтому меняется и с датасетом, и с параметрами. Слабый - сжатые ответы отличаются побайтно, но не по смыслу.
+// Пустой, если датасет в памяти ещё не загружен или поиск идёт во внешнем Storage: его версии мы не знаем
+func (s *Server) searchETag(cacheKey string) string {
+	if s.Storage != nil {
+		return ""
+	}
+	snapshot := s.store.Snapshot()
+	if snapshot == nil || snapshot.checksum == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(snapshot.checksum + "\x00" + cacheKey))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// datasetModified - когда загружен датасет в памяти, им отвечаем на If-Modified-Since.
+// Нулевое, если датасет не загружен или поиск идёт во внешнем Storage
+func (s *Server) datasetModified() time.Time {
+	if s.Storage != nil {
+		return time.Time{}
+	}
+	snapshot := s.store.Snapshot()
+	if snapshot == nil {
+		return time.Time{}
+	}
+	return snapshot.LoadedAt
+}
+
+// notModified - можно ли ответить 304. If-Modified-Since смотрим, только если нет If-None-Match,
+// и с точностью до секунды, как в заголовке
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatches - подходит ли etag под If-None-Match: список через запятую или *, сравнение слабое
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package searchserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEtagMatches(t *testing.T) {
+	cases := []struct {
+		IfNoneMatch string
+		ETag        string
+		Expected    bool
+	}{
+		{IfNoneMatch: `W/"abc"`, ETag: `W/"abc"`, Expected: true},
+		{IfNoneMatch: `"abc"`, ETag: `W/"abc"`, Expected: true},
+		{IfNoneMatch: `"x", W/"abc"`, ETag: `W/"abc"`, Expected: true},
+		{IfNoneMatch: `*`, ETag: `W/"abc"`, Expected: true},
+		{IfNoneMatch: `W/"abd"`, ETag: `W/"abc"`, Expected: false},
+		{IfNoneMatch: ``, ETag: `W/"abc"`, Expected: false},
+		{IfNoneMatch: `*`, ETag: ``, Expected: false},
+	}
+	for caseNum, testCase := range cases {
+		if got := etagMatches(testCase.IfNoneMatch, testCase.ETag); got != testCase.Expected {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	data, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DatasetPath: path}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := authorizedRequest(target)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/?limit=5&order_by=-1&order_field=Age", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d %q", first.Code, etag)
+	}
+	// тот же запрос в другом порядке параметров - та же версия ответа
+	rec := get("/?order_field=Age&order_by=-1&limit=5", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected empty 304, got %d %q", rec.Code, rec.Body)
+	}
+	if rec := get("/?limit=6&order_by=-1&order_field=Age", ""); rec.Header().Get("ETag") == etag {
+		t.Error("expected other ETag for other query")
+	}
+	if rec := get("/v2/?limit=5&order_by=-1&order_field=Age", ""); rec.Header().Get("ETag") == etag {
+		t.Error("expected other ETag for other api version")
+	}
+
+	if err := os.WriteFile(path, bytes.Replace(data, []byte("Boyd"), []byte("Byod"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rec = get("/?limit=5&order_by=-1&order_field=Age", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("expected 200 with new ETag after reload, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// версии внешнего хранилища неизвестны - без ETag
+	storageServer := &Server{Storage: &MemoryStorage{Store: &Store{}}}
+	storageServer.Storage.(*MemoryStorage).Store.Swap(Root{Row: []Item{{Id: 1}}})
+	rec = httptest.NewRecorder()
+	storageServer.ServeHTTP(rec, authorizedRequest("/?limit=1&order_by=-1"))
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+		t.Errorf("expected 200 without ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestServerLastModified(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	loadedAt := s.Snapshot().LoadedAt
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?limit=1&order_by=-1"))
+	if expected := loadedAt.UTC().Format(http.TimeFormat); rec.Header().Get("Last-Modified") != expected {
+		t.Fatalf("expected Last-Modified %q, got %q", expected, rec.Header().Get("Last-Modified"))
+	}
+
+	cases := []struct {
+		IfModifiedSince string
+		IfNoneMatch     string
+		ExpectedCode    int
+	}{
+		{IfModifiedSince: loadedAt.UTC().Format(http.TimeFormat), ExpectedCode: http.StatusNotModified},
+		{IfModifiedSince: loadedAt.Add(time.Hour).UTC().Format(http.TimeFormat), ExpectedCode: http.StatusNotModified},
+		{IfModifiedSince: loadedAt.Add(-time.Hour).UTC().Format(http.TimeFormat), ExpectedCode: http.StatusOK},
+		{IfModifiedSince: "yesterday", ExpectedCode: http.StatusOK},
+		// If-None-Match важнее If-Modified-Since
+		{IfModifiedSince: loadedAt.Add(time.Hour).UTC().Format(http.TimeFormat), IfNoneMatch: `W/"other"`, ExpectedCode: http.StatusOK},
+	}
+	for caseNum, testCase := range cases {
+		req := authorizedRequest("/?limit=1&order_by=-1")
+		req.Header.Set("If-Modified-Since", testCase.IfModifiedSince)
+		if testCase.IfNoneMatch != "" {
+			req.Header.Set("If-None-Match", testCase.IfNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.ExpectedCode, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package searchserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSHeaders - какие заголовки браузер может присылать, если AllowedHeaders не заданы
+var DefaultCORSHeaders = []string{"AccessToken", "Authorization", "Content-Type", "Accept", RequestIDHeader}
+
+// corsExposedHeaders - заголовки ответа, которые скрипт на странице может прочитать
+var corsExposedHeaders = []string{RequestIDHeader, "Retry-After", "Link", TotalCountHeader}
+
+// CORS разрешает браузерным приложениям с других origin ходить в Handler напрямую.
+// Запросы без Origin и с неразрешённым Origin проходят как есть, просто без заголовков CORS -
+// ответ тогда не отдаст сам браузер
+type CORS struct {
+	Handler http.Handler
+	// с каких origin можно ходить: "https://app.example.com", "https://*.example.com" или "*" - с любого
+	AllowedOrigins []string
+	// какие заголовки можно присылать, пустой - DefaultCORSHeaders
+	AllowedHeaders []string
+	// сколько браузер может помнить ответ на preflight, 0 - решает браузер
+	MaxAge time.Duration
+}
+
+func (c *CORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		c.Handler.ServeHTTP(w, r)
+		return
+	}
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	allowed := c.allowed(origin)
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if !allowed {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		c.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	if !preflight {
+		header.Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		c.Handler.ServeHTTP(w, r)
+		return
+	}
+	headers := c.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultCORSHeaders
+	}
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowed - подходит ли origin под AllowedOrigins
+func (c *CORS) allowed(origin string) bool {
+	for _, pattern := range c.AllowedOrigins {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		// https://*.example.com - любой поддомен, но не сам example.com
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+			strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
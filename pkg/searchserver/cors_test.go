@@ -0,0 +1,82 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	handler := &CORS{
+		Handler:        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }),
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		MaxAge:         10 * time.Minute,
+	}
+	cases := []struct {
+		Method        string
+		Origin        string
+		Preflight     bool
+		ExpectedCode  int
+		ExpectedAllow string
+		ExpectedAge   string
+	}{
+		{Method: http.MethodGet, ExpectedCode: http.StatusTeapot},
+		{Method: http.MethodGet, Origin: "https://app.example.com", ExpectedCode: http.StatusTeapot, ExpectedAllow: "https://app.example.com"},
+		{Method: http.MethodGet, Origin: "https://evil.example.com", ExpectedCode: http.StatusTeapot},
+		{Method: http.MethodGet, Origin: "https://spa.example.org", ExpectedCode: http.StatusTeapot, ExpectedAllow: "https://spa.example.org"},
+		// сам домен под шаблон поддоменов не подходит
+		{Method: http.MethodGet, Origin: "https://.example.org", ExpectedCode: http.StatusTeapot},
+		{Method: http.MethodGet, Origin: "https://example.org.evil.com", ExpectedCode: http.StatusTeapot},
+		{Method: http.MethodOptions, Origin: "https://app.example.com", Preflight: true, ExpectedCode: http.StatusNoContent, ExpectedAllow: "https://app.example.com", ExpectedAge: "600"},
+		{Method: http.MethodOptions, Origin: "https://evil.example.com", Preflight: true, ExpectedCode: http.StatusForbidden},
+		// OPTIONS без Access-Control-Request-Method - не preflight
+		{Method: http.MethodOptions, Origin: "https://app.example.com", ExpectedCode: http.StatusTeapot, ExpectedAllow: "https://app.example.com"},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(testCase.Method, "/?limit=1", nil)
+		if testCase.Origin != "" {
+			req.Header.Set("Origin", testCase.Origin)
+		}
+		if testCase.Preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			req.Header.Set("Access-Control-Request-Headers", "accesstoken")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.ExpectedCode, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != testCase.ExpectedAllow {
+			t.Errorf("[%d] expected allow origin %q, got %q", caseNum, testCase.ExpectedAllow, got)
+		}
+		if got := rec.Header().Get("Access-Control-Max-Age"); got != testCase.ExpectedAge {
+			t.Errorf("[%d] expected max age %q, got %q", caseNum, testCase.ExpectedAge, got)
+		}
+		if testCase.Preflight && testCase.ExpectedAllow != "" && rec.Header().Get("Access-Control-Allow-Headers") == "" {
+			t.Errorf("[%d] expected allowed headers in preflight response", caseNum)
+		}
+	}
+}
+
+// preflight отвечает сам, без токена: браузер его не присылает
+func TestCORSPreflightBeforeAuth(t *testing.T) {
+	handler := &CORS{Handler: &Server{DatasetPath: datasetPath, Token: "secret"}, AllowedOrigins: []string{"*"}}
+	req := httptest.NewRequest(http.MethodOptions, "/v2/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+
+	// ошибку авторизации скрипт тоже должен суметь прочитать
+	req = httptest.NewRequest(http.MethodGet, "/v2/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Errorf("expected 401 with CORS headers, got %d %v", rec.Code, rec.Header())
+	}
+}
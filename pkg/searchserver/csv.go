@@ -0,0 +1,112 @@
+package searchserver
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// csvColumns - во что раскладывать колонки csv. Заголовки сравниваются без учёта регистра,
+// пробелов, "_" и "-", так что подходят и first_name, и FirstName, и "First Name"
+var csvColumns = map[string]func(item *Item, value string) error{
+	"id": func(item *Item, value string) (err error) {
+		item.Id, err = strconv.Atoi(value)
+		return err
+	},
+	"guid": func(item *Item, value string) error {
+		item.Guid = value
+		return nil
+	},
+	"age": func(item *Item, value string) (err error) {
+		if value == "" {
+			return nil
+		}
+		item.Age, err = strconv.Atoi(value)
+		return err
+	},
+	"firstname": func(item *Item, value string) error {
+		item.FirstName = value
+		return nil
+	},
+	"lastname": func(item *Item, value string) error {
+		item.LastName = value
+		return nil
+	},
+	"about": func(item *Item, value string) error {
+		item.About = value
+		return nil
+	},
+	"gender": func(item *Item, value string) error {
+		item.Gender = value
+		return nil
+	},
+}
+
+func normalizeColumn(name string) string {
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+func (r *Root) DecodeCSV(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	if err := r.DecodeCSVFrom(file); err != nil {
+		return fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return nil
+}
+
+// DecodeCSVFrom читает csv с заголовком в первой строке. Колонки сопоставляются с полями по заголовку,
+// порядок колонок не важен, незнакомые колонки пропускаются. Колонка id обязательна
+func (r *Root) DecodeCSVFrom(reader io.Reader) error {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err != nil {
+		return fmt.Errorf("cant read header: %w", err)
+	}
+	// первой строкой может прийти BOM от экселя
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+
+	setters := make([]func(*Item, string) error, len(header))
+	names := make([]string, len(header))
+	hasID := false
+	for i, column := range header {
+		name := normalizeColumn(column)
+		setters[i] = csvColumns[name]
+		names[i] = column
+		hasID = hasID || name == "id"
+	}
+	if !hasID {
+		return fmt.Errorf("no id column in header %v", header)
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := csvReader.FieldPos(0)
+		var item Item
+		for i, value := range record {
+			if setters[i] == nil {
+				continue
+			}
+			if err := setters[i](&item, value); err != nil {
+				return fmt.Errorf("line %d, column %s: %w", line, names[i], err)
+			}
+		}
+		r.Row = append(r.Row, item)
+	}
+}
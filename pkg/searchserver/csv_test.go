@@ -0,0 +1,76 @@
+package searchserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRootDecodeCSVFrom(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected []Item
+		IsError  bool
+	}{
+		{
+			Input: "id,first_name,last_name,age,gender,about\n1,Boyd,Wolf,22,male,\"Nulla, cillum\"\n",
+			Expected: []Item{
+				{Id: 1, FirstName: "Boyd", LastName: "Wolf", Age: 22, Gender: "male", About: "Nulla, cillum"},
+			},
+		},
+		{
+			// порядок колонок любой, заголовки в другом регистре, лишние колонки пропускаются
+			Input: "\uFEFFGender, Last Name,FirstName,ID,email\nfemale,Doe,Jane,7,jane@example.com\nmale,Roe,John,8,\n",
+			Expected: []Item{
+				{Id: 7, FirstName: "Jane", LastName: "Doe", Gender: "female"},
+				{Id: 8, FirstName: "John", LastName: "Roe", Gender: "male"},
+			},
+		},
+		{Input: "id,age\n1,\n", Expected: []Item{{Id: 1}}},
+		{Input: "id\n", Expected: nil},
+		{Input: "first_name,last_name\nJane,Doe\n", IsError: true},
+		{Input: "id,age\n1,old\n", IsError: true},
+		{Input: "id,age\n1\n", IsError: true},
+		{Input: "", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		var root Root
+		err := root.DecodeCSVFrom(strings.NewReader(testCase.Input))
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(root.Row, testCase.Expected) {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, testCase.Expected, root.Row)
+		}
+	}
+}
+
+func TestServerCSVDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	content := "id,first_name,last_name,age,about,gender\n1,Jane,Doe,30,likes csv,female\n2,John,Roe,40,likes xml,male\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DatasetPath: path}
+	code, users := search(t, s, "token", "query=csv&order_by=0")
+	expected := []UserJson{{Id: 1, Name: "Jane Doe", Age: 30, About: "likes csv", Gender: "female"}}
+	if code != http.StatusOK || !reflect.DeepEqual(users, expected) {
+		t.Errorf("expected %+v, got %+v (status %d)", expected, users, code)
+	}
+}
+
+func TestLoadDatasetUnknownFormat(t *testing.T) {
+	if _, err := LoadDataset("users.json"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,152 @@
+package searchserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Root struct {
+	XMLName xml.Name `xml:"root"`
+	Row     []Item   `xml:"row"`
+}
+type Item struct {
+	Id        int    `xml:"id" json:"id"`
+	Guid      string `xml:"guid" json:"guid"`
+	Age       int    `xml:"age" json:"age"`
+	FirstName string `xml:"first_name" json:"first_name"`
+	LastName  string `xml:"last_name" json:"last_name"`
+	Name      string `xml:"-" json:"-"`
+	About     string `xml:"about" json:"about"`
+	Gender    string `xml:"gender" json:"gender"`
+	// релевантность запросу при сортировке по ScoreField, в датасете её нет
+	Score float64 `xml:"-" json:"-"`
+
+	// Name и About после foldCase, считаются один раз при загрузке в Store
+	nameLower  string
+	aboutLower string
+	// номер записи в снимке Store
+	pos int
+}
+
+// prepare заполняет вычисляемые поля, чтобы не считать их на каждый запрос
+func (item *Item) prepare() {
+	item.Name = item.FirstName + " " + item.LastName
+	item.nameLower = foldCase(item.Name)
+	item.aboutLower = foldCase(item.About)
+}
+
+type UserJson struct {
+	Id int `json:"Id"`
+	// внешний идентификатор из датасета, у датасетов без guid его нет
+	Guid   string `json:"Guid,omitempty"`
+	Name   string `json:"Name"`
+	Age    int    `json:"Age"`
+	About  string `json:"About"`
+	Gender string `json:"Gender"`
+	// релевантность запросу, только при сортировке по _score
+	Score float64 `json:"Score,omitempty"`
+	// Name и About с размеченными совпадениями, только с highlight=true и только поля, где что-то нашлось
+	Highlight map[string]string `json:"Highlight,omitempty"`
+}
+
+// LoadDataset читает датасет, формат определяется по расширению файла: .xml, .csv, .ndjson/.jsonl или бинарный .bin
+func LoadDataset(filename string) (Root, error) {
+	var root Root
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".xml":
+		err = root.DecodeXML(filename)
+	case ".csv":
+		err = root.DecodeCSV(filename)
+	case ".ndjson", ".jsonl":
+		err = root.DecodeNDJSON(filename)
+	case ".bin":
+		err = root.DecodeBinary(filename)
+	default:
+		err = fmt.Errorf("unknown dataset format %q, expected .xml, .csv, .ndjson, .jsonl or .bin", ext)
+	}
+	return root, err
+}
+
+// fileChecksum - sha256 содержимого файла в hex, по нему видно, какая версия датасета загружена
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checksum - fileChecksum для данных в памяти
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Root) DecodeXML(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	if err := r.DecodeXMLFrom(file); err != nil {
+		return fmt.Errorf("failed to unmarshal XML: %w", err)
+	}
+	return nil
+}
+
+// DecodeXMLFrom читает датасет потоково, по одной записи: в памяти не держатся одновременно
+// сырые байты файла и всё дерево, так что большие датасеты грузятся без двойного расхода памяти
+func (r *Root) DecodeXMLFrom(reader io.Reader) error {
+	decoder := xml.NewDecoder(reader)
+	rootFound := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !rootFound {
+			if start.Name.Local != "root" {
+				return fmt.Errorf("expected element type <root> but have <%s>", start.Name.Local)
+			}
+			r.XMLName = start.Name
+			rootFound = true
+			continue
+		}
+		if start.Name.Local != "row" {
+			// чужие элементы пропускаем, как и xml.Unmarshal
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		var item Item
+		if err := decoder.DecodeElement(&item, &start); err != nil {
+			return err
+		}
+		r.Row = append(r.Row, item)
+	}
+	if !rootFound {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
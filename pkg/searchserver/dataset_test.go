@@ -0,0 +1,65 @@
+package searchserver
+
+import (
+	"encoding/xml"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRootDecodeXMLFrom(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected []int
+		IsError  bool
+	}{
+		{Input: `<root></root>`, Expected: nil},
+		{Input: `<?xml version="1.0"?><root><row><id>1</id></row><row><id>2</id></row></root>`, Expected: []int{1, 2}},
+		{Input: `<root><meta><row><id>5</id></row></meta><row><id>3</id></row></root>`, Expected: []int{3}},
+		{Input: `<users><row><id>1</id></row></users>`, IsError: true},
+		{Input: `<root><row><id>1</id>`, IsError: true},
+		{Input: `<root><row><id>x</id></row></root>`, IsError: true},
+		{Input: ``, IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		var root Root
+		err := root.DecodeXMLFrom(strings.NewReader(testCase.Input))
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		var ids []int
+		for _, item := range root.Row {
+			ids = append(ids, item.Id)
+		}
+		if !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, ids)
+		}
+	}
+}
+
+// потоковый разбор должен давать то же, что и xml.Unmarshal целого файла
+func TestRootDecodeMatchesUnmarshal(t *testing.T) {
+	data, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected Root
+	if err := xml.Unmarshal(data, &expected); err != nil {
+		t.Fatal(err)
+	}
+	var got Root
+	if err := got.DecodeXML(datasetPath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("streaming decode differs from xml.Unmarshal")
+	}
+}
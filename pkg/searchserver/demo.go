@@ -0,0 +1,21 @@
+package searchserver
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+)
+
+// demoDataset - несколько пользователей из dataset.xml, встроенные в бинарник
+//
+//go:embed demo.xml
+var demoDataset []byte
+
+// DemoDataset - встроенный демо-датасет, чтобы запустить сервер без внешнего файла
+func DemoDataset() (Root, error) {
+	var root Root
+	if err := root.DecodeXMLFrom(bytes.NewReader(demoDataset)); err != nil {
+		return root, fmt.Errorf("failed to unmarshal demo dataset: %w", err)
+	}
+	return root, nil
+}
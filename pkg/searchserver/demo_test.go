@@ -0,0 +1,33 @@
+package searchserver
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDemoDataset(t *testing.T) {
+	root, err := DemoDataset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Row) != 10 || root.Row[0].FirstName != "Boyd" {
+		t.Errorf("expected 10 users starting with Boyd, got %d", len(root.Row))
+	}
+}
+
+// демо-режиму файл датасета не нужен
+func TestServerDemo(t *testing.T) {
+	s := &Server{Demo: true, DatasetPath: "missing.xml", MapDataset: true}
+	code, users := search(t, s, "token", "query=boyd&order_by=1")
+	if code != http.StatusOK || len(users) != 1 || users[0].Name != "Boyd Wolf" {
+		t.Errorf("expected Boyd Wolf, got %+v (status %d)", users, code)
+	}
+	if err := s.Reload(); err != nil {
+		t.Errorf("unexpected reload error: %s", err)
+	}
+	_, all := search(t, s, "token", "order_by=-1&order_field=Id&limit=3")
+	if ids := userIds(all); !reflect.DeepEqual(ids, []int{0, 1, 2}) {
+		t.Errorf("expected first demo users, got %v", ids)
+	}
+}
@@ -0,0 +1,107 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// distinctFields - поля, разные значения которых отдаёт /distinct, в нижнем регистре -> имя поля UserJson.
+// Имена и описания почти все разные, для них есть /suggest
+var distinctFields = map[string]string{
+	"gender": searchclient.DistinctGender,
+	"age":    searchclient.DistinctAge,
+}
+
+// ParseDistinctField разбирает field без учёта регистра
+func ParseDistinctField(value string) (string, error) {
+	field, ok := distinctFields[strings.ToLower(value)]
+	if !ok {
+		return "", &ServerError{
+			Code:    searchclient.CodeBadFields,
+			Message: fmt.Sprintf("invalid field: %q, expected %s or %s", value, searchclient.DistinctGender, searchclient.DistinctAge),
+			Field:   "field",
+		}
+	}
+	return field, nil
+}
+
+// distinct - разные значения поля среди найденных по запросу. Считаются теми же агрегатами, что у /aggregate:
+// пол - числом по полу, возраст - гистограммой с корзиной в год, поэтому работает во всех хранилищах
+func (s *Server) distinct(ctx context.Context, query Query, field string) ([]searchclient.DistinctValue, error) {
+	values := []searchclient.DistinctValue{}
+	if field == searchclient.DistinctGender {
+		aggs, err := s.aggregate(ctx, query, DefaultAgeInterval)
+		if err != nil {
+			return nil, err
+		}
+		for gender, count := range aggs.ByGender {
+			if count > 0 {
+				values = append(values, searchclient.DistinctValue{Value: gender, Count: count})
+			}
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+		return values, nil
+	}
+	aggs, err := s.aggregate(ctx, query, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range aggs.AgeHistogram {
+		if bucket.Count > 0 {
+			values = append(values, searchclient.DistinctValue{Value: strconv.Itoa(bucket.From), Count: bucket.Count})
+		}
+	}
+	return values, nil
+}
+
+// serveDistinct - GET /distinct?field=Gender&query=nulla: разные значения поля среди найденных и сколько у каждого
+// пользователей, для выпадающих списков фильтров
+func (s *Server) serveDistinct(w http.ResponseWriter, r *http.Request, mask FieldMask) {
+	params := r.URL.Query()
+	field, err := ParseDistinctField(params.Get("field"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadFields, http.StatusBadRequest)
+		return
+	}
+	if mask[field] != "" {
+		JSONError(w, r, "token has no "+ScopePIIRead+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+		return
+	}
+	query, err := ParseQuery(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	query.Synonyms = s.Synonyms
+	ctx := r.Context()
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	values, err := s.distinct(ctx, query, field)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			JSONError(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "search timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	noteResults(r.Context(), len(values), len(values))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
@@ -0,0 +1,103 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestParseDistinctField(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected string
+		IsError  bool
+	}{
+		{Value: "Gender", Expected: searchclient.DistinctGender},
+		{Value: "age", Expected: searchclient.DistinctAge},
+		{Value: "", IsError: true},
+		{Value: "Name", IsError: true},
+		{Value: "About", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		field, err := ParseDistinctField(testCase.Value)
+		if testCase.IsError != (err != nil) || field != testCase.Expected {
+			t.Errorf("[%d] expected %q (error %v), got %q %v", caseNum, testCase.Expected, testCase.IsError, field, err)
+		}
+	}
+}
+
+func TestServerDistinct(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Boyd</first_name><last_name>Wolf</last_name><age>22</age><gender>male</gender><about>Nulla</about></row>
+		<row><id>2</id><first_name>Hilda</first_name><last_name>Mayer</last_name><age>21</age><gender>female</gender><about>Nulla</about></row>
+		<row><id>3</id><first_name>Brooks</first_name><last_name>Aguilar</last_name><age>34</age><gender>male</gender><about>Sit</about></row>
+		<row><id>4</id><first_name>Beth</first_name><last_name>Wynn</last_name><age>22</age><gender>female</gender><about>Sit</about></row>
+		<row><id>5</id><first_name>Owen</first_name><last_name>Lynn</last_name><age>22</age><gender>male</gender><about>Nulla</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		DatasetPath: path,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"Age": MaskHide},
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Expected []searchclient.DistinctValue
+	}{
+		{Target: "/distinct?field=Gender", Token: "r-secret", Status: http.StatusOK, Expected: []searchclient.DistinctValue{{Value: "female", Count: 2}, {Value: "male", Count: 3}}},
+		{Target: "/v2/distinct?field=gender&query=nulla&gender=male", Token: "r-secret", Status: http.StatusOK, Expected: []searchclient.DistinctValue{{Value: "male", Count: 2}}},
+		{Target: "/distinct?field=Age", Token: "s-secret", Status: http.StatusOK, Expected: []searchclient.DistinctValue{{Value: "21", Count: 1}, {Value: "22", Count: 3}, {Value: "34", Count: 1}}},
+		{Target: "/distinct?field=Age&query=sit", Token: "s-secret", Status: http.StatusOK, Expected: []searchclient.DistinctValue{{Value: "22", Count: 1}, {Value: "34", Count: 1}}},
+		{Target: "/distinct?field=Gender&query=nothing", Token: "r-secret", Status: http.StatusOK, Expected: []searchclient.DistinctValue{}},
+		{Target: "/distinct?field=Name", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/distinct", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/distinct?field=Gender&age_min=x", Token: "s-secret", Status: http.StatusBadRequest},
+		// возраст спрятан от токена без pii:read
+		{Target: "/distinct?field=Age", Token: "r-secret", Status: http.StatusForbidden},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status != http.StatusOK {
+			continue
+		}
+		var values []searchclient.DistinctValue
+		if err := json.Unmarshal(rec.Body.Bytes(), &values); err != nil {
+			t.Fatalf("[%d] cant decode values: %s", caseNum, err)
+		}
+		if !reflect.DeepEqual(values, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, values)
+		}
+	}
+}
+
+func TestSQLiteDistinctMatchesMemory(t *testing.T) {
+	memory := &Server{DatasetPath: datasetPath}
+	backend := &Server{Storage: newSQLiteStorage(t)}
+	for caseNum, target := range []string{"/distinct?field=Gender", "/distinct?field=Age", "/distinct?field=Age&query=nulla&gender=female"} {
+		expected, got := httptest.NewRecorder(), httptest.NewRecorder()
+		memory.ServeHTTP(expected, authorizedRequest(target))
+		backend.ServeHTTP(got, authorizedRequest(target))
+		if expected.Code != http.StatusOK || got.Body.String() != expected.Body.String() {
+			t.Errorf("[%d] %s: expected %s, got %d %s", caseNum, target, expected.Body, got.Code, got.Body)
+		}
+	}
+}
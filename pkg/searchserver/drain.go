@@ -0,0 +1,72 @@
+package searchserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"hw4/pkg/searchclient"
+)
+
+// Drainer считает запросы, которые сейчас в обработке, и после начала остановки
+// отвечает на новые 503, давая старым спокойно доработать
+type Drainer struct {
+	Handler http.Handler
+
+	mu       sync.Mutex
+	inFlight int
+	draining bool
+	// закрывается, когда после начала остановки не осталось запросов
+	idle chan struct{}
+}
+
+func (d *Drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		w.Header().Set("Connection", "close")
+		JSONError(w, r, "server is shutting down", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+		return
+	}
+	d.inFlight++
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.inFlight--
+		// после начала остановки новых запросов нет, до нуля счётчик доходит один раз
+		if d.draining && d.inFlight == 0 {
+			close(d.idle)
+		}
+		d.mu.Unlock()
+	}()
+	d.Handler.ServeHTTP(w, r)
+}
+
+// InFlight возвращает количество запросов в обработке
+func (d *Drainer) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inFlight
+}
+
+// Drain перестаёт принимать новые запросы и ждёт завершения текущих, пока не истечёт ctx
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		d.idle = make(chan struct{})
+		if d.inFlight == 0 {
+			close(d.idle)
+		}
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainer(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	drainer := &Drainer{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})}
+
+	slow := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		drainer.ServeHTTP(slow, httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-started
+	if drainer.InFlight() != 1 {
+		t.Fatalf("expected 1 in-flight request, got %d", drainer.InFlight())
+	}
+
+	// пока запрос не закончился, Drain упирается в дедлайн
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := drainer.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	rejected := httptest.NewRecorder()
+	drainer.ServeHTTP(rejected, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rejected.Code != http.StatusServiceUnavailable || rejected.Header().Get("Connection") != "close" {
+		t.Errorf("expected 503 with Connection: close while draining, got %d %v", rejected.Code, rejected.Header())
+	}
+
+	close(release)
+	if err := drainer.Drain(context.Background()); err != nil {
+		t.Errorf("unexpected drain error: %s", err)
+	}
+	<-done
+	if slow.Code != http.StatusOK {
+		t.Errorf("in-flight request must complete, got %d", slow.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package searchserver
+
+import "fmt"
+
+// Что делать с записями, у которых повторяется id или непустой guid
+const (
+	// DuplicatesReject - не загружать такой датасет, политика по умолчанию
+	DuplicatesReject = "reject"
+	// DuplicatesKeepFirst - оставить первую запись, остальные выкинуть
+	DuplicatesKeepFirst = "keep-first"
+	// DuplicatesKeepLast - оставить последнюю запись, остальные выкинуть
+	DuplicatesKeepLast = "keep-last"
+)
+
+// Dedupe выкидывает повторы по политике keep-first или keep-last и возвращает выкинутые записи.
+// При DuplicatesReject (и пустой политике) записи не трогает: повторы потом найдёт Validate
+func (r *Root) Dedupe(policy string) ([]Problem, error) {
+	rows, dropped, err := dedupeRows(r.Row, policy)
+	if err != nil {
+		return nil, err
+	}
+	r.Row = rows
+	return dropped, nil
+}
+
+func dedupeRows(rows []Item, policy string) ([]Item, []Problem, error) {
+	var reverse bool
+	switch policy {
+	case "", DuplicatesReject:
+		return rows, nil, nil
+	case DuplicatesKeepFirst:
+	case DuplicatesKeepLast:
+		reverse = true
+	default:
+		return nil, nil, fmt.Errorf("unknown duplicates policy %q, expected %s, %s or %s", policy, DuplicatesReject, DuplicatesKeepFirst, DuplicatesKeepLast)
+	}
+
+	// идём от той записи, которую оставляем: для keep-last - с конца
+	keep := make([]bool, len(rows))
+	var dropped []Problem
+	ids := make(map[int]int, len(rows))
+	guids := make(map[string]int, len(rows))
+	for k := range rows {
+		i := k
+		if reverse {
+			i = len(rows) - 1 - k
+		}
+		item := &rows[i]
+		if kept, ok := ids[item.Id]; ok {
+			dropped = append(dropped, Problem{Row: i + 1, Id: item.Id, Field: "id",
+				Message: fmt.Sprintf("duplicate id %d, kept row %d", item.Id, kept)})
+			continue
+		}
+		if kept, ok := guids[item.Guid]; ok && item.Guid != "" {
+			dropped = append(dropped, Problem{Row: i + 1, Id: item.Id, Field: "guid",
+				Message: fmt.Sprintf("duplicate guid %s, kept row %d", item.Guid, kept)})
+			continue
+		}
+		keep[i] = true
+		ids[item.Id] = i + 1
+		if item.Guid != "" {
+			guids[item.Guid] = i + 1
+		}
+	}
+	if len(dropped) == 0 {
+		return rows, nil, nil
+	}
+
+	kept := make([]Item, 0, len(rows)-len(dropped))
+	for i := range rows {
+		if keep[i] {
+			kept = append(kept, rows[i])
+		}
+	}
+	if reverse {
+		// выкинутые - по порядку строк в файле
+		for i, j := 0, len(dropped)-1; i < j; i, j = i+1, j-1 {
+			dropped[i], dropped[j] = dropped[j], dropped[i]
+		}
+	}
+	return kept, dropped, nil
+}
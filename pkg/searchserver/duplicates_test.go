@@ -0,0 +1,108 @@
+package searchserver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRootDedupe(t *testing.T) {
+	rows := []Item{
+		{Id: 1, Guid: "a", FirstName: "Ann"},
+		{Id: 2, Guid: "b", FirstName: "Bob"},
+		{Id: 1, Guid: "c", FirstName: "Ann2"},
+		{Id: 3, Guid: "b", FirstName: "Bob2"},
+		{Id: 4, FirstName: "Dan"},
+		{Id: 5, FirstName: "Eve"},
+	}
+	cases := []struct {
+		Policy      string
+		ExpectedIds []int
+		Dropped     []Problem
+		IsError     bool
+	}{
+		{Policy: "", ExpectedIds: []int{1, 2, 1, 3, 4, 5}},
+		{Policy: DuplicatesReject, ExpectedIds: []int{1, 2, 1, 3, 4, 5}},
+		{
+			Policy:      DuplicatesKeepFirst,
+			ExpectedIds: []int{1, 2, 4, 5},
+			Dropped: []Problem{
+				{Row: 3, Id: 1, Field: "id", Message: "duplicate id 1, kept row 1"},
+				{Row: 4, Id: 3, Field: "guid", Message: "duplicate guid b, kept row 2"},
+			},
+		},
+		{
+			Policy:      DuplicatesKeepLast,
+			ExpectedIds: []int{1, 3, 4, 5},
+			Dropped: []Problem{
+				{Row: 1, Id: 1, Field: "id", Message: "duplicate id 1, kept row 3"},
+				{Row: 2, Id: 2, Field: "guid", Message: "duplicate guid b, kept row 4"},
+			},
+		},
+		{Policy: "keep-all", IsError: true},
+	}
+	for caseNum, item := range cases {
+		root := Root{Row: append([]Item(nil), rows...)}
+		dropped, err := root.Dedupe(item.Policy)
+		if item.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		ids := []int{}
+		for _, row := range root.Row {
+			ids = append(ids, row.Id)
+		}
+		if err != nil || !reflect.DeepEqual(ids, item.ExpectedIds) || !reflect.DeepEqual(dropped, item.Dropped) {
+			t.Errorf("[%d] expected %v dropping %+v, got %v dropping %+v (%v)", caseNum, item.ExpectedIds, item.Dropped, ids, dropped, err)
+		}
+		if keep := item.Policy == DuplicatesKeepFirst || item.Policy == DuplicatesKeepLast; keep && root.Validate().Err() != nil {
+			t.Errorf("[%d] expected no duplicates left, got %v", caseNum, root.Validate().Err())
+		}
+	}
+
+	root := Root{Row: []Item{{Id: 1, Guid: "a", FirstName: "Ann"}, {Id: 2, Guid: "a", FirstName: "Bob"}}}
+	if err := root.Validate().Err(); err == nil || !strings.Contains(err.Error(), "duplicate guid a, first seen in row 1") {
+		t.Errorf("expected duplicate guid problem, got %v", err)
+	}
+}
+
+func TestServerDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	content := `<root><row><id>1</id><first_name>Ann</first_name></row><row><id>1</id><first_name>Bob</first_name></row></root>`
+	path := filepath.Join(dir, "dataset.xml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := WriteBinaryDataset(&buf, Root{Row: []Item{{Id: 1, FirstName: "Ann"}, {Id: 1, FirstName: "Bob"}}}); err != nil {
+		t.Fatal(err)
+	}
+	binPath := filepath.Join(dir, "dataset.bin")
+	if err := os.WriteFile(binPath, []byte(buf.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mapped := range []bool{false, true} {
+		dataset := path
+		if mapped {
+			dataset = binPath
+		}
+		if err := (&Server{DatasetPath: dataset, MapDataset: mapped}).Reload(); err == nil {
+			t.Errorf("mapped %v: expected duplicates to be rejected by default", mapped)
+		}
+		s := &Server{DatasetPath: dataset, MapDataset: mapped, Duplicates: DuplicatesKeepLast}
+		if err := s.Reload(); err != nil {
+			t.Fatalf("mapped %v: unexpected error: %s", mapped, err)
+		}
+		if dropped := s.ReloadStatus().Dropped; len(dropped) != 1 || dropped[0].Row != 1 {
+			t.Errorf("mapped %v: expected first row dropped, got %+v", mapped, dropped)
+		}
+		if _, users := search(t, s, "token", "order_by=-1"); len(users) != 1 || users[0].Name != "Bob " {
+			t.Errorf("mapped %v: expected only Bob, got %+v", mapped, users)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package searchserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// esMaxResultWindow - больше стольких записей Elasticsearch по умолчанию за раз не отдаёт (index.max_result_window)
+const esMaxResultWindow = 10000
+
+// esSortFields - по каким полям индекса сортировать. Текст сортируется по keyword-подполю,
+// как его заводит динамический маппинг
+var esSortFields = map[string]string{"Id": "id", "Age": "age", "Name": "name.keyword", ScoreField: "_score"}
+
+// esQueryFields - в каком поле индекса искать терм запроса с префиксом name: или about:
+var esQueryFields = map[string]string{"Name": "name", "About": "about"}
+
+// ElasticsearchStorage ищет в индексе Elasticsearch или OpenSearch. Документы - пользователи с полями
+// как в xml (id, first_name, last_name, age, about, gender) и name - имя с фамилией.
+// Запрос ищется через multi_match по name и about, то есть по словам, а не по подстроке
+type ElasticsearchStorage struct {
+	// адрес кластера, например http://localhost:9200
+	URL   string
+	Index string
+	// ключ для Authorization: ApiKey, если пустой и задан Username - basic auth
+	APIKey   string
+	Username string
+	Password string
+	// пустой - http.DefaultClient
+	Client *http.Client
+}
+
+type esHit struct {
+	// релевантность, Elasticsearch считает её сам, если сортировка по _score
+	Score  *float64 `json:"_score"`
+	Source struct {
+		Item
+		Name string `json:"name"`
+	} `json:"_source"`
+}
+
+type esResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []esHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// esQueryNode переводит дерево запроса в запрос Elasticsearch: терм - multi_match, операторы - bool.
+// fuzziness Elasticsearch применяет к словам сам, к фразам он её не умеет
+func esQueryNode(node *queryNode, fuzziness int) map[string]interface{} {
+	children := make([]interface{}, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = esQueryNode(child, fuzziness)
+	}
+	switch node.Op {
+	case queryAnd:
+		return map[string]interface{}{"bool": map[string]interface{}{"must": children}}
+	case queryOr:
+		return map[string]interface{}{"bool": map[string]interface{}{"should": children, "minimum_should_match": 1}}
+	case queryNot:
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": children}}
+	}
+	fields := []string{"name", "about"}
+	if field, ok := esQueryFields[node.Term.Field]; ok {
+		fields = []string{field}
+	}
+	match := map[string]interface{}{"query": node.Term.Text, "fields": fields}
+	if node.Term.Phrase {
+		match["type"] = "phrase"
+	} else if fuzziness > 0 {
+		match["fuzziness"] = fuzziness
+	}
+	return map[string]interface{}{"multi_match": match}
+}
+
+// esQuery переводит Query в тело запроса _search
+func esQuery(query Query) (map[string]interface{}, error) {
+	if query.IgnoreAccents {
+		// диакритику убирает анализатор индекса, на запрос его не поменять
+		return nil, &ServerError{Code: searchclient.CodeBadQuery, Message: "ignore_accents is not supported by elasticsearch storage", Field: "ignore_accents"}
+	}
+	body := map[string]interface{}{
+		"from":             query.Offset,
+		"size":             query.Limit,
+		"track_total_hits": true,
+		"query":            map[string]interface{}{"match_all": map[string]interface{}{}},
+	}
+	if query.Limit < 0 || query.Limit > esMaxResultWindow {
+		body["size"] = esMaxResultWindow
+	}
+	if tree := query.searchTree(); tree != nil {
+		body["query"] = esQueryNode(tree, query.Fuzziness)
+	}
+	// фильтры на релевантность не влияют, строки сравниваются по keyword-подполю целиком
+	var filters []interface{}
+	if query.Gender != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"gender.keyword": query.Gender}})
+	}
+	if query.AgeMin != nil || query.AgeMax != nil {
+		age := map[string]interface{}{}
+		if query.AgeMin != nil {
+			age["gte"] = *query.AgeMin
+		}
+		if query.AgeMax != nil {
+			age["lte"] = *query.AgeMax
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"age": age}})
+	}
+	if len(query.IDs) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"id": query.IDs}})
+	}
+	if query.IdFrom != nil || query.IdTo != nil {
+		id := map[string]interface{}{}
+		if query.IdFrom != nil {
+			id["gte"] = *query.IdFrom
+		}
+		if query.IdTo != nil {
+			id["lte"] = *query.IdTo
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"id": id}})
+	}
+	if query.Guid != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"guid.keyword": query.Guid}})
+	}
+	if len(filters) > 0 {
+		body["query"] = map[string]interface{}{
+			"bool": map[string]interface{}{"must": body["query"], "filter": filters},
+		}
+	}
+	var sort []interface{}
+	for _, key := range query.Sort {
+		field, ok := esSortFields[key.Field]
+		if !ok {
+			return nil, errBadOrderField("sort", key.Field)
+		}
+		order := "desc"
+		if key.Order == searchclient.OrderByAsc {
+			order = "asc"
+		}
+		sort = append(sort, map[string]interface{}{field: map[string]string{"order": order}})
+	}
+	if len(sort) > 0 {
+		body["sort"] = sort
+	}
+	return body, nil
+}
+
+func (s *ElasticsearchStorage) Search(ctx context.Context, query Query) (Page, error) {
+	body, err := esQuery(query)
+	if err != nil {
+		return Page{}, err
+	}
+	var result esResponse
+	if err := s.search(ctx, body, &result); err != nil {
+		return Page{}, err
+	}
+	return esPage(result, query.scored()), nil
+}
+
+// esPage собирает страницу из ответа _search, релевантность берётся, только если по ней сортировали
+func esPage(result esResponse, scored bool) Page {
+	page := Page{Users: []Item{}, Total: result.Hits.Total.Value}
+	for _, hit := range result.Hits.Hits {
+		item := hit.Source.Item
+		item.Name = hit.Source.Name
+		if item.Name == "" {
+			item.Name = item.FirstName + " " + item.LastName
+		}
+		if hit.Score != nil && scored {
+			item.Score = *hit.Score
+		}
+		page.Users = append(page.Users, item)
+	}
+	return page
+}
+
+// Sample выбирает n случайных найденных одним запросом: function_score с random_score по seed и id
+// заменяет релевантность случайным числом, и Elasticsearch отдаёт первые n. Выборка повторяется,
+// пока не поменялся индекс, но не совпадает с выборкой MemoryStorage
+func (s *ElasticsearchStorage) Sample(ctx context.Context, query Query, n int, seed int64) (Page, error) {
+	query.Sort = nil
+	body, err := esQuery(query)
+	if err != nil {
+		return Page{}, err
+	}
+	body["from"], body["size"] = 0, n
+	body["query"] = map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query":        body["query"],
+			"random_score": map[string]interface{}{"seed": seed, "field": "id"},
+			"boost_mode":   "replace",
+		},
+	}
+	var result esResponse
+	if err := s.search(ctx, body, &result); err != nil {
+		return Page{}, err
+	}
+	return esPage(result, false), nil
+}
+
+// esAggsResponse - ответ _search с агрегатами из esAggs
+type esAggsResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		Gender struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"gender"`
+		AgeHistogram struct {
+			Buckets []struct {
+				Key      float64 `json:"key"`
+				DocCount int     `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"age_histogram"`
+		Age struct {
+			Min *float64 `json:"min"`
+			Max *float64 `json:"max"`
+			Avg *float64 `json:"avg"`
+		} `json:"age"`
+	} `json:"aggregations"`
+}
+
+// esAggs - агрегаты для Aggregate. Пустые корзины между найденными histogram отдаёт сам
+func esAggs(ageInterval int) map[string]interface{} {
+	return map[string]interface{}{
+		"gender":        map[string]interface{}{"terms": map[string]interface{}{"field": "gender.keyword", "size": 10}},
+		"age_histogram": map[string]interface{}{"histogram": map[string]interface{}{"field": "age", "interval": ageInterval}},
+		"age":           map[string]interface{}{"stats": map[string]interface{}{"field": "age"}},
+	}
+}
+
+// Aggregate считает агрегаты в Elasticsearch, без выгрузки найденных документов
+func (s *ElasticsearchStorage) Aggregate(ctx context.Context, query Query, ageInterval int) (searchclient.Aggregations, error) {
+	body, err := esQuery(query)
+	if err != nil {
+		return searchclient.Aggregations{}, err
+	}
+	delete(body, "from")
+	delete(body, "sort")
+	body["size"] = 0
+	body["aggs"] = esAggs(ageInterval)
+	var result esAggsResponse
+	if err := s.search(ctx, body, &result); err != nil {
+		return searchclient.Aggregations{}, err
+	}
+	aggs := searchclient.Aggregations{
+		Total:        result.Hits.Total.Value,
+		ByGender:     map[string]int{searchclient.GenderMale: 0, searchclient.GenderFemale: 0},
+		AgeHistogram: []searchclient.AgeBucket{},
+	}
+	for _, bucket := range result.Aggregations.Gender.Buckets {
+		aggs.ByGender[bucket.Key] = bucket.DocCount
+	}
+	for _, bucket := range result.Aggregations.AgeHistogram.Buckets {
+		from := int(bucket.Key)
+		aggs.AgeHistogram = append(aggs.AgeHistogram, searchclient.AgeBucket{From: from, To: from + ageInterval, Count: bucket.DocCount})
+	}
+	if age := result.Aggregations.Age; aggs.Total > 0 && age.Min != nil && age.Max != nil && age.Avg != nil {
+		aggs.Age = &searchclient.AgeStats{Min: int(*age.Min), Max: int(*age.Max), Avg: *age.Avg}
+	}
+	return aggs, nil
+}
+
+// search отправляет тело в _search индекса и разбирает ответ в result
+func (s *ElasticsearchStorage) search(ctx context.Context, body map[string]interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(s.URL, "/") + "/" + url.PathEscape(s.Index) + "/_search"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("elasticsearch returned %d: %s", resp.StatusCode, respBody)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("cant decode elasticsearch response: %w", err)
+	}
+	return nil
+}
+
+// Ping проверяет, что индекс существует и кластер отвечает
+func (s *ElasticsearchStorage) Ping(ctx context.Context) error {
+	endpoint := strings.TrimRight(s.URL, "/") + "/" + url.PathEscape(s.Index)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch returned %d for index %s", resp.StatusCode, s.Index)
+	}
+	return nil
+}
+
+// do отправляет запрос с авторизацией кластера
+func (s *ElasticsearchStorage) do(req *http.Request) (*http.Response, error) {
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	} else if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("elasticsearch request failed: %w", err)
+	}
+	return resp, nil
+}
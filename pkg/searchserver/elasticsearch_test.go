@@ -0,0 +1,203 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestElasticsearchQuery(t *testing.T) {
+	ageMin, idTo := 30, 30
+	cases := []struct {
+		Query    Query
+		Expected string
+	}{
+		{
+			Query:    Query{Limit: -1},
+			Expected: `{"from":0,"query":{"match_all":{}},"size":10000,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{
+				Query:  "boyd",
+				Sort:   []SortField{{Field: "Age", Order: searchclient.OrderByDesc}, {Field: "Name", Order: searchclient.OrderByAsc}},
+				Offset: 5,
+				Limit:  26,
+			},
+			Expected: `{"from":5,"query":{"multi_match":{"fields":["name","about"],"query":"boyd"}},"size":26,` +
+				`"sort":[{"age":{"order":"desc"}},{"name.keyword":{"order":"asc"}}],"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Query: `wolf about:"nulla cillum"`, Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"must":[{"multi_match":{"fields":["name","about"],"query":"wolf"}},` +
+				`{"multi_match":{"fields":["about"],"query":"nulla cillum","type":"phrase"}}]}},"size":10,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Query: "boyd OR NOT about:nulla", Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"minimum_should_match":1,"should":[` +
+				`{"multi_match":{"fields":["name","about"],"query":"boyd"}},` +
+				`{"bool":{"must_not":[{"multi_match":{"fields":["about"],"query":"nulla"}}]}}]}},"size":10,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Query: `boid "nulla cillum"`, Fuzziness: 1, Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"must":[{"multi_match":{"fields":["name","about"],"fuzziness":1,"query":"boid"}},` +
+				`{"multi_match":{"fields":["name","about"],"query":"nulla cillum","type":"phrase"}}]}},"size":10,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Query: "nulla", Sort: []SortField{{Field: ScoreField, Order: searchclient.OrderByDesc}, {Field: "Id", Order: searchclient.OrderByAsc}}, Limit: 10},
+			Expected: `{"from":0,"query":{"multi_match":{"fields":["name","about"],"query":"nulla"}},"size":10,` +
+				`"sort":[{"_score":{"order":"desc"}},{"id":{"order":"asc"}}],"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Gender: "male", Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"filter":[{"term":{"gender.keyword":"male"}}],"must":{"match_all":{}}}},` +
+				`"size":10,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{Gender: "female", AgeMin: &ageMin, Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"filter":[{"term":{"gender.keyword":"female"}},{"range":{"age":{"gte":30}}}],` +
+				`"must":{"match_all":{}}}},"size":10,"track_total_hits":true}`,
+		},
+		{
+			Query: Query{IDs: []int{1, 5, 9}, IdTo: &idTo, Guid: "f8f6bdc9", Limit: 10},
+			Expected: `{"from":0,"query":{"bool":{"filter":[{"terms":{"id":[1,5,9]}},{"range":{"id":{"lte":30}}},` +
+				`{"term":{"guid.keyword":"f8f6bdc9"}}],` +
+				`"must":{"match_all":{}}}},"size":10,"track_total_hits":true}`,
+		},
+	}
+	for caseNum, testCase := range cases {
+		body, err := esQuery(testCase.Query)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		data, _ := json.Marshal(body)
+		if string(data) != testCase.Expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, testCase.Expected, data)
+		}
+	}
+
+	if _, err := esQuery(Query{Sort: []SortField{{Field: "About"}}}); err == nil {
+		t.Error("expected error for unknown sort field")
+	}
+	if _, err := esQuery(Query{Query: "muller", IgnoreAccents: true}); err == nil {
+		t.Error("expected error for ignore_accents")
+	}
+	// синонимы раскрываются до Elasticsearch
+	synonyms, _ := ParseSynonyms(strings.NewReader("bob=robert"))
+	body, _ := esQuery(Query{Query: "bob", Synonyms: synonyms})
+	if data, _ := json.Marshal(body["query"]); !strings.Contains(string(data), `"query":"robert"`) {
+		t.Errorf("expected synonyms in elasticsearch query, got %s", data)
+	}
+}
+
+func TestElasticsearchStorage(t *testing.T) {
+	var gotPath, gotAuth, gotBody string
+	status := http.StatusOK
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"error":{"type":"index_not_found_exception"}}`))
+			return
+		}
+		w.Write([]byte(`{"hits":{"total":{"value":42,"relation":"eq"},"hits":[
+			{"_score":1.5,"_source":{"id":1,"first_name":"Boyd","last_name":"Wolf","age":22,"gender":"male","about":"Nulla"}},
+			{"_source":{"id":2,"name":"Hilda Mayer","age":21,"gender":"female"}}
+		]}}`))
+	}))
+	defer es.Close()
+
+	storage := &ElasticsearchStorage{URL: es.URL + "/", Index: "users", APIKey: "key"}
+	s := &Server{Storage: storage}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/v2/?query=wolf&order_by=-1&order_field=Id&limit=1&offset=3"))
+
+	if gotPath != "/users/_search" || gotAuth != "ApiKey key" {
+		t.Errorf("unexpected request to elasticsearch: %s with %q", gotPath, gotAuth)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(gotBody), &body); err != nil || body["from"] != 3.0 || body["size"] != 1.0 {
+		t.Errorf("unexpected request body %s", gotBody)
+	}
+	var result struct {
+		Users []UserJson `json:"users"`
+		Total int        `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("cant decode response %s: %s", rec.Body, err)
+	}
+	expected := []UserJson{
+		{Id: 1, Name: "Boyd Wolf", Age: 22, About: "Nulla", Gender: "male"},
+		{Id: 2, Name: "Hilda Mayer", Age: 21, Gender: "female"},
+	}
+	if !reflect.DeepEqual(result.Users, expected) || result.Total != 42 {
+		t.Errorf("expected %+v of 42, got %+v of %d", expected, result.Users, result.Total)
+	}
+	// _score из ответа Elasticsearch отдаётся, только если по нему сортировали
+	page, err := storage.Search(context.Background(), Query{Query: "wolf", Sort: []SortField{{Field: ScoreField, Order: searchclient.OrderByDesc}}, Limit: 2})
+	if err != nil || len(page.Users) != 2 || page.Users[0].Score != 1.5 || page.Users[1].Score != 0 {
+		t.Errorf("expected score from elasticsearch, got %+v %v", page.Users, err)
+	}
+
+	storage.APIKey = ""
+	storage.Username, storage.Password = "elastic", "secret"
+	status = http.StatusNotFound
+	if _, err := storage.Search(context.Background(), Query{Limit: -1}); err == nil {
+		t.Error("expected error for failed elasticsearch request")
+	}
+	if user, password, ok := (&http.Request{Header: http.Header{"Authorization": {gotAuth}}}).BasicAuth(); !ok || user != "elastic" || password != "secret" {
+		t.Errorf("expected basic auth, got %q", gotAuth)
+	}
+}
+
+func TestElasticsearchSample(t *testing.T) {
+	var gotBody []byte
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"hits":{"total":{"value":20000,"relation":"eq"},"hits":[
+			{"_score":0.7,"_source":{"id":12001,"name":"Hilda Mayer","age":21,"gender":"female"}}
+		]}}`))
+	}))
+	defer es.Close()
+
+	storage := &ElasticsearchStorage{URL: es.URL, Index: "users"}
+	page, err := storage.Sample(context.Background(), Query{Gender: "female", Sort: []SortField{{Field: "Id", Order: searchclient.OrderByAsc}}}, 5, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// выбранные далеко за max_result_window достаются тем же одним запросом
+	if len(page.Users) != 1 || page.Users[0].Id != 12001 || page.Users[0].Score != 0 || page.Total != 20000 {
+		t.Errorf("unexpected sample %+v", page)
+	}
+	var body struct {
+		From  int             `json:"from"`
+		Size  int             `json:"size"`
+		Sort  json.RawMessage `json:"sort"`
+		Query struct {
+			FunctionScore struct {
+				Query       map[string]interface{} `json:"query"`
+				RandomScore struct {
+					Seed  int64  `json:"seed"`
+					Field string `json:"field"`
+				} `json:"random_score"`
+			} `json:"function_score"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal(gotBody, &body); err != nil {
+		t.Fatalf("cant decode request %s: %s", gotBody, err)
+	}
+	random := body.Query.FunctionScore
+	if body.From != 0 || body.Size != 5 || body.Sort != nil || random.RandomScore.Seed != 42 || random.RandomScore.Field != "id" || random.Query["bool"] == nil {
+		t.Errorf("unexpected sample request %s", gotBody)
+	}
+}
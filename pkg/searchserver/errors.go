@@ -0,0 +1,75 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// ErrorResponse - тело ответа с ошибкой, одно на все ошибки сервера
+type ErrorResponse struct {
+	Error ErrorDetails `json:"error"`
+}
+
+// ErrorDetails - код из searchclient.Code*, текст, параметр запроса, если ошибка в нём, и id запроса из access log
+type ErrorDetails struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ServerError - ошибка обработки запроса с машиночитаемым кодом, см. searchclient.Code*.
+// Field - параметр запроса, из-за которого ошибка
+type ServerError struct {
+	Code    string
+	Message string
+	Field   string
+}
+
+// errBadOrderField - поле сортировки, по которому сортировать нельзя, param - в каком параметре оно пришло
+func errBadOrderField(param, field string) *ServerError {
+	return &ServerError{Code: searchclient.CodeBadOrderField, Message: fmt.Sprintf("cant sort by field %q", field), Field: param}
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+// JSONError пишет ошибку в ответ. Если errorMessage - ServerError, код и параметр берутся из неё.
+// Клиентам, которые просят application/problem+json, ошибка отдаётся в формате RFC 7807
+func JSONError(w http.ResponseWriter, r *http.Request, errorMessage interface{}, errorCode string, code int) {
+	details := ErrorDetails{Code: errorCode, Message: fmt.Sprintf("%v", errorMessage), RequestID: RequestID(r.Context())}
+	var serverErr *ServerError
+	if err, ok := errorMessage.(error); ok && errors.As(err, &serverErr) {
+		details.Code, details.Field = serverErr.Code, serverErr.Field
+	}
+	var errorResponse interface{} = ErrorResponse{Error: details}
+	if strings.Contains(r.Header.Get("Accept"), searchclient.ProblemContentType) {
+		problemType := "about:blank"
+		if details.Code != "" {
+			problemType = "urn:searchserver:error:" + details.Code
+		}
+		errorResponse = searchclient.Problem{
+			Type:      problemType,
+			Title:     http.StatusText(code),
+			Status:    code,
+			Detail:    details.Message,
+			Instance:  r.URL.RequestURI(),
+			Code:      details.Code,
+			Field:     details.Field,
+			RequestID: details.RequestID,
+		}
+		w.Header().Set("Content-Type", searchclient.ProblemContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
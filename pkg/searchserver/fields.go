@@ -0,0 +1,66 @@
+package searchserver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// ResponseFields - поля пользователя в ответе по порядку, Id в ответе есть всегда
+var ResponseFields = []string{"Id", "Guid", "Name", "Age", "About", "Gender"}
+
+// ParseFields разбирает fields=Id,Name - какие поля пользователя нужны клиенту. Имена без учёта регистра,
+// повторы и порядок не важны. Отдаёт выбранные поля в порядке ResponseFields, пустой параметр - nil, то есть все
+func ParseFields(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	selected := map[string]bool{"Id": true}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		field, ok := responseField(name)
+		if !ok {
+			return nil, &ServerError{
+				Code:    searchclient.CodeBadFields,
+				Message: fmt.Sprintf("unknown field %q, expected %s", name, strings.Join(ResponseFields, ", ")),
+				Field:   "fields",
+			}
+		}
+		selected[field] = true
+	}
+	fields := make([]string, 0, len(selected))
+	for _, field := range ResponseFields {
+		if selected[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+func responseField(name string) (string, bool) {
+	for _, field := range ResponseFields {
+		if strings.EqualFold(field, name) {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// only - маска m, в которой спрятаны ещё и поля не из fields. Пустой fields - m как есть
+func (m FieldMask) only(fields []string) FieldMask {
+	if len(fields) == 0 {
+		return m
+	}
+	projected := FieldMask{}
+	for field, action := range m {
+		projected[field] = action
+	}
+	for _, field := range ResponseFields {
+		if !slices.Contains(fields, field) {
+			projected[field] = MaskHide
+		}
+	}
+	return projected
+}
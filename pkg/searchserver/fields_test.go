@@ -0,0 +1,72 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	cases := []struct {
+		Value         string
+		Expected      []string
+		ExpectedError bool
+	}{
+		{Value: "", Expected: nil},
+		{Value: "Name,Id", Expected: []string{"Id", "Name"}},
+		// Id есть всегда, регистр и повторы не важны
+		{Value: "about, NAME,about", Expected: []string{"Id", "Name", "About"}},
+		{Value: "Name,Password", ExpectedError: true},
+		{Value: "Name,", ExpectedError: true},
+	}
+	for caseNum, testCase := range cases {
+		fields, err := ParseFields(testCase.Value)
+		if (err != nil) != testCase.ExpectedError {
+			t.Errorf("[%d] unexpected error: %v", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(fields, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, fields)
+		}
+	}
+}
+
+func TestServerFields(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"About": MaskRedact},
+		PageCache:   &PageCache{Size: 10},
+	}
+	cases := []struct {
+		Method   string
+		Target   string
+		Body     string
+		Token    string
+		Status   int
+		Expected string
+	}{
+		{Method: http.MethodGet, Target: "/?limit=1&order_field=Id&order_by=-1&fields=Id,Name", Token: "s-secret", Status: http.StatusOK, Expected: `[{"Id":0,"Name":"Boyd Wolf"}]`},
+		// тот же поиск без fields не должен достаться из PageCache урезанным
+		{Method: http.MethodGet, Target: "/?limit=1&order_field=Id&order_by=-1", Token: "s-secret", Status: http.StatusOK, Expected: `"About":"Nulla cillum`},
+		{Method: http.MethodGet, Target: "/v2/?limit=1&order_field=Id&order_by=-1&fields=age", Token: "s-secret", Status: http.StatusOK, Expected: `{"users":[{"Id":0,"Age":22}],"total":35}`},
+		// fields не открывает то, что прячет FieldMask
+		{Method: http.MethodGet, Target: "/?limit=1&order_field=Id&order_by=-1&fields=About", Token: "r-secret", Status: http.StatusOK, Expected: `[{"Id":0,"About":"***"}]`},
+		{Method: http.MethodPost, Target: "/search", Body: `{"limit": 1, "order_field": "Id", "order_by": -1, "fields": ["Guid"]}`, Token: "s-secret", Status: http.StatusOK, Expected: `[{"Id":0,"Guid":"1a6fa827-62f1-45f6-b579-aaead2b47169"}]`},
+		{Method: http.MethodGet, Target: "/users/7?fields=Gender", Token: "s-secret", Status: http.StatusOK, Expected: `{"Id":7,"Gender":"female"}`},
+		{Method: http.MethodGet, Target: "/?fields=Password", Token: "s-secret", Status: http.StatusBadRequest, Expected: `"code":"BAD_FIELDS","message":"unknown field \"Password\"`},
+		{Method: http.MethodGet, Target: "/users/7?fields=Password", Token: "s-secret", Status: http.StatusBadRequest, Expected: `"field":"fields"`},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(testCase.Method, testCase.Target, strings.NewReader(testCase.Body))
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status || !strings.Contains(rec.Body.String(), testCase.Expected) {
+			t.Errorf("[%d] expected %d with %s, got %d %s", caseNum, testCase.Status, testCase.Expected, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package searchserver
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldCase - текст для сравнения без учёта регистра. Это полная свёртка регистра Unicode, а не ToLower:
+// "STRASSE" совпадает со "straße", а "ΣΊΣΥΦΟΣ" - с "σίσυφος"
+func foldCase(text string) string {
+	if isASCII(text) {
+		return strings.ToLower(text)
+	}
+	// Caser хранит состояние, делить один на горутины нельзя
+	return cases.Fold().String(text)
+}
+
+// stripAccents убирает из текста диакритику: "müller" - "muller", "café" - "cafe".
+// Буквы, которые не раскладываются на основу и знак, вроде "ø" и "ł", остаются как есть
+func stripAccents(text string) string {
+	if isASCII(text) {
+		return text
+	}
+	result, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		return text
+	}
+	return result
+}
+
+// foldRunes - foldCase, а с accents ещё и stripAccents, по символам text. Символов может стать больше или меньше,
+// поэтому origin[i] - номер символа text, из которого получился i-й символ результата, и в конце ещё len(text)
+func foldRunes(text []rune, accents bool) (folded []rune, origin []int) {
+	folded = make([]rune, 0, len(text))
+	origin = make([]int, 0, len(text)+1)
+	for i, r := range text {
+		if r < utf8.RuneSelf {
+			folded, origin = append(folded, unicode.ToLower(r)), append(origin, i)
+			continue
+		}
+		s := foldCase(string(r))
+		if accents {
+			s = stripAccents(s)
+		}
+		for _, f := range s {
+			folded, origin = append(folded, f), append(origin, i)
+		}
+	}
+	return folded, append(origin, len(text))
+}
+
+// withoutAccents - дерево, в котором из текста термов убрана диакритика
+func (n *queryNode) withoutAccents() *queryNode {
+	if n == nil {
+		return nil
+	}
+	node := &queryNode{Op: n.Op, Term: n.Term}
+	node.Term.Text = stripAccents(n.Term.Text)
+	for _, child := range n.Children {
+		node.Children = append(node.Children, child.withoutAccents())
+	}
+	return node
+}
+
+// isASCII - только ли ASCII в тексте, такой текст сворачивается обычным ToLower, а диакритики в нём нет
+func isASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
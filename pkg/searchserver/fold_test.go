@@ -0,0 +1,120 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFoldCase(t *testing.T) {
+	cases := []struct {
+		A, B string
+	}{
+		{A: "Boyd Wolf", B: "boyd wolf"},
+		{A: "MÜLLER", B: "müller"},
+		{A: "STRASSE", B: "straße"},
+		{A: "ΣΊΣΥΦΟΣ", B: "σίσυφος"},
+		{A: "ЁЛКА", B: "ёлка"},
+	}
+	for caseNum, testCase := range cases {
+		if a, b := foldCase(testCase.A), foldCase(testCase.B); a != b {
+			t.Errorf("[%d] expected %q and %q to fold the same, got %q and %q", caseNum, testCase.A, testCase.B, a, b)
+		}
+	}
+	if foldCase("müller") == foldCase("muller") {
+		t.Errorf("expected accents to survive case folding")
+	}
+}
+
+func TestStripAccents(t *testing.T) {
+	cases := []struct {
+		Text     string
+		Expected string
+	}{
+		{Text: "boyd", Expected: "boyd"},
+		{Text: "müller", Expected: "muller"},
+		{Text: "café crème", Expected: "cafe creme"},
+		// уже разложенная буква со знаком
+		{Text: "mu\u0308ller", Expected: "muller"},
+		// не раскладываются
+		{Text: "søren łukasz", Expected: "søren łukasz"},
+	}
+	for caseNum, testCase := range cases {
+		if got := stripAccents(testCase.Text); got != testCase.Expected {
+			t.Errorf("[%d] expected %q, got %q", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestFoldRunes(t *testing.T) {
+	cases := []struct {
+		Text    string
+		Accents bool
+		Folded  string
+		Origin  []int
+	}{
+		{Text: "Wolf", Folded: "wolf", Origin: []int{0, 1, 2, 3, 4}},
+		{Text: "Straße", Folded: "strasse", Origin: []int{0, 1, 2, 3, 4, 4, 5, 6}},
+		{Text: "Mü", Folded: "mü", Origin: []int{0, 1, 2}},
+		{Text: "Mü", Accents: true, Folded: "mu", Origin: []int{0, 1, 2}},
+		{Text: "Mu\u0308", Accents: true, Folded: "mu", Origin: []int{0, 1, 3}},
+	}
+	for caseNum, testCase := range cases {
+		folded, origin := foldRunes([]rune(testCase.Text), testCase.Accents)
+		if string(folded) != testCase.Folded || !reflect.DeepEqual(origin, testCase.Origin) {
+			t.Errorf("[%d] expected %q %v, got %q %v", caseNum, testCase.Folded, testCase.Origin, string(folded), origin)
+		}
+	}
+}
+
+func TestServerFolding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Anna</first_name><last_name>Müller</last_name><about>Lives on a Straße</about></row>
+		<row><id>2</id><first_name>John</first_name><last_name>Muller</last_name><about>Drinks café crème</about></row>
+		<row><id>3</id><first_name>Σωκράτης</first_name><last_name>Παππάς</last_name><about>ΦΙΛΟΣΟΦΟΣ</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Query    string
+		Accents  bool
+		Expected []int
+	}{
+		{Query: "MÜLLER", Expected: []int{1}},
+		{Query: "muller", Expected: []int{2}},
+		{Query: "MULLER", Accents: true, Expected: []int{1, 2}},
+		{Query: "müller", Accents: true, Expected: []int{1, 2}},
+		{Query: "STRASSE", Expected: []int{1}},
+		{Query: "cafe", Expected: []int{}},
+		{Query: `about:"CAFE CREME"`, Accents: true, Expected: []int{2}},
+		{Query: "φιλοσοφος", Expected: []int{3}},
+		{Query: "παππας", Accents: true, Expected: []int{3}},
+		{Query: "name:muller NOT anna", Accents: true, Expected: []int{2}},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		s := &Server{DatasetPath: path, Index: index}
+		for caseNum, testCase := range cases {
+			params := url.Values{"query": {testCase.Query}, "order_field": {"Id"}, "order_by": {"-1"}}
+			if testCase.Accents {
+				params.Set("ignore_accents", "true")
+			}
+			code, users := search(t, s, "token", params.Encode())
+			if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %v (status %d)", index, caseNum, testCase.Query, testCase.Expected, userIds(users), code)
+			}
+		}
+
+		_, users := search(t, s, "token", "query=muller&ignore_accents=true&highlight=true&order_field=Id&order_by=-1")
+		if len(users) != 2 || users[0].Highlight["Name"] != "Anna <em>Müller</em>" || users[1].Highlight["Name"] != "John <em>Muller</em>" {
+			t.Errorf("[%s] expected accented match highlighted, got %+v", index, users)
+		}
+		if code, _ := search(t, s, "token", "query=muller&ignore_accents=maybe"); code != http.StatusBadRequest {
+			t.Errorf("[%s] expected %d for bad ignore_accents, got %d", index, http.StatusBadRequest, code)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package searchserver
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// MaxFuzziness - сколько опечаток в слове запроса можно простить, больше - находится почти что угодно
+const MaxFuzziness = 2
+
+// levenshtein - расстояние Левенштейна между a и b по символам, а не байтам
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// bkTree - BK-дерево слов: у каждого узла дети разложены по расстоянию до его слова, поэтому при поиске
+// похожих слов по неравенству треугольника обходятся только ветки, где они могут быть
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	word     string
+	children map[int]*bkNode
+}
+
+// newBKTree строит дерево по словам из Name и About записей после prepare
+func newBKTree(rows []Item) *bkTree {
+	tree := &bkTree{}
+	seen := map[string]bool{}
+	for _, item := range rows {
+		for _, word := range splitWords(item.nameLower + " " + item.aboutLower) {
+			if !seen[word] {
+				seen[word] = true
+				tree.add(word)
+			}
+		}
+	}
+	return tree
+}
+
+func (t *bkTree) add(word string) {
+	if t.root == nil {
+		t.root = &bkNode{word: word}
+		return
+	}
+	node := t.root
+	for {
+		distance := levenshtein(word, node.word)
+		if distance == 0 {
+			return
+		}
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = map[int]*bkNode{}
+			}
+			node.children[distance] = &bkNode{word: word}
+			return
+		}
+		node = child
+	}
+}
+
+// within - слова дерева не дальше distance от word, по алфавиту
+func (t *bkTree) within(word string, distance int) []string {
+	var result []string
+	if t.root == nil {
+		return result
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := levenshtein(word, node.word)
+		if d <= distance {
+			result = append(result, node.word)
+		}
+		for childDistance, child := range node.children {
+			if childDistance >= d-distance && childDistance <= d+distance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// fuzzyDistance - сколько опечаток прощать в слове: в словах до трёх символов ни одной, до шести - одну,
+// иначе до fuzziness, как AUTO в Elasticsearch
+func fuzzyDistance(word string, fuzziness int) int {
+	switch length := utf8.RuneCountInString(word); {
+	case length < 3:
+		return 0
+	case length < 6:
+		return min(fuzziness, 1)
+	}
+	return fuzziness
+}
+
+// fuzzy - дерево, в котором каждое слово без кавычек заменено на OR из него самого и похожих слов,
+// которые отдаёт similar. Фразы в кавычках ищутся как есть
+func (n *queryNode) fuzzy(fuzziness int, similar func(word string, distance int) []string) *queryNode {
+	if n == nil {
+		return nil
+	}
+	if n.Op != "" {
+		node := &queryNode{Op: n.Op, Children: make([]*queryNode, len(n.Children))}
+		for i, child := range n.Children {
+			node.Children[i] = child.fuzzy(fuzziness, similar)
+		}
+		return node
+	}
+	distance := fuzzyDistance(n.Term.Text, fuzziness)
+	if n.Term.Phrase || distance == 0 {
+		return n
+	}
+	node := &queryNode{Op: queryOr, Children: []*queryNode{n}}
+	for _, word := range similar(n.Term.Text, distance) {
+		if word != n.Term.Text {
+			node.Children = append(node.Children, &queryNode{Term: queryTerm{Field: n.Term.Field, Text: word}})
+		}
+	}
+	if len(node.Children) == 1 {
+		return n
+	}
+	return node
+}
@@ -0,0 +1,147 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		A, B     string
+		Expected int
+	}{
+		{A: "", B: "", Expected: 0},
+		{A: "boyd", B: "boyd", Expected: 0},
+		{A: "boid", B: "boyd", Expected: 1},
+		{A: "travsi", B: "travis", Expected: 2},
+		{A: "mayer", B: "", Expected: 5},
+		{A: "kitten", B: "sitting", Expected: 3},
+		// по символам, а не байтам
+		{A: "ёлка", B: "елка", Expected: 1},
+	}
+	for caseNum, testCase := range cases {
+		if got := levenshtein(testCase.A, testCase.B); got != testCase.Expected {
+			t.Errorf("[%d] %s %s: expected %d, got %d", caseNum, testCase.A, testCase.B, testCase.Expected, got)
+		}
+		if got := levenshtein(testCase.B, testCase.A); got != testCase.Expected {
+			t.Errorf("[%d] %s %s: expected %d, got %d", caseNum, testCase.B, testCase.A, testCase.Expected, got)
+		}
+	}
+}
+
+func TestBKTreeWithin(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	var store Store
+	snapshot, err := store.SwapIndexed(root, IndexWords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := snapshot.fuzzyWords()
+	words := map[string]bool{}
+	for _, item := range snapshot.rows {
+		for _, word := range splitWords(item.nameLower + " " + item.aboutLower) {
+			words[word] = true
+		}
+	}
+	// дерево должно находить ровно то же, что перебор всех слов
+	for caseNum, query := range []string{"boid", "nula", "travsi", "mayer", "x", "cillumm"} {
+		for distance := 0; distance <= MaxFuzziness; distance++ {
+			var expected []string
+			for word := range words {
+				if levenshtein(query, word) <= distance {
+					expected = append(expected, word)
+				}
+			}
+			sort.Strings(expected)
+			if got := tree.within(query, distance); !reflect.DeepEqual(got, expected) {
+				t.Errorf("[%d] %s within %d: expected %v, got %v", caseNum, query, distance, expected, got)
+			}
+		}
+	}
+}
+
+func TestFuzzyTree(t *testing.T) {
+	similar := func(word string, distance int) []string {
+		return map[string][]string{"boid": {"bold", "boyd"}, "wolff": {"wolf"}}[word]
+	}
+	cases := []struct {
+		Query     string
+		Fuzziness int
+		Expected  string
+	}{
+		{Query: "boid", Fuzziness: 1, Expected: `OR("boid", "bold", "boyd")`},
+		{Query: "name:boid wolff", Fuzziness: 1, Expected: `AND(OR(name:"boid", name:"bold", name:"boyd"), OR("wolff", "wolf"))`},
+		// фразы и короткие слова - как есть
+		{Query: `"boid" NOT ab`, Fuzziness: 2, Expected: `AND(PHRASE("boid"), NOT("ab"))`},
+		{Query: "unknown", Fuzziness: 2, Expected: `"unknown"`},
+	}
+	for caseNum, testCase := range cases {
+		tree := Query{Query: testCase.Query}.searchTree().fuzzy(testCase.Fuzziness, similar)
+		if got := tree.String(); got != testCase.Expected {
+			t.Errorf("[%d] %s: expected %s, got %s", caseNum, testCase.Query, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerFuzziness(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Body     string
+		Status   int
+		Expected []int
+	}{
+		{Query: "query=Boid%20Wolf", Status: http.StatusOK, Expected: []int{}},
+		{Query: "query=Boid%20Wolf&fuzziness=1", Status: http.StatusOK, Expected: []int{0}},
+		{Query: "query=hilda%20meyer&fuzziness=1", Status: http.StatusOK, Expected: []int{1}},
+		// в слове из шести букв прощается две опечатки, только если их разрешили
+		{Query: "query=travsi&fuzziness=1", Status: http.StatusOK, Expected: []int{}},
+		{Query: "query=travsi&fuzziness=2", Status: http.StatusOK, Expected: []int{7}},
+		// фраза в кавычках ищется как написана
+		{Query: "query=%22Boid%20Wolf%22&fuzziness=2", Status: http.StatusOK, Expected: []int{}},
+		{Body: `{"query": "Boid Wolf", "fuzziness": 1, "limit": 10}`, Status: http.StatusOK, Expected: []int{0}},
+		{Query: "query=boid&fuzziness=3", Status: http.StatusBadRequest},
+		{Query: "query=boid&fuzziness=-1", Status: http.StatusBadRequest},
+		{Query: "query=boid&fuzziness=auto", Status: http.StatusBadRequest},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		s := &Server{DatasetPath: datasetPath, Index: index, PageCache: &PageCache{Size: 10}}
+		for caseNum, testCase := range cases {
+			var code int
+			var users []UserJson
+			if testCase.Body != "" {
+				req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testCase.Body))
+				req.Header.Set("AccessToken", "token")
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, req)
+				code = rec.Code
+				json.Unmarshal(rec.Body.Bytes(), &users)
+			} else {
+				code, users = search(t, s, "token", "order_field=Id&order_by=-1&limit=35&"+testCase.Query)
+			}
+			if code != testCase.Status {
+				t.Errorf("[%s %d] %s: expected %d, got %d", index, caseNum, testCase.Query, testCase.Status, code)
+				continue
+			}
+			if code == http.StatusOK && !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %v", index, caseNum, testCase.Query, testCase.Expected, userIds(users))
+			}
+		}
+	}
+
+	// ошибка указывает на параметр
+	s := &Server{DatasetPath: datasetPath}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?fuzziness=9&query="+url.QueryEscape("boid")))
+	if !strings.Contains(rec.Body.String(), `"code":"BAD_QUERY"`) || !strings.Contains(rec.Body.String(), `"field":"fuzziness"`) {
+		t.Errorf("expected BAD_QUERY for fuzziness, got %s", rec.Body)
+	}
+}
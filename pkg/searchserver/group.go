@@ -0,0 +1,121 @@
+package searchserver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// MaxGroupLimit - больше стольких пользователей на группу не отдаётся
+const MaxGroupLimit = 100
+
+// GroupBy - как группировать найденных: по полу или по десятилетиям возраста и сколько первых записей отдать в группе
+type GroupBy struct {
+	// searchclient.GroupByGender или searchclient.GroupByAgeDecade, пустой - без группировки
+	Field string
+	// сколько первых по сортировке запроса пользователей отдать в каждой группе, 0 - только число
+	Limit int
+}
+
+// userGroup - группа найденных и её первые записи
+type userGroup struct {
+	Key   string
+	Count int
+	Users []Item
+}
+
+// maskedField - какое поле UserJson выдаёт группировка
+func (g GroupBy) maskedField() string {
+	if g.Field == searchclient.GroupByAgeDecade {
+		return "Age"
+	}
+	return "Gender"
+}
+
+// ParseGroupBy разбирает group_by и group_limit, без group_by группировки нет и group_limit не смотрится
+func ParseGroupBy(params url.Values) (GroupBy, error) {
+	field := strings.ToLower(params.Get("group_by"))
+	switch field {
+	case "":
+		return GroupBy{}, nil
+	case searchclient.GroupByGender, searchclient.GroupByAgeDecade:
+	default:
+		return GroupBy{}, &ServerError{
+			Code:    searchclient.CodeBadQuery,
+			Message: fmt.Sprintf("invalid group_by: %s, expected %s or %s", params.Get("group_by"), searchclient.GroupByGender, searchclient.GroupByAgeDecade),
+			Field:   "group_by",
+		}
+	}
+	group := GroupBy{Field: field}
+	if value := params.Get("group_limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 || limit > MaxGroupLimit {
+			return GroupBy{}, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid group_limit: %s, expected 0..%d", value, MaxGroupLimit), Field: "group_limit"}
+		}
+		group.Limit = limit
+	}
+	return group, nil
+}
+
+// group делит найденных по запросу на группы: число в каждой берётся из агрегатов, а первые записи -
+// отдельным поиском с фильтром группы, поэтому группировка работает во всех хранилищах и через тот же кэш.
+// Пустых групп в ответе нет, группы идут по возрастанию ключа
+func (s *Server) group(ctx context.Context, query Query, group GroupBy) ([]userGroup, int, error) {
+	aggs, err := s.aggregate(ctx, query, 10)
+	if err != nil {
+		return nil, 0, err
+	}
+	groups := []userGroup{}
+	var filters []Query
+	if group.Field == searchclient.GroupByGender {
+		genders := make([]string, 0, len(aggs.ByGender))
+		for gender, count := range aggs.ByGender {
+			if count > 0 {
+				genders = append(genders, gender)
+			}
+		}
+		sort.Strings(genders)
+		for _, gender := range genders {
+			groups = append(groups, userGroup{Key: gender, Count: aggs.ByGender[gender]})
+			filter := query
+			filter.Gender = gender
+			filters = append(filters, filter)
+		}
+	} else {
+		for _, bucket := range aggs.AgeHistogram {
+			if bucket.Count == 0 {
+				continue
+			}
+			groups = append(groups, userGroup{Key: fmt.Sprintf("%d-%d", bucket.From, bucket.To-1), Count: bucket.Count})
+			filter := query
+			// границы группы сужают границы запроса, а не заменяют их
+			from, to := bucket.From, bucket.To-1
+			if query.AgeMin != nil && *query.AgeMin > from {
+				from = *query.AgeMin
+			}
+			if query.AgeMax != nil && *query.AgeMax < to {
+				to = *query.AgeMax
+			}
+			filter.AgeMin, filter.AgeMax = &from, &to
+			filters = append(filters, filter)
+		}
+	}
+	for i, filter := range filters {
+		groups[i].Users = []Item{}
+		if group.Limit == 0 {
+			continue
+		}
+		filter.Offset, filter.Limit = 0, group.Limit
+		page, err := s.search(ctx, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups[i].Users = page.Users
+	}
+	return groups, aggs.Total, nil
+}
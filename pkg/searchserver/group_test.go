@@ -0,0 +1,157 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	cases := []struct {
+		Params   url.Values
+		Expected GroupBy
+		IsError  bool
+	}{
+		{Params: url.Values{}, Expected: GroupBy{}},
+		{Params: url.Values{"group_limit": {"bad"}}, Expected: GroupBy{}},
+		{Params: url.Values{"group_by": {"Gender"}}, Expected: GroupBy{Field: searchclient.GroupByGender}},
+		{Params: url.Values{"group_by": {"age_decade"}, "group_limit": {"3"}}, Expected: GroupBy{Field: searchclient.GroupByAgeDecade, Limit: 3}},
+		{Params: url.Values{"group_by": {"name"}}, IsError: true},
+		{Params: url.Values{"group_by": {"gender"}, "group_limit": {"-1"}}, IsError: true},
+		{Params: url.Values{"group_by": {"gender"}, "group_limit": {"101"}}, IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		group, err := ParseGroupBy(testCase.Params)
+		if testCase.IsError != (err != nil) || group != testCase.Expected {
+			t.Errorf("[%d] expected %+v (error %v), got %+v %v", caseNum, testCase.Expected, testCase.IsError, group, err)
+		}
+	}
+}
+
+func TestServerGroupBy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Boyd</first_name><last_name>Wolf</last_name><age>22</age><gender>male</gender><about>Nulla</about></row>
+		<row><id>2</id><first_name>Hilda</first_name><last_name>Mayer</last_name><age>21</age><gender>female</gender><about>Nulla</about></row>
+		<row><id>3</id><first_name>Brooks</first_name><last_name>Aguilar</last_name><age>34</age><gender>male</gender><about>Nulla</about></row>
+		<row><id>4</id><first_name>Beth</first_name><last_name>Wynn</last_name><age>31</age><gender>female</gender><about>Sit</about></row>
+		<row><id>5</id><first_name>Owen</first_name><last_name>Lynn</last_name><age>30</age><gender>male</gender><about>Nulla</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		DatasetPath: path,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"Age": MaskHide},
+	}
+	type group struct {
+		Key   string
+		Count int
+		Ids   []int
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Total    int
+		Expected []group
+	}{
+		{
+			Target:   "/v2/?group_by=gender",
+			Token:    "r-secret",
+			Status:   http.StatusOK,
+			Total:    5,
+			Expected: []group{{Key: "female", Count: 2, Ids: []int{}}, {Key: "male", Count: 3, Ids: []int{}}},
+		},
+		{
+			// в группе - первые по сортировке запроса, limit и offset не мешают
+			Target:   "/v2/?group_by=gender&group_limit=2&order_field=Id&order_by=-1&limit=1&offset=3",
+			Token:    "r-secret",
+			Status:   http.StatusOK,
+			Total:    5,
+			Expected: []group{{Key: "female", Count: 2, Ids: []int{2, 4}}, {Key: "male", Count: 3, Ids: []int{1, 3}}},
+		},
+		{
+			Target:   "/v2/?query=nulla&gender=male&group_by=gender&group_limit=5&order_field=Id&order_by=-1",
+			Token:    "r-secret",
+			Status:   http.StatusOK,
+			Total:    3,
+			Expected: []group{{Key: "male", Count: 3, Ids: []int{1, 3, 5}}},
+		},
+		{
+			Target:   "/v2/?group_by=age_decade&group_limit=1&order_field=Age&order_by=1",
+			Token:    "s-secret",
+			Status:   http.StatusOK,
+			Total:    5,
+			Expected: []group{{Key: "20-29", Count: 2, Ids: []int{1}}, {Key: "30-39", Count: 3, Ids: []int{3}}},
+		},
+		{
+			// границы возраста запроса сужают группы
+			Target:   "/v2/?group_by=age_decade&group_limit=10&age_max=30&order_field=Id&order_by=-1",
+			Token:    "s-secret",
+			Status:   http.StatusOK,
+			Total:    3,
+			Expected: []group{{Key: "20-29", Count: 2, Ids: []int{1, 2}}, {Key: "30-39", Count: 1, Ids: []int{5}}},
+		},
+		{Target: "/v2/?query=nothing&group_by=gender", Token: "r-secret", Status: http.StatusOK, Expected: []group{}},
+		{Target: "/?group_by=gender", Token: "r-secret", Status: http.StatusBadRequest},
+		{Target: "/v2/?group_by=name", Token: "r-secret", Status: http.StatusBadRequest},
+		{Target: "/v2/?group_by=gender&group_limit=1000", Token: "r-secret", Status: http.StatusBadRequest},
+		// возраст спрятан от токена без pii:read, группы по нему его выдают
+		{Target: "/v2/?group_by=age_decade", Token: "r-secret", Status: http.StatusForbidden},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status != http.StatusOK {
+			continue
+		}
+		var resp searchclient.SearchResponseV2
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("[%d] cant decode response: %s", caseNum, err)
+		}
+		got := []group{}
+		for _, g := range resp.Groups {
+			ids := []int{}
+			for _, user := range g.Users {
+				ids = append(ids, user.Id)
+			}
+			got = append(got, group{Key: g.Key, Count: g.Count, Ids: ids})
+		}
+		if !reflect.DeepEqual(got, testCase.Expected) || resp.Total != testCase.Total || rec.Header().Get("Link") != "" {
+			t.Errorf("[%d] expected %+v of %d, got %+v of %d", caseNum, testCase.Expected, testCase.Total, got, resp.Total)
+		}
+	}
+
+	// в группах пользователи - с той же маской, что и в поиске
+	req := httptest.NewRequest(http.MethodGet, "/v2/?group_by=gender&group_limit=1", nil)
+	req.Header.Set("AccessToken", "r-secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var resp struct {
+		Groups []struct {
+			Users []map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Groups) != 2 {
+		t.Fatalf("cant decode groups %s: %v", rec.Body, err)
+	}
+	if _, ok := resp.Groups[0].Users[0]["Age"]; ok {
+		t.Errorf("expected hidden age in groups, got %v", resp.Groups[0].Users[0])
+	}
+}
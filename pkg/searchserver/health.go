@@ -0,0 +1,71 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// readyTimeout - сколько /readyz ждёт хранилище и кэш
+const readyTimeout = 2 * time.Second
+
+// HealthResponse - тело ответа /healthz и /readyz
+type HealthResponse struct {
+	Status string `json:"status"`
+	// итог каждой проверки: "ok" или текст ошибки
+	Checks map[string]string `json:"checks,omitempty"`
+	// последняя неудачная перезагрузка датасета, сервер при этом работает на старом
+	ReloadError string `json:"reload_error,omitempty"`
+}
+
+// serveHealth отвечает на /healthz: процесс жив и обрабатывает запросы
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, HealthResponse{Status: "ok"}, http.StatusOK)
+}
+
+// serveReady отвечает на /readyz: датасет загружен и прошёл проверку, хранилище отвечает.
+// Недоступный кэш попадает в ответ, но готовности не мешает - поиск работает и без него
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	resp := HealthResponse{Status: "ok", Checks: map[string]string{}}
+	code := http.StatusOK
+	fail := func(check string, err error) {
+		resp.Checks[check] = err.Error()
+		resp.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	if s.Storage == nil {
+		if _, err := s.loadDataset(); err != nil {
+			fail("dataset", err)
+		} else {
+			resp.Checks["dataset"] = "ok"
+		}
+	} else if pinger, ok := s.Storage.(Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			fail("storage", err)
+		} else {
+			resp.Checks["storage"] = "ok"
+		}
+	}
+	if pinger, ok := s.Cache.(Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			resp.Checks["cache"] = err.Error()
+		} else {
+			resp.Checks["cache"] = "ok"
+		}
+	}
+	resp.ReloadError = s.ReloadStatus().LastError
+	writeJSON(w, resp, code)
+}
+
+// writeJSON пишет служебный ответ, который не должен оседать в кэшах
+func writeJSON(w http.ResponseWriter, resp interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
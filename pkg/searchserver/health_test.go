@@ -0,0 +1,93 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pingStorage - хранилище, которое отвечает на Ping заданной ошибкой
+type pingStorage struct {
+	Storage
+	err error
+}
+
+func (p *pingStorage) Ping(ctx context.Context) error {
+	return p.err
+}
+
+// pingCache - кэш, который ничего не хранит и отвечает на Ping заданной ошибкой
+type pingCache struct {
+	err error
+}
+
+func (p *pingCache) Get(ctx context.Context, key string) (Page, bool) { return Page{}, false }
+func (p *pingCache) Set(ctx context.Context, key string, page Page)   {}
+func (p *pingCache) Ping(ctx context.Context) error                   { return p.err }
+
+func TestServerHealth(t *testing.T) {
+	down := errors.New("connection refused")
+	cases := []struct {
+		Server         *Server
+		Path           string
+		ExpectedCode   int
+		ExpectedChecks map[string]string
+	}{
+		// живость не зависит от датасета
+		{Server: &Server{DatasetPath: "missing.xml"}, Path: "/healthz", ExpectedCode: http.StatusOK},
+		{Server: &Server{DatasetPath: datasetPath}, Path: "/readyz", ExpectedCode: http.StatusOK,
+			ExpectedChecks: map[string]string{"dataset": "ok"}},
+		{Server: &Server{DatasetPath: "missing.xml"}, Path: "/readyz", ExpectedCode: http.StatusServiceUnavailable},
+		{Server: &Server{Storage: &pingStorage{}}, Path: "/readyz", ExpectedCode: http.StatusOK,
+			ExpectedChecks: map[string]string{"storage": "ok"}},
+		{Server: &Server{Storage: &pingStorage{err: down}}, Path: "/readyz", ExpectedCode: http.StatusServiceUnavailable,
+			ExpectedChecks: map[string]string{"storage": down.Error()}},
+		// без кэша поиск работает, так что готовности он не мешает
+		{Server: &Server{Storage: &pingStorage{}, Cache: &pingCache{err: down}}, Path: "/readyz", ExpectedCode: http.StatusOK,
+			ExpectedChecks: map[string]string{"storage": "ok", "cache": down.Error()}},
+	}
+	for caseNum, testCase := range cases {
+		rec := httptest.NewRecorder()
+		// пробы ходят без токена
+		testCase.Server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, testCase.Path, nil))
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected code %d, got %d: %s", caseNum, testCase.ExpectedCode, rec.Code, rec.Body)
+			continue
+		}
+		var resp HealthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("[%d] cant decode response: %s", caseNum, err)
+			continue
+		}
+		for check, expected := range testCase.ExpectedChecks {
+			if resp.Checks[check] != expected {
+				t.Errorf("[%d] expected %s check %q, got %q", caseNum, check, expected, resp.Checks[check])
+			}
+		}
+	}
+}
+
+func TestElasticsearchPing(t *testing.T) {
+	status := http.StatusOK
+	var gotMethod, gotPath string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.WriteHeader(status)
+	}))
+	defer es.Close()
+
+	storage := &ElasticsearchStorage{URL: es.URL, Index: "users"}
+	if err := storage.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if gotMethod != http.MethodHead || gotPath != "/users" {
+		t.Errorf("unexpected ping request %s %s", gotMethod, gotPath)
+	}
+	status = http.StatusNotFound
+	if err := storage.Ping(context.Background()); err == nil {
+		t.Error("expected error for missing index")
+	}
+}
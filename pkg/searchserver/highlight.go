@@ -0,0 +1,222 @@
+package searchserver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"hw4/pkg/searchclient"
+)
+
+// метки, которыми в подсветке обёрнуто найденное, как по умолчанию в Elasticsearch.
+// Текст между ними не экранируется: показывать подсветку как HTML можно только после экранирования
+const (
+	HighlightPre  = "<em>"
+	HighlightPost = "</em>"
+)
+
+// сколько символов About показывать в подсветке: до первого совпадения и всего
+const (
+	highlightContext = 40
+	highlightSnippet = 160
+)
+
+// highlightEllipsis - чем отмечен обрезанный край фрагмента About
+const highlightEllipsis = "…"
+
+// ParseHighlight разбирает параметр highlight, пустой - без подсветки
+func ParseHighlight(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	highlight, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid highlight: %s, expected true or false", value), Field: "highlight"}
+	}
+	return highlight, nil
+}
+
+// highlighter размечает в Name и About то, что нашёл запрос. Работает по тексту записи, а не по хранилищу,
+// поэтому одинаково для всех Storage
+type highlighter struct {
+	terms     []queryTerm
+	fuzziness int
+	// сравнивать без диакритики, Query.IgnoreAccents
+	accents bool
+	// в About подсвечиваются и слова с той же основой, nil - нет
+	analyzer *Analyzer
+}
+
+// newHighlighter - подсветка для запроса, nil - подсвечивать нечего. Части под NOT не подсвечиваются.
+// С analyzer в About подсвечиваются и слова, найденные по основе
+func newHighlighter(query Query, analyzer *Analyzer) *highlighter {
+	h := &highlighter{fuzziness: query.Fuzziness, accents: query.IgnoreAccents, analyzer: analyzer}
+	for _, node := range query.searchTree().positiveTerms(nil) {
+		h.terms = append(h.terms, node.Term)
+	}
+	if len(h.terms) == 0 {
+		return nil
+	}
+	return h
+}
+
+// highlight - размеченные Name и About записи, в которых что-то нашлось. Поля, которые mask прячет
+// или маскирует, не подсвечиваются, чтобы подсветка их не выдала
+func (h *highlighter) highlight(item *Item, mask FieldMask) map[string]string {
+	if h == nil {
+		return nil
+	}
+	var result map[string]string
+	for _, field := range []string{"Name", "About"} {
+		if mask[field] != "" {
+			continue
+		}
+		text := item.Name
+		if field == "About" {
+			text = item.About
+		}
+		runes := []rune(text)
+		ranges := h.ranges(runes, field)
+		if len(ranges) == 0 {
+			continue
+		}
+		if result == nil {
+			result = map[string]string{}
+		}
+		if field == "About" {
+			result[field] = markSnippet(runes, ranges)
+		} else {
+			result[field] = mark(runes, ranges, 0, len(runes))
+		}
+	}
+	return result
+}
+
+// ranges - где в тексте поля совпали термы, в символах, по возрастанию и без пересечений.
+// Термы ищутся в тексте после foldRunes, а найденное переводится обратно в символы исходного текста
+func (h *highlighter) ranges(runes []rune, field string) [][2]int {
+	lower, origin := foldRunes(runes, h.accents)
+	var ranges [][2]int
+	for _, term := range h.terms {
+		if term.Field != "" && term.Field != field {
+			continue
+		}
+		text := []rune(term.Text)
+		for i := 0; len(text) > 0 && i+len(text) <= len(lower); i++ {
+			if string(lower[i:i+len(text)]) == term.Text {
+				ranges = append(ranges, [2]int{i, i + len(text)})
+			}
+		}
+		// с fuzziness находятся и похожие слова целиком
+		if distance := fuzzyDistance(term.Text, h.fuzziness); !term.Phrase && distance > 0 {
+			for _, word := range wordRanges(lower) {
+				if levenshtein(string(lower[word[0]:word[1]]), term.Text) <= distance {
+					ranges = append(ranges, word)
+				}
+			}
+		}
+		if stem := h.stem(term); stem != "" && field == "About" {
+			for _, word := range wordRanges(lower) {
+				if h.analyzer.stem(string(lower[word[0]:word[1]])) == stem {
+					ranges = append(ranges, word)
+				}
+			}
+		}
+	}
+	for i, r := range ranges {
+		ranges[i] = [2]int{origin[r[0]], origin[r[1]-1] + 1}
+	}
+	return mergeRanges(ranges)
+}
+
+// stem - основа слова term для поиска по основам, пустая - term так не ищется
+func (h *highlighter) stem(term queryTerm) string {
+	if h.analyzer == nil || term.Phrase || term.Field == "Name" {
+		return ""
+	}
+	words := splitWords(term.Text)
+	if len(words) != 1 {
+		return ""
+	}
+	return h.analyzer.stem(words[0])
+}
+
+// wordRanges - где в тексте слова из букв и цифр, как у splitWords
+func wordRanges(runes []rune) [][2]int {
+	var words [][2]int
+	start := -1
+	for i, r := range runes {
+		letter := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case letter && start < 0:
+			start = i
+		case !letter && start >= 0:
+			words, start = append(words, [2]int{start, i}), -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, [2]int{start, len(runes)})
+	}
+	return words
+}
+
+// mergeRanges сортирует диапазоны и склеивает пересекающиеся и соседние
+func mergeRanges(ranges [][2]int) [][2]int {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	var merged [][2]int
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r[0] <= merged[last][1] {
+			merged[last][1] = max(merged[last][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// mark - текст от from до to с размеченными ranges
+func mark(runes []rune, ranges [][2]int, from, to int) string {
+	var b strings.Builder
+	pos := from
+	for _, r := range ranges {
+		start, end := max(r[0], from), min(r[1], to)
+		if start >= end {
+			continue
+		}
+		b.WriteString(string(runes[pos:start]))
+		b.WriteString(HighlightPre)
+		b.WriteString(string(runes[start:end]))
+		b.WriteString(HighlightPost)
+		pos = end
+	}
+	b.WriteString(string(runes[pos:to]))
+	return b.String()
+}
+
+// markSnippet - кусок текста вокруг первого совпадения, обрезанный по границам слов
+func markSnippet(runes []rune, ranges [][2]int) string {
+	from := max(ranges[0][0]-highlightContext, 0)
+	for from > 0 && !unicode.IsSpace(runes[from-1]) {
+		from--
+	}
+	to := min(max(from+highlightSnippet, ranges[0][1]), len(runes))
+	for to < len(runes) && !unicode.IsSpace(runes[to]) {
+		to++
+	}
+	// совпадение, которое не влезло целиком, не обрезается посередине
+	for _, r := range ranges {
+		if r[0] < to && r[1] > to {
+			to = r[1]
+		}
+	}
+	snippet := mark(runes, ranges, from, to)
+	if from > 0 {
+		snippet = highlightEllipsis + strings.TrimLeftFunc(snippet, unicode.IsSpace)
+	}
+	if to < len(runes) {
+		snippet = strings.TrimRightFunc(snippet, unicode.IsSpace) + highlightEllipsis
+	}
+	return snippet
+}
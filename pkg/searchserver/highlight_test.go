@@ -0,0 +1,112 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHighlighter(t *testing.T) {
+	item := &Item{Name: "Boyd Wolf", About: "Nulla cillum enim. Wolfram nulla, NULLA!"}
+	cases := []struct {
+		Query    Query
+		Mask     FieldMask
+		Expected map[string]string
+	}{
+		{Query: Query{Query: "nulla"}, Expected: map[string]string{"About": "<em>Nulla</em> cillum enim. Wolfram <em>nulla</em>, <em>NULLA</em>!"}},
+		{Query: Query{Query: "wolf"}, Expected: map[string]string{"Name": "Boyd <em>Wolf</em>", "About": "Nulla cillum enim. <em>Wolf</em>ram nulla, NULLA!"}},
+		// поле терма и NOT
+		{Query: Query{Query: "name:wolf NOT nulla"}, Expected: map[string]string{"Name": "Boyd <em>Wolf</em>"}},
+		// пересечения склеиваются
+		{Query: Query{Query: `"boyd w" "d wolf"`}, Expected: map[string]string{"Name": "<em>Boyd Wolf</em>"}},
+		// похожие слова с fuzziness - целиком
+		{Query: Query{Query: "boid", Fuzziness: 1}, Expected: map[string]string{"Name": "<em>Boyd</em> Wolf"}},
+		{Query: Query{Query: "boid"}, Expected: nil},
+		// спрятанные и замаскированные поля не подсвечиваются
+		{Query: Query{Query: "wolf"}, Mask: FieldMask{"About": MaskRedact}, Expected: map[string]string{"Name": "Boyd <em>Wolf</em>"}},
+		{Query: Query{Query: "wolf"}, Mask: FieldMask{"Name": MaskHide, "About": MaskHide}, Expected: nil},
+	}
+	for caseNum, testCase := range cases {
+		if got := newHighlighter(testCase.Query, nil).highlight(item, testCase.Mask); !reflect.DeepEqual(got, testCase.Expected) {
+			t.Errorf("[%d] %s: expected %v, got %v", caseNum, testCase.Query.Query, testCase.Expected, got)
+		}
+	}
+	if newHighlighter(Query{}, nil) != nil || newHighlighter(Query{Query: "NOT wolf"}, nil) != nil {
+		t.Error("expected no highlighter without positive terms")
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = "lorem"
+	}
+	words[50] = "Nulla"
+	words[60] = "nulla"
+	about := strings.Join(words, " ")
+	got := newHighlighter(Query{Query: "nulla"}, nil).highlight(&Item{About: about}, nil)["About"]
+	if !strings.HasPrefix(got, "…lorem") || !strings.HasSuffix(got, "lorem…") {
+		t.Errorf("expected snippet cut on both sides, got %q", got)
+	}
+	if !strings.Contains(got, "<em>Nulla</em>") || !strings.Contains(got, "<em>nulla</em>") {
+		t.Errorf("expected both matches in snippet, got %q", got)
+	}
+	if before := strings.Index(got, "<em>"); before > highlightContext+len("…")+len("lorem") {
+		t.Errorf("expected about %d characters before the match, got %q", highlightContext, got)
+	}
+}
+
+func TestServerHighlight(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"About": MaskRedact},
+		PageCache:   &PageCache{Size: 10},
+	}
+	get := func(token, target string) (int, []UserJson) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("AccessToken", token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		var users []UserJson
+		json.Unmarshal(rec.Body.Bytes(), &users)
+		return rec.Code, users
+	}
+
+	// тот же поиск без подсветки не должен достаться из кэша с ней и наоборот
+	if _, users := get("s-secret", "/?limit=1&order_field=Id&order_by=-1&query=wolf%20nulla"); len(users) != 1 || users[0].Highlight != nil {
+		t.Errorf("expected no highlight by default, got %+v", users)
+	}
+	_, users := get("s-secret", "/?limit=1&order_field=Id&order_by=-1&query=wolf%20nulla&highlight=true")
+	if len(users) != 1 || users[0].Highlight["Name"] != "Boyd <em>Wolf</em>" || !strings.HasPrefix(users[0].Highlight["About"], "<em>Nulla</em> cillum") {
+		t.Errorf("expected highlighted Name and About, got %+v", users)
+	}
+	// About под маской не подсвечивается
+	_, users = get("r-secret", "/?limit=1&order_field=Id&order_by=-1&query=wolf%20nulla&highlight=true")
+	if len(users) != 1 || !reflect.DeepEqual(users[0].Highlight, map[string]string{"Name": "Boyd <em>Wolf</em>"}) {
+		t.Errorf("expected only Name highlighted under mask, got %+v", users)
+	}
+	// и не выбранный в fields тоже
+	_, users = get("s-secret", "/?limit=1&order_field=Id&order_by=-1&query=wolf%20nulla&highlight=true&fields=About")
+	if len(users) != 1 || !reflect.DeepEqual(users[0].Highlight, map[string]string{"About": users[0].Highlight["About"]}) || users[0].Highlight["About"] == "" {
+		t.Errorf("expected only About highlighted with fields=About, got %+v", users)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query": "boyd", "highlight": true, "limit": 1}`))
+	req.Header.Set("AccessToken", "s-secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var posted []UserJson
+	json.Unmarshal(rec.Body.Bytes(), &posted)
+	if len(posted) != 1 || !reflect.DeepEqual(posted[0].Highlight, map[string]string{"Name": "<em>Boyd</em> Wolf"}) {
+		t.Errorf("expected highlight from POST body, got %s", rec.Body)
+	}
+
+	if code, _ := get("s-secret", "/?query=wolf&highlight=maybe"); code != http.StatusBadRequest {
+		t.Errorf("expected %d for bad highlight, got %d", http.StatusBadRequest, code)
+	}
+}
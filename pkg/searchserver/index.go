@@ -0,0 +1,84 @@
+package searchserver
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// InvertedIndex - слова из Name и About после foldCase и номера записей, в которых они встречаются.
+// Поиск идёт по подстроке, поэтому индекс не отвечает на запрос сам, а сужает круг записей, которые надо проверить
+type InvertedIndex struct {
+	postings map[string][]int
+	terms    []string
+}
+
+// splitWords режет текст на слова из букв и цифр
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// NewInvertedIndex строит индекс по записям после prepare, номер записи - её позиция в rows
+func NewInvertedIndex(rows []Item) *InvertedIndex {
+	index := &InvertedIndex{postings: map[string][]int{}}
+	for pos, item := range rows {
+		text := item.nameLower + " " + item.aboutLower
+		for _, word := range splitWords(text) {
+			postings := index.postings[word]
+			if len(postings) > 0 && postings[len(postings)-1] == pos {
+				continue
+			}
+			index.postings[word] = append(postings, pos)
+		}
+	}
+	index.terms = make([]string, 0, len(index.postings))
+	for term := range index.postings {
+		index.terms = append(index.terms, term)
+	}
+	sort.Strings(index.terms)
+	return index
+}
+
+func (ix *InvertedIndex) size() (int, int) {
+	postings := 0
+	for _, positions := range ix.postings {
+		postings += len(positions)
+	}
+	return len(ix.postings), postings
+}
+
+// Candidates отдаёт по возрастанию номера записей, которые могут содержать query как подстроку:
+// каждое слово запроса обязано быть подстрокой какого-то слова записи. false - в запросе нет слов
+// и индекс ничем не поможет
+func (ix *InvertedIndex) Candidates(query string) ([]int, bool) {
+	words := splitWords(foldCase(query))
+	if len(words) == 0 {
+		return nil, false
+	}
+	var candidates map[int]bool
+	for _, word := range words {
+		matched := map[int]bool{}
+		for _, term := range ix.terms {
+			if !strings.Contains(term, word) {
+				continue
+			}
+			for _, pos := range ix.postings[term] {
+				if candidates == nil || candidates[pos] {
+					matched[pos] = true
+				}
+			}
+		}
+		candidates = matched
+		if len(candidates) == 0 {
+			break
+		}
+	}
+	positions := make([]int, 0, len(candidates))
+	for pos := range candidates {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	return positions, true
+}
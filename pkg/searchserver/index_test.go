@@ -0,0 +1,75 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func prepared(items ...Item) []Item {
+	for i := range items {
+		items[i].prepare()
+	}
+	return items
+}
+
+func TestInvertedIndexCandidates(t *testing.T) {
+	index := NewInvertedIndex(prepared(
+		Item{FirstName: "Boyd", LastName: "Wolf", About: "Nulla cillum"},
+		Item{FirstName: "Hilda", LastName: "Mayer", About: "Sit commodo, consectetur"},
+		Item{FirstName: "Иван", LastName: "Петров", About: "Любит Nulla"},
+	))
+	cases := []struct {
+		Query    string
+		Expected []int
+		Ok       bool
+	}{
+		{Query: "nulla", Expected: []int{0, 2}, Ok: true},
+		{Query: "ULL", Expected: []int{0, 2}, Ok: true},
+		{Query: "yd wo", Expected: []int{0}, Ok: true},
+		{Query: "modo, con", Expected: []int{1}, Ok: true},
+		{Query: "иВАН", Expected: []int{2}, Ok: true},
+		{Query: "wolf hilda", Expected: []int{}, Ok: true},
+		{Query: "xyz", Expected: []int{}, Ok: true},
+		{Query: " ,", Ok: false},
+	}
+	for caseNum, testCase := range cases {
+		got, ok := index.Candidates(testCase.Query)
+		if ok != testCase.Ok || (ok && !reflect.DeepEqual(got, testCase.Expected)) {
+			t.Errorf("[%d] %q: expected %v %v, got %v %v", caseNum, testCase.Query, testCase.Expected, testCase.Ok, got, ok)
+		}
+	}
+}
+
+// поиск по индексу обязан находить ровно то же, что и полный проход SearchItems
+func TestSnapshotSearchMatchesSearchItems(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{"", " ", "  ", ",", ".\n", "boyd", "BOYD WOLF", "yd wo", "d w", "nulla cillum", "ea. ",
+		"sit amet", "Et", "e", "xyz", "ex\nlab", "Hilda", "a-b"}
+	// все подстроки из начала нескольких описаний
+	for _, item := range root.Row[:5] {
+		text := item.FirstName + " " + item.LastName + " " + item.About
+		for start := 0; start < 40; start += 3 {
+			for length := 1; length < 12; length += 2 {
+				queries = append(queries, text[start:start+length])
+			}
+		}
+	}
+	for _, kind := range []string{IndexWords, IndexTrigrams} {
+		var store Store
+		snapshot, err := store.SwapIndexed(root, kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, query := range queries {
+			expected := snapshot.Root()
+			expected.SearchItems(query)
+			got := snapshot.Search(query)
+			if !reflect.DeepEqual(got.Row, expected.Row) {
+				t.Errorf("%s %q: index search differs from full scan: %d vs %d rows", kind, query, len(got.Row), len(expected.Row))
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package searchserver
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWT проверяет токены JWT от внешнего провайдера (SSO): подпись HS256 общим секретом или RS256
+// открытым ключом провайдера, срок действия, издателя и аудиторию. Токен без exp не принимается
+type JWT struct {
+	// секрет для HS256, пустой - HS256 не принимается
+	Secret []byte
+	// открытый ключ для RS256, пустой - RS256 не принимается. См. LoadRSAPublicKey
+	PublicKey *rsa.PublicKey
+	// каким должен быть iss, пустой - любым
+	Issuer string
+	// что должно быть в aud, пустой - не проверять
+	Audience string
+	// насколько могут расходиться часы у нас и у провайдера при проверке exp и nbf
+	Leeway time.Duration
+
+	// текущее время, для тестов
+	now func() time.Time
+}
+
+// Claims - поля JWT, которые нужны серверу
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	// нулевое - не задано
+	NotBefore time.Time
+	// из claim scope (через пробел) или scp, пустой - DefaultScopes
+	Scopes []string
+}
+
+var (
+	errJWTMalformed = errors.New("malformed jwt")
+	errJWTSignature = errors.New("invalid jwt signature")
+	errJWTExpired   = errors.New("jwt expired")
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Scope     string          `json:"scope"`
+	Scp       json.RawMessage `json:"scp"`
+}
+
+// LooksLikeJWT - токен из трёх частей через точку, остальное точно не JWT
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate проверяет подпись и поля токена и отдаёт его claims
+func (j *JWT) Validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errJWTMalformed
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errJWTMalformed
+	}
+	if err := j.verify(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return Claims{}, err
+	}
+
+	var raw jwtClaims
+	if err := decodeJWTPart(parts[1], &raw); err != nil {
+		return Claims{}, err
+	}
+	claims := Claims{Subject: raw.Subject, Issuer: raw.Issuer}
+	if claims.Audience, err = parseStringList(raw.Audience); err != nil {
+		return Claims{}, err
+	}
+	claims.Scopes = ParseScopes(raw.Scope)
+	if len(claims.Scopes) == 0 {
+		scp, err := parseStringList(raw.Scp)
+		if err != nil {
+			return Claims{}, err
+		}
+		claims.Scopes = ParseScopes(strings.Join(scp, " "))
+	}
+	if raw.ExpiresAt == nil {
+		return Claims{}, fmt.Errorf("jwt has no exp")
+	}
+	claims.ExpiresAt = unixTime(*raw.ExpiresAt)
+	if raw.NotBefore != nil {
+		claims.NotBefore = unixTime(*raw.NotBefore)
+	}
+
+	now := time.Now()
+	if j.now != nil {
+		now = j.now()
+	}
+	if !now.Before(claims.ExpiresAt.Add(j.Leeway)) {
+		return Claims{}, errJWTExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(j.Leeway).Before(claims.NotBefore) {
+		return Claims{}, fmt.Errorf("jwt not valid yet")
+	}
+	if j.Issuer != "" && claims.Issuer != j.Issuer {
+		return Claims{}, fmt.Errorf("unexpected jwt issuer %q", claims.Issuer)
+	}
+	if j.Audience != "" && !contains(claims.Audience, j.Audience) {
+		return Claims{}, fmt.Errorf("jwt is not intended for %q", j.Audience)
+	}
+	return claims, nil
+}
+
+// verify проверяет подпись. Алгоритм берётся из заголовка, но только из настроенных:
+// иначе токен с alg none или HS256, подписанный открытым ключом, сошёл бы за настоящий
+func (j *JWT) verify(alg, signed string, signature []byte) error {
+	switch {
+	case alg == "HS256" && len(j.Secret) > 0:
+		mac := hmac.New(sha256.New, j.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errJWTSignature
+		}
+		return nil
+	case alg == "RS256" && j.PublicKey != nil:
+		hash := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(j.PublicKey, crypto.SHA256, hash[:], signature) != nil {
+			return errJWTSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported jwt alg %q", alg)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+// parseStringList - aud и scp бывают и строкой, и массивом строк
+func parseStringList(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, errJWTMalformed
+	}
+	return list, nil
+}
+
+// unixTime - время из NumericDate, секунды могут быть дробными
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRSAPublicKey читает открытый ключ RS256 из pem-файла: PUBLIC KEY, RSA PUBLIC KEY или сертификат
+func LoadRSAPublicKey(filename string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cant read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no pem block", filename)
+	}
+	var key interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%s: unexpected pem block %q", filename, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an rsa key", filename)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,196 @@
+package searchserver
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var jwtNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// signJWT собирает токен с claims; key - []byte для HS256 или *rsa.PrivateKey для RS256
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("shared-secret")
+	j := &JWT{Secret: secret, PublicKey: &rsaKey.PublicKey, Issuer: "https://sso.example.com", Audience: "searchserver",
+		Leeway: time.Minute, now: func() time.Time { return jwtNow }}
+
+	claims := func(override map[string]interface{}) map[string]interface{} {
+		result := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://sso.example.com",
+			"aud": []string{"other", "searchserver"},
+			"exp": jwtNow.Add(time.Hour).Unix(),
+		}
+		for name, value := range override {
+			if value == nil {
+				delete(result, name)
+				continue
+			}
+			result[name] = value
+		}
+		return result
+	}
+	publicKeyDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	cases := []struct {
+		Token           string
+		ExpectedSubject string
+		ExpectedError   bool
+	}{
+		{Token: signJWT(t, "HS256", secret, claims(nil)), ExpectedSubject: "alice"},
+		{Token: signJWT(t, "RS256", rsaKey, claims(nil)), ExpectedSubject: "alice"},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"aud": "searchserver"})), ExpectedSubject: "alice"},
+		// часы провайдера могут немного спешить или отставать
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"exp": jwtNow.Add(-30 * time.Second).Unix()})), ExpectedSubject: "alice"},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"nbf": jwtNow.Add(30 * time.Second).Unix()})), ExpectedSubject: "alice"},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"exp": jwtNow.Add(-2 * time.Minute).Unix()})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"nbf": jwtNow.Add(2 * time.Minute).Unix()})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"exp": nil})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"iss": "https://evil.example.com"})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"aud": "other"})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", secret, claims(map[string]interface{}{"aud": nil})), ExpectedError: true},
+		{Token: signJWT(t, "HS256", []byte("wrong-secret"), claims(nil)), ExpectedError: true},
+		{Token: signJWT(t, "RS256", otherKey, claims(nil)), ExpectedError: true},
+		// открытый ключ известен всем, подпись им по HMAC не должна сходить за RS256
+		{Token: signJWT(t, "HS384", publicKeyDER, claims(nil)), ExpectedError: true},
+		{Token: signJWT(t, "none", nil, claims(nil)), ExpectedError: true},
+		{Token: "not.a.jwt", ExpectedError: true},
+		{Token: "token", ExpectedError: true},
+	}
+	for caseNum, testCase := range cases {
+		got, err := j.Validate(testCase.Token)
+		if testCase.ExpectedError {
+			if err == nil {
+				t.Errorf("[%d] expected error, got %+v", caseNum, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if got.Subject != testCase.ExpectedSubject {
+			t.Errorf("[%d] expected subject %q, got %q", caseNum, testCase.ExpectedSubject, got.Subject)
+		}
+	}
+
+	// только с секретом RS256 не принимается, и наоборот
+	rsOnly := &JWT{PublicKey: &rsaKey.PublicKey, now: j.now}
+	if _, err := rsOnly.Validate(signJWT(t, "HS256", secret, claims(nil))); err == nil {
+		t.Error("expected HS256 to be rejected without secret")
+	}
+	hsOnly := &JWT{Secret: secret, now: j.now}
+	if _, err := hsOnly.Validate(signJWT(t, "RS256", rsaKey, claims(nil))); err == nil {
+		t.Error("expected RS256 to be rejected without public key")
+	}
+}
+
+func TestLoadRSAPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cases := []struct {
+		Block         *pem.Block
+		ExpectedError bool
+	}{
+		{Block: &pem.Block{Type: "PUBLIC KEY", Bytes: pkix}},
+		{Block: &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}},
+		{Block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, ExpectedError: true},
+		{Block: &pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")}, ExpectedError: true},
+	}
+	for caseNum, testCase := range cases {
+		filename := filepath.Join(dir, "key.pem")
+		if err := os.WriteFile(filename, pem.EncodeToMemory(testCase.Block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadRSAPublicKey(filename)
+		if testCase.ExpectedError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(&key.PublicKey) {
+			t.Errorf("[%d] expected the generated key, got error %v", caseNum, err)
+		}
+	}
+}
+
+func TestServerJWT(t *testing.T) {
+	secret := []byte("shared-secret")
+	s := &Server{DatasetPath: datasetPath, Token: "static", JWT: &JWT{Secret: secret, Audience: "searchserver"}}
+	valid := signJWT(t, "HS256", secret, map[string]interface{}{"sub": "alice", "aud": "searchserver", "exp": time.Now().Add(time.Hour).Unix()})
+	expired := signJWT(t, "HS256", secret, map[string]interface{}{"sub": "alice", "aud": "searchserver", "exp": time.Now().Add(-time.Hour).Unix()})
+	cases := []struct {
+		Sent         string
+		ExpectedCode int
+	}{
+		{Sent: valid, ExpectedCode: http.StatusOK},
+		{Sent: "static", ExpectedCode: http.StatusOK},
+		{Sent: expired, ExpectedCode: http.StatusUnauthorized},
+		{Sent: "anything", ExpectedCode: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=1&order_by=-1", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.Sent)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected %d, got %d: %s", caseNum, testCase.ExpectedCode, rec.Code, rec.Body)
+		}
+	}
+
+	// с одним JWT любой непустой токен уже не подходит
+	s = &Server{DatasetPath: datasetPath, JWT: &JWT{Secret: secret}}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?limit=1&order_by=-1"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a non-jwt token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package searchserver
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// PageCache - LRU готовых ответов на поиск. Server очищает его при Reload, а TTL ограничивает,
+// сколько живут ответы от Storage, данные в котором меняются без ведома сервера
+type PageCache struct {
+	// сколько ответов хранить
+	Size int
+	// сколько хранить ответ, 0 - пока не вытеснят или не очистят
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type pageCacheEntry struct {
+	key     string
+	page    RenderedPage
+	expires time.Time
+}
+
+// Get отдаёт ответ и поднимает его в начало очереди на вытеснение
+func (c *PageCache) Get(key string) (RenderedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return RenderedPage{}, false
+	}
+	entry := element.Value.(*pageCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return RenderedPage{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.page, true
+}
+
+// Set запоминает ответ, вытесняя самый давно использованный, если места нет
+func (c *PageCache) Set(key string, page RenderedPage) {
+	if c.Size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+		c.order = list.New()
+	}
+	entry := &pageCacheEntry{key: key, page: page}
+	if c.TTL > 0 {
+		entry.expires = time.Now().Add(c.TTL)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pageCacheEntry).key)
+	}
+}
+
+// Purge выбрасывает все ответы
+func (c *PageCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.order = nil
+}
+
+// Len - сколько ответов в кэше
+func (c *PageCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,87 @@
+package searchserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPageCache(t *testing.T) {
+	cache := &PageCache{Size: 2}
+	cache.Set("a", RenderedPage{Body: []byte("1")})
+	cache.Set("b", RenderedPage{Body: []byte("2")})
+	// a использовали недавно, вытесняется b
+	if page, ok := cache.Get("a"); !ok || string(page.Body) != "1" {
+		t.Errorf("expected a, got %q %v", page.Body, ok)
+	}
+	cache.Set("c", RenderedPage{Body: []byte("3")})
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	cache.Set("a", RenderedPage{Body: []byte("4")})
+	if page, _ := cache.Get("a"); string(page.Body) != "4" || cache.Len() != 2 {
+		t.Errorf("expected overwritten a, got %q with %d entries", page.Body, cache.Len())
+	}
+	cache.Purge()
+	if _, ok := cache.Get("a"); ok || cache.Len() != 0 {
+		t.Error("expected empty cache after purge")
+	}
+
+	expiring := &PageCache{Size: 2, TTL: 20 * time.Millisecond}
+	expiring.Set("a", RenderedPage{Body: []byte("1")})
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := expiring.Get("a"); ok {
+		t.Error("expected a to expire")
+	}
+
+	disabled := &PageCache{}
+	disabled.Set("a", RenderedPage{Body: []byte("1")})
+	if _, ok := disabled.Get("a"); ok {
+		t.Error("expected nothing to be cached with zero size")
+	}
+}
+
+func TestServerPageCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<root><row><id>1</id><first_name>Jane</first_name></row></root>`)
+	s := &Server{DatasetPath: path, PageCache: &PageCache{Size: 10}}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(target string) string {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, authorizedRequest(target))
+		return rec.Body.String()
+	}
+
+	first := serve("/?query=jane&order_by=0")
+	if s.PageCache.Len() != 1 {
+		t.Fatalf("expected cached page, got %d", s.PageCache.Len())
+	}
+	// v1 и v2 кэшируются отдельно
+	serve("/v2/?query=jane&order_by=0")
+	if s.PageCache.Len() != 2 {
+		t.Errorf("expected separate pages for v1 and v2, got %d", s.PageCache.Len())
+	}
+	if again := serve("/?query=JANE&order_by=0"); again != first {
+		t.Errorf("expected cached %s, got %s", first, again)
+	}
+
+	write(`<root><row><id>2</id><first_name>Jane</first_name></row></root>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.PageCache.Len() != 0 {
+		t.Errorf("expected cache to be purged on reload, got %d", s.PageCache.Len())
+	}
+	if after := serve("/?query=jane&order_by=0"); after == first {
+		t.Errorf("expected fresh page after reload, got %s", after)
+	}
+}
@@ -0,0 +1,100 @@
+package searchserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ScopePIIRead - видеть персональные данные без FieldMask
+const ScopePIIRead = "pii:read"
+
+// что FieldMask делает с полем
+const (
+	// поле пропадает из ответа
+	MaskHide = "hide"
+	// значение строкового поля заменяется на MaskedValue
+	MaskRedact = "mask"
+)
+
+// MaskedValue - чем заменяется значение поля с MaskRedact
+const MaskedValue = "***"
+
+// FieldMask - какие поля ответа прятать от клиентов без ScopePIIRead: имя поля UserJson -> MaskHide или MaskRedact.
+// Id не прячется никогда, по нему клиенты отличают пользователей
+type FieldMask map[string]string
+
+// maskableFields - поля, которые можно прятать, и можно ли их маскировать значением
+var maskableFields = map[string]bool{
+	"Name":   true,
+	"Age":    false,
+	"About":  true,
+	"Gender": true,
+}
+
+// Validate проверяет, что маска знает все поля и действия
+func (m FieldMask) Validate() error {
+	for _, field := range m.fields() {
+		canRedact, ok := maskableFields[field]
+		if !ok {
+			return fmt.Errorf("field %q cant be masked, expected one of Name, Age, About, Gender", field)
+		}
+		switch action := m[field]; {
+		case action == MaskHide:
+		case action == MaskRedact && canRedact:
+		case action == MaskRedact:
+			return fmt.Errorf("field %s is not a string and can only be hidden", field)
+		default:
+			return fmt.Errorf("unknown action %q for field %s, expected %s or %s", action, field, MaskHide, MaskRedact)
+		}
+	}
+	return nil
+}
+
+// fields - поля маски в стабильном порядке, чтобы ошибки Validate не прыгали
+func (m FieldMask) fields() []string {
+	fields := make([]string, 0, len(m))
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// maskedUser - UserJson, из которого поля можно убрать
+type maskedUser struct {
+	Id     int     `json:"Id"`
+	Guid   string  `json:"Guid,omitempty"`
+	Name   *string `json:"Name,omitempty"`
+	Age    *int    `json:"Age,omitempty"`
+	About  *string `json:"About,omitempty"`
+	Gender *string `json:"Gender,omitempty"`
+	Score  float64 `json:"Score,omitempty"`
+	// подсветка ставится отдельно, с учётом маски
+	Highlight map[string]string `json:"Highlight,omitempty"`
+}
+
+// apply - пользователь для ответа с учётом маски
+func (m FieldMask) apply(item *Item) maskedUser {
+	user := maskedUser{Id: item.Id, Score: item.Score}
+	if m["Guid"] != MaskHide {
+		user.Guid = item.Guid
+	}
+	user.Name = m.maskString("Name", item.Name)
+	if m["Age"] != MaskHide {
+		age := item.Age
+		user.Age = &age
+	}
+	user.About = m.maskString("About", item.About)
+	user.Gender = m.maskString("Gender", item.Gender)
+	return user
+}
+
+func (m FieldMask) maskString(field, value string) *string {
+	switch m[field] {
+	case MaskHide:
+		return nil
+	case MaskRedact:
+		value = MaskedValue
+	}
+	return &value
+}
@@ -0,0 +1,81 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestFieldMaskValidate(t *testing.T) {
+	cases := []struct {
+		Mask          FieldMask
+		ExpectedError bool
+	}{
+		{Mask: nil},
+		{Mask: FieldMask{"About": MaskRedact, "Age": MaskHide, "Name": MaskHide}},
+		{Mask: FieldMask{"Age": MaskRedact}, ExpectedError: true},
+		{Mask: FieldMask{"Id": MaskHide}, ExpectedError: true},
+		{Mask: FieldMask{"about": MaskHide}, ExpectedError: true},
+		{Mask: FieldMask{"About": "blur"}, ExpectedError: true},
+	}
+	for caseNum, testCase := range cases {
+		err := testCase.Mask.Validate()
+		if (err != nil) != testCase.ExpectedError {
+			t.Errorf("[%d] expected error %v, got %v", caseNum, testCase.ExpectedError, err)
+		}
+	}
+}
+
+func TestRenderUsersMasked(t *testing.T) {
+	items := []Item{{Id: 1, Name: "Jane Doe", Age: 30, About: "likes cats", Gender: "female"}}
+	mask := FieldMask{"About": MaskRedact, "Age": MaskHide}
+	cases := []struct {
+		Version  string
+		Expected string
+	}{
+		{Version: searchclient.APIVersion1, Expected: `[{"Id":1,"Name":"Jane Doe","About":"***","Gender":"female"}]`},
+		{Version: searchclient.APIVersion2, Expected: `{"users":[{"Id":1,"Name":"Jane Doe","About":"***","Gender":"female"}],"total":1}`},
+	}
+	for caseNum, testCase := range cases {
+		if got := string(renderUsers(testCase.Version, items, 1, mask, nil, nil)); got != testCase.Expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerFieldMask(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"About": MaskRedact, "Age": MaskHide},
+		PageCache:   &PageCache{Size: 10},
+	}
+	cases := []struct {
+		Token          string
+		ExpectedMasked bool
+	}{
+		{Token: "r-secret", ExpectedMasked: true},
+		// полный ответ не должен достаться из кэша тому, кому положен замаскированный, и наоборот
+		{Token: "s-secret", ExpectedMasked: false},
+		{Token: "r-secret", ExpectedMasked: true},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=1&order_by=-1", nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("[%d] expected 200, got %d", caseNum, rec.Code)
+			continue
+		}
+		body := rec.Body.String()
+		masked := strings.Contains(body, `"About":"***"`) && !strings.Contains(body, `"Age"`)
+		if masked != testCase.ExpectedMasked {
+			t.Errorf("[%d] expected masked %v, got %s", caseNum, testCase.ExpectedMasked, body)
+		}
+	}
+}
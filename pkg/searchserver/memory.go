@@ -0,0 +1,76 @@
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"runtime"
+)
+
+// errNotLoaded - поиск по хранилищу, в которое ещё ничего не загрузили
+var errNotLoaded = errors.New("dataset is not loaded")
+
+// MemoryStorage ищет по текущему снимку датасета из Store. Хранилище по умолчанию у Server
+type MemoryStorage struct {
+	Store *Store
+	// на сколько шардов максимум делить поиск по большому датасету, 0 - по числу процессоров, 1 - не параллелить
+	Workers int
+	// как сортировать Name, пустой - побайтно
+	Collation *Collation
+	// как разбирать About на слова, nil - искать только подстроки
+	Analyzer *Analyzer
+}
+
+func (m *MemoryStorage) Search(ctx context.Context, query Query) (Page, error) {
+	snapshot, base, err := m.view(query)
+	if err != nil {
+		return Page{}, err
+	}
+	// строки производных снимков смотрят в файл основного, он должен дожить до конца поиска
+	defer runtime.KeepAlive(base)
+	var scores *scorer
+	if query.scored() {
+		scores = snapshot.newScorer(query)
+	}
+	positions, err := snapshot.sorted(ctx, query, m.Workers, m.Collation, scores)
+	if err != nil {
+		return Page{}, err
+	}
+	// записи копируются только для отдаваемой страницы
+	total := len(positions)
+	page := pagePositions(positions, query.Offset, query.Limit)
+	users := snapshot.rowsAt(page)
+	if scores != nil {
+		for i, pos := range page {
+			users[i].Score = scores.scoreAt(pos)
+		}
+	}
+	return Page{Users: users, Total: total}, nil
+}
+
+// view - снимок, по которому искать query: с основами слов и без диакритики, если они нужны, и основной снимок, из которого он сделан
+func (m *MemoryStorage) view(query Query) (*Snapshot, *Snapshot, error) {
+	base := m.Store.Snapshot()
+	if base == nil {
+		return nil, nil, errNotLoaded
+	}
+	snapshot := base
+	if m.Analyzer != nil {
+		snapshot = snapshot.analyzed(m.Analyzer)
+	}
+	if query.IgnoreAccents {
+		snapshot = snapshot.unaccented()
+	}
+	return snapshot, base, nil
+}
+
+// pagePositions - Root.Page над номерами записей
+func pagePositions(positions []int, offset, limit int) []int {
+	if offset >= len(positions) {
+		return []int{}
+	}
+	end := len(positions)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return positions[offset:end]
+}
@@ -0,0 +1,83 @@
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestMemoryStorageSearch(t *testing.T) {
+	store := &Store{}
+	storage := &MemoryStorage{Store: store}
+	if _, err := storage.Search(context.Background(), Query{Limit: -1}); !errors.Is(err, errNotLoaded) {
+		t.Fatalf("expected errNotLoaded, got %v", err)
+	}
+
+	store.Swap(Root{Row: []Item{
+		{Id: 1, FirstName: "Anna", LastName: "Lee", Age: 30},
+		{Id: 2, FirstName: "Bob", LastName: "Stone", Age: 25, About: "likes anna"},
+		{Id: 3, FirstName: "Carl", LastName: "Hanna", Age: 30},
+		{Id: 4, FirstName: "Dan", LastName: "Smith", Age: 41},
+	}})
+	byAge := []SortField{{Field: "Age", Order: searchclient.OrderByDesc}}
+	cases := []struct {
+		Query         Query
+		ExpectedIds   []int
+		ExpectedTotal int
+	}{
+		{Query: Query{Limit: -1}, ExpectedIds: []int{1, 2, 3, 4}, ExpectedTotal: 4},
+		{Query: Query{Query: "ANNA", Limit: -1}, ExpectedIds: []int{1, 2, 3}, ExpectedTotal: 3},
+		// одинаковый возраст - сохраняется исходный порядок
+		{Query: Query{Sort: byAge, Limit: -1}, ExpectedIds: []int{4, 1, 3, 2}, ExpectedTotal: 4},
+		{Query: Query{Sort: byAge, Offset: 1, Limit: 2}, ExpectedIds: []int{1, 3}, ExpectedTotal: 4},
+		{Query: Query{Sort: byAge, Offset: 3, Limit: 5}, ExpectedIds: []int{2}, ExpectedTotal: 4},
+		{Query: Query{Offset: 10, Limit: -1}, ExpectedIds: []int{}, ExpectedTotal: 4},
+		{Query: Query{Limit: 0}, ExpectedIds: []int{}, ExpectedTotal: 4},
+	}
+	for caseNum, testCase := range cases {
+		page, err := storage.Search(context.Background(), testCase.Query)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		ids := []int{}
+		for _, item := range page.Users {
+			ids = append(ids, item.Id)
+		}
+		if !reflect.DeepEqual(ids, testCase.ExpectedIds) || page.Total != testCase.ExpectedTotal {
+			t.Errorf("[%d] expected %v of %d, got %v of %d", caseNum, testCase.ExpectedIds, testCase.ExpectedTotal, ids, page.Total)
+		}
+	}
+
+	_, err := storage.Search(context.Background(), Query{Sort: []SortField{{Field: "About"}}})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != searchclient.CodeBadOrderField {
+		t.Errorf("expected bad order field, got %v", err)
+	}
+}
+
+// страницы режутся из готового порядка индекса, поиски не должны его портить
+func TestMemoryStorageKeepsSortIndex(t *testing.T) {
+	store := &Store{}
+	snapshot := store.Swap(Root{Row: []Item{{Id: 1, Age: 30}, {Id: 2, Age: 20}, {Id: 3, Age: 25}}})
+	storage := &MemoryStorage{Store: store}
+	asc := append([]int(nil), snapshot.sorts["Age"].asc...)
+
+	byAge := []SortField{{Field: "Age", Order: searchclient.OrderByAsc}}
+	for i := 0; i < 2; i++ {
+		page, err := storage.Search(context.Background(), Query{Sort: byAge, Offset: 1, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.Users[0].Id = 100
+	}
+	if !reflect.DeepEqual(snapshot.sorts["Age"].asc, asc) {
+		t.Errorf("expected sort index %v to stay intact, got %v", asc, snapshot.sorts["Age"].asc)
+	}
+	if snapshot.rows[2].Id != 3 {
+		t.Errorf("expected snapshot rows to stay intact, got id %d", snapshot.rows[2].Id)
+	}
+}
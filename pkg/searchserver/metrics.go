@@ -0,0 +1,172 @@
+package searchserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hw4/pkg/searchclient"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics - метрики сервера для Prometheus, отдаются на /metrics
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	// размеры посчитанных результатов: ответы из PageCache и общие ответы одновременных
+	// одинаковых запросов сюда не попадают
+	pageUsers    prometheus.Histogram
+	totalMatches prometheus.Histogram
+}
+
+// NewMetrics заводит метрики запросов вместе со стандартными метриками Go и процесса
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "searchserver_http_requests_total",
+			Help: "Запросы по ручкам и кодам ответа.",
+		}, []string{"endpoint", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "searchserver_http_request_duration_seconds",
+			Help:    "Время ответа по ручкам.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		pageUsers: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "searchserver_search_page_users",
+			Help:    "Сколько пользователей отдано на странице поиска.",
+			Buckets: []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000},
+		}),
+		totalMatches: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "searchserver_search_total_matches",
+			Help:    "Сколько всего пользователей нашлось по запросу.",
+			Buckets: []float64{0, 1, 10, 100, 1000, 10000, 100000, 1000000},
+		}),
+	}
+	m.registry.MustRegister(m.requests, m.duration, m.pageUsers, m.totalMatches,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// observeRequest учитывает обработанный запрос
+func (m *Metrics) observeRequest(endpoint string, code int, elapsed time.Duration) {
+	m.requests.WithLabelValues(endpoint, strconv.Itoa(code)).Inc()
+	m.duration.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+}
+
+// observePage учитывает размер посчитанного результата поиска
+func (m *Metrics) observePage(page Page) {
+	m.pageUsers.Observe(float64(len(page.Users)))
+	m.totalMatches.Observe(float64(page.Total))
+}
+
+// serve отдаёт метрики запросов вместе с состоянием датасета s на момент запроса
+func (m *Metrics) serve(w http.ResponseWriter, r *http.Request, s *Server) {
+	dataset := prometheus.NewRegistry()
+	dataset.MustRegister(datasetCollector{s})
+	gatherers := prometheus.Gatherers{m.registry, dataset}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+var (
+	datasetRowsDesc = prometheus.NewDesc("searchserver_dataset_rows",
+		"Сколько пользователей в загруженном датасете.", nil, nil)
+	datasetLoadedDesc = prometheus.NewDesc("searchserver_dataset_loaded_timestamp_seconds",
+		"Когда загружен текущий датасет.", nil, nil)
+	reloadSuccessDesc = prometheus.NewDesc("searchserver_reload_last_success_timestamp_seconds",
+		"Последняя успешная перезагрузка датасета.", nil, nil)
+	reloadFailureDesc = prometheus.NewDesc("searchserver_reload_last_failure_timestamp_seconds",
+		"Последняя неудачная перезагрузка датасета, после которой не было успешной.", nil, nil)
+	reloadFailuresDesc = prometheus.NewDesc("searchserver_reload_consecutive_failures",
+		"Сколько перезагрузок датасета подряд кончились ошибкой.", nil, nil)
+)
+
+// datasetCollector - состояние датасета в памяти и его перезагрузок
+type datasetCollector struct {
+	server *Server
+}
+
+func (c datasetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- datasetRowsDesc
+	ch <- datasetLoadedDesc
+	ch <- reloadSuccessDesc
+	ch <- reloadFailureDesc
+	ch <- reloadFailuresDesc
+}
+
+func (c datasetCollector) Collect(ch chan<- prometheus.Metric) {
+	if snapshot := c.server.Snapshot(); snapshot != nil {
+		ch <- prometheus.MustNewConstMetric(datasetRowsDesc, prometheus.GaugeValue, float64(snapshot.Len()))
+		ch <- prometheus.MustNewConstMetric(datasetLoadedDesc, prometheus.GaugeValue, unixSeconds(snapshot.LoadedAt))
+	}
+	status := c.server.ReloadStatus()
+	if !status.LastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(reloadSuccessDesc, prometheus.GaugeValue, unixSeconds(status.LastSuccess))
+	}
+	if !status.LastFailure.IsZero() {
+		ch <- prometheus.MustNewConstMetric(reloadFailureDesc, prometheus.GaugeValue, unixSeconds(status.LastFailure))
+	}
+	ch <- prometheus.MustNewConstMetric(reloadFailuresDesc, prometheus.GaugeValue, float64(status.Failures))
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// endpointLabel - ручка для метрик. Путь целиком в метку не идёт, чтобы не плодить серии
+func endpointLabel(path string) string {
+	switch path {
+	case "/healthz", "/readyz", "/version", "/metrics":
+		return path[1:]
+	}
+	if _, rest, ok := SplitAPIVersion(path); ok {
+		// Id в метку не попадает, иначе у метрики будет по ряду на пользователя
+		switch {
+		case rest == "/openapi.json":
+			return "openapi"
+		case strings.HasPrefix(rest, searchclient.UsersPath):
+			return "user"
+		case rest == searchclient.SuggestPath:
+			return "suggest"
+		case rest == searchclient.AggregatePath:
+			return "aggregate"
+		case rest == StatsPath:
+			return "stats"
+		case rest == searchclient.DistinctPath:
+			return "distinct"
+		case rest == searchclient.SamplePath:
+			return "sample"
+		case rest == AnalyticsPath:
+			return "analytics"
+		}
+	}
+	return "search"
+}
+
+// statusRecorder запоминает код ответа и сколько байт записано
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap даёт http.ResponseController добраться до исходного ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
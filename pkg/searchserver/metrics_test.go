@@ -0,0 +1,138 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestServerMetrics(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, Metrics: NewMetrics()}
+	for _, target := range []string{"/?query=boyd&order_by=-1&limit=5", "/v2/?order_field=About", "/healthz"} {
+		s.ServeHTTP(httptest.NewRecorder(), authorizedRequest(target))
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	expected := []string{
+		`searchserver_http_requests_total{code="200",endpoint="search"} 1`,
+		`searchserver_http_requests_total{code="400",endpoint="search"} 1`,
+		`searchserver_http_requests_total{code="200",endpoint="healthz"} 1`,
+		`searchserver_http_request_duration_seconds_count{endpoint="search"} 2`,
+		`searchserver_search_page_users_count 1`,
+		`searchserver_search_total_matches_sum 1`,
+		`searchserver_dataset_rows 35`,
+		`searchserver_dataset_loaded_timestamp_seconds `,
+		`searchserver_reload_last_success_timestamp_seconds `,
+		`searchserver_reload_consecutive_failures 0`,
+		`go_goroutines `,
+	}
+	for caseNum, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("[%d] expected %q in metrics", caseNum, line)
+		}
+	}
+
+	// без Metrics ручки нет
+	rec = httptest.NewRecorder()
+	(&Server{DatasetPath: datasetPath}).ServeHTTP(rec, authorizedRequest("/metrics"))
+	if rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "searchserver_") {
+		t.Errorf("expected 404 without Metrics, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestEndpointLabel(t *testing.T) {
+	cases := []struct {
+		Path     string
+		Expected string
+	}{
+		{Path: "/", Expected: "search"},
+		{Path: "/v2/", Expected: "search"},
+		{Path: "/some/random/path", Expected: "search"},
+		{Path: "/openapi.json", Expected: "openapi"},
+		{Path: "/v2/openapi.json", Expected: "openapi"},
+		{Path: "/users/12", Expected: "user"},
+		{Path: "/v2/users/7", Expected: "user"},
+		{Path: "/suggest", Expected: "suggest"},
+		{Path: "/v1/suggest", Expected: "suggest"},
+		{Path: "/v2/aggregate", Expected: "aggregate"},
+		{Path: "/stats", Expected: "stats"},
+		{Path: "/v1/distinct", Expected: "distinct"},
+		{Path: "/sample", Expected: "sample"},
+		{Path: "/admin/analytics", Expected: "analytics"},
+		{Path: "/healthz", Expected: "healthz"},
+		{Path: "/metrics", Expected: "metrics"},
+	}
+	for caseNum, testCase := range cases {
+		if got := endpointLabel(testCase.Path); got != testCase.Expected {
+			t.Errorf("[%d] expected %q for %s, got %q", caseNum, testCase.Expected, testCase.Path, got)
+		}
+	}
+}
+
+func TestOpenAPIPathsMatchRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(searchclient.OpenAPISpec, &spec); err != nil {
+		t.Fatalf("cant decode spec: %s", err)
+	}
+	s := &Server{
+		DatasetPath: datasetPath,
+		Token:       "token",
+		Scopes:      map[string][]string{DefaultClientName: {ScopeSearchRead, ScopeAdmin}},
+		Analytics:   &Analytics{},
+	}
+	// значения обязательных параметров
+	required := map[string]string{"prefix": "bo", "field": searchclient.DistinctGender}
+	covered := map[string]bool{}
+	for path, methods := range spec.Paths {
+		label := endpointLabel(path)
+		covered[label] = true
+		// путь, которого сервер не знает, ушёл бы в поиск
+		if _, rest, _ := SplitAPIVersion(path); label == "search" && rest != "/" && rest != "/search" {
+			t.Errorf("%s from spec is not routed by server", path)
+		}
+		target := strings.NewReplacer("{id}", "1", "{guid}", "1a6fa827-62f1-45f6-b579-aaead2b47169").Replace(path)
+		for method, operation := range methods {
+			params := url.Values{}
+			for _, param := range operation.Parameters {
+				if param.In == "query" && param.Required {
+					params.Set(param.Name, required[param.Name])
+				}
+			}
+			req := authorizedRequest(target + "?" + params.Encode())
+			req.Method = strings.ToUpper(method)
+			if req.Method == http.MethodPost {
+				req.Body = io.NopCloser(strings.NewReader(`{"limit":1}`))
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s %s from spec: expected 200, got %d %s", req.Method, path, rec.Code, rec.Body)
+			}
+		}
+	}
+	// каждая ручка API, которую различает сервер, есть в спеке
+	for _, label := range []string{"search", "openapi", "user", "suggest", "aggregate", "stats", "distinct", "sample", "analytics"} {
+		if !covered[label] {
+			t.Errorf("no %s endpoint in spec", label)
+		}
+	}
+}
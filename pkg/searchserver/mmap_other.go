@@ -0,0 +1,17 @@
+//go:build !unix
+
+package searchserver
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapFile без mmap просто читает файл целиком
+func mapFile(filename string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, func() error { return nil }, nil
+}
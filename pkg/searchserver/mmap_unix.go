@@ -0,0 +1,31 @@
+//go:build unix
+
+package searchserver
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile отображает файл в память только для чтения. Страницы берутся из общего page cache,
+// так что несколько процессов с одним файлом не держат каждый свою копию
+func mapFile(filename string) ([]byte, func() error, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant mmap %s: %w", filename, err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
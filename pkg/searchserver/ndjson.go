@@ -0,0 +1,45 @@
+package searchserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+func (r *Root) DecodeNDJSON(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	if err := r.DecodeNDJSONFrom(file); err != nil {
+		return fmt.Errorf("failed to parse NDJSON: %w", err)
+	}
+	return nil
+}
+
+// DecodeNDJSONFrom читает по одному json-объекту на строку, в памяти держится только текущая строка.
+// Ключи - как теги в xml (id, first_name, ...), лишние ключи и пустые строки пропускаются
+func (r *Root) DecodeNDJSONFrom(reader io.Reader) error {
+	buffered := bufio.NewReader(reader)
+	for line := 1; ; line++ {
+		data, err := buffered.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var item Item
+			if err := json.Unmarshal(data, &item); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			r.Row = append(r.Row, item)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
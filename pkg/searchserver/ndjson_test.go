@@ -0,0 +1,68 @@
+package searchserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRootDecodeNDJSONFrom(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected []Item
+		IsError  bool
+	}{
+		{
+			Input: `{"id": 1, "first_name": "Boyd", "last_name": "Wolf", "age": 22, "gender": "male", "about": "Nulla"}` + "\n",
+			Expected: []Item{
+				{Id: 1, FirstName: "Boyd", LastName: "Wolf", Age: 22, Gender: "male", About: "Nulla"},
+			},
+		},
+		{
+			// пустые строки, \r\n, лишние ключи и последняя строка без перевода строки
+			Input:    "{\"id\": 1, \"email\": \"a@example.com\"}\r\n\n  \n{\"id\": 2}",
+			Expected: []Item{{Id: 1}, {Id: 2}},
+		},
+		{Input: "", Expected: nil},
+		{Input: "{\"id\": 1}\n{\"id\": \"one\"}\n", IsError: true},
+		{Input: "{\"id\": 1}\n{\"id\":\n", IsError: true},
+		{Input: "[{\"id\": 1}]\n", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		var root Root
+		err := root.DecodeNDJSONFrom(strings.NewReader(testCase.Input))
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if !reflect.DeepEqual(root.Row, testCase.Expected) {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, testCase.Expected, root.Row)
+		}
+	}
+}
+
+func TestServerNDJSONDataset(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"id": 1, "first_name": "Jane", "last_name": "Doe", "age": 30, "gender": "female"}` + "\n" +
+		`{"id": 2, "first_name": "John", "last_name": "Roe", "age": 40, "gender": "male"}` + "\n"
+	for _, name := range []string{"users.ndjson", "users.jsonl"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s := &Server{DatasetPath: name, BaseDir: dir}
+		code, users := search(t, s, "token", "query=john&order_by=0")
+		expected := []UserJson{{Id: 2, Name: "John Roe", Age: 40, Gender: "male"}}
+		if code != http.StatusOK || !reflect.DeepEqual(users, expected) {
+			t.Errorf("%s: expected %+v, got %+v (status %d)", name, expected, users, code)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package searchserver
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// paginationLinks - заголовок Link (RFC 8288) со ссылками на первую, предыдущую и следующую страницы,
+// чтобы листать можно было, не разбирая тело. Ссылки - GET на тот же путь с теми же параметрами,
+// в том числе пришедшими в теле POST, и другим offset. Без limit страниц нет - пустая строка
+func paginationLinks(path string, params url.Values, query Query, total int) string {
+	if query.Limit <= 0 {
+		return ""
+	}
+	var links []string
+	link := func(offset int, rel string) {
+		page := url.Values{}
+		for name, values := range params {
+			// из тела POST приходят и незаданные поля, в ссылке они не нужны
+			if len(values) > 1 || (len(values) == 1 && values[0] != "") {
+				page[name] = values
+			}
+		}
+		page.Set("offset", strconv.Itoa(offset))
+		links = append(links, "<"+path+"?"+page.Encode()+`>; rel="`+rel+`"`)
+	}
+	link(0, "first")
+	if query.Offset > 0 {
+		link(max(0, query.Offset-query.Limit), "prev")
+	}
+	if query.Offset+query.Limit < total {
+		link(query.Offset+query.Limit, "next")
+	}
+	return strings.Join(links, ", ")
+}
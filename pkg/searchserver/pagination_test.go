@@ -0,0 +1,92 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPaginationLinks(t *testing.T) {
+	params := url.Values{"query": {"an"}, "limit": {"10"}, "order_by": {"-1"}}
+	cases := []struct {
+		Query    Query
+		Total    int
+		Expected string
+	}{
+		{
+			Query:    Query{Offset: 0, Limit: 10},
+			Total:    25,
+			Expected: `</v2/?limit=10&offset=0&order_by=-1&query=an>; rel="first", </v2/?limit=10&offset=10&order_by=-1&query=an>; rel="next"`,
+		},
+		{
+			Query:    Query{Offset: 10, Limit: 10},
+			Total:    25,
+			Expected: `</v2/?limit=10&offset=0&order_by=-1&query=an>; rel="first", </v2/?limit=10&offset=0&order_by=-1&query=an>; rel="prev", </v2/?limit=10&offset=20&order_by=-1&query=an>; rel="next"`,
+		},
+		// последняя страница, предыдущая не уходит в минус
+		{
+			Query:    Query{Offset: 5, Limit: 10},
+			Total:    15,
+			Expected: `</v2/?limit=10&offset=0&order_by=-1&query=an>; rel="first", </v2/?limit=10&offset=0&order_by=-1&query=an>; rel="prev"`,
+		},
+		{Query: Query{Limit: -1}, Total: 25, Expected: ""},
+		{Query: Query{Limit: 0}, Total: 25, Expected: ""},
+	}
+	for caseNum, testCase := range cases {
+		if got := paginationLinks("/v2/", params, testCase.Query, testCase.Total); got != testCase.Expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerPaginationLinks(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, MaxLimit: 20, PageCache: &PageCache{Size: 10}}
+	cases := []struct {
+		Method   string
+		Target   string
+		Body     string
+		Expected []string
+	}{
+		{
+			Method:   http.MethodGet,
+			Target:   "/v2/?limit=10&offset=10&order_by=-1",
+			Expected: []string{`offset=0&order_by=-1>; rel="first"`, `offset=0&order_by=-1>; rel="prev"`, `offset=20&order_by=-1>; rel="next"`},
+		},
+		// тот же запрос из PageCache
+		{
+			Method:   http.MethodGet,
+			Target:   "/v2/?limit=10&offset=10&order_by=-1",
+			Expected: []string{`rel="prev"`, `offset=20&order_by=-1>; rel="next"`},
+		},
+		// limit режется MaxLimit, ссылки - по урезанному
+		{
+			Method:   http.MethodGet,
+			Target:   "/?limit=100&order_by=-1",
+			Expected: []string{`</?limit=20&offset=0&order_by=-1>; rel="first"`, `</?limit=20&offset=20&order_by=-1>; rel="next"`},
+		},
+		{
+			Method:   http.MethodPost,
+			Target:   "/v2/",
+			Body:     `{"limit": 30, "offset": 20, "sort": [{"field": "Age", "order_by": -1}]}`,
+			Expected: []string{`</v2/?limit=20&offset=0&sort=Age%3A-1>; rel="first"`, `</v2/?limit=20&offset=0&sort=Age%3A-1>; rel="prev"`},
+		},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(testCase.Method, testCase.Target, strings.NewReader(testCase.Body))
+		req.Header.Set("AccessToken", "token")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("[%d] expected 200, got %d: %s", caseNum, rec.Code, rec.Body)
+			continue
+		}
+		link := rec.Header().Get("Link")
+		for _, expected := range testCase.Expected {
+			if !strings.Contains(link, expected) {
+				t.Errorf("[%d] expected %s in Link, got %s", caseNum, expected, link)
+			}
+		}
+	}
+}
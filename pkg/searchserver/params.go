@@ -0,0 +1,368 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// SplitAPIVersion отрезает от пути префикс версии, пути без версии работают как v1
+func SplitAPIVersion(path string) (string, string, bool) {
+	if !strings.HasPrefix(path, "/v") {
+		return searchclient.APIVersion1, path, true
+	}
+	version, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if version != searchclient.APIVersion1 && version != searchclient.APIVersion2 {
+		return "", "", false
+	}
+	return version, "/" + rest, true
+}
+
+// BearerToken достаёт токен из Authorization: Bearer <token>
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// DefaultMaxBodyBytes - сколько байт тела POST-поиска сервер читает без Server.MaxBodyBytes
+const DefaultMaxBodyBytes = 64 << 10
+
+// ParseSearchParams собирает параметры поиска из GET-параметров или, для POST, из json-тела.
+// Ключи сортировки из тела складываются в параметр sort в виде "Field:order". limit и order_by, которых
+// нет в теле, не задаются, как и в GET: 0 у них значит не то же, что отсутствие
+func ParseSearchParams(r *http.Request) (url.Values, error) {
+	params := r.URL.Query()
+	if r.Method != http.MethodPost {
+		return params, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	var body searchclient.SearchRequestBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(data, &present); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if _, ok := present["limit"]; ok {
+		params.Set("limit", strconv.Itoa(body.Limit))
+	}
+	params.Set("offset", strconv.Itoa(body.Offset))
+	params.Set("query", body.Query)
+	params.Set("order_field", body.OrderField)
+	if _, ok := present["order_by"]; ok {
+		params.Set("order_by", strconv.Itoa(body.OrderBy))
+	}
+	for _, key := range body.Sort {
+		params.Add("sort", key.Field+":"+strconv.Itoa(key.OrderBy))
+	}
+	params.Set("gender", body.Gender)
+	// 0 в теле - не задано, как и в SearchRequest
+	if body.AgeMin != 0 {
+		params.Set("age_min", strconv.Itoa(body.AgeMin))
+	}
+	if body.AgeMax != 0 {
+		params.Set("age_max", strconv.Itoa(body.AgeMax))
+	}
+	if len(body.IDs) > 0 {
+		ids := make([]string, len(body.IDs))
+		for i, id := range body.IDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		params.Set("ids", strings.Join(ids, ","))
+	}
+	if body.IdFrom != 0 {
+		params.Set("id_from", strconv.Itoa(body.IdFrom))
+	}
+	if body.IdTo != 0 {
+		params.Set("id_to", strconv.Itoa(body.IdTo))
+	}
+	if len(body.Fields) > 0 {
+		params.Set("fields", strings.Join(body.Fields, ","))
+	}
+	if body.Fuzziness != 0 {
+		params.Set("fuzziness", strconv.Itoa(body.Fuzziness))
+	}
+	if body.Highlight {
+		params.Set("highlight", "true")
+	}
+	if body.IgnoreAccents {
+		params.Set("ignore_accents", "true")
+	}
+	if body.Facets {
+		params.Set("facets", "true")
+	}
+	if body.AgeInterval != 0 {
+		params.Set("age_interval", strconv.Itoa(body.AgeInterval))
+	}
+	if body.GroupBy != "" {
+		params.Set("group_by", body.GroupBy)
+	}
+	if body.GroupLimit != 0 {
+		params.Set("group_limit", strconv.Itoa(body.GroupLimit))
+	}
+	return params, nil
+}
+
+// SearchParams - параметры поиска, которые понимает сервер
+var SearchParams = []string{"query", "limit", "offset", "order_field", "order_by", "sort", "gender", "age_min", "age_max", "ids", "id_from", "id_to", "fields", "fuzziness", "highlight", "ignore_accents", "facets", "age_interval", "group_by", "group_limit"}
+
+// unknownParams - параметры не из SearchParams, по порядку, чтобы ошибка была одна и та же
+func unknownParams(params url.Values) []string {
+	var unknown []string
+	for name := range params {
+		if !slices.Contains(SearchParams, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// errUnknownParams - ошибка строгого режима, в ней список того, что сервер понимает
+func errUnknownParams(unknown []string) *ServerError {
+	return &ServerError{
+		Code:    searchclient.CodeUnknownParam,
+		Message: fmt.Sprintf("unknown parameters: %s, accepted: %s", strings.Join(unknown, ", "), strings.Join(SearchParams, ", ")),
+		Field:   unknown[0],
+	}
+}
+
+// sortFields - поля, по которым можно сортировать, по имени без регистра и подчёркиваний.
+// Name начинается с first_name, так что сортировка по first_name - та же сортировка по Name
+var sortFields = map[string]string{
+	"id":        "Id",
+	"age":       "Age",
+	"name":      "Name",
+	"fullname":  "Name",
+	"firstname": "Name",
+	"score":     ScoreField,
+}
+
+// sortField приводит поле сортировки к имени из Item: "id", "ID" и "first_name" тоже подходят
+func sortField(field string) (string, bool) {
+	normalized, ok := sortFields[strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(field))]
+	return normalized, ok
+}
+
+// DefaultOrderBy - направление сортировки, если order_by не задан, как у клиента с пустым SearchRequest.OrderBy
+const DefaultOrderBy = searchclient.OrderByAsIs
+
+// parseOrder разбирает order_by, пустой - DefaultOrderBy
+func parseOrder(order string) (int, error) {
+	if order == "" {
+		return DefaultOrderBy, nil
+	}
+	orderInt, err := strconv.Atoi(order)
+	if err != nil || (orderInt != searchclient.OrderByAsc && orderInt != searchclient.OrderByDesc && orderInt != searchclient.OrderByAsIs) {
+		return 0, &ServerError{Code: searchclient.CodeBadOrderBy, Message: badOrderMessage(order), Field: "order_by"}
+	}
+	return orderInt, nil
+}
+
+// badOrderMessage - текст ошибки order_by, с допустимыми значениями и тем, что будет без параметра
+func badOrderMessage(order string) string {
+	return fmt.Sprintf("invalid order: %s, expected %d (asc), %d (desc) or %d (as is), missing order_by means %d",
+		order, searchclient.OrderByAsc, searchclient.OrderByDesc, searchclient.OrderByAsIs, DefaultOrderBy)
+}
+
+// stableSort дописывает к ключам сортировки Id по возрастанию, если его там нет. Тогда у записей
+// с одинаковыми ключами порядок один и тот же в любом хранилище и на любой странице,
+// и при листании записи не повторяются и не теряются. Пустая сортировка так и остаётся пустой
+func stableSort(fields []SortField) []SortField {
+	if len(fields) == 0 {
+		return fields
+	}
+	for _, field := range fields {
+		if field.Field == "Id" {
+			return fields
+		}
+	}
+	return append(fields, SortField{Field: "Id", Order: searchclient.OrderByAsc})
+}
+
+// ParseQuery проверяет параметры поиска и собирает из них Query, ошибки те же, что у SortRoot, SortRootBy и ApplyLimitOffset
+func ParseQuery(params url.Values) (Query, error) {
+	query := Query{Query: params.Get("query"), Limit: -1}
+	if _, err := ParseSearchQuery(query.Query); err != nil {
+		return query, err
+	}
+	if fuzziness := params.Get("fuzziness"); fuzziness != "" {
+		value, err := strconv.Atoi(fuzziness)
+		if err != nil || value < 0 || value > MaxFuzziness {
+			return query, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid fuzziness: %s, expected 0..%d", fuzziness, MaxFuzziness), Field: "fuzziness"}
+		}
+		query.Fuzziness = value
+	}
+	if ignoreAccents := params.Get("ignore_accents"); ignoreAccents != "" {
+		value, err := strconv.ParseBool(ignoreAccents)
+		if err != nil {
+			return query, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid ignore_accents: %s, expected true or false", ignoreAccents), Field: "ignore_accents"}
+		}
+		query.IgnoreAccents = value
+	}
+
+	if sortKeys := params["sort"]; len(sortKeys) > 0 {
+		for _, key := range sortKeys {
+			name, order, _ := strings.Cut(key, ":")
+			field, ok := sortField(name)
+			if !ok {
+				return query, errBadOrderField("sort", name)
+			}
+			// в ключе sort направление обязательно
+			orderInt, err := parseOrder(order)
+			if err != nil || order == "" {
+				return query, &ServerError{Code: searchclient.CodeBadOrderBy, Message: fmt.Sprintf("invalid order: %s", order), Field: "sort"}
+			}
+			if orderInt != searchclient.OrderByAsIs {
+				query.Sort = append(query.Sort, SortField{Field: field, Order: orderInt})
+			}
+		}
+	} else {
+		orderInt, err := parseOrder(params.Get("order_by"))
+		if err != nil {
+			return query, err
+		}
+		name := params.Get("order_field")
+		if name == "" {
+			name = "Name"
+		}
+		field, ok := sortField(name)
+		if !ok {
+			return query, errBadOrderField("order_field", name)
+		}
+		// так исторически сложилось: в SortRoot OrderByAsIs сортирует по убыванию
+		if orderInt == searchclient.OrderByAsIs {
+			orderInt = searchclient.OrderByDesc
+		}
+		query.Sort = []SortField{{Field: field, Order: orderInt}}
+	}
+	query.Sort = stableSort(query.Sort)
+
+	switch gender := strings.ToLower(params.Get("gender")); gender {
+	case "", searchclient.GenderAny:
+	case searchclient.GenderMale, searchclient.GenderFemale:
+		query.Gender = gender
+	default:
+		return query, &ServerError{
+			Code:    searchclient.CodeBadFilter,
+			Message: fmt.Sprintf("invalid gender: %s, expected %s, %s or %s", params.Get("gender"), searchclient.GenderMale, searchclient.GenderFemale, searchclient.GenderAny),
+			Field:   "gender",
+		}
+	}
+	var err error
+	if query.AgeMin, query.AgeMax, err = parseRange(params, "age_min", "age_max"); err != nil {
+		return query, err
+	}
+	if query.IdFrom, query.IdTo, err = parseRange(params, "id_from", "id_to"); err != nil {
+		return query, err
+	}
+	if query.IDs, err = parseIDs(params); err != nil {
+		return query, err
+	}
+
+	if offset := params.Get("offset"); offset != "" {
+		offsetInt, err := strconv.Atoi(offset)
+		if err == nil && offsetInt < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+		if err != nil {
+			return query, &ServerError{Code: searchclient.CodeBadOffset, Message: fmt.Sprintf("invalid offset value: %s", err), Field: "offset"}
+		}
+		query.Offset = offsetInt
+	}
+	if limit := params.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err == nil && limitInt < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+		if err != nil {
+			return query, &ServerError{Code: searchclient.CodeBadLimit, Message: fmt.Sprintf("invalid limit value: %s", err), Field: "limit"}
+		}
+		query.Limit = limitInt
+	}
+	return query, nil
+}
+
+// parseRange - границы диапазона из параметров from и to включительно, пустой параметр - без границы
+func parseRange(params url.Values, from, to string) (*int, *int, error) {
+	low, err := parseBound(params, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	high, err := parseBound(params, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if low != nil && high != nil && *low > *high {
+		return nil, nil, &ServerError{
+			Code:    searchclient.CodeBadFilter,
+			Message: fmt.Sprintf("invalid range: %s %d is greater than %s %d", from, *low, to, *high),
+			Field:   to,
+		}
+	}
+	return low, high, nil
+}
+
+func parseBound(params url.Values, name string) (*int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	bound, err := strconv.Atoi(value)
+	if err == nil && bound < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	if err != nil {
+		return nil, &ServerError{Code: searchclient.CodeBadFilter, Message: fmt.Sprintf("invalid %s value: %s", name, err), Field: name}
+	}
+	return &bound, nil
+}
+
+// MaxFilterIDs - сколько Id можно перечислить в ids за один запрос
+const MaxFilterIDs = 1000
+
+// parseIDs разбирает ids=1,5,9, параметр можно и повторять. Id сортируются и повторы выкидываются,
+// чтобы одинаковые наборы давали один и тот же Query
+func parseIDs(params url.Values) ([]int, error) {
+	var ids []int
+	for _, value := range params["ids"] {
+		if value == "" {
+			continue
+		}
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err == nil && id < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+			if err != nil {
+				return nil, &ServerError{Code: searchclient.CodeBadFilter, Message: fmt.Sprintf("invalid ids value %q: %s", part, err), Field: "ids"}
+			}
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > MaxFilterIDs {
+		return nil, &ServerError{
+			Code:    searchclient.CodeBadFilter,
+			Message: fmt.Sprintf("too many ids: %d, at most %d", len(ids), MaxFilterIDs),
+			Field:   "ids",
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,43 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PostgresStorage ищет пользователей в таблице users в PostgreSQL: фильтрация, сортировка и пагинация
+// выполняются в базе, данные можно менять на живую. Пулом соединений управляет DB
+// (SetMaxOpenConns, SetMaxIdleConns, SetConnMaxLifetime), драйвер подключает тот, кто открывает DB,
+// например github.com/jackc/pgx/v5/stdlib
+type PostgresStorage struct {
+	DB *sql.DB
+}
+
+// Init создаёт таблицу, если её ещё нет
+func (s *PostgresStorage) Init(ctx context.Context) error {
+	return sqlInit(ctx, s.DB)
+}
+
+// Count - сколько пользователей в базе
+func (s *PostgresStorage) Count(ctx context.Context) (int, error) {
+	return sqlCount(ctx, s.DB)
+}
+
+// Import заменяет содержимое таблицы записями из root одной транзакцией
+func (s *PostgresStorage) Import(ctx context.Context, root Root) error {
+	return sqlImport(ctx, s.DB, postgresDialect, root)
+}
+
+func (s *PostgresStorage) Search(ctx context.Context, query Query) (Page, error) {
+	return sqlSearch(ctx, s.DB, postgresDialect, query)
+}
+
+// Sample выбирает n случайных найденных, не перебирая их по одному (см. sqlSample)
+func (s *PostgresStorage) Sample(ctx context.Context, query Query, n int, seed int64) (Page, error) {
+	return sqlSample(ctx, s.DB, postgresDialect, query, n, seed)
+}
+
+// Ping проверяет, что база отвечает
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
@@ -0,0 +1,123 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestPostgresSearchQueries(t *testing.T) {
+	ageMin, ageMax, idFrom := 30, 40, 30
+	cases := []struct {
+		Query        Query
+		ExpectedSQL  string
+		ExpectedArgs []interface{}
+	}{
+		{
+			Query:        Query{Sort: []SortField{{Field: "Name", Order: searchclient.OrderByAsc}}, Limit: -1},
+			ExpectedSQL:  `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users ORDER BY name COLLATE "C" ASC LIMIT ALL OFFSET $1`,
+			ExpectedArgs: []interface{}{0},
+		},
+		{
+			Query: Query{Query: "50%_off", Sort: []SortField{{Field: "Age", Order: searchclient.OrderByDesc}, {Field: "Id", Order: searchclient.OrderByAsc}}, Offset: 5, Limit: 10},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE (name_lower LIKE $1 ESCAPE '\' OR about_lower LIKE $2 ESCAPE '\')` +
+				` ORDER BY age DESC, id ASC LIMIT $3 OFFSET $4`,
+			ExpectedArgs: []interface{}{`%50\%\_off%`, `%50\%\_off%`, 10, 5},
+		},
+		{
+			Query: Query{Query: "boyd", Gender: "female", Sort: []SortField{{Field: "Id", Order: searchclient.OrderByAsc}}, Limit: 5},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE (name_lower LIKE $1 ESCAPE '\' OR about_lower LIKE $2 ESCAPE '\') AND gender = $3` +
+				` ORDER BY id ASC LIMIT $4 OFFSET $5`,
+			ExpectedArgs: []interface{}{`%boyd%`, `%boyd%`, "female", 5, 0},
+		},
+		{
+			Query: Query{AgeMin: &ageMin, AgeMax: &ageMax, Sort: []SortField{{Field: "Id", Order: searchclient.OrderByAsc}}, Limit: 5},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE age >= $1 AND age <= $2 ORDER BY id ASC LIMIT $3 OFFSET $4`,
+			ExpectedArgs: []interface{}{30, 40, 5, 0},
+		},
+		{
+			Query: Query{IDs: []int{1, 5, 9}, IdFrom: &idFrom, Sort: []SortField{{Field: "Id", Order: searchclient.OrderByAsc}}, Limit: 5},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE id IN ($1, $2, $3) AND id >= $4 ORDER BY id ASC LIMIT $5 OFFSET $6`,
+			ExpectedArgs: []interface{}{1, 5, 9, 30, 5, 0},
+		},
+		{
+			Query: Query{Query: `wolf name:Boyd about:"nulla cillum"`, Limit: 5},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE (name_lower LIKE $1 ESCAPE '\' OR about_lower LIKE $2 ESCAPE '\') AND name_lower LIKE $3 ESCAPE '\'` +
+				` AND about_lower LIKE $4 ESCAPE '\' LIMIT $5 OFFSET $6`,
+			ExpectedArgs: []interface{}{`%wolf%`, `%wolf%`, `%boyd%`, `%nulla cillum%`, 5, 0},
+		},
+		{
+			Query: Query{Query: "(name:boyd OR hilda) AND NOT about:nulla", Limit: 5},
+			ExpectedSQL: `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users` +
+				` WHERE (name_lower LIKE $1 ESCAPE '\' OR (name_lower LIKE $2 ESCAPE '\' OR about_lower LIKE $3 ESCAPE '\'))` +
+				` AND NOT about_lower LIKE $4 ESCAPE '\' LIMIT $5 OFFSET $6`,
+			ExpectedArgs: []interface{}{`%boyd%`, `%hilda%`, `%hilda%`, `%nulla%`, 5, 0},
+		},
+		{
+			Query:        Query{Guid: "f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb", Limit: 1},
+			ExpectedSQL:  `SELECT id, guid, age, first_name, last_name, name, about, gender FROM users WHERE guid = $1 LIMIT $2 OFFSET $3`,
+			ExpectedArgs: []interface{}{"f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb", 1, 0},
+		},
+	}
+	for caseNum, testCase := range cases {
+		_, _, pageSQL, pageArgs, err := sqlSearchQueries(postgresDialect, testCase.Query)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %s", caseNum, err)
+			continue
+		}
+		if pageSQL != testCase.ExpectedSQL {
+			t.Errorf("[%d] expected sql\n%s\ngot\n%s", caseNum, testCase.ExpectedSQL, pageSQL)
+		}
+		if !reflect.DeepEqual(pageArgs, testCase.ExpectedArgs) {
+			t.Errorf("[%d] expected args %v, got %v", caseNum, testCase.ExpectedArgs, pageArgs)
+		}
+	}
+
+	_, _, _, _, err := sqlSearchQueries(postgresDialect, Query{Query: "boid", Fuzziness: 1, Limit: 5})
+	if serverErr, ok := err.(*ServerError); !ok || serverErr.Code != searchclient.CodeBadQuery || serverErr.Field != "fuzziness" {
+		t.Errorf("expected bad query error for fuzziness, got %v", err)
+	}
+	_, _, _, _, err = sqlSearchQueries(postgresDialect, Query{Query: "muller", IgnoreAccents: true, Limit: 5})
+	if serverErr, ok := err.(*ServerError); !ok || serverErr.Code != searchclient.CodeBadQuery || serverErr.Field != "ignore_accents" {
+		t.Errorf("expected bad query error for ignore_accents, got %v", err)
+	}
+}
+
+// живой Postgres есть не везде, поэтому тест запускается только с SEARCHSERVER_TEST_POSTGRES=<dsn>.
+// Таблица users в этой базе перезаписывается
+func TestPostgresStorageMatchesMemory(t *testing.T) {
+	dsn := os.Getenv("SEARCHSERVER_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("SEARCHSERVER_TEST_POSTGRES is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	storage := &PostgresStorage{DB: db}
+	ctx := context.Background()
+	if err := storage.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Import(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	checkStorageMatchesMemory(t, storage)
+}
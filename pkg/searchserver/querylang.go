@@ -0,0 +1,395 @@
+package searchserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"hw4/pkg/searchclient"
+)
+
+// queryFields - префиксы, которыми терм запроса ограничивается одним полем: name:Boyd, about:"nulla cillum"
+var queryFields = map[string]string{"name": "Name", "about": "About"}
+
+// операторы запроса, пишутся заглавными отдельными словами: wolf AND male NOT mayer
+const (
+	queryAnd = "AND"
+	queryOr  = "OR"
+	queryNot = "NOT"
+)
+
+// queryTerm - слово или фраза запроса, которые должны найтись в записи подстрокой без учёта регистра
+type queryTerm struct {
+	// где искать: "Name", "About" или пусто - в любом из них
+	Field string
+	// после foldCase, а с Query.IgnoreAccents - ещё и без диакритики
+	Text string
+	// фраза в кавычках: ищется целиком, вместе с пробелами
+	Phrase bool
+}
+
+// queryNode - узел дерева запроса: терм или оператор над детьми. У NOT ребёнок один
+type queryNode struct {
+	// queryAnd, queryOr, queryNot или пусто - терм
+	Op       string
+	Term     queryTerm
+	Children []*queryNode
+}
+
+// String - запрос в каноническом виде: одинаковые по смыслу запросы пишутся одинаково, разные - по-разному
+func (n *queryNode) String() string {
+	if n == nil {
+		return ""
+	}
+	if n.Op == "" {
+		prefix := ""
+		if n.Term.Field != "" {
+			prefix = strings.ToLower(n.Term.Field) + ":"
+		}
+		if n.Term.Phrase {
+			return "PHRASE(" + prefix + strconv.Quote(n.Term.Text) + ")"
+		}
+		return prefix + strconv.Quote(n.Term.Text)
+	}
+	children := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		children[i] = child.String()
+	}
+	return n.Op + "(" + strings.Join(children, ", ") + ")"
+}
+
+// match - подходит ли запись с именем и описанием, уже приведёнными к нижнему регистру
+func (n *queryNode) match(nameLower, aboutLower string) bool {
+	switch n.Op {
+	case queryAnd:
+		for _, child := range n.Children {
+			if !child.match(nameLower, aboutLower) {
+				return false
+			}
+		}
+		return true
+	case queryOr:
+		for _, child := range n.Children {
+			if child.match(nameLower, aboutLower) {
+				return true
+			}
+		}
+		return false
+	case queryNot:
+		return !n.Children[0].match(nameLower, aboutLower)
+	}
+	return matchTerm(nameLower, aboutLower, n.Term)
+}
+
+// matchTerm - есть ли терм в имени или описании, уже приведённых к нижнему регистру
+func matchTerm(nameLower, aboutLower string, term queryTerm) bool {
+	switch term.Field {
+	case "Name":
+		return strings.Contains(nameLower, term.Text)
+	case "About":
+		return strings.Contains(aboutLower, term.Text)
+	}
+	return strings.Contains(nameLower, term.Text) || strings.Contains(aboutLower, term.Text)
+}
+
+// candidates - записи, среди которых точно есть все подходящие под n: у AND - пересечение того,
+// что индекс отдал по детям, у OR - объединение. false - индекс тут ничем не поможет, проверять надо всё
+func (n *queryNode) candidates(index candidateIndex) ([]int, bool) {
+	if n == nil {
+		return nil, false
+	}
+	switch n.Op {
+	case queryAnd:
+		var result []int
+		found := false
+		for _, child := range n.Children {
+			positions, ok := child.candidates(index)
+			if !ok {
+				continue
+			}
+			if !found {
+				result, found = append([]int(nil), positions...), true
+			} else {
+				result = intersectSorted(result, positions)
+			}
+			if len(result) == 0 {
+				break
+			}
+		}
+		return result, found
+	case queryOr:
+		var result []int
+		for _, child := range n.Children {
+			positions, ok := child.candidates(index)
+			if !ok {
+				return nil, false
+			}
+			result = unionSorted(result, positions)
+		}
+		return result, true
+	case queryNot:
+		return nil, false
+	}
+	return index.Candidates(n.Term.Text)
+}
+
+// unionSorted объединяет два возрастающих списка без повторов в новый
+func unionSorted(a, b []int) []int {
+	result := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// errBadQuery - запрос не разбирается: незакрытая скобка, оператор без операнда
+func errBadQuery(format string, args ...interface{}) *ServerError {
+	return &ServerError{Code: searchclient.CodeBadQuery, Message: "invalid query: " + fmt.Sprintf(format, args...), Field: "query"}
+}
+
+// ParseSearchQuery разбирает строку поиска в дерево, пустой запрос - nil.
+//
+// Слова ищутся каждое само по себе в Name или About, фраза в кавычках - целиком, name:Boyd и
+// about:"nulla cillum" - только в своём поле; части запроса, записанные через пробел, должны совпасть все.
+// Если в запросе есть операторы AND, OR или NOT (заглавными, отдельными словами), работают и скобки,
+// а "AND" в кавычках - просто слово. Незнакомые префиксы вроде id:5 - обычный текст, незакрытая кавычка
+// тянется до конца запроса. Ошибки бывают только в запросах с операторами
+func ParseSearchQuery(query string) (*queryNode, error) {
+	tokens := lexQuery(query, hasQueryOperators(query))
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &queryParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errBadQuery("unexpected %s", p.tokens[p.pos].text)
+	}
+	return node, nil
+}
+
+// searchTree - дерево запроса q.Query. Запросы от клиентов уже проверены в ParseQuery, а запрос,
+// собранный в коде с ошибкой, ищется одной подстрокой целиком. Synonyms раскрываются в дереве,
+// с IgnoreAccents термы без диакритики
+func (q Query) searchTree() *queryNode {
+	node, err := ParseSearchQuery(q.Query)
+	if err != nil {
+		node = &queryNode{Term: queryTerm{Text: foldCase(q.Query)}}
+	}
+	if q.Synonyms != nil {
+		node = node.withSynonyms(q.Synonyms)
+	}
+	if q.IgnoreAccents {
+		node = node.withoutAccents()
+	}
+	return node
+}
+
+// hasQueryOperators - есть ли в запросе AND, OR или NOT отдельным словом вне кавычек
+func hasQueryOperators(query string) bool {
+	for _, token := range lexQuery(query, true) {
+		if token.kind == tokenOp {
+			return true
+		}
+	}
+	return false
+}
+
+// виды лексем запроса
+const (
+	tokenWord = iota
+	tokenOp
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind int
+	// слово, значение терма с префиксом или оператор
+	text string
+	// поле терма с префиксом
+	field string
+	// фраза в кавычках
+	quoted bool
+}
+
+// lexQuery режет запрос на лексемы. Без операторов скобки - обычные символы слов
+func lexQuery(query string, operators bool) []queryToken {
+	var tokens []queryToken
+	special := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || (operators && (r == '(' || r == ')'))
+	}
+	rest := query
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return tokens
+		}
+		switch {
+		case operators && rest[0] == '(':
+			tokens, rest = append(tokens, queryToken{kind: tokenOpen, text: "("}), rest[1:]
+			continue
+		case operators && rest[0] == ')':
+			tokens, rest = append(tokens, queryToken{kind: tokenClose, text: ")"}), rest[1:]
+			continue
+		case rest[0] == '"':
+			var text string
+			if text, rest = readQuoted(rest[1:]); text != "" {
+				tokens = append(tokens, queryToken{kind: tokenWord, text: text, quoted: true})
+			}
+			continue
+		}
+		word := rest
+		if i := strings.IndexFunc(rest, special); i >= 0 {
+			word = rest[:i]
+		}
+		if operators && (word == queryAnd || word == queryOr || word == queryNot) {
+			tokens, rest = append(tokens, queryToken{kind: tokenOp, text: word}), rest[len(word):]
+			continue
+		}
+		prefix, value, scoped := strings.Cut(word, ":")
+		field, known := queryFields[strings.ToLower(prefix)]
+		// name:"nulla cillum" - значение до закрывающей кавычки, даже через пробелы
+		if scoped && known && strings.HasPrefix(rest[len(prefix)+1:], `"`) {
+			value, rest = readQuoted(rest[len(prefix)+2:])
+			if value != "" {
+				tokens = append(tokens, queryToken{kind: tokenWord, text: value, field: field, quoted: true})
+			}
+			continue
+		}
+		rest = rest[len(word):]
+		if scoped && known && value != "" {
+			tokens = append(tokens, queryToken{kind: tokenWord, text: value, field: field})
+			continue
+		}
+		tokens = append(tokens, queryToken{kind: tokenWord, text: word})
+	}
+}
+
+// readQuoted читает текст до закрывающей кавычки, \" и \\ внутри - сами символы. Отдаёт текст и остаток после кавычки
+func readQuoted(s string) (string, string) {
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			return text.String(), s[i+1:]
+		case s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+		}
+		text.WriteByte(s[i])
+	}
+	return text.String(), ""
+}
+
+// queryParser - разбор по приоритетам: OR слабее AND, AND слабее NOT. Части без оператора между ними - AND
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	var children []*queryNode
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		if token := p.peek(); token == nil || token.kind != tokenOp || token.text != queryOr {
+			return joinNodes(queryOr, children), nil
+		}
+		p.pos++
+	}
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	var children []*queryNode
+	for {
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		token := p.peek()
+		switch {
+		case token == nil || token.kind == tokenClose || (token.kind == tokenOp && token.text == queryOr):
+			return joinNodes(queryAnd, children), nil
+		case token.kind == tokenOp && token.text == queryAnd:
+			p.pos++
+		}
+	}
+}
+
+func (p *queryParser) parseNot() (*queryNode, error) {
+	token := p.peek()
+	if token != nil && token.kind == tokenOp && token.text == queryNot {
+		p.pos++
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{Op: queryNot, Children: []*queryNode{child}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (*queryNode, error) {
+	token := p.peek()
+	switch {
+	case token == nil:
+		return nil, errBadQuery("unexpected end of query")
+	case token.kind == tokenOpen:
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenClose {
+			return nil, errBadQuery("missing )")
+		}
+		p.pos++
+		return node, nil
+	case token.kind != tokenWord:
+		return nil, errBadQuery("unexpected %s", token.text)
+	}
+	p.pos++
+	return &queryNode{Term: queryTerm{Field: token.field, Text: foldCase(token.text), Phrase: token.quoted}}, nil
+}
+
+// joinNodes - оператор op над children, вложенные такие же операторы раскрываются, один ребёнок - он сам
+func joinNodes(op string, children []*queryNode) *queryNode {
+	if len(children) == 1 {
+		return children[0]
+	}
+	node := &queryNode{Op: op}
+	for _, child := range children {
+		if child.Op == op {
+			node.Children = append(node.Children, child.Children...)
+		} else {
+			node.Children = append(node.Children, child)
+		}
+	}
+	return node
+}
@@ -0,0 +1,134 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{Query: "", Expected: ""},
+		// слова ищутся каждое само по себе, фраза в кавычках - целиком
+		{Query: "Boyd  Wolf", Expected: `AND("boyd", "wolf")`},
+		{Query: `"Boyd Wolf"`, Expected: `PHRASE("boyd wolf")`},
+		{Query: `wolf "nulla  cillum" boyd`, Expected: `AND("wolf", PHRASE("nulla  cillum"), "boyd")`},
+		{Query: "name:Boyd", Expected: `name:"boyd"`},
+		{Query: `ABOUT:"Nulla Cillum"`, Expected: `PHRASE(about:"nulla cillum")`},
+		{Query: `wolf name:Boyd about:"nulla cillum" male`, Expected: `AND("wolf", name:"boyd", PHRASE(about:"nulla cillum"), "male")`},
+		// незакрытая кавычка - до конца запроса
+		{Query: `about:"nulla cillum`, Expected: `PHRASE(about:"nulla cillum")`},
+		{Query: `wolf "nulla cillum`, Expected: `AND("wolf", PHRASE("nulla cillum"))`},
+		// незнакомый префикс и пустое значение - обычный текст
+		{Query: "id:5", Expected: `"id:5"`},
+		{Query: "name: Boyd", Expected: `AND("name:", "boyd")`},
+		{Query: `name:"" about:x`, Expected: `about:"x"`},
+		// без операторов скобки - часть слова
+		{Query: "(boyd)", Expected: `"(boyd)"`},
+		// операторы: NOT сильнее AND, AND сильнее OR
+		{Query: "wolf AND male NOT mayer", Expected: `AND("wolf", "male", NOT("mayer"))`},
+		{Query: "boyd OR hilda AND mayer", Expected: `OR("boyd", AND("hilda", "mayer"))`},
+		{Query: "(boyd OR hilda) mayer", Expected: `AND(OR("boyd", "hilda"), "mayer")`},
+		{Query: "a OR (b OR c)", Expected: `OR("a", "b", "c")`},
+		{Query: `"AND" OR name:"Leann Travis"`, Expected: `OR(PHRASE("and"), PHRASE(name:"leann travis"))`},
+		{Query: "NOT NOT wolf", Expected: `NOT(NOT("wolf"))`},
+		// строчные and и or - обычные слова
+		{Query: "wolf and male", Expected: `AND("wolf", "and", "male")`},
+	}
+	for caseNum, testCase := range cases {
+		node, err := ParseSearchQuery(testCase.Query)
+		if err != nil || node.String() != testCase.Expected {
+			t.Errorf("[%d] %s: expected %s, got %s %v", caseNum, testCase.Query, testCase.Expected, node, err)
+		}
+	}
+
+	for caseNum, query := range []string{"wolf AND", "AND wolf", "(wolf OR male", "wolf OR male )", "NOT", "wolf AND ()", "OR"} {
+		_, err := ParseSearchQuery(query)
+		serverErr, ok := err.(*ServerError)
+		if !ok || serverErr.Code != searchclient.CodeBadQuery || serverErr.Field != "query" {
+			t.Errorf("[%d] %s: expected bad query error, got %v", caseNum, query, err)
+		}
+	}
+}
+
+func TestServerFieldScopedQuery(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected []int
+	}{
+		{Query: "name:Boyd", Expected: []int{0}},
+		{Query: "about:boyd", Expected: []int{}},
+		{Query: `about:"nulla cillum"`, Expected: []int{0, 13}},
+		{Query: "name:an about:nulla", Expected: []int{7, 14, 24, 34}},
+		{Query: "wolf name:boyd", Expected: []int{0}},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		s := &Server{DatasetPath: datasetPath, Index: index}
+		for caseNum, testCase := range cases {
+			code, users := search(t, s, "token", "order_field=Id&order_by=-1&query="+url.QueryEscape(testCase.Query))
+			if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %d %v", index, caseNum, testCase.Query, testCase.Expected, code, userIds(users))
+			}
+		}
+	}
+}
+
+func TestServerBooleanQuery(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected []int
+	}{
+		{Query: "wolf OR mayer", Expected: []int{0, 1}},
+		{Query: "nulla NOT name:an", Expected: []int{0, 1, 2, 5, 6, 9, 11, 12, 13, 19, 21, 28, 33}},
+		{Query: "name:boyd OR (name:hilda AND about:nulla)", Expected: []int{0, 1}},
+		{Query: "NOT nulla", Expected: []int{3, 4, 8, 10, 15, 16, 17, 18, 20, 22, 23, 25, 26, 27, 29, 30, 31, 32}},
+		{Query: "(name:an OR name:el) AND NOT about:nulla", Expected: []int{8, 10, 16, 18}},
+		{Query: "wolf AND mayer", Expected: []int{}},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		s := &Server{DatasetPath: datasetPath, Index: index, PageCache: &PageCache{Size: 10}}
+		for caseNum, testCase := range cases {
+			code, users := search(t, s, "token", "order_field=Id&order_by=-1&limit=35&query="+url.QueryEscape(testCase.Query))
+			if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %d %v", index, caseNum, testCase.Query, testCase.Expected, code, userIds(users))
+			}
+		}
+		// "wolf or mayer" - три слова, а не OR, и не должны достаться из кэша от "wolf OR mayer"
+		if code, users := search(t, s, "token", "order_field=Id&order_by=-1&limit=35&query="+url.QueryEscape("Wolf or Mayer")); code != http.StatusOK || len(users) != 0 {
+			t.Errorf("[%s] expected no users for lowercase or, got %d %v", index, code, userIds(users))
+		}
+		if code, _ := search(t, s, "token", "query="+url.QueryEscape("wolf AND (mayer")); code != http.StatusBadRequest {
+			t.Errorf("[%s] expected %d for unbalanced query, got %d", index, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestServerPhraseQuery(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected []int
+	}{
+		{Query: "cillum nulla", Expected: []int{0, 2, 5, 13, 19, 24, 33, 34}},
+		{Query: `"nulla cillum"`, Expected: []int{0, 13}},
+		{Query: `"cillum nulla"`, Expected: []int{}},
+		{Query: "Wolf Boyd", Expected: []int{0}},
+		{Query: `"Wolf Boyd"`, Expected: []int{}},
+		{Query: `"Boyd Wolf"`, Expected: []int{0}},
+		{Query: `"nulla cillum" OR name:"hilda mayer"`, Expected: []int{0, 1, 13}},
+	}
+	for _, index := range []string{IndexWords, IndexTrigrams} {
+		s := &Server{DatasetPath: datasetPath, Index: index, PageCache: &PageCache{Size: 10}}
+		for caseNum, testCase := range cases {
+			code, users := search(t, s, "token", "order_field=Id&order_by=-1&limit=35&query="+url.QueryEscape(testCase.Query))
+			if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+				t.Errorf("[%s %d] %s: expected %v, got %d %v", index, caseNum, testCase.Query, testCase.Expected, code, userIds(users))
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package searchserver
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitSweepEvery - как часто RateLimiter выбрасывает лимитеры токенов, которые давно не приходили
+const rateLimitSweepEvery = time.Minute
+
+// RateLimiter ограничивает частоту запросов с каждого токена отдельно (token bucket):
+// в среднем Rate запросов в секунду, разом - до Burst
+type RateLimiter struct {
+	Rate float64
+	// сколько запросов можно сделать разом, 0 - один
+	Burst int
+
+	mu        sync.Mutex
+	limiters  map[string]*tokenLimiter
+	lastSweep time.Time
+}
+
+type tokenLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Allow учитывает запрос с токеном token. Если лимит исчерпан - запрос не учитывается,
+// а retryAfter говорит, через сколько его можно повторить
+func (l *RateLimiter) Allow(token string) (ok bool, retryAfter time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limiters == nil {
+		l.limiters = map[string]*tokenLimiter{}
+		l.lastSweep = now
+	}
+	// токенов может быть сколько угодно, если подходит любой, поэтому лимитеры не копятся вечно
+	if now.Sub(l.lastSweep) >= rateLimitSweepEvery {
+		l.sweep(now)
+	}
+	entry, found := l.limiters[token]
+	if !found {
+		entry = &tokenLimiter{limiter: rate.NewLimiter(rate.Limit(l.Rate), l.burst())}
+		l.limiters[token] = entry
+	}
+	entry.lastSeen = now
+
+	reservation := entry.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, time.Second
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+func (l *RateLimiter) burst() int {
+	if l.Burst <= 0 {
+		return 1
+	}
+	return l.Burst
+}
+
+// sweep выбрасывает лимитеры, которые успели наполниться до краёв: новый лимитер для токена будет таким же
+func (l *RateLimiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.burst()) / l.Rate * float64(time.Second))
+	for token, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > full {
+			delete(l.limiters, token)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,76 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &RateLimiter{Rate: 1, Burst: 2}
+	cases := []struct {
+		Token    string
+		Expected bool
+	}{
+		{Token: "a", Expected: true},
+		{Token: "a", Expected: true},
+		// запас кончился
+		{Token: "a", Expected: false},
+		// у другого токена свой запас
+		{Token: "b", Expected: true},
+		{Token: "a", Expected: false},
+	}
+	for caseNum, item := range cases {
+		ok, retryAfter := limiter.Allow(item.Token)
+		if ok != item.Expected {
+			t.Errorf("[%d] %s: expected allowed %v, got %v", caseNum, item.Token, item.Expected, ok)
+		}
+		if !ok && (retryAfter <= 0 || retryAfter > time.Second) {
+			t.Errorf("[%d] expected retry after up to a second, got %s", caseNum, retryAfter)
+		}
+	}
+}
+
+// лимитеры токенов, которые давно не приходили, не копятся
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := &RateLimiter{Rate: 1000, Burst: 1}
+	limiter.Allow("old")
+	limiter.mu.Lock()
+	limiter.limiters["old"].lastSeen = time.Now().Add(-time.Hour)
+	limiter.lastSweep = time.Now().Add(-2 * rateLimitSweepEvery)
+	limiter.mu.Unlock()
+
+	limiter.Allow("new")
+	if _, ok := limiter.limiters["old"]; ok || len(limiter.limiters) != 1 {
+		t.Errorf("expected only fresh limiter to stay, got %d limiters", len(limiter.limiters))
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, RateLimit: &RateLimiter{Rate: 0.5, Burst: 1}}
+	if code, _ := search(t, s, "token", "limit=1&order_by=-1"); code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?limit=1&order_by=-1"))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 with Retry-After 2, got %d with %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code != searchclient.CodeRateLimited {
+		t.Errorf("expected %s error, got %s", searchclient.CodeRateLimited, rec.Body)
+	}
+	if code, _ := search(t, s, "token", "limit=1&order_by=-1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected token to stay limited, got %d", code)
+	}
+	// служебные ручки лимит не трогает
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected healthz to pass, got %d", rec.Code)
+	}
+}
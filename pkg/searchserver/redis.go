@@ -0,0 +1,47 @@
+package searchserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache хранит результаты поиска в Redis, так что одинаковые запросы к разным репликам
+// считаются один раз за TTL. Результаты по датасету в памяти хранятся под версией датасета, после перезагрузки
+// старые не читаются и доживают TTL. Результаты по Storage живут до конца TTL
+type RedisCache struct {
+	Client redis.Cmdable
+	TTL    time.Duration
+	// префикс ключей, пустой - "searchserver:"
+	Prefix string
+}
+
+func (c *RedisCache) key(key string) string {
+	if c.Prefix == "" {
+		return "searchserver:" + key
+	}
+	return c.Prefix + key
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (Page, bool) {
+	data, err := c.Client.Get(ctx, c.key(key)).Bytes()
+	if err != nil {
+		return Page{}, false
+	}
+	page, err := decodePage(data)
+	return page, err == nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, page Page) {
+	data, err := encodePage(page)
+	if err != nil {
+		return
+	}
+	c.Client.Set(ctx, c.key(key), data, c.TTL)
+}
+
+// Ping проверяет, что Redis отвечает
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.Client.Ping(ctx).Err()
+}
@@ -0,0 +1,118 @@
+package searchserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingStorage считает, сколько раз поиск дошёл до хранилища
+type countingStorage struct {
+	Storage
+	calls atomic.Int32
+}
+
+func (c *countingStorage) Search(ctx context.Context, query Query) (Page, error) {
+	c.calls.Add(1)
+	return c.Storage.Search(ctx, query)
+}
+
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	store := &Store{}
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	store.Swap(root)
+	storage := &countingStorage{Storage: &MemoryStorage{Store: store}}
+	// две реплики с общим кэшем
+	first := &Server{Storage: storage, Cache: &RedisCache{Client: client, TTL: time.Minute}}
+	second := &Server{Storage: storage, Cache: &RedisCache{Client: client, TTL: time.Minute}}
+
+	serve := func(s *Server, target string) string {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, authorizedRequest(target))
+		return rec.Body.String()
+	}
+	expected := serve(&Server{Storage: storage}, "/v2/?query=boyd&order_by=1&limit=5")
+	storage.calls.Store(0)
+
+	cases := []struct {
+		Server        *Server
+		Target        string
+		ExpectedCalls int32
+	}{
+		{Server: first, Target: "/v2/?query=boyd&order_by=1&limit=5", ExpectedCalls: 1},
+		{Server: second, Target: "/v2/?query=boyd&order_by=1&limit=5", ExpectedCalls: 1},
+		{Server: second, Target: "/v2/?query=BOYD&order_by=1&limit=5", ExpectedCalls: 1},
+		{Server: first, Target: "/v2/?query=boyd&order_by=1&limit=6", ExpectedCalls: 2},
+	}
+	for caseNum, testCase := range cases {
+		body := serve(testCase.Server, testCase.Target)
+		if caseNum < 3 && body != expected {
+			t.Errorf("[%d] expected %s, got %s", caseNum, expected, body)
+		}
+		if calls := storage.calls.Load(); calls != testCase.ExpectedCalls {
+			t.Errorf("[%d] expected %d storage calls, got %d", caseNum, testCase.ExpectedCalls, calls)
+		}
+	}
+
+	// после TTL результат считается заново
+	mr.FastForward(2 * time.Minute)
+	serve(first, "/v2/?query=boyd&order_by=1&limit=5")
+	if calls := storage.calls.Load(); calls != 3 {
+		t.Errorf("expected search after ttl, got %d storage calls", calls)
+	}
+
+	// без Redis поиск продолжает работать
+	mr.Close()
+	if body := serve(first, "/v2/?query=boyd&order_by=1&limit=5"); body != expected {
+		t.Errorf("expected search without redis, got %s", body)
+	}
+}
+
+func TestRedisCacheReload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	dataset, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := os.WriteFile(path, dataset, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first := &Server{DatasetPath: path, Cache: &RedisCache{Client: client, TTL: time.Minute}}
+	if _, users := search(t, first, "token", "limit=100&order_by=0"); len(users) != 35 {
+		t.Fatalf("expected 35 users, got %d", len(users))
+	}
+
+	small := `<root><row><id>7</id><first_name>Jane</first_name><last_name>Doe</last_name></row></root>`
+	if err := os.WriteFile(path, []byte(small), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %s", err)
+	}
+	// реплика, загрузившая новый файл, тоже не должна видеть результат по старому
+	second := &Server{DatasetPath: path, Cache: &RedisCache{Client: client, TTL: time.Minute}}
+	for caseNum, s := range []*Server{first, second} {
+		if _, users := search(t, s, "token", "limit=100&order_by=0"); !reflect.DeepEqual(userIds(users), []int{7}) {
+			t.Errorf("[%d] expected only new dataset after reload, got %v", caseNum, userIds(users))
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package searchserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IsRemoteDataset - путь до датасета на самом деле ссылка http(s):// или s3://
+func IsRemoteDataset(location string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(strings.ToLower(location), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// S3Config - куда и с какими ключами ходить за s3:// датасетом. Без ключей запрос уходит анонимным
+type S3Config struct {
+	// регион бакета, пустой - us-east-1
+	Region string
+	// свой адрес S3-совместимого хранилища (MinIO и т.п.), бакет тогда указывается в пути
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// RemoteDataset скачивает датасет по ссылке и проверяет его контрольную сумму
+type RemoteDataset struct {
+	URL string
+	// ожидаемый sha256 содержимого в hex, можно с префиксом "sha256:". Подходит для ссылки на неизменяемый файл:
+	// после замены файла по ссылке скачанный с этой суммой не совпадёт
+	Checksum string
+	// ссылка на файл с sha256 рядом с датасетом, в формате sha256sum ("<sum>  <файл>") или только сумма.
+	// Читается заново при каждом скачивании, поэтому датасет по ссылке можно заменять вместе с ним.
+	// Пустой у http(s):// без Checksum - URL + ".sha256", непроверенный датасет не загружается.
+	// У s3:// без Checksum и ChecksumURL проверяется только сумма, которую прислал сам S3
+	ChecksumURL string
+	S3          S3Config
+	// пустой - клиент с таймаутом defaultDownloadTimeout
+	Client *http.Client
+}
+
+// defaultDownloadTimeout - сколько ждать скачивания датасета, если клиент не задан
+const defaultDownloadTimeout = 5 * time.Minute
+
+// Download скачивает датасет во временный файл с тем же расширением, что и в ссылке, чтобы
+// LoadDataset понял формат. Удалить файл должен вызывающий
+func (d *RemoteDataset) Download(ctx context.Context) (string, error) {
+	req, err := d.request(ctx)
+	if err != nil {
+		return "", err
+	}
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultDownloadTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cant download dataset: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cant download dataset %s: %s", d.URL, resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "dataset-*"+path.Ext(req.URL.Path))
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = d.verify(ctx, client, hash.Sum(nil), resp.Header.Get("x-amz-checksum-sha256"))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("cant download dataset %s: %w", d.URL, err)
+	}
+	return file.Name(), nil
+}
+
+// checksumURL - откуда читать ожидаемую сумму, пустой - ожидаемая сумма задана в Checksum или её нет
+func (d *RemoteDataset) checksumURL() string {
+	if d.Checksum != "" {
+		return ""
+	}
+	if d.ChecksumURL == "" && !strings.HasPrefix(strings.ToLower(d.URL), "s3://") {
+		return d.URL + ".sha256"
+	}
+	return d.ChecksumURL
+}
+
+// fetchChecksum читает ожидаемую сумму по ссылке checksumURL теми же ключами, что и датасет
+func (d *RemoteDataset) fetchChecksum(ctx context.Context, client *http.Client, location string) (string, error) {
+	req, err := (&RemoteDataset{URL: location, S3: d.S3}).request(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cant download checksum: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cant download checksum %s: %s", location, resp.Status)
+	}
+	// в файле одна строка, больше килобайта - не он
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("cant download checksum %s: %w", location, err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file %s is empty", location)
+	}
+	return fields[0], nil
+}
+
+// verify сверяет сумму скачанного с ожидаемой и с той, что прислал S3
+func (d *RemoteDataset) verify(ctx context.Context, client *http.Client, sum []byte, s3Checksum string) error {
+	checksum := d.Checksum
+	if location := d.checksumURL(); location != "" {
+		var err error
+		if checksum, err = d.fetchChecksum(ctx, client, location); err != nil {
+			return err
+		}
+	}
+	if checksum != "" {
+		expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+		if got := hex.EncodeToString(sum); got != expected {
+			return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expected, got)
+		}
+	}
+	// у составных загрузок сумма считается по частям и кончается на -N, с суммой файла её не сравнить
+	if s3Checksum != "" && !strings.Contains(s3Checksum, "-") {
+		if got := base64.StdEncoding.EncodeToString(sum); got != s3Checksum {
+			return fmt.Errorf("checksum mismatch: s3 reports sha256 %s, got %s", s3Checksum, got)
+		}
+	}
+	return nil
+}
+
+func (d *RemoteDataset) request(ctx context.Context) (*http.Request, error) {
+	location, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dataset url: %w", err)
+	}
+	if !strings.EqualFold(location.Scheme, "s3") {
+		return http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	}
+
+	bucket, key := location.Host, strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid dataset url %s, expected s3://bucket/key", d.URL)
+	}
+	region := d.S3.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	var target *url.URL
+	if d.S3.Endpoint != "" {
+		target, err = url.Parse(strings.TrimSuffix(d.S3.Endpoint, "/") + "/" + bucket + "/" + key)
+	} else {
+		target, err = url.Parse("https://" + bucket + ".s3." + region + ".amazonaws.com/" + key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid dataset url: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// просим S3 прислать sha256 объекта, если он его хранит
+	req.Header.Set("x-amz-checksum-mode", "ENABLED")
+	if d.S3.AccessKeyID != "" {
+		signS3(req, d.S3, region, time.Now())
+	}
+	return req, nil
+}
+
+// emptyPayloadHash - sha256 пустого тела, у GET тела нет
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signS3 подписывает запрос без тела по AWS Signature V4. Подписываются host и все заголовки запроса
+func signS3(req *http.Request, cfg S3Config, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if cfg.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath кодирует путь объекта, как того требует подпись: всё, кроме незарезервированных символов и /
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	var escaped strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			escaped.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+	return escaped.String()
+}
+
+// errRemoteWatch - за файлом по ссылке следить нельзя, только перечитывать
+var errRemoteWatch = errors.New("remote dataset cannot be watched")
@@ -0,0 +1,125 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"hw4/pkg/searchclient"
+)
+
+// bufferPool - буферы под ответы, чтобы не растить новый буфер на каждый запрос
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// буферы больше этого в пул не возвращаем, чтобы один огромный ответ не держал память
+const maxPooledBuffer = 1 << 20
+
+// renderUsers готовит ответ со страницей пользователей: в v1 - массивом, в v2 - вместе с общим количеством.
+// Пользователи пишутся в буфер из пула по одному, без промежуточного среза UserJson. Непустая mask прячет поля,
+// непустой highlight добавляет подсветку найденного, непустые facets в v2 отдаются рядом со страницей
+func renderUsers(version string, items []Item, total int, mask FieldMask, highlight *highlighter, facets *searchclient.Aggregations) []byte {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	if version == searchclient.APIVersion2 {
+		buf.WriteString(`{"users":`)
+		writeUsers(buf, items, "[]", mask, highlight)
+		buf.WriteString(`,"total":`)
+		buf.WriteString(strconv.Itoa(total))
+		writeFacets(buf, facets)
+		buf.WriteByte('}')
+	} else {
+		writeUsers(buf, items, "null", mask, highlight)
+	}
+	return bytes.Clone(buf.Bytes())
+}
+
+// renderGroups готовит ответ v2 с группами вместо страницы: {"groups":[{"Key","Count","Users"}],"total"}.
+// Пользователи в группах пишутся так же, как в renderUsers
+func renderGroups(groups []userGroup, total int, mask FieldMask, highlight *highlighter, facets *searchclient.Aggregations) []byte {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	buf.WriteString(`{"groups":[`)
+	for i, group := range groups {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(group.Key)
+		buf.WriteString(`{"Key":`)
+		buf.Write(key)
+		buf.WriteString(`,"Count":`)
+		buf.WriteString(strconv.Itoa(group.Count))
+		buf.WriteString(`,"Users":`)
+		writeUsers(buf, group.Users, "[]", mask, highlight)
+		buf.WriteByte('}')
+	}
+	buf.WriteString(`],"total":`)
+	buf.WriteString(strconv.Itoa(total))
+	writeFacets(buf, facets)
+	buf.WriteByte('}')
+	return bytes.Clone(buf.Bytes())
+}
+
+// writeFacets дописывает к объекту ответа поле facets, если они есть
+func writeFacets(buf *bytes.Buffer, facets *searchclient.Aggregations) {
+	if facets == nil {
+		return
+	}
+	buf.WriteString(`,"facets":`)
+	_ = json.NewEncoder(buf).Encode(facets)
+	buf.Truncate(buf.Len() - 1)
+}
+
+// writeUsers пишет пользователей json-массивом, пустой список пишется как empty
+func writeUsers(buf *bytes.Buffer, items []Item, empty string, mask FieldMask, highlight *highlighter) {
+	if len(items) == 0 {
+		buf.WriteString(empty)
+		return
+	}
+	encoder := json.NewEncoder(buf)
+	var user UserJson
+	buf.WriteByte('[')
+	for i := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		item := &items[i]
+		if len(mask) > 0 {
+			masked := mask.apply(item)
+			masked.Highlight = highlight.highlight(item, mask)
+			_ = encoder.Encode(&masked)
+			buf.Truncate(buf.Len() - 1)
+			continue
+		}
+		user = UserJson{
+			Id:     item.Id,
+			Guid:   item.Guid,
+			Name:   item.Name,
+			Age:    item.Age,
+			About:  item.About,
+			Gender: item.Gender,
+			Score:  item.Score,
+			// без маски прятать нечего
+			Highlight: highlight.highlight(item, nil),
+		}
+		// UserJson из строк и чисел кодируется всегда
+		_ = encoder.Encode(&user)
+		// Encode дописывает перевод строки, в массиве он не нужен
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte(']')
+}
@@ -0,0 +1,73 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+// marshalUsers - прежний рендер через json.Marshal, с ним сравниваем потоковый
+func marshalUsers(version string, items []Item, total int) []byte {
+	var users []UserJson
+	for _, item := range items {
+		users = append(users, UserJson{Id: item.Id, Name: item.Name, Age: item.Age, About: item.About, Gender: item.Gender})
+	}
+	if version == searchclient.APIVersion2 {
+		if users == nil {
+			users = []UserJson{}
+		}
+		result, _ := json.Marshal(struct {
+			Users []UserJson `json:"users"`
+			Total int        `json:"total"`
+		}{Users: users, Total: total})
+		return result
+	}
+	result, _ := json.Marshal(users)
+	return result
+}
+
+func TestRenderUsersMatchesMarshal(t *testing.T) {
+	cases := []struct {
+		Items []Item
+		Total int
+	}{
+		{Items: nil, Total: 0},
+		{Items: []Item{}, Total: 5},
+		{Items: []Item{{Id: 1, Name: "Jane Doe", Age: 30, About: "likes <tags> & \"quotes\"\n", Gender: "female"}}, Total: 1},
+		{Items: []Item{{Id: 1, Name: "Jane"}, {Id: 2, Name: "Иван Петров", About: "юникод  "}}, Total: 10},
+	}
+	for caseNum, item := range cases {
+		for _, version := range []string{searchclient.APIVersion1, searchclient.APIVersion2} {
+			got := string(renderUsers(version, item.Items, item.Total, nil, nil, nil))
+			want := string(marshalUsers(version, item.Items, item.Total))
+			if got != want {
+				t.Errorf("[%d] %s: expected %s, got %s", caseNum, version, want, got)
+			}
+		}
+	}
+}
+
+func TestRenderUsersDoesNotShareBuffer(t *testing.T) {
+	first := renderUsers(searchclient.APIVersion1, []Item{{Id: 1, Name: "first"}}, 1, nil, nil, nil)
+	want := string(first)
+	renderUsers(searchclient.APIVersion1, []Item{{Id: 2, Name: "second"}}, 1, nil, nil, nil)
+	if string(first) != want {
+		t.Errorf("expected %s to stay intact, got %s", want, first)
+	}
+}
+
+func TestRenderUsersFacets(t *testing.T) {
+	facets := &searchclient.Aggregations{Total: 1, ByGender: map[string]int{"female": 1, "male": 0}, AgeHistogram: []searchclient.AgeBucket{{From: 30, To: 40, Count: 1}}}
+	items := []Item{{Id: 1, Name: "Jane", Age: 30, Gender: "female"}}
+	got := string(renderUsers(searchclient.APIVersion2, items, 1, nil, nil, facets))
+	expected := `{"users":[{"Id":1,"Name":"Jane","Age":30,"About":"","Gender":"female"}],"total":1,` +
+		`"facets":{"Total":1,"ByGender":{"female":1,"male":0},"AgeHistogram":[{"From":30,"To":40,"Count":1}]}}`
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	// в v1 фасетам негде быть
+	if got := string(renderUsers(searchclient.APIVersion1, items, 1, nil, nil, facets)); got != string(marshalUsers(searchclient.APIVersion1, items, 1)) {
+		t.Errorf("expected plain array in v1, got %s", got)
+	}
+}
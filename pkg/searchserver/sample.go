@@ -0,0 +1,185 @@
+package searchserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"strconv"
+
+	"hw4/pkg/searchclient"
+)
+
+// размер выборки /sample: если не задан и самый большой
+const (
+	DefaultSampleSize = 10
+	MaxSampleSize     = 100
+)
+
+// Sampler - хранилище, которое выбирает случайных найденных на своей стороне. Его реализуют все встроенные хранилища,
+// у остальных сервер узнаёт число найденных и достаёт выбранных по одному по номеру в порядке Id
+type Sampler interface {
+	Sample(ctx context.Context, query Query, n int, seed int64) (Page, error)
+}
+
+// ParseSampleSize разбирает n, пустой - DefaultSampleSize, больше MaxSampleSize - MaxSampleSize
+func ParseSampleSize(value string) (int, error) {
+	if value == "" {
+		return DefaultSampleSize, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, &ServerError{Code: searchclient.CodeBadLimit, Message: fmt.Sprintf("invalid n: %s, expected positive number", value), Field: "n"}
+	}
+	return min(n, MaxSampleSize), nil
+}
+
+// ParseSampleSeed разбирает seed, пустой - случайный, чтобы выборки шли разные, а повторить можно было по seed из ответа
+func ParseSampleSeed(value string) (int64, error) {
+	if value == "" {
+		return rand.Int63(), nil
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &ServerError{Code: searchclient.CodeBadQuery, Message: fmt.Sprintf("invalid seed: %s, expected integer", value), Field: "seed"}
+	}
+	return seed, nil
+}
+
+// samplePositions - n разных случайных номеров из [0, total) в случайном порядке, каждый набор равновероятен.
+// Частичное перемешивание Фишера-Йетса, переставленные номера хранятся в map, чтобы не заводить массив на total
+func samplePositions(total, n int, seed int64) []int {
+	n = min(n, total)
+	rng := rand.New(rand.NewSource(seed))
+	swapped := make(map[int]int, n)
+	at := func(i int) int {
+		if pos, ok := swapped[i]; ok {
+			return pos
+		}
+		return i
+	}
+	positions := make([]int, n)
+	for i := range positions {
+		j := i + rng.Intn(total-i)
+		positions[i], swapped[j] = at(j), at(i)
+	}
+	return positions
+}
+
+// Sample выбирает n случайных среди найденных в снимке. Найденные идут в порядке записей в датасете,
+// поэтому одинаковый seed по тому же датасету даёт ту же выборку
+func (m *MemoryStorage) Sample(ctx context.Context, query Query, n int, seed int64) (Page, error) {
+	snapshot, base, err := m.view(query)
+	if err != nil {
+		return Page{}, err
+	}
+	defer runtime.KeepAlive(base)
+	query.Sort = nil
+	positions, err := snapshot.sorted(ctx, query, m.Workers, nil, nil)
+	if err != nil {
+		return Page{}, err
+	}
+	picked := samplePositions(len(positions), n, seed)
+	for i, index := range picked {
+		picked[i] = positions[index]
+	}
+	return Page{Users: snapshot.rowsAt(picked), Total: len(positions)}, nil
+}
+
+// sample - n случайных среди найденных через Sampler хранилища, а если его нет - поиском по номеру в порядке Id
+func (s *Server) sample(ctx context.Context, query Query, n int, seed int64) (Page, error) {
+	query.Sort, query.Offset = nil, 0
+	var storage Storage = s.Storage
+	if storage == nil {
+		if _, err := s.loadDataset(); err != nil {
+			return Page{}, err
+		}
+		storage = &MemoryStorage{Store: &s.store, Workers: s.SearchWorkers, Analyzer: s.Analyzer}
+	}
+	if sampler, ok := storage.(Sampler); ok {
+		return sampler.Sample(ctx, query, n, seed)
+	}
+	query.Limit = 0
+	counted, err := s.search(ctx, query)
+	if err != nil {
+		return Page{}, err
+	}
+	query.Sort, query.Limit = []SortField{{Field: "Id", Order: searchclient.OrderByAsc}}, 1
+	page := Page{Users: []Item{}, Total: counted.Total}
+	for _, offset := range samplePositions(counted.Total, n, seed) {
+		query.Offset = offset
+		found, err := s.search(ctx, query)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Users = append(page.Users, found.Users...)
+	}
+	return page, nil
+}
+
+// renderSample готовит ответ /sample: {"users":[...],"total":N,"seed":S}, пользователи пишутся как в renderUsers
+func renderSample(page Page, seed int64, mask FieldMask) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"users":`)
+	writeUsers(&buf, page.Users, "[]", mask, nil)
+	buf.WriteString(`,"total":`)
+	buf.WriteString(strconv.Itoa(page.Total))
+	buf.WriteString(`,"seed":`)
+	buf.WriteString(strconv.FormatInt(seed, 10))
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// serveSample - GET /sample?n=10&seed=42&gender=female: n случайных пользователей среди найденных,
+// для выборочных проверок и демо. С тем же seed по тем же данным выборка повторяется
+func (s *Server) serveSample(w http.ResponseWriter, r *http.Request, mask FieldMask) {
+	params := r.URL.Query()
+	n, err := ParseSampleSize(params.Get("n"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadLimit, http.StatusBadRequest)
+		return
+	}
+	seed, err := ParseSampleSeed(params.Get("seed"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	fields, err := ParseFields(params.Get("fields"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadFields, http.StatusBadRequest)
+		return
+	}
+	query, err := ParseQuery(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	query.Synonyms = s.Synonyms
+	ctx := r.Context()
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	page, err := s.sample(ctx, query, n, seed)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			JSONError(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "sample timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	noteResults(r.Context(), len(page.Users), page.Total)
+	w.Header().Set(TotalCountHeader, strconv.Itoa(page.Total))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(renderSample(page, seed, mask.only(fields)))
+}
@@ -0,0 +1,180 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestSamplePositions(t *testing.T) {
+	cases := []struct {
+		Total int
+		N     int
+	}{
+		{Total: 35, N: 10},
+		{Total: 5, N: 5},
+		{Total: 3, N: 10},
+		{Total: 0, N: 10},
+		{Total: 1000000, N: 100},
+	}
+	for caseNum, testCase := range cases {
+		positions := samplePositions(testCase.Total, testCase.N, 42)
+		if len(positions) != min(testCase.Total, testCase.N) {
+			t.Errorf("[%d] expected %d positions, got %v", caseNum, min(testCase.Total, testCase.N), positions)
+			continue
+		}
+		seen := map[int]bool{}
+		for _, pos := range positions {
+			if pos < 0 || pos >= testCase.Total || seen[pos] {
+				t.Errorf("[%d] bad or repeated position %d in %v", caseNum, pos, positions)
+			}
+			seen[pos] = true
+		}
+		if again := samplePositions(testCase.Total, testCase.N, 42); !reflect.DeepEqual(again, positions) {
+			t.Errorf("[%d] expected the same positions for the same seed, got %v and %v", caseNum, positions, again)
+		}
+	}
+
+	// каждый номер попадает в выборку 2 из 5 примерно в 40% случаев
+	hits := make([]int, 5)
+	for seed := int64(0); seed < 5000; seed++ {
+		for _, pos := range samplePositions(5, 2, seed) {
+			hits[pos]++
+		}
+	}
+	for pos, count := range hits {
+		if count < 1800 || count > 2200 {
+			t.Errorf("position %d picked %d times of 5000, expected about 2000", pos, count)
+		}
+	}
+}
+
+func TestParseSampleSize(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected int
+		IsError  bool
+	}{
+		{Value: "", Expected: DefaultSampleSize},
+		{Value: "3", Expected: 3},
+		{Value: "1000", Expected: MaxSampleSize},
+		{Value: "0", IsError: true},
+		{Value: "-1", IsError: true},
+		{Value: "x", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		n, err := ParseSampleSize(testCase.Value)
+		if testCase.IsError != (err != nil) || n != testCase.Expected {
+			t.Errorf("[%d] expected %d (error %v), got %d %v", caseNum, testCase.Expected, testCase.IsError, n, err)
+		}
+	}
+}
+
+func decodeSample(t *testing.T, s *Server, target, token string) (int, searchclient.SampleResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("AccessToken", token)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var resp searchclient.SampleResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("cant decode sample %s: %s", rec.Body, err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestServerSample(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"Name": MaskHide},
+	}
+	cases := []struct {
+		Target string
+		Token  string
+		Status int
+		Size   int
+		Total  int
+	}{
+		{Target: "/sample", Token: "s-secret", Status: http.StatusOK, Size: DefaultSampleSize, Total: 35},
+		{Target: "/v2/sample?n=5&seed=7", Token: "s-secret", Status: http.StatusOK, Size: 5, Total: 35},
+		{Target: "/sample?n=100&gender=female", Token: "s-secret", Status: http.StatusOK, Size: 11, Total: 11},
+		{Target: "/sample?n=3&query=nothing", Token: "s-secret", Status: http.StatusOK, Size: 0, Total: 0},
+		{Target: "/sample?n=0", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/sample?seed=x", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/sample?fields=Password", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/sample?age_min=x", Token: "s-secret", Status: http.StatusBadRequest},
+		{Target: "/sample", Token: "bad", Status: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		code, sample := decodeSample(t, s, testCase.Target, testCase.Token)
+		if code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d", caseNum, testCase.Status, code)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if len(sample.Users) != testCase.Size || sample.Total != testCase.Total {
+			t.Errorf("[%d] expected %d of %d users, got %d of %d", caseNum, testCase.Size, testCase.Total, len(sample.Users), sample.Total)
+		}
+		ids := []int{}
+		for _, user := range sample.Users {
+			if slices.Contains(ids, user.Id) {
+				t.Errorf("[%d] user %d sampled twice", caseNum, user.Id)
+			}
+			ids = append(ids, user.Id)
+		}
+	}
+
+	_, first := decodeSample(t, s, "/sample?n=5&seed=7", "s-secret")
+	_, second := decodeSample(t, s, "/sample?n=5&seed=7", "s-secret")
+	if first.Seed != 7 || !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same sample for the same seed, got %+v and %+v", first, second)
+	}
+	// без seed сервер выбирает его сам и отдаёт, чтобы выборку можно было повторить
+	_, random := decodeSample(t, s, "/sample?n=5", "s-secret")
+	_, repeated := decodeSample(t, s, "/sample?n=5&seed="+strconv.FormatInt(random.Seed, 10), "s-secret")
+	if !reflect.DeepEqual(random, repeated) {
+		t.Errorf("expected sample to repeat with returned seed, got %+v and %+v", random, repeated)
+	}
+
+	_, masked := decodeSample(t, s, "/sample?n=5&seed=7", "r-secret")
+	if len(masked.Users) != len(first.Users) {
+		t.Fatalf("expected %d masked users, got %+v", len(first.Users), masked)
+	}
+	for i, user := range masked.Users {
+		if user.Name != "" || user.Id != first.Users[i].Id {
+			t.Errorf("expected masked user %d, got %+v", first.Users[i].Id, user)
+		}
+	}
+	_, projected := decodeSample(t, s, "/sample?n=5&seed=7&fields=Id", "s-secret")
+	for _, user := range projected.Users {
+		if user.Name != "" || user.About != "" || user.Age != 0 {
+			t.Errorf("expected only Id, got %+v", user)
+		}
+	}
+}
+
+func TestSQLiteSampleMatchesMemory(t *testing.T) {
+	// в dataset.xml записи идут по Id, поэтому выборка по номеру в порядке Id та же, что в памяти
+	memory := &Server{DatasetPath: datasetPath}
+	backend := &Server{Storage: newSQLiteStorage(t)}
+	for caseNum, target := range []string{"/sample?seed=1", "/sample?n=7&seed=99&gender=male", "/sample?n=3&seed=5&query=nulla"} {
+		expected, got := httptest.NewRecorder(), httptest.NewRecorder()
+		memory.ServeHTTP(expected, authorizedRequest(target))
+		backend.ServeHTTP(got, authorizedRequest(target))
+		if expected.Code != http.StatusOK || got.Body.String() != expected.Body.String() {
+			t.Errorf("[%d] %s: expected %s, got %d %s", caseNum, target, expected.Body, got.Code, got.Body)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package searchserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// scope - что разрешено делать с токеном
+const (
+	// искать и читать пользователей
+	ScopeSearchRead = "search:read"
+	// всё, включая служебные ручки
+	ScopeAdmin = "admin"
+)
+
+// DefaultScopes - scope клиентов, которым они не заданы явно: только поиск
+var DefaultScopes = []string{ScopeSearchRead}
+
+// identity - кто прислал запрос и что ему можно
+type identity struct {
+	client string
+	scopes []string
+}
+
+// can - есть ли у клиента scope; admin разрешает всё
+func (id identity) can(scope string) bool {
+	for _, have := range id.scopes {
+		if have == scope || have == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// requireScope отвечает 403, если у клиента запроса нет scope
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	id, _ := r.Context().Value(identityKey{}).(identity)
+	if id.can(scope) {
+		return true
+	}
+	JSONError(w, r, "token has no "+scope+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+	return false
+}
+
+// clientScopes - scope клиента по имени из Server.Scopes, если не заданы - DefaultScopes
+func (s *Server) clientScopes(client string) []string {
+	if scopes, ok := s.Scopes[client]; ok {
+		return scopes
+	}
+	return DefaultScopes
+}
+
+// ParseScopes разбирает список scope через пробел или запятую, как в claim scope у OAuth
+func ParseScopes(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func withIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
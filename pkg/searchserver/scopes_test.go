@@ -0,0 +1,68 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseScopes(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected []string
+	}{
+		{Value: "search:read", Expected: []string{"search:read"}},
+		{Value: "search:read pii:read", Expected: []string{"search:read", "pii:read"}},
+		{Value: "admin,search:read", Expected: []string{"admin", "search:read"}},
+		{Value: " ", Expected: []string{}},
+	}
+	for caseNum, testCase := range cases {
+		if got := ParseScopes(testCase.Value); !reflect.DeepEqual(got, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerScopes(t *testing.T) {
+	secret := []byte("shared-secret")
+	s := &Server{
+		DatasetPath: datasetPath,
+		Token:       "main",
+		Tokens:      map[string]string{"reader": "r-secret", "auditor": "a-secret", "ops": "o-secret"},
+		Scopes: map[string][]string{
+			"auditor": {ScopePIIRead},
+			"ops":     {ScopeAdmin},
+		},
+		JWT: &JWT{Secret: secret},
+	}
+	jwtWith := func(claims map[string]interface{}) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		return signJWT(t, "HS256", secret, claims)
+	}
+	cases := []struct {
+		Sent         string
+		ExpectedCode int
+	}{
+		// кому scope не заданы - только поиск
+		{Sent: "main", ExpectedCode: http.StatusOK},
+		{Sent: "r-secret", ExpectedCode: http.StatusOK},
+		{Sent: "a-secret", ExpectedCode: http.StatusForbidden},
+		{Sent: "o-secret", ExpectedCode: http.StatusOK},
+		{Sent: jwtWith(map[string]interface{}{"sub": "alice"}), ExpectedCode: http.StatusOK},
+		{Sent: jwtWith(map[string]interface{}{"sub": "alice", "scope": "pii:read search:read"}), ExpectedCode: http.StatusOK},
+		{Sent: jwtWith(map[string]interface{}{"sub": "alice", "scope": "pii:read"}), ExpectedCode: http.StatusForbidden},
+		{Sent: jwtWith(map[string]interface{}{"sub": "alice", "scp": []string{"pii:read"}}), ExpectedCode: http.StatusForbidden},
+		{Sent: jwtWith(map[string]interface{}{"sub": "alice", "scp": []string{"admin"}}), ExpectedCode: http.StatusOK},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/?limit=1&order_by=-1", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.Sent)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected %d, got %d: %s", caseNum, testCase.ExpectedCode, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package searchserver
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ScoreField - псевдополе сортировки по релевантности записи запросу, order_field=_score.
+// Без направления лучшие совпадения идут первыми, как и у остальных полей с OrderByAsIs
+const ScoreField = "_score"
+
+// параметры BM25: насыщение частоты слова и поправка на длину поля
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// совпадение в имени говорит о записи больше, чем то же слово где-то в описании
+	bm25NameBoost = 2
+)
+
+// scored - сортируется ли запрос по релевантности
+func (q Query) scored() bool {
+	for _, field := range q.Sort {
+		if field.Field == ScoreField {
+			return true
+		}
+	}
+	return false
+}
+
+// scorer считает релевантность записей снимка запросу по BM25 над Name и About.
+// Вклад дают слова и фразы запроса, кроме тех, что под NOT. Посчитанное запоминается по номеру записи
+type scorer struct {
+	snapshot *Snapshot
+	terms    []scoredTerm
+	scores   map[int]float64
+}
+
+type scoredTerm struct {
+	queryTerm
+	idf float64
+}
+
+// newScorer готовит подсчёт релевантности: idf каждого терма - по тому, в скольких записях снимка он есть
+func (s *Snapshot) newScorer(query Query) *scorer {
+	sc := &scorer{snapshot: s, scores: map[int]float64{}}
+	seen := map[queryTerm]bool{}
+	for _, node := range s.searchTree(query).positiveTerms(nil) {
+		if seen[node.Term] {
+			continue
+		}
+		seen[node.Term] = true
+		found := 0
+		positions, ok := node.candidates(s.index)
+		if !ok {
+			positions = s.all()
+		}
+		for _, pos := range positions {
+			if node.match(s.rows[pos].nameLower, s.rows[pos].aboutLower) {
+				found++
+			}
+		}
+		n := float64(len(s.rows))
+		idf := math.Log(1 + (n-float64(found)+0.5)/(float64(found)+0.5))
+		sc.terms = append(sc.terms, scoredTerm{queryTerm: node.Term, idf: idf})
+	}
+	return sc
+}
+
+// positiveTerms дописывает в terms термы дерева, которые не стоят под NOT
+func (n *queryNode) positiveTerms(terms []*queryNode) []*queryNode {
+	switch {
+	case n == nil || n.Op == queryNot:
+		return terms
+	case n.Op == "":
+		return append(terms, n)
+	}
+	for _, child := range n.Children {
+		terms = child.positiveTerms(terms)
+	}
+	return terms
+}
+
+// scoreAt - релевантность записи с номером pos
+func (sc *scorer) scoreAt(pos int) float64 {
+	if score, ok := sc.scores[pos]; ok {
+		return score
+	}
+	item := &sc.snapshot.rows[pos]
+	avgName, avgAbout := sc.snapshot.averageLengths()
+	score := 0.0
+	for _, term := range sc.terms {
+		if term.Field != "About" {
+			score += bm25NameBoost * term.idf * bm25(item.nameLower, term.Text, avgName)
+		}
+		if term.Field != "Name" {
+			score += term.idf * bm25(item.aboutLower, term.Text, avgAbout)
+		}
+	}
+	sc.scores[pos] = score
+	return score
+}
+
+// ranks - номера групп равной релевантности по возрастанию для записей positions, как sortIndex.rank
+func (sc *scorer) ranks(positions []int) []int {
+	values := make([]float64, len(positions))
+	for i, pos := range positions {
+		values[i] = sc.scoreAt(pos)
+	}
+	sort.Float64s(values)
+	rank := make([]int, len(sc.snapshot.rows))
+	for _, pos := range positions {
+		rank[pos] = sort.SearchFloat64s(values, sc.scores[pos])
+	}
+	return rank
+}
+
+// bm25 - вклад терма в одно поле: растёт с числом вхождений, но с насыщением, и меньше в длинных полях
+func bm25(field, term string, avgLength float64) float64 {
+	tf := float64(strings.Count(field, term))
+	if tf == 0 {
+		return 0
+	}
+	norm := 1.0
+	if avgLength > 0 {
+		norm = 1 - bm25B + bm25B*float64(countWords(field))/avgLength
+	}
+	return tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+// countWords - сколько слов в тексте, как len(splitWords(text)), но без среза
+func countWords(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		letter := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if letter && !inWord {
+			count++
+		}
+		inWord = letter
+	}
+	return count
+}
+
+// averageLengths - средняя длина Name и About в словах, считается один раз на снимок
+func (s *Snapshot) averageLengths() (float64, float64) {
+	s.lengthsOnce.Do(func() {
+		if len(s.rows) == 0 {
+			return
+		}
+		var name, about int
+		for i := range s.rows {
+			name += countWords(s.rows[i].nameLower)
+			about += countWords(s.rows[i].aboutLower)
+		}
+		s.avgName = float64(name) / float64(len(s.rows))
+		s.avgAbout = float64(about) / float64(len(s.rows))
+	})
+	return s.avgName, s.avgAbout
+}
@@ -0,0 +1,87 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBM25(t *testing.T) {
+	if got := bm25("boyd wolf", "mayer", 2); got != 0 {
+		t.Errorf("expected 0 for missing term, got %v", got)
+	}
+	once, twice := bm25("nulla cillum", "nulla", 2), bm25("nulla nulla", "nulla", 2)
+	if !(twice > once) || !(twice < 2*once) {
+		t.Errorf("expected repeated term to score higher but saturate, got %v and %v", once, twice)
+	}
+	short, long := bm25("nulla cillum", "nulla", 4), bm25("nulla cillum ex ea commodo id", "nulla", 4)
+	if !(short > long) {
+		t.Errorf("expected shorter field to score higher, got %v and %v", short, long)
+	}
+	if got := countWords("Nulla cillum, ex  ea-commodo"); got != 5 {
+		t.Errorf("expected 5 words, got %d", got)
+	}
+}
+
+func TestServerScoreOrder(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, PageCache: &PageCache{Size: 10}}
+	scores := func(rawQuery string) ([]int, []float64) {
+		code, users := search(t, s, "token", rawQuery)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", rawQuery, http.StatusOK, code)
+		}
+		var values []float64
+		for _, user := range users {
+			values = append(values, user.Score)
+		}
+		return userIds(users), values
+	}
+
+	// совпадение и в имени, и в описании - первым
+	ids, values := scores("order_field=_score&limit=35&query=" + url.QueryEscape("boyd OR nulla"))
+	if len(ids) != 17 || ids[0] != 0 {
+		t.Errorf("expected 17 users with Boyd first, got %v", ids)
+	}
+	if !sort.IsSorted(sort.Reverse(sort.Float64Slice(values))) || values[len(values)-1] <= 0 {
+		t.Errorf("expected positive scores best first, got %v", values)
+	}
+	// из кэша - те же оценки
+	if cachedIds, cachedValues := scores("order_field=_score&limit=35&query=" + url.QueryEscape("boyd OR nulla")); !reflect.DeepEqual(cachedIds, ids) || !reflect.DeepEqual(cachedValues, values) {
+		t.Errorf("expected cached page with the same scores, got %v %v", cachedIds, cachedValues)
+	}
+
+	// order_by=-1 - от худших к лучшим, равные по Id
+	ascIds, _ := scores("order_field=_score&order_by=-1&limit=35&query=" + url.QueryEscape("boyd OR nulla"))
+	if ascIds[len(ascIds)-1] != 0 {
+		t.Errorf("expected Boyd last in ascending order, got %v", ascIds)
+	}
+
+	// то, что под NOT, на оценку не влияет
+	_, plain := scores("order_field=_score&limit=35&query=nulla")
+	_, negated := scores("order_field=_score&limit=35&query=" + url.QueryEscape("nulla NOT zzz"))
+	if !reflect.DeepEqual(plain, negated) {
+		t.Errorf("expected NOT to keep scores, got %v and %v", plain, negated)
+	}
+
+	// без запроса оценки нулевые, порядок - по Id, а Score в ответе нет
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?order_field=_score&limit=3"))
+	var raw []map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &raw)
+	if len(raw) != 3 || raw[0]["Id"] != float64(0) || raw[2]["Id"] != float64(2) || raw[0]["Score"] != nil {
+		t.Errorf("expected first users by Id without Score, got %s", rec.Body)
+	}
+
+	// без сортировки по _score оценок тоже нет
+	if _, values := scores("order_field=Id&limit=3&query=nulla"); !reflect.DeepEqual(values, []float64{0, 0, 0}) {
+		t.Errorf("expected no scores without _score sort, got %v", values)
+	}
+	// в sort - как обычное поле
+	if sortIds, _ := scores("sort=_score:1&sort=Age:-1&limit=35&query=" + url.QueryEscape("boyd OR nulla")); !reflect.DeepEqual(sortIds, ids) {
+		t.Errorf("expected the same order via sort, got %v", sortIds)
+	}
+}
@@ -0,0 +1,202 @@
+package searchserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// SearchItems оставляет записи, в имени или описании которых есть query. Фильтрует на месте,
+// не копируя записи в новый срез
+func (r *Root) SearchItems(query string) {
+	r.SearchItemsContext(context.Background(), query)
+}
+
+// SearchItemsContext - SearchItems, который бросает поиск, если ctx отменили. Тогда возвращается ctx.Err(),
+// а записи в r остаются отфильтрованными наполовину
+func (r *Root) SearchItemsContext(ctx context.Context, query string) error {
+	results := r.Row[:0]
+	tree := Query{Query: query}.searchTree()
+	for i := range r.Row {
+		if i%ctxCheckEvery == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		item := &r.Row[i]
+		item.Name = item.FirstName + " " + item.LastName
+
+		if matchItem(item, tree) {
+			results = append(results, *item)
+		}
+	}
+	if len(results) == 0 {
+		results = nil
+	}
+	r.Row = results
+	return nil
+}
+
+// matchItem - подходит ли запись под дерево запроса без учёта регистра, Name должен быть заполнен
+func matchItem(item *Item, tree *queryNode) bool {
+	return tree == nil || tree.match(foldCase(item.Name), foldCase(item.About))
+}
+
+func (r *Root) SortRoot(orderField string, order string) error {
+	return r.SortRootContext(context.Background(), orderField, order)
+}
+
+// SortRootContext - SortRoot, который бросает сортировку, если ctx отменили. Тогда возвращается ctx.Err(),
+// а записи остаются недосортированными. Пустой order - DefaultOrderBy
+func (r *Root) SortRootContext(ctx context.Context, orderField string, order string) error {
+	orderInt, err := parseOrder(order)
+	if err != nil {
+		return err
+	}
+
+	if orderField == "" {
+		orderField = "Name"
+	}
+	if field, ok := sortField(orderField); ok {
+		orderField = field
+	}
+
+	compare, ok := itemComparators[orderField]
+	if !ok {
+		return errBadOrderField("order_field", orderField)
+	}
+	// так исторически сложилось: всё, кроме OrderByAsc, - по убыванию.
+	// Равные по полю - по Id, чтобы порядок не зависел от того, как лёг датасет
+	less, cancelled := cancellable(ctx, func(i, j int) bool {
+		a, b := &r.Row[i], &r.Row[j]
+		if cmp := compare(a, b); cmp != 0 {
+			if orderInt == searchclient.OrderByAsc {
+				return cmp < 0
+			}
+			return cmp > 0
+		}
+		return a.Id < b.Id
+	})
+	sort.SliceStable(r.Row, less)
+	return cancelled()
+}
+
+// cancellable оборачивает less для sort так, что после отмены ctx записи больше не сравниваются
+// и сортировка быстро доходит до конца. cancelled после сортировки - ctx.Err(), если её бросили
+func cancellable(ctx context.Context, less func(i, j int) bool) (wrapped func(i, j int) bool, cancelled func() error) {
+	compared := 0
+	var err error
+	wrapped = func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		if compared++; compared%ctxCheckEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		return less(i, j)
+	}
+	return wrapped, func() error { return err }
+}
+
+var itemComparators = map[string]func(a, b *Item) int{
+	"Id":   func(a, b *Item) int { return a.Id - b.Id },
+	"Age":  func(a, b *Item) int { return a.Age - b.Age },
+	"Name": func(a, b *Item) int { return strings.Compare(a.Name, b.Name) },
+}
+
+// SortRootBy сортирует по нескольким ключам вида "Field:order", ключи с searchclient.OrderByAsIs на порядок не влияют
+func (r *Root) SortRootBy(keys []string) error {
+	var fields []SortField
+	for _, key := range keys {
+		name, order, _ := strings.Cut(key, ":")
+		field, ok := sortField(name)
+		if !ok {
+			return errBadOrderField("sort", name)
+		}
+		orderInt, err := strconv.Atoi(order)
+		if err != nil || (orderInt != searchclient.OrderByAsc && orderInt != searchclient.OrderByDesc && orderInt != searchclient.OrderByAsIs) {
+			return &ServerError{Code: searchclient.CodeBadOrderBy, Message: fmt.Sprintf("invalid order: %s", order), Field: "sort"}
+		}
+		if orderInt != searchclient.OrderByAsIs {
+			fields = append(fields, SortField{Field: field, Order: orderInt})
+		}
+	}
+	return r.SortFields(stableSort(fields))
+}
+
+// SortFields сортирует по ключам по порядку важности, записи с одинаковыми ключами сохраняют порядок
+func (r *Root) SortFields(fields []SortField) error {
+	compares := make([]func(a, b *Item) int, len(fields))
+	for i, field := range fields {
+		compare, ok := itemComparators[field.Field]
+		if !ok {
+			return errBadOrderField("sort", field.Field)
+		}
+		compares[i] = compare
+	}
+
+	sort.SliceStable(r.Row, func(i, j int) bool {
+		for k, field := range fields {
+			cmp := compares[k](&r.Row[i], &r.Row[j])
+			if cmp == 0 {
+				continue
+			}
+			if field.Order == searchclient.OrderByAsc {
+				return cmp < 0
+			}
+			return cmp > 0
+		}
+		return false
+	})
+	return nil
+}
+
+func (r *Root) ApplyLimitOffset(offset, limit string) error {
+	offsetInt := 0
+	if offset != "" {
+		var err error
+		offsetInt, err = strconv.Atoi(offset)
+		if err != nil {
+			return &ServerError{Code: searchclient.CodeBadOffset, Message: fmt.Sprintf("invalid offset value: %s", err), Field: "offset"}
+		}
+	}
+
+	limitInt := len(r.Row)
+	if limit != "" {
+		var err error
+		limitInt, err = strconv.Atoi(limit)
+		if err != nil {
+			return &ServerError{Code: searchclient.CodeBadLimit, Message: fmt.Sprintf("invalid limit value: %s", err), Field: "limit"}
+		}
+	}
+
+	if offsetInt >= len(r.Row) {
+		r.Row = []Item{}
+		return nil
+	}
+
+	end := offsetInt + limitInt
+	if end > len(r.Row) {
+		end = len(r.Row)
+	}
+
+	r.Row = r.Row[offsetInt:end]
+	return nil
+}
+
+// Page отрезает страницу: offset записей пропускается, limit < 0 - до конца
+func (r *Root) Page(offset, limit int) {
+	if offset >= len(r.Row) {
+		r.Row = []Item{}
+		return
+	}
+	end := len(r.Row)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	r.Row = r.Row[offset:end]
+}
@@ -0,0 +1,678 @@
+// Package searchserver - поисковый сервис по датасету пользователей, внешняя система для searchclient
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hw4/pkg/searchclient"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Server ищет пользователей в xml-датасете, реализует http.Handler
+type Server struct {
+	// путь до датасета (.xml, .csv, .ndjson или .jsonl) или ссылка http(s):// или s3:// на него,
+	// пустой - DefaultDatasetPath
+	DatasetPath string
+	// sha256 датасета по ссылке в hex. См. RemoteDataset
+	DatasetChecksum string
+	// ссылка на sha256 датасета, перечитывается при каждой загрузке. Пустой у http(s):// - ссылка на датасет + ".sha256"
+	DatasetChecksumURL string
+	// ключи и адрес для датасета по s3:// ссылке
+	S3 S3Config
+	// чем скачивать датасет по ссылке, пустой - клиент с таймаутом defaultDownloadTimeout
+	HTTPClient *http.Client
+	// относительно чего разрешается относительный DatasetPath, пустой - рабочая директория процесса
+	BaseDir string
+	// токен, который должны присылать клиенты, в логах клиент называется DefaultClientName.
+	// Если пустой и Tokens пустой - подходит любой непустой токен
+	Token string
+	// токены нескольких клиентов: имя клиента для логов -> токен, см. LoadTokens
+	Tokens map[string]string
+	// scope клиентов по именам из Tokens (и DefaultClientName для Token), кому не задано - DefaultScopes
+	Scopes map[string][]string
+	// какие поля прятать от клиентов без ScopePIIRead, пустая - ничего не прятать
+	FieldMask FieldMask
+	// проверка JWT от внешнего провайдера, клиент в логах называется по sub. Пустой - JWT не принимаются
+	JWT *JWT
+	// больше стольких записей за раз не отдаём, 0 - без ограничения
+	MaxLimit int
+	// больше стольких байт тела POST-поиска не читаем, 0 - DefaultMaxBodyBytes
+	MaxBodyBytes int64
+	// сколько записей отдавать, если limit не задан, 0 - все (но не больше MaxLimit)
+	DefaultLimit int
+	// неизвестные параметры поиска (опечатки вроде ordr_by) - 400 со списком известных.
+	// Без строгого режима они игнорируются и только попадают в access log
+	StrictParams bool
+	// сортировка Name по правилам языка, пустой - побайтно. Только для датасета в памяти
+	Collation *Collation
+	// разбор About на основы слов без стоп-слов, nil - только поиск подстрок. Только для датасета в памяти
+	Analyzer *Analyzer
+	// синонимы, с которыми ищутся слова query, nil - без них. Работают для всех Storage
+	Synonyms *Synonyms
+	// где искать. Пустое - MemoryStorage по датасету из DatasetPath
+	Storage Storage
+	// кэш результатов поиска, пустой - без кэша
+	Cache Cache
+	// LRU готовых ответов, очищается при Reload. Пустой - без него
+	PageCache *PageCache
+	// какой индекс строить по датасету в памяти: IndexWords (по умолчанию) или IndexTrigrams
+	Index string
+	// искать по встроенному DemoDataset, DatasetPath и MapDataset не используются
+	Demo bool
+	// что делать с повторами id и guid: DuplicatesReject (по умолчанию), DuplicatesKeepFirst или DuplicatesKeepLast
+	Duplicates string
+	// отображать бинарный датасет (.bin) в память вместо чтения, см. Store.SwapMapped
+	MapDataset bool
+	// на сколько шардов максимум делить поиск по датасету в памяти, 0 - по числу процессоров
+	SearchWorkers int
+	// сколько максимум искать на один запрос, по истечении поиск бросается и клиент получает 503. 0 - без ограничения
+	RequestTimeout time.Duration
+	// поиски дольше этого пишутся в SlowQueryLogger с параметрами и временем по этапам, 0 - не писать
+	SlowQueryThreshold time.Duration
+	// куда писать медленные поиски, пустой - slog.Default()
+	SlowQueryLogger *slog.Logger
+	// ограничение частоты запросов с одного токена, пустой - без ограничения
+	RateLimit *RateLimiter
+	// метрики для Prometheus, отдаются на /metrics. Пустой - метрики не собираются
+	Metrics *Metrics
+	// что ищут и по чему ничего не находится, отдаётся на /admin/analytics. Пустой - не считается
+	Analytics *Analytics
+
+	// датасет в памяти, загружается один раз и подменяется через Reload
+	store  Store
+	loadMu sync.Mutex
+	// Reload от SIGHUP, слежения за файлом и периодического обновления идут по очереди: иначе более старая
+	// загрузка может подменить более новую, а в ReloadStatus попадёт чужая контрольная сумма
+	reloadMu sync.Mutex
+	// одновременные одинаковые поиски
+	flights singleflight.Group
+	// итог последних Reload
+	status   ReloadStatus
+	statusMu sync.Mutex
+}
+
+// TotalCountHeader - сколько всего нашлось, есть в каждом ответе на поиск, и в v1 тоже
+const TotalCountHeader = "X-Total-Count"
+
+// DefaultDatasetPath - датасет, если путь не задан
+const DefaultDatasetPath = "dataset.xml"
+
+// DatasetFile - путь до датасета с учётом BaseDir, ссылка отдаётся как есть
+func (s *Server) DatasetFile() string {
+	path := s.DatasetPath
+	if path == "" {
+		path = DefaultDatasetPath
+	}
+	if IsRemoteDataset(path) {
+		return path
+	}
+	if s.BaseDir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(s.BaseDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// Reload перечитывает датасет, целиком проверяет его (Root.Validate) и только потом подменяет им текущий.
+// Если с новым датасетом что-то не так - продолжаем работать со старым, ошибка видна в ReloadStatus.
+// Одновременные вызовы выполняются по очереди
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	if !s.MapDataset || s.Demo {
+		root, checksum, err := s.readDataset()
+		dropped, err := s.swap(root, checksum, err)
+		return s.recordReload(checksum, dropped, err)
+	}
+	return s.recordReload(s.swapMapped())
+}
+
+// swapMapped - Reload для отображаемого в память бинарного датасета
+func (s *Server) swapMapped() (string, []Problem, error) {
+	file, err := s.fetchDataset()
+	if err != nil {
+		return "", nil, err
+	}
+	if file != s.DatasetFile() {
+		// скачанная копия: отображённый файл после удаления остаётся доступен до конца отображения
+		defer os.Remove(file)
+	}
+	checksum, err := fileChecksum(file)
+	if err != nil {
+		return "", nil, err
+	}
+	var dropped []Problem
+	snapshot, err := openMapped(file, s.Index, func(rows []Item) ([]Item, error) {
+		if rows, dropped, err = dedupeRows(rows, s.Duplicates); err != nil {
+			return nil, err
+		}
+		return rows, validateRows(rows).Err()
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	snapshot.checksum = checksum
+	s.store.current.Store(snapshot)
+	s.warmIndexes(snapshot)
+	s.purgePages()
+	return checksum, dropped, nil
+}
+
+// ReadDataset читает датасет: по ссылке - скачивает, в демо-режиме - отдаёт встроенный
+func (s *Server) ReadDataset() (Root, error) {
+	root, _, err := s.readDataset()
+	return root, err
+}
+
+// readDataset - ReadDataset, который заодно отдаёт sha256 прочитанного файла
+func (s *Server) readDataset() (Root, string, error) {
+	if s.Demo {
+		root, err := DemoDataset()
+		return root, checksum(demoDataset), err
+	}
+	file, err := s.fetchDataset()
+	if err != nil {
+		return Root{}, "", err
+	}
+	if file != s.DatasetFile() {
+		defer os.Remove(file)
+	}
+	root, err := LoadDataset(file)
+	if err != nil {
+		return root, "", err
+	}
+	sum, err := fileChecksum(file)
+	return root, sum, err
+}
+
+// swap выкидывает повторы по политике Duplicates, проверяет прочитанный датасет и делает его текущим
+func (s *Server) swap(root Root, checksum string, err error) ([]Problem, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Row) == 0 {
+		return nil, fmt.Errorf("dataset %s is empty", s.DatasetFile())
+	}
+	dropped, err := root.Dedupe(s.Duplicates)
+	if err != nil {
+		return nil, err
+	}
+	if err := root.Validate().Err(); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.store.swapIndexed(root, s.Index, checksum)
+	if err != nil {
+		return nil, err
+	}
+	s.warmIndexes(snapshot)
+	s.purgePages()
+	return dropped, nil
+}
+
+// warmIndexes строит дерево подсказок, индекс по Name для Collation и основы слов для Analyzer
+// сразу после загрузки, а не на первом запросе
+func (s *Server) warmIndexes(snapshot *Snapshot) {
+	snapshot.suggestions()
+	if s.Collation != nil {
+		snapshot.nameIndex(s.Collation)
+	}
+	if s.Analyzer != nil {
+		snapshot.analyzed(s.Analyzer)
+	}
+}
+
+// purgePages выкидывает готовые ответы по старому датасету
+func (s *Server) purgePages() {
+	if s.PageCache != nil {
+		s.PageCache.Purge()
+	}
+}
+
+// fetchDataset - локальный файл датасета. Датасет по ссылке сначала скачивается во временный файл
+func (s *Server) fetchDataset() (string, error) {
+	location := s.DatasetFile()
+	if !IsRemoteDataset(location) {
+		return location, nil
+	}
+	remote := &RemoteDataset{URL: location, Checksum: s.DatasetChecksum, ChecksumURL: s.DatasetChecksumURL, S3: s.S3, Client: s.HTTPClient}
+	return remote.Download(context.Background())
+}
+
+// Snapshot - текущий датасет, nil - ещё не загружен
+func (s *Server) Snapshot() *Snapshot {
+	return s.store.Snapshot()
+}
+
+// loadDataset отдаёт снимок датасета для запроса.
+// Датасет читается один раз - при первом запросе, если его не загрузили заранее через Reload
+func (s *Server) loadDataset() (*Snapshot, error) {
+	if snapshot := s.store.Snapshot(); snapshot != nil {
+		return snapshot, nil
+	}
+	// одновременные первые запросы не должны разбирать файл каждый сам по себе
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	if snapshot := s.store.Snapshot(); snapshot != nil {
+		return snapshot, nil
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s.store.Snapshot(), nil
+}
+
+var defaultServer = &Server{}
+
+// SearchServer - обработчик с настройками по умолчанию: dataset.xml из рабочей директории и любой непустой токен
+func SearchServer(w http.ResponseWriter, r *http.Request) {
+	defaultServer.ServeHTTP(w, r)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Metrics == nil {
+		s.serveHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.serveHTTP(recorder, r)
+	s.Metrics.observeRequest(endpointLabel(r.URL.Path), recorder.status, time.Since(start))
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// пробы Kubernetes и служебные ручки ходят без токена и мимо версий API
+	switch r.URL.Path {
+	case "/healthz":
+		s.serveHealth(w, r)
+		return
+	case "/readyz":
+		s.serveReady(w, r)
+		return
+	case "/version":
+		s.serveVersion(w, r)
+		return
+	case "/metrics":
+		if s.Metrics == nil {
+			JSONError(w, r, "metrics are disabled", searchclient.CodeNotFound, http.StatusNotFound)
+			return
+		}
+		s.Metrics.serve(w, r, s)
+		return
+	}
+	version, path, ok := SplitAPIVersion(r.URL.Path)
+	if !ok {
+		JSONError(w, r, "unsupported api version", searchclient.CodeNotFound, http.StatusNotFound)
+		return
+	}
+	if path == "/openapi.json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(searchclient.OpenAPISpec)
+		return
+	}
+
+	id, err := s.authenticate(accessToken(r))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadToken, http.StatusUnauthorized)
+		return
+	}
+	noteClient(r.Context(), id.client)
+	r = r.WithContext(withIdentity(r.Context(), id))
+	if s.RateLimit != nil {
+		// у JWT токен меняется при каждом обновлении, поэтому лимит считаем по клиенту, если он известен
+		limitKey := id.client
+		if limitKey == "" {
+			limitKey = accessToken(r)
+		}
+		if ok, retryAfter := s.RateLimit.Allow(limitKey); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			JSONError(w, r, "rate limit exceeded", searchclient.CodeRateLimited, http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if !requireScope(w, r, ScopeSearchRead) {
+		return
+	}
+	// без pii:read поля прячутся, такой ответ кэшируется отдельно от полного
+	var mask FieldMask
+	if len(s.FieldMask) > 0 && !id.can(ScopePIIRead) {
+		mask = s.FieldMask
+	}
+	if strings.HasPrefix(path, searchclient.UsersPath) {
+		s.serveUser(w, r, path, mask)
+		return
+	}
+	if path == searchclient.SuggestPath {
+		s.serveSuggest(w, r, mask)
+		return
+	}
+	if path == searchclient.AggregatePath {
+		s.serveAggregate(w, r, mask)
+		return
+	}
+	if path == StatsPath {
+		s.serveStats(w, r, mask)
+		return
+	}
+	if path == searchclient.DistinctPath {
+		s.serveDistinct(w, r, mask)
+		return
+	}
+	if path == searchclient.SamplePath {
+		s.serveSample(w, r, mask)
+		return
+	}
+	if path == AnalyticsPath {
+		s.serveAnalytics(w, r)
+		return
+	}
+
+	start := time.Now()
+	var timings *queryTimings
+	if s.SlowQueryThreshold > 0 {
+		timings = &queryTimings{}
+		r = r.WithContext(withTimings(r.Context(), timings))
+	}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes())
+	}
+	params, err := ParseSearchParams(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		JSONError(w, r, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit), searchclient.CodeBadBody, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadBody, http.StatusBadRequest)
+		return
+	}
+	if unknown := unknownParams(params); len(unknown) > 0 {
+		if s.StrictParams {
+			JSONError(w, r, errUnknownParams(unknown), searchclient.CodeUnknownParam, http.StatusBadRequest)
+			return
+		}
+		noteUnknownParams(r.Context(), unknown)
+	}
+	if params.Get("limit") == "" && s.DefaultLimit > 0 {
+		params.Set("limit", strconv.Itoa(s.DefaultLimit))
+	}
+	params.Set("limit", s.capLimit(params.Get("limit")))
+	query, err := ParseQuery(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadOrderBy, http.StatusBadRequest)
+		return
+	}
+	query.Synonyms = s.Synonyms
+	fields, err := ParseFields(params.Get("fields"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadFields, http.StatusBadRequest)
+		return
+	}
+	highlight, err := ParseHighlight(params.Get("highlight"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	facets, err := ParseFacets(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	cacheKey := version + ":" + QueryKey(query)
+	if len(mask) > 0 {
+		cacheKey += ":masked"
+	}
+	if facets > 0 {
+		// в v1 ответ - голый массив, фасетам в нём негде быть
+		if version != searchclient.APIVersion2 {
+			JSONError(w, r, &ServerError{Code: searchclient.CodeBadQuery, Message: "facets need api " + searchclient.APIVersion2, Field: "facets"}, searchclient.CodeBadQuery, http.StatusBadRequest)
+			return
+		}
+		// по фасетам страницы из одного Id спрятанное поле легко узнать
+		if mask["Age"] != "" || mask["Gender"] != "" {
+			JSONError(w, r, "token has no "+ScopePIIRead+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+			return
+		}
+		cacheKey += ":facets=" + strconv.Itoa(facets)
+	}
+	group, err := ParseGroupBy(params)
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	if group.Field != "" {
+		if version != searchclient.APIVersion2 {
+			JSONError(w, r, &ServerError{Code: searchclient.CodeBadQuery, Message: "group_by needs api " + searchclient.APIVersion2, Field: "group_by"}, searchclient.CodeBadQuery, http.StatusBadRequest)
+			return
+		}
+		// ключ группы выдаёт поле, которое маска прячет
+		if mask[group.maskedField()] != "" {
+			JSONError(w, r, "token has no "+ScopePIIRead+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+			return
+		}
+		// страницы в группировке нет
+		query.Offset, query.Limit = 0, -1
+		cacheKey += ":group=" + group.Field + ":" + strconv.Itoa(group.Limit)
+	}
+	if len(fields) > 0 {
+		cacheKey += ":fields=" + strings.Join(fields, ",")
+		mask = mask.only(fields)
+	}
+	var highlighter *highlighter
+	if highlight {
+		cacheKey += ":highlight"
+		// по основам слов ищет только датасет в памяти
+		var analyzer *Analyzer
+		if s.Storage == nil {
+			analyzer = s.Analyzer
+		}
+		highlighter = newHighlighter(query, analyzer)
+	}
+	etag, modified := s.searchETag(cacheKey), s.datasetModified()
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	decode := time.Since(start)
+	rendered, err := s.renderPage(r.Context(), version, cacheKey, query, pageOptions{mask: mask, highlight: highlighter, facets: facets, group: group})
+	s.logSlowQuery(r, params, start, decode, timings, rendered, err)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			JSONError(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "search timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	noteResults(r.Context(), rendered.Users, rendered.Total)
+	if s.Analytics != nil {
+		s.Analytics.Record(query.Query, rendered.Total)
+	}
+	w.Header().Set(TotalCountHeader, strconv.Itoa(rendered.Total))
+	if link := paginationLinks(r.URL.Path, params, query, rendered.Total); link != "" && group.Field == "" {
+		w.Header().Set("Link", link)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(rendered.Body)
+}
+
+// RenderedPage - готовый ответ на поиск, сколько в нём пользователей и сколько нашлось всего
+type RenderedPage struct {
+	Body  []byte
+	Users int
+	Total int
+}
+
+// pageOptions - что ещё, кроме пользователей, нужно в ответе на поиск
+type pageOptions struct {
+	// прячет поля пользователей
+	mask FieldMask
+	// добавляет подсветку найденного, nil - без неё
+	highlight *highlighter
+	// ширина корзины возраста в фасетах, 0 - без фасетов
+	facets int
+	// отдать найденных группами вместо страницы
+	group GroupBy
+}
+
+// flightResult - общий для одинаковых запросов результат поиска вместе со временем его этапов
+type flightResult struct {
+	page    RenderedPage
+	timings *queryTimings
+}
+
+// renderPage - ответ на поиск из PageCache или свежий
+func (s *Server) renderPage(ctx context.Context, version, cacheKey string, query Query, opts pageOptions) (RenderedPage, error) {
+	if s.PageCache != nil {
+		if page, ok := s.PageCache.Get(cacheKey); ok {
+			return page, nil
+		}
+	}
+	// одинаковые запросы, пришедшие одновременно, считаются один раз. Отмена запроса, который
+	// начал поиск, не должна ломать остальным ответ, поэтому поиск идёт без его отмены,
+	// но не дольше RequestTimeout: те, кто присоединился позже, пришли позже и дедлайн у них не раньше.
+	// Время этапов копится в результат поиска, а не в ctx начавшего его, чтобы досталось всем
+	callerTimings := timingsFrom(ctx)
+	ctx = context.WithoutCancel(ctx)
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	result, err, _ := s.flights.Do(cacheKey, func() (interface{}, error) {
+		timings := &queryTimings{}
+		ctx := withTimings(ctx, timings)
+		var facets *searchclient.Aggregations
+		if opts.facets > 0 {
+			aggs, err := s.aggregate(ctx, query, opts.facets)
+			if err != nil {
+				return flightResult{timings: timings}, err
+			}
+			facets = &aggs
+		}
+		var rendered RenderedPage
+		if opts.group.Field != "" {
+			groups, total, err := s.group(ctx, query, opts.group)
+			if err != nil {
+				return flightResult{timings: timings}, err
+			}
+			encodeStart := time.Now()
+			rendered = RenderedPage{Body: renderGroups(groups, total, opts.mask, opts.highlight, facets), Total: total}
+			timings.addEncode(time.Since(encodeStart))
+			for _, group := range groups {
+				rendered.Users += len(group.Users)
+			}
+		} else {
+			page, err := s.search(ctx, query)
+			if err != nil {
+				return flightResult{timings: timings}, err
+			}
+			if s.Metrics != nil {
+				s.Metrics.observePage(page)
+			}
+			encodeStart := time.Now()
+			rendered = RenderedPage{Body: renderUsers(version, page.Users, page.Total, opts.mask, opts.highlight, facets), Users: len(page.Users), Total: page.Total}
+			timings.addEncode(time.Since(encodeStart))
+		}
+		if s.PageCache != nil {
+			s.PageCache.Set(cacheKey, rendered)
+		}
+		return flightResult{page: rendered, timings: timings}, nil
+	})
+	shared := result.(flightResult)
+	callerTimings.add(shared.timings)
+	if err != nil {
+		return RenderedPage{}, err
+	}
+	return shared.page, nil
+}
+
+// search отдаёт результат из кэша или ищет через searchStorage и кладёт результат в кэш.
+// Для датасета в памяти в ключ входит версия снимка: после Reload старые результаты не читаются,
+// а реплики с разными датасетами не делят записи
+func (s *Server) search(ctx context.Context, query Query) (Page, error) {
+	if s.Cache == nil {
+		return s.searchStorage(ctx, query)
+	}
+	key := QueryKey(query)
+	var snapshot *Snapshot
+	if s.Storage == nil {
+		var err error
+		if snapshot, err = s.loadDataset(); err != nil {
+			return Page{}, err
+		}
+		key = snapshot.version() + ":" + key
+	}
+	if page, ok := s.Cache.Get(ctx, key); ok {
+		return page, nil
+	}
+	page, err := s.searchStorage(ctx, query)
+	// если датасет подменили посреди поиска, результат мог найтись уже в новом и под старый ключ не годится
+	if err == nil && (snapshot == nil || s.store.Snapshot() == snapshot) {
+		s.Cache.Set(ctx, key, page)
+	}
+	return page, err
+}
+
+// searchStorage ищет в Storage, а если оно не задано - в датасете в памяти, загружая его при первом запросе
+func (s *Server) searchStorage(ctx context.Context, query Query) (Page, error) {
+	if s.Storage != nil {
+		start := time.Now()
+		defer func() { timingsFrom(ctx).addSearch(time.Since(start), 0) }()
+		return s.Storage.Search(ctx, query)
+	}
+	if _, err := s.loadDataset(); err != nil {
+		return Page{}, err
+	}
+	return (&MemoryStorage{Store: &s.store, Workers: s.SearchWorkers, Collation: s.Collation, Analyzer: s.Analyzer}).Search(ctx, query)
+}
+
+// accessToken - токен клиента из заголовка AccessToken или Authorization: Bearer
+func accessToken(r *http.Request) string {
+	if token := r.Header.Get("AccessToken"); token != "" {
+		return token
+	}
+	return BearerToken(r)
+}
+
+// maxBodyBytes - сколько байт тела POST-поиска можно прочитать
+func (s *Server) maxBodyBytes() int64 {
+	if s.MaxBodyBytes > 0 {
+		return s.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// capLimit ограничивает limit сверху MaxLimit, некорректные значения оставляет как есть - на них ругнётся ApplyLimitOffset
+func (s *Server) capLimit(limit string) string {
+	if s.MaxLimit <= 0 {
+		return limit
+	}
+	limitInt, err := strconv.Atoi(limit)
+	if limit == "" || (err == nil && limitInt > s.MaxLimit) {
+		return strconv.Itoa(s.MaxLimit)
+	}
+	return limit
+}
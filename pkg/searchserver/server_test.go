@@ -0,0 +1,741 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hw4/pkg/searchclient"
+)
+
+// датасет лежит в корне репозитория
+var datasetPath = filepath.Join("..", "..", "dataset.xml")
+
+func search(t *testing.T, s *Server, token, rawQuery string) (int, []UserJson) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/?"+rawQuery, nil)
+	if token != "" {
+		req.Header.Set("AccessToken", token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	var users []UserJson
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+			t.Fatalf("cant decode users: %s", err)
+		}
+	}
+	return rec.Code, users
+}
+
+func userIds(users []UserJson) []int {
+	ids := []int{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+func TestServerToken(t *testing.T) {
+	cases := []struct {
+		Token    string
+		Sent     string
+		Expected int
+	}{
+		{Token: "", Sent: "", Expected: http.StatusUnauthorized},
+		{Token: "", Sent: "anything", Expected: http.StatusOK},
+		{Token: "secret", Sent: "anything", Expected: http.StatusUnauthorized},
+		{Token: "secret", Sent: "secret", Expected: http.StatusOK},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: datasetPath, Token: testCase.Token}
+		code, _ := search(t, s, testCase.Sent, "limit=1&order_by=-1")
+		if code != testCase.Expected {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.Expected, code)
+		}
+	}
+}
+
+func TestServerMaxLimit(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, MaxLimit: 3}
+	cases := []struct {
+		Query    string
+		Expected []int
+	}{
+		{Query: "order_field=Id&order_by=-1", Expected: []int{0, 1, 2}},
+		{Query: "order_field=Id&order_by=-1&limit=100", Expected: []int{0, 1, 2}},
+		{Query: "order_field=Id&order_by=-1&limit=2", Expected: []int{0, 1}},
+	}
+	for caseNum, testCase := range cases {
+		code, users := search(t, s, "token", testCase.Query)
+		if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %d %v", caseNum, testCase.Expected, code, userIds(users))
+		}
+	}
+}
+
+func TestServerMissingDataset(t *testing.T) {
+	s := &Server{DatasetPath: filepath.Join("testdata", "missing.xml")}
+	code, _ := search(t, s, "token", "order_by=-1")
+	if code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", code)
+	}
+}
+
+func TestServerDatasetFile(t *testing.T) {
+	cases := []struct {
+		DatasetPath string
+		BaseDir     string
+		Expected    string
+	}{
+		{Expected: "dataset.xml"},
+		{BaseDir: "/data", Expected: "/data/dataset.xml"},
+		{DatasetPath: "users.xml", BaseDir: "/data", Expected: "/data/users.xml"},
+		{DatasetPath: "../users.xml", BaseDir: "/data/a", Expected: "/data/users.xml"},
+		{DatasetPath: "/srv/users.xml", BaseDir: "/data", Expected: "/srv/users.xml"},
+		{DatasetPath: "./users.xml", Expected: "users.xml"},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: testCase.DatasetPath, BaseDir: testCase.BaseDir}
+		if got := s.DatasetFile(); got != filepath.FromSlash(testCase.Expected) {
+			t.Errorf("[%d] expected %s, got %s", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerMultipleDatasets(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.xml": `<root><row><id>1</id><first_name>Ann</first_name></row></root>`,
+		"b.xml": `<root><row><id>2</id><first_name>Bob</first_name></row><row><id>3</id><first_name>Cid</first_name></row></root>`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &Server{DatasetPath: "a.xml", BaseDir: dir}
+	b := &Server{DatasetPath: "b.xml", BaseDir: dir}
+	if _, users := search(t, a, "token", "order_by=-1"); !reflect.DeepEqual(userIds(users), []int{1}) {
+		t.Errorf("expected users from a.xml, got %v", userIds(users))
+	}
+	if _, users := search(t, b, "token", "order_by=-1"); !reflect.DeepEqual(userIds(users), []int{2, 3}) {
+		t.Errorf("expected users from b.xml, got %v", userIds(users))
+	}
+}
+
+func TestServerLoadsDatasetOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := os.WriteFile(path, []byte(`<root><row><id>1</id><first_name>Ann</first_name></row></root>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DatasetPath: path}
+	if _, users := search(t, s, "token", "order_by=-1"); !reflect.DeepEqual(userIds(users), []int{1}) {
+		t.Fatalf("expected users from file, got %v", userIds(users))
+	}
+
+	// после первого запроса файл больше не читается
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if code, users := search(t, s, "token", "order_by=-1"); code != http.StatusOK || !reflect.DeepEqual(userIds(users), []int{1}) {
+		t.Errorf("expected users from memory, got %v (status %d)", userIds(users), code)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	dataset, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := os.WriteFile(path, dataset, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DatasetPath: path}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %s", err)
+	}
+
+	// после загрузки файл больше не нужен, работаем с данными из памяти
+	if err := os.WriteFile(path, []byte("<root></root>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, users := search(t, s, "token", "limit=100&order_by=0"); code != http.StatusOK || len(users) != 35 {
+		t.Errorf("expected 35 users from memory, got %d (status %d)", len(users), code)
+	}
+
+	// пустой и битый датасет не подменяют рабочий
+	for _, content := range []string{"<root></root>", "<root><row>"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reload(); err == nil {
+			t.Errorf("expected error for dataset %q", content)
+		}
+		if _, users := search(t, s, "token", "limit=100&order_by=0"); len(users) != 35 {
+			t.Errorf("expected old dataset after failed reload, got %d users", len(users))
+		}
+	}
+
+	small := `<root><row><id>7</id><first_name>Jane</first_name><last_name>Doe</last_name></row></root>`
+	if err := os.WriteFile(path, []byte(small), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %s", err)
+	}
+	if _, users := search(t, s, "token", "limit=100&order_by=0"); !reflect.DeepEqual(userIds(users), []int{7}) {
+		t.Errorf("expected new dataset after reload, got %v", userIds(users))
+	}
+}
+
+func TestServerConcurrentReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dataset.xml")
+	s := &Server{DatasetPath: path}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		// файл подменяется переименованием, как это делают выкладки, и каждая загрузка может прочитать свой
+		tmp := filepath.Join(dir, strconv.Itoa(i)+".xml")
+		content := fmt.Sprintf(`<root><row><id>%d</id><first_name>Jane</first_name></row></root>`, i)
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Reload(); err != nil {
+				t.Errorf("unexpected reload error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if status := s.ReloadStatus(); status.Checksum != s.Snapshot().checksum {
+		t.Errorf("expected status checksum of current dataset %s, got %s", s.Snapshot().checksum, status.Checksum)
+	}
+}
+
+func TestApplyLimitOffset(t *testing.T) {
+	cases := []struct {
+		Offset   string
+		Limit    string
+		Expected []int
+		Code     string
+	}{
+		{Expected: []int{0, 1, 2, 3}},
+		{Offset: "1", Limit: "2", Expected: []int{1, 2}},
+		{Offset: "3", Limit: "10", Expected: []int{3}},
+		{Offset: "4", Expected: []int{}},
+		{Offset: "x", Code: searchclient.CodeBadOffset},
+		{Limit: "x", Code: searchclient.CodeBadLimit},
+	}
+	for caseNum, testCase := range cases {
+		root := Root{Row: []Item{{Id: 0}, {Id: 1}, {Id: 2}, {Id: 3}}}
+		err := root.ApplyLimitOffset(testCase.Offset, testCase.Limit)
+		if testCase.Code != "" {
+			serverErr, ok := err.(*ServerError)
+			if !ok || serverErr.Code != testCase.Code {
+				t.Errorf("[%d] expected %s error, got %#v", caseNum, testCase.Code, err)
+			}
+			continue
+		}
+		ids := []int{}
+		for _, item := range root.Row {
+			ids = append(ids, item.Id)
+		}
+		if err != nil || !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v (%v)", caseNum, testCase.Expected, ids, err)
+		}
+	}
+}
+
+// slowStorage ищет, пока у запроса не кончится время
+type slowStorage struct{}
+
+func (slowStorage) Search(ctx context.Context, query Query) (Page, error) {
+	<-ctx.Done()
+	return Page{}, ctx.Err()
+}
+
+func TestServerRequestTimeout(t *testing.T) {
+	s := &Server{Storage: slowStorage{}, RequestTimeout: 20 * time.Millisecond}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, authorizedRequest("/?query=boyd&order_by=-1"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code != searchclient.CodeUnavailable {
+		t.Errorf("expected %s error, got %s (%v)", searchclient.CodeUnavailable, rec.Body, err)
+	}
+}
+
+// поиск и сортировка в памяти бросают работу, когда время запроса вышло
+func TestSearchCancelled(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	var store Store
+	store.Swap(root)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	byAge := []SortField{{Field: "Age", Order: searchclient.OrderByAsc}, {Field: "Id", Order: searchclient.OrderByDesc}}
+	if _, err := (&MemoryStorage{Store: &store}).Search(ctx, Query{Query: "e", Sort: byAge, Limit: -1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected MemoryStorage to stop with context.Canceled, got %v", err)
+	}
+	if err := root.SearchItemsContext(ctx, "e"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected SearchItemsContext to stop with context.Canceled, got %v", err)
+	}
+
+	// сортировка проверяет ctx раз в ctxCheckEvery сравнений, ей нужно побольше записей
+	big := Root{Row: make([]Item, 4*ctxCheckEvery)}
+	for i := range big.Row {
+		big.Row[i].Id = len(big.Row) - i
+	}
+	if err := big.SortRootContext(ctx, "Id", "-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected SortRootContext to stop with context.Canceled, got %v", err)
+	}
+	if err := big.SortRootContext(context.Background(), "Id", "-1"); err != nil || big.Row[0].Id != 1 {
+		t.Errorf("expected sorted rows without cancel, got first id %d (%v)", big.Row[0].Id, err)
+	}
+}
+
+func TestServerTotalCountHeader(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, PageCache: &PageCache{Size: 10}}
+	cases := []struct {
+		Target   string
+		Expected string
+	}{
+		{Target: "/?limit=1&order_by=-1", Expected: "35"},
+		// из PageCache - тот же заголовок
+		{Target: "/?limit=1&order_by=-1", Expected: "35"},
+		{Target: "/v2/?limit=5&order_by=-1&query=nulla", Expected: "17"},
+		{Target: "/?order_by=-1&query=xyz", Expected: "0"},
+	}
+	for caseNum, testCase := range cases {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, authorizedRequest(testCase.Target))
+		if got := rec.Header().Get(TotalCountHeader); rec.Code != http.StatusOK || got != testCase.Expected {
+			t.Errorf("[%d] expected 200 with total %s, got %d with %q", caseNum, testCase.Expected, rec.Code, got)
+		}
+	}
+}
+
+func TestServerErrorEnvelope(t *testing.T) {
+	handler := &AccessLog{
+		Handler: &Server{DatasetPath: datasetPath},
+		Logger:  slog.New(slog.NewJSONHandler(io.Discard, nil)),
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Expected ErrorDetails
+	}{
+		{
+			Target:   "/?order_by=-1",
+			Token:    "",
+			Status:   http.StatusUnauthorized,
+			Expected: ErrorDetails{Code: searchclient.CodeBadToken, Message: "Bad AccessToken"},
+		},
+		{
+			Target:   "/?order_by=-1&order_field=About",
+			Token:    "token",
+			Status:   http.StatusBadRequest,
+			Expected: ErrorDetails{Code: searchclient.CodeBadOrderField, Message: `cant sort by field "About"`, Field: "order_field"},
+		},
+		{
+			Target:   "/?order_by=-1&sort=About:1",
+			Token:    "token",
+			Status:   http.StatusBadRequest,
+			Expected: ErrorDetails{Code: searchclient.CodeBadOrderField, Message: `cant sort by field "About"`, Field: "sort"},
+		},
+		{
+			Target:   "/?order_by=-1&limit=-5",
+			Token:    "token",
+			Status:   http.StatusBadRequest,
+			Expected: ErrorDetails{Code: searchclient.CodeBadLimit, Message: "invalid limit value: must not be negative", Field: "limit"},
+		},
+		{
+			Target:   "/?order_by=2",
+			Token:    "token",
+			Status:   http.StatusBadRequest,
+			Expected: ErrorDetails{Code: searchclient.CodeBadOrderBy, Message: "invalid order: 2, expected -1 (asc), 1 (desc) or 0 (as is), missing order_by means 0", Field: "order_by"},
+		},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		if testCase.Token != "" {
+			req.Header.Set("AccessToken", testCase.Token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("[%d] cant decode error: %s", caseNum, err)
+			continue
+		}
+		// id запроса тот же, что в заголовке и в логе
+		testCase.Expected.RequestID = rec.Header().Get(RequestIDHeader)
+		if resp.Error != testCase.Expected {
+			t.Errorf("[%d] expected %#v, got %#v", caseNum, testCase.Expected, resp.Error)
+		}
+	}
+}
+
+func TestServerStrictParams(t *testing.T) {
+	accepted := strings.Join(SearchParams, ", ")
+	cases := []struct {
+		Strict   bool
+		Method   string
+		Target   string
+		Body     string
+		Status   int
+		Expected ErrorDetails
+	}{
+		{Strict: false, Method: http.MethodGet, Target: "/?ordr_by=1&order_by=-1", Status: http.StatusOK},
+		{Strict: true, Method: http.MethodGet, Target: "/?query=boyd&order_by=-1&order_field=Age&sort=Id:1&limit=1&offset=0", Status: http.StatusOK},
+		{
+			Strict: true, Method: http.MethodGet, Target: "/?ordr_by=1&order_by=-1&Limit=5", Status: http.StatusBadRequest,
+			Expected: ErrorDetails{
+				Code:    searchclient.CodeUnknownParam,
+				Message: "unknown parameters: Limit, ordr_by, accepted: " + accepted,
+				Field:   "Limit",
+			},
+		},
+		// поля тела POST сервер знает сам, проверяются только параметры урла
+		{Strict: true, Method: http.MethodPost, Target: "/search", Body: `{"query": "boyd"}`, Status: http.StatusOK},
+		{
+			Strict: true, Method: http.MethodPost, Target: "/search?debug=1", Body: `{"query": "boyd"}`, Status: http.StatusBadRequest,
+			Expected: ErrorDetails{
+				Code:    searchclient.CodeUnknownParam,
+				Message: "unknown parameters: debug, accepted: " + accepted,
+				Field:   "debug",
+			},
+		},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: datasetPath, StrictParams: testCase.Strict}
+		req := httptest.NewRequest(testCase.Method, testCase.Target, strings.NewReader(testCase.Body))
+		req.Header.Set("AccessToken", "token")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status == http.StatusOK {
+			continue
+		}
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error != testCase.Expected {
+			t.Errorf("[%d] expected %#v, got %s (%v)", caseNum, testCase.Expected, rec.Body, err)
+		}
+	}
+}
+
+func TestServerDefaults(t *testing.T) {
+	cases := []struct {
+		DefaultLimit int
+		MaxLimit     int
+		Query        string
+		Expected     int
+	}{
+		{DefaultLimit: 0, Query: "", Expected: 35},
+		{DefaultLimit: 5, Query: "", Expected: 5},
+		{DefaultLimit: 5, Query: "limit=10", Expected: 10},
+		{DefaultLimit: 5, Query: "limit=0", Expected: 0},
+		// DefaultLimit больше MaxLimit режется так же, как limit из запроса
+		{DefaultLimit: 50, MaxLimit: 20, Query: "", Expected: 20},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: datasetPath, DefaultLimit: testCase.DefaultLimit, MaxLimit: testCase.MaxLimit}
+		code, users := search(t, s, "token", testCase.Query)
+		if code != http.StatusOK || len(users) != testCase.Expected {
+			t.Errorf("[%d] expected 200 with %d users, got %d with %d", caseNum, testCase.Expected, code, len(users))
+		}
+	}
+
+	// в POST без limit DefaultLimit работает так же, как в GET
+	for caseNum, testCase := range []struct {
+		Body     string
+		Expected int
+	}{
+		{Body: `{}`, Expected: 3},
+		{Body: `{"query": "nulla"}`, Expected: 3},
+		{Body: `{"limit": 0}`, Expected: 0},
+		{Body: `{"limit": 10}`, Expected: 10},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testCase.Body))
+		req.Header.Set("AccessToken", "token")
+		rec := httptest.NewRecorder()
+		(&Server{DatasetPath: datasetPath, DefaultLimit: 3}).ServeHTTP(rec, req)
+		var users []searchclient.User
+		json.Unmarshal(rec.Body.Bytes(), &users)
+		if rec.Code != http.StatusOK || len(users) != testCase.Expected {
+			t.Errorf("[%d] POST %s: expected 200 with %d users, got %d with %d", caseNum, testCase.Body, testCase.Expected, rec.Code, len(users))
+		}
+	}
+
+	// без order_by - как order_by=0, который шлёт клиент по умолчанию
+	s := &Server{DatasetPath: datasetPath}
+	_, missing := search(t, s, "token", "order_field=Age")
+	_, asIs := search(t, s, "token", "order_field=Age&order_by=0")
+	if len(missing) == 0 || !reflect.DeepEqual(userIds(missing), userIds(asIs)) {
+		t.Errorf("expected missing order_by to work as %d, got %v and %v", DefaultOrderBy, userIds(missing), userIds(asIs))
+	}
+}
+
+func TestServerMaxBodyBytes(t *testing.T) {
+	large := `{"query": "` + strings.Repeat("a", 200) + `"}`
+	cases := []struct {
+		MaxBodyBytes int64
+		Body         string
+		Problem      bool
+		Status       int
+	}{
+		{MaxBodyBytes: 100, Body: `{"query": "boyd"}`, Status: http.StatusOK},
+		{MaxBodyBytes: 100, Body: large, Status: http.StatusRequestEntityTooLarge},
+		{MaxBodyBytes: 100, Body: large, Problem: true, Status: http.StatusRequestEntityTooLarge},
+		{Body: large, Status: http.StatusOK},
+		{Body: `{"query": "` + strings.Repeat("a", DefaultMaxBodyBytes) + `"}`, Status: http.StatusRequestEntityTooLarge},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testCase.Body))
+		req.Header.Set("AccessToken", "token")
+		if testCase.Problem {
+			req.Header.Set("Accept", searchclient.ProblemContentType)
+		}
+		rec := httptest.NewRecorder()
+		(&Server{DatasetPath: datasetPath, MaxBodyBytes: testCase.MaxBodyBytes}).ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status == http.StatusOK {
+			continue
+		}
+		var code string
+		if testCase.Problem {
+			var problem searchclient.Problem
+			json.Unmarshal(rec.Body.Bytes(), &problem)
+			code = problem.Code
+		} else {
+			var errResp ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &errResp)
+			code = errResp.Error.Code
+		}
+		if code != searchclient.CodeBadBody {
+			t.Errorf("[%d] expected %s, got %s", caseNum, searchclient.CodeBadBody, rec.Body)
+		}
+	}
+}
+
+func TestServerOrderFieldAliases(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath}
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{Query: "order_field=id&order_by=1", Expected: "order_field=Id&order_by=1"},
+		{Query: "order_field=ID&order_by=-1", Expected: "order_field=Id&order_by=-1"},
+		{Query: "order_field=age&order_by=1", Expected: "order_field=Age&order_by=1"},
+		{Query: "order_field=name&order_by=-1", Expected: "order_field=Name&order_by=-1"},
+		{Query: "order_field=first_name&order_by=-1", Expected: "order_field=Name&order_by=-1"},
+		{Query: "order_field=FullName&order_by=1", Expected: "order_field=Name&order_by=1"},
+		{Query: "sort=AGE:1&sort=id:-1", Expected: "sort=Age:1&sort=Id:-1"},
+	}
+	for caseNum, testCase := range cases {
+		code, users := search(t, s, "token", testCase.Query)
+		_, expected := search(t, s, "token", testCase.Expected)
+		if code != http.StatusOK || !reflect.DeepEqual(userIds(users), userIds(expected)) {
+			t.Errorf("[%d] expected %v, got %d %v", caseNum, userIds(expected), code, userIds(users))
+		}
+	}
+	if code, _ := search(t, s, "token", "order_field=last_name"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for last_name, got %d", code)
+	}
+}
+
+func TestServerStableSort(t *testing.T) {
+	// записи не по порядку Id, у большинства одинаковый возраст
+	path := filepath.Join(t.TempDir(), "users.csv")
+	content := "id,first_name,last_name,age\n5,Eve,Doe,30\n3,Cid,Doe,30\n9,Ian,Doe,30\n2,Bob,Doe,20\n1,Ann,Doe,30\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{DatasetPath: path}
+	cases := []struct {
+		Query    string
+		Expected []int
+	}{
+		{Query: "order_field=Age&order_by=1", Expected: []int{1, 3, 5, 9, 2}},
+		{Query: "order_field=Age&order_by=-1", Expected: []int{2, 1, 3, 5, 9}},
+		{Query: "sort=Age:1", Expected: []int{1, 3, 5, 9, 2}},
+		// Id в ключах уже есть - он и решает
+		{Query: "sort=Age:1&sort=Id:1", Expected: []int{9, 5, 3, 1, 2}},
+		{Query: "sort=Age:0", Expected: []int{5, 3, 9, 2, 1}},
+	}
+	for caseNum, testCase := range cases {
+		// по две записи на страницу, склеенные страницы - та же выдача без повторов и пропусков
+		var ids []int
+		for offset := 0; offset < len(testCase.Expected); offset += 2 {
+			_, users := search(t, s, "token", fmt.Sprintf("%s&limit=2&offset=%d", testCase.Query, offset))
+			ids = append(ids, userIds(users)...)
+		}
+		if !reflect.DeepEqual(ids, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, ids)
+		}
+	}
+
+	root := Root{Row: []Item{{Id: 5, Age: 30}, {Id: 3, Age: 30}, {Id: 2, Age: 20}, {Id: 1, Age: 30}}}
+	if err := root.SortRoot("Age", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := []int{root.Row[0].Id, root.Row[1].Id, root.Row[2].Id, root.Row[3].Id}; !reflect.DeepEqual(ids, []int{1, 3, 5, 2}) {
+		t.Errorf("expected SortRoot to break ties by Id, got %v", ids)
+	}
+}
+
+func TestServerGenderFilter(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath}
+	cases := []struct {
+		Query    string
+		Status   int
+		Expected int
+		Gender   string
+	}{
+		{Query: "gender=female", Status: http.StatusOK, Expected: 11, Gender: "female"},
+		{Query: "gender=MALE&order_field=Age", Status: http.StatusOK, Expected: 24, Gender: "male"},
+		{Query: "gender=any", Status: http.StatusOK, Expected: 35},
+		// фильтр до страниц: offset и limit считаются по отфильтрованным
+		{Query: "gender=female&order_field=Id&order_by=-1&offset=10&limit=5", Status: http.StatusOK, Expected: 1, Gender: "female"},
+		{Query: "gender=female&query=nulla", Status: http.StatusOK, Expected: 5, Gender: "female"},
+		{Query: "gender=robot", Status: http.StatusBadRequest},
+	}
+	for caseNum, testCase := range cases {
+		code, users := search(t, s, "token", testCase.Query)
+		if code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.Status, code)
+			continue
+		}
+		if len(users) != testCase.Expected {
+			t.Errorf("[%d] expected %d users, got %d", caseNum, testCase.Expected, len(users))
+		}
+		for _, user := range users {
+			if testCase.Gender != "" && user.Gender != testCase.Gender {
+				t.Errorf("[%d] expected only %s, got %+v", caseNum, testCase.Gender, user)
+			}
+		}
+	}
+}
+
+func TestServerAgeFilter(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath}
+	cases := []struct {
+		Method   string
+		Query    string
+		Body     string
+		Status   int
+		Expected int
+		Min, Max int
+	}{
+		{Query: "age_min=30&age_max=40", Status: http.StatusOK, Expected: 22, Min: 30, Max: 40},
+		{Query: "age_max=25&order_field=Age&order_by=-1", Status: http.StatusOK, Expected: 6, Max: 25},
+		{Query: "age_min=30&gender=female", Status: http.StatusOK, Expected: 9, Min: 30},
+		{Query: "age_min=36&age_max=36", Status: http.StatusOK, Expected: 4, Min: 36, Max: 36},
+		{Query: "age_min=0&age_max=0", Status: http.StatusOK, Expected: 0},
+		{Method: http.MethodPost, Body: `{"age_min": 30, "age_max": 40, "limit": 30}`, Status: http.StatusOK, Expected: 22, Min: 30, Max: 40},
+		{Query: "age_min=-1", Status: http.StatusBadRequest},
+		{Query: "age_max=old", Status: http.StatusBadRequest},
+		{Query: "age_min=40&age_max=30", Status: http.StatusBadRequest},
+	}
+	for caseNum, testCase := range cases {
+		var code int
+		var users []UserJson
+		if testCase.Method == http.MethodPost {
+			req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(testCase.Body))
+			req.Header.Set("AccessToken", "token")
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			code = rec.Code
+			json.Unmarshal(rec.Body.Bytes(), &users)
+		} else {
+			code, users = search(t, s, "token", testCase.Query)
+		}
+		if code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.Status, code)
+			continue
+		}
+		if len(users) != testCase.Expected {
+			t.Errorf("[%d] expected %d users, got %d", caseNum, testCase.Expected, len(users))
+		}
+		for _, user := range users {
+			if (testCase.Min != 0 && user.Age < testCase.Min) || (testCase.Max != 0 && user.Age > testCase.Max) {
+				t.Errorf("[%d] expected age in [%d, %d], got %+v", caseNum, testCase.Min, testCase.Max, user)
+			}
+		}
+	}
+}
+
+func TestServerIDFilter(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath}
+	cases := []struct {
+		Query    string
+		Status   int
+		Expected []int
+	}{
+		{Query: "ids=1,5,9&order_field=Id&order_by=-1", Status: http.StatusOK, Expected: []int{1, 5, 9}},
+		// порядок и повторы в ids на ответ не влияют, несуществующие Id просто не находятся
+		{Query: "ids=9,1,%205&ids=1,999&order_field=Id&order_by=-1", Status: http.StatusOK, Expected: []int{1, 5, 9}},
+		{Query: "ids=1,5,9&order_field=Id&order_by=1", Status: http.StatusOK, Expected: []int{9, 5, 1}},
+		{Query: "id_from=10&id_to=13&order_field=Id&order_by=-1", Status: http.StatusOK, Expected: []int{10, 11, 12, 13}},
+		{Query: "id_from=33&order_field=Id&order_by=-1", Status: http.StatusOK, Expected: []int{33, 34}},
+		{Query: "ids=1,5,9,20&id_to=10&order_field=Id&order_by=-1", Status: http.StatusOK, Expected: []int{1, 5, 9}},
+		{Query: "ids=&order_field=Id&order_by=-1&limit=3", Status: http.StatusOK, Expected: []int{0, 1, 2}},
+		{Query: "ids=1,x", Status: http.StatusBadRequest},
+		{Query: "ids=-1", Status: http.StatusBadRequest},
+		{Query: "id_from=5&id_to=1", Status: http.StatusBadRequest},
+	}
+	for caseNum, testCase := range cases {
+		code, users := search(t, s, "token", testCase.Query)
+		if code != testCase.Status {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.Status, code)
+			continue
+		}
+		if code == http.StatusOK && !reflect.DeepEqual(userIds(users), testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, userIds(users))
+		}
+	}
+
+	ids := make([]string, MaxFilterIDs+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	if code, _ := search(t, s, "token", "ids="+strings.Join(ids, ",")); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for more than %d ids, got %d", MaxFilterIDs, code)
+	}
+}
@@ -0,0 +1,116 @@
+package searchserver
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// minShardSize - на шард меньше стольких записей параллелить невыгодно: запуск дороже самой проверки
+var minShardSize = 8192
+
+// searchPool - общие для всех поисков воркеры, их столько же, сколько процессоров.
+// Сколько бы поисков ни шло одновременно, лишних горутин они не плодят
+var searchPool workerPool
+
+type workerPool struct {
+	once  sync.Once
+	tasks chan func()
+}
+
+// run выполняет задачи и ждёт их. Задачу, которую не взял ни один свободный воркер,
+// выполняет сам вызывающий, так что занятый пул не блокирует поиск
+func (p *workerPool) run(tasks []func()) {
+	p.once.Do(func() {
+		p.tasks = make(chan func())
+		for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+			go func() {
+				for task := range p.tasks {
+					task()
+				}
+			}()
+		}
+	})
+	var wg sync.WaitGroup
+	for _, task := range tasks[1:] {
+		task := task
+		wg.Add(1)
+		done := func() {
+			defer wg.Done()
+			task()
+		}
+		select {
+		case p.tasks <- done:
+		default:
+			done()
+		}
+	}
+	tasks[0]()
+	wg.Wait()
+}
+
+// shardCount - на сколько шардов делить n записей, workers <= 0 - по числу процессоров
+func shardCount(n, workers int) int {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	shards := n / minShardSize
+	if shards > workers {
+		shards = workers
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	return shards
+}
+
+// ctxCheckEvery - через сколько записей долгие циклы поиска проверяют, не вышло ли время запроса
+const ctxCheckEvery = 4096
+
+// matchSharded делит n записей на шарды и проверяет их параллельно. match проверяет записи [from, to)
+// и дописывает подходящие номера в results; результаты шардов склеиваются по порядку,
+// так что порядок такой же, как у последовательного прохода. Каждые ctxCheckEvery записей
+// проверяется ctx, отменённый поиск бросается на полпути и возвращает ctx.Err()
+func matchSharded(ctx context.Context, n, workers int, match func(from, to int, results []int) []int) ([]int, error) {
+	chunked := func(from, to int) []int {
+		var results []int
+		for ; from < to; from += ctxCheckEvery {
+			if ctx.Err() != nil {
+				return nil
+			}
+			results = match(from, min(from+ctxCheckEvery, to), results)
+		}
+		return results
+	}
+	shards := shardCount(n, workers)
+	if shards == 1 {
+		results := chunked(0, n)
+		return results, ctx.Err()
+	}
+	parts := make([][]int, shards)
+	tasks := make([]func(), shards)
+	for i := range tasks {
+		i := i
+		from, to := n*i/shards, n*(i+1)/shards
+		tasks[i] = func() {
+			parts[i] = chunked(from, to)
+		}
+	}
+	searchPool.run(tasks)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, part := range parts {
+		total += len(part)
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	results := make([]int, 0, total)
+	for _, part := range parts {
+		results = append(results, part...)
+	}
+	return results, nil
+}
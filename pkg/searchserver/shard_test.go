@@ -0,0 +1,104 @@
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// параллельный поиск по шардам обязан находить то же и в том же порядке, что и последовательный
+func TestShardedFindMatchesSequential(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int) { minShardSize = size }(minShardSize)
+	minShardSize = 1
+
+	queries := []string{"e", "nulla", "boyd", "sit amet", "xyz", "Et"}
+	for _, kind := range []string{IndexWords, IndexTrigrams} {
+		var store Store
+		snapshot, err := store.SwapIndexed(root, kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		find := func(query string, workers int) []int {
+			positions, err := snapshot.find(context.Background(), Query{Query: query}, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return positions
+		}
+		for _, query := range queries {
+			expected := find(query, 1)
+			for _, workers := range []int{0, 2, 7, 1000} {
+				if got := find(query, workers); !reflect.DeepEqual(got, expected) {
+					t.Errorf("%s %q: %d workers found %v, expected %v", kind, query, workers, got, expected)
+				}
+			}
+		}
+	}
+}
+
+// отменённый поиск бросается на полпути, и по одному шарду, и по нескольким
+func TestMatchShardedCancel(t *testing.T) {
+	defer func(size int) { minShardSize = size }(minShardSize)
+	minShardSize = ctxCheckEvery
+
+	ctx, cancel := context.WithCancel(context.Background())
+	checked := 0
+	_, err := matchSharded(ctx, 10*ctxCheckEvery, 1, func(from, to int, results []int) []int {
+		checked += to - from
+		cancel()
+		return results
+	})
+	if !errors.Is(err, context.Canceled) || checked != ctxCheckEvery {
+		t.Errorf("expected search to stop after %d rows with context.Canceled, checked %d with %v", ctxCheckEvery, checked, err)
+	}
+
+	var calls atomic.Int32
+	_, err = matchSharded(ctx, 10*ctxCheckEvery, 4, func(from, to int, results []int) []int {
+		calls.Add(1)
+		return results
+	})
+	if !errors.Is(err, context.Canceled) || calls.Load() != 0 {
+		t.Errorf("expected cancelled sharded search not to check rows, got %d calls with %v", calls.Load(), err)
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	defer func(size int) { minShardSize = size }(minShardSize)
+	minShardSize = 10
+	cases := []struct {
+		N, Workers, Expected int
+	}{
+		{N: 0, Workers: 4, Expected: 1},
+		{N: 9, Workers: 4, Expected: 1},
+		{N: 35, Workers: 4, Expected: 3},
+		{N: 1000, Workers: 4, Expected: 4},
+		{N: 1000, Workers: 1, Expected: 1},
+	}
+	for caseNum, item := range cases {
+		if got := shardCount(item.N, item.Workers); got != item.Expected {
+			t.Errorf("[%d] expected %d shards, got %d", caseNum, item.Expected, got)
+		}
+	}
+}
+
+// задачи выполняются все, даже если свободных воркеров нет
+func TestWorkerPoolRunsAllTasks(t *testing.T) {
+	var pool workerPool
+	var done atomic.Int32
+	tasks := make([]func(), 100)
+	for i := range tasks {
+		tasks[i] = func() { done.Add(1) }
+	}
+	for i := 0; i < 3; i++ {
+		pool.run(tasks)
+	}
+	if got := done.Load(); got != 300 {
+		t.Errorf("expected 300 tasks done, got %d", got)
+	}
+}
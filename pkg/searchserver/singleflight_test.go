@@ -0,0 +1,69 @@
+package searchserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStorage держит поиск, пока не закроют release
+type blockingStorage struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingStorage) Search(ctx context.Context, query Query) (Page, error) {
+	b.calls.Add(1)
+	<-b.release
+	return Page{Users: []Item{{Id: 1, Name: "Jane Doe"}}, Total: 1}, nil
+}
+
+func TestServerCollapsesIdenticalSearches(t *testing.T) {
+	storage := &blockingStorage{release: make(chan struct{})}
+	s := &Server{Storage: storage}
+
+	const requests = 10
+	bodies := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, authorizedRequest("/?query=jane&order_by=1"))
+			if rec.Code != http.StatusOK {
+				t.Errorf("[%d] expected 200, got %d", i, rec.Code)
+			}
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	// другой запрос ждёт своего поиска
+	other := make(chan struct{})
+	go func() {
+		defer close(other)
+		s.ServeHTTP(httptest.NewRecorder(), authorizedRequest("/?query=john&order_by=1"))
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for storage.calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// даём остальным одинаковым запросам дойти до ожидания
+	time.Sleep(20 * time.Millisecond)
+	close(storage.release)
+	wg.Wait()
+	<-other
+
+	if calls := storage.calls.Load(); calls != 2 {
+		t.Errorf("expected 2 searches for 2 distinct queries, got %d", calls)
+	}
+	for i, body := range bodies {
+		if body != bodies[0] {
+			t.Errorf("[%d] expected shared result %s, got %s", i, bodies[0], body)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package searchserver
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// queryTimings - сколько поиск провёл в фильтрации, сортировке и подготовке ответа. Поиск идёт в горутине
+// singleflight и может продолжаться, когда запрос уже бросил его по таймауту, поэтому счётчики атомарные
+type queryTimings struct {
+	filter atomic.Int64
+	sort   atomic.Int64
+	encode atomic.Int64
+}
+
+type queryTimingsKey struct{}
+
+// withTimings - ctx, в котором этапы поиска копят время в timings
+func withTimings(ctx context.Context, timings *queryTimings) context.Context {
+	return context.WithValue(ctx, queryTimingsKey{}, timings)
+}
+
+// timingsFrom - куда копить время этапов поиска, nil - медленные поиски не пишутся и копить некуда
+func timingsFrom(ctx context.Context) *queryTimings {
+	timings, _ := ctx.Value(queryTimingsKey{}).(*queryTimings)
+	return timings
+}
+
+// addSearch добавляет время фильтрации и сортировки. Сторонние хранилища делают их одним запросом,
+// у них всё время идёт в filter
+func (t *queryTimings) addSearch(filter, sort time.Duration) {
+	if t == nil {
+		return
+	}
+	t.filter.Add(int64(filter))
+	t.sort.Add(int64(sort))
+}
+
+// addEncode добавляет время подготовки тела ответа
+func (t *queryTimings) addEncode(encode time.Duration) {
+	if t == nil {
+		return
+	}
+	t.encode.Add(int64(encode))
+}
+
+// add добавляет время этапов other, например поиска, к которому запрос присоединился в singleflight
+func (t *queryTimings) add(other *queryTimings) {
+	if t == nil || other == nil {
+		return
+	}
+	t.filter.Add(other.filter.Load())
+	t.sort.Add(other.sort.Load())
+	t.encode.Add(other.encode.Load())
+}
+
+// logSlowQuery пишет в SlowQueryLogger поиск, который шёл дольше SlowQueryThreshold: параметры без секретов
+// и время по этапам. decode - разбор параметров, filter и sort - поиск, encode - подготовка ответа.
+// У ответа из PageCache или Cache filter, sort и encode нулевые
+func (s *Server) logSlowQuery(r *http.Request, params url.Values, start time.Time, decode time.Duration, timings *queryTimings, rendered RenderedPage, err error) {
+	elapsed := time.Since(start)
+	if timings == nil || elapsed < s.SlowQueryThreshold {
+		return
+	}
+	logger := s.SlowQueryLogger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	attrs := []slog.Attr{
+		slog.String("request_id", RequestID(r.Context())),
+		slog.String("path", r.URL.Path),
+		slog.String("query", redactQuery(maps.Clone(params))),
+		slog.Duration("duration", elapsed),
+		slog.Duration("decode", decode),
+		slog.Duration("filter", time.Duration(timings.filter.Load())),
+		slog.Duration("sort", time.Duration(timings.sort.Load())),
+		slog.Duration("encode", time.Duration(timings.encode.Load())),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.Int("results", rendered.Users), slog.Int("total", rendered.Total))
+	}
+	logger.LogAttrs(r.Context(), slog.LevelWarn, "slow query", attrs...)
+}
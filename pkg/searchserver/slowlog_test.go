@@ -0,0 +1,146 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowQueries - записи лога медленных поисков, по одной на строку JSON
+func slowQueries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	entries := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("cant decode log line %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	cases := []struct {
+		Server  *Server
+		Target  string
+		Logged  bool
+		Stages  []string
+		Results float64
+	}{
+		{Server: &Server{DatasetPath: datasetPath, SlowQueryThreshold: time.Nanosecond}, Target: "/?query=nulla&order_field=Age&limit=3", Logged: true, Stages: []string{"decode", "filter", "sort", "encode"}, Results: 3},
+		{Server: &Server{DatasetPath: datasetPath, SlowQueryThreshold: time.Nanosecond}, Target: "/v2/search?gender=male&limit=2&password=x", Logged: true, Stages: []string{"decode", "filter", "encode"}, Results: 2},
+		// у стороннего хранилища фильтрация и сортировка - один запрос
+		{Server: &Server{Storage: newSQLiteStorage(t), SlowQueryThreshold: time.Nanosecond}, Target: "/?query=nulla&order_field=Name", Logged: true, Stages: []string{"decode", "filter", "encode"}, Results: 0},
+		{Server: &Server{DatasetPath: datasetPath, SlowQueryThreshold: time.Hour}, Target: "/?query=nulla"},
+		{Server: &Server{DatasetPath: datasetPath}, Target: "/?query=nulla"},
+		// медленными считаются только поиски
+		{Server: &Server{DatasetPath: datasetPath, SlowQueryThreshold: time.Nanosecond}, Target: "/stats"},
+	}
+	for caseNum, testCase := range cases {
+		var buf bytes.Buffer
+		testCase.Server.SlowQueryLogger = slog.New(slog.NewJSONHandler(&buf, nil))
+		rec := httptest.NewRecorder()
+		testCase.Server.ServeHTTP(rec, authorizedRequest(testCase.Target))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("[%d] unexpected status %d: %s", caseNum, rec.Code, rec.Body)
+		}
+		entries := slowQueries(t, &buf)
+		if !testCase.Logged {
+			if len(entries) != 0 {
+				t.Errorf("[%d] expected no slow query log, got %v", caseNum, entries)
+			}
+			continue
+		}
+		if len(entries) != 1 {
+			t.Fatalf("[%d] expected one slow query, got %v", caseNum, entries)
+		}
+		entry := entries[0]
+		if entry["msg"] != "slow query" || entry["level"] != "WARN" || entry["duration"].(float64) <= 0 {
+			t.Errorf("[%d] unexpected entry %v", caseNum, entry)
+		}
+		for _, stage := range testCase.Stages {
+			if spent, ok := entry[stage].(float64); !ok || spent <= 0 {
+				t.Errorf("[%d] expected time spent in %s, got %v", caseNum, stage, entry)
+			}
+		}
+		if testCase.Results > 0 && entry["results"] != testCase.Results {
+			t.Errorf("[%d] expected %v results, got %v", caseNum, testCase.Results, entry["results"])
+		}
+		if query := entry["query"].(string); strings.Contains(query, "password=x") {
+			t.Errorf("[%d] expected redacted query, got %s", caseNum, query)
+		}
+	}
+}
+
+func TestSlowQueryLogCached(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Server{
+		DatasetPath:        datasetPath,
+		PageCache:          &PageCache{Size: 10},
+		SlowQueryThreshold: time.Nanosecond,
+		SlowQueryLogger:    slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+	for i := 0; i < 2; i++ {
+		s.ServeHTTP(httptest.NewRecorder(), authorizedRequest("/?query=nulla"))
+	}
+	entries := slowQueries(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("expected two slow queries, got %v", entries)
+	}
+	// второй ответ из кэша, поиска не было
+	if cached := entries[1]; cached["filter"] != 0.0 || cached["sort"] != 0.0 || cached["encode"] != 0.0 {
+		t.Errorf("expected no search stages for cached page, got %v", cached)
+	}
+}
+
+func TestSlowQueryLogSharedSearch(t *testing.T) {
+	var buf bytes.Buffer
+	storage := &blockingStorage{release: make(chan struct{})}
+	s := &Server{
+		Storage:            storage,
+		SlowQueryThreshold: time.Nanosecond,
+		SlowQueryLogger:    slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+
+	const requests = 5
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ServeHTTP(httptest.NewRecorder(), authorizedRequest("/?query=jane"))
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for storage.calls.Load() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// даём остальным запросам присоединиться к поиску
+	time.Sleep(20 * time.Millisecond)
+	close(storage.release)
+	wg.Wait()
+
+	if calls := storage.calls.Load(); calls != 1 {
+		t.Fatalf("expected one shared search, got %d", calls)
+	}
+	entries := slowQueries(t, &buf)
+	if len(entries) != requests {
+		t.Fatalf("expected %d slow queries, got %v", requests, entries)
+	}
+	// время поиска видно и тем, кто его не начинал, а дождался
+	for i, entry := range entries {
+		if filter, ok := entry["filter"].(float64); !ok || filter <= 0 {
+			t.Errorf("[%d] expected time spent in filter, got %v", i, entry)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package searchserver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"hw4/pkg/searchclient"
+)
+
+// sortIndex - записи, заранее упорядоченные по одному полю. Строится при загрузке, чтобы на запрос
+// не сортировать заново и не сравнивать строки
+type sortIndex struct {
+	// номера записей по возрастанию и по убыванию поля, равные - в исходном порядке
+	asc, desc []int
+	// для каждой записи - номер группы равных значений по возрастанию
+	rank []int
+}
+
+func newSortIndex(rows []Item, compare func(a, b *Item) int) *sortIndex {
+	index := &sortIndex{asc: make([]int, len(rows)), rank: make([]int, len(rows))}
+	for i := range index.asc {
+		index.asc[i] = i
+	}
+	sort.SliceStable(index.asc, func(i, j int) bool {
+		return compare(&rows[index.asc[i]], &rows[index.asc[j]]) < 0
+	})
+	rank := 0
+	for i, pos := range index.asc {
+		if i > 0 && compare(&rows[index.asc[i-1]], &rows[pos]) != 0 {
+			rank++
+		}
+		index.rank[pos] = rank
+	}
+
+	// по убыванию: группы в обратном порядке, внутри группы - исходный
+	index.desc = make([]int, 0, len(rows))
+	for end := len(index.asc); end > 0; {
+		start := end - 1
+		for start > 0 && index.rank[index.asc[start-1]] == index.rank[index.asc[end-1]] {
+			start--
+		}
+		index.desc = append(index.desc, index.asc[start:end]...)
+		end = start
+	}
+	return index
+}
+
+func newSortIndexes(rows []Item) map[string]*sortIndex {
+	indexes := make(map[string]*sortIndex, len(itemComparators))
+	for field, compare := range itemComparators {
+		indexes[field] = newSortIndex(rows, compare)
+	}
+	return indexes
+}
+
+// Sorted ищет query и сортирует результат как Root.SortFields, но по заранее построенным индексам
+func (s *Snapshot) Sorted(query string, fields []SortField) (Root, error) {
+	positions, err := s.sorted(context.Background(), Query{Query: query, Sort: fields}, 0, nil, nil)
+	if err != nil {
+		return Root{}, err
+	}
+	return Root{Row: s.rowsAt(positions)}, nil
+}
+
+// sorted - Sorted над номерами записей с фильтрами из query, страницы не режутся. workers - как у find,
+// Name сортируется по collation, ScoreField - по scores (nil - заведётся свой). Результат может быть срезом
+// самого индекса, менять его нельзя. Отменённый ctx прерывает и поиск, и сортировку
+func (s *Snapshot) sorted(ctx context.Context, query Query, workers int, collation *Collation, scores *scorer) ([]int, error) {
+	// всё, кроме поиска подходящих записей, считается сортировкой
+	start, filtering := time.Now(), time.Duration(0)
+	defer func() { timingsFrom(ctx).addSearch(filtering, time.Since(start)-filtering) }()
+	find := func() ([]int, error) {
+		findStart := time.Now()
+		defer func() { filtering = time.Since(findStart) }()
+		return s.find(ctx, query, workers)
+	}
+	fields := query.Sort
+	// без строки поиска и фильтров подходят все записи
+	all := query.Query == "" && !query.filtered()
+	indexes := make([]*sortIndex, len(fields))
+	for i, field := range fields {
+		if field.Field == ScoreField {
+			continue
+		}
+		index, ok := s.sorts[field.Field]
+		if !ok {
+			return nil, errBadOrderField("sort", field.Field)
+		}
+		if field.Field == "Name" && collation != nil {
+			index = s.nameIndex(collation)
+		}
+		indexes[i] = index
+	}
+	// релевантность заранее не упорядочить, её индекс строится по найденным записям
+	if query.scored() {
+		found, err := find()
+		if err != nil {
+			return nil, err
+		}
+		if scores == nil {
+			scores = s.newScorer(query)
+		}
+		rank := scores.ranks(found)
+		for i, field := range fields {
+			if field.Field == ScoreField {
+				indexes[i] = &sortIndex{rank: rank}
+			}
+		}
+		return found, sortByRanks(ctx, found, fields, indexes)
+	}
+	if len(fields) == 0 {
+		if all {
+			return s.all(), nil
+		}
+		return find()
+	}
+
+	if len(fields) == 1 {
+		order := indexes[0].asc
+		if fields[0].Order != searchclient.OrderByAsc {
+			order = indexes[0].desc
+		}
+		if all {
+			return order, nil
+		}
+		found, err := find()
+		if err != nil {
+			return nil, err
+		}
+		// если нашлась заметная часть датасета, дешевле пройти по готовому порядку, чем сортировать
+		if len(found)*4 >= len(s.rows) {
+			matched := make([]bool, len(s.rows))
+			for _, pos := range found {
+				matched[pos] = true
+			}
+			positions := found[:0]
+			for i, pos := range order {
+				if i%ctxCheckEvery == 0 && ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if matched[pos] {
+					positions = append(positions, pos)
+				}
+			}
+			return positions, nil
+		}
+		return found, sortByRanks(ctx, found, fields, indexes)
+	}
+
+	var found []int
+	if all {
+		found = s.all()
+	} else {
+		var err error
+		if found, err = find(); err != nil {
+			return nil, err
+		}
+	}
+	return found, sortByRanks(ctx, found, fields, indexes)
+}
+
+// sortByRanks сортирует номера записей, сравнивая номера групп вместо самих значений.
+// Если ctx отменят, сортировка бросается и возвращает ctx.Err()
+func sortByRanks(ctx context.Context, positions []int, fields []SortField, indexes []*sortIndex) error {
+	less, cancelled := cancellable(ctx, func(i, j int) bool {
+		for k, field := range fields {
+			a, b := indexes[k].rank[positions[i]], indexes[k].rank[positions[j]]
+			if a == b {
+				continue
+			}
+			if field.Order == searchclient.OrderByAsc {
+				return a < b
+			}
+			return a > b
+		}
+		return false
+	})
+	sort.SliceStable(positions, less)
+	return cancelled()
+}
@@ -0,0 +1,68 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestSortIndex(t *testing.T) {
+	rows := []Item{{Id: 0, Age: 30}, {Id: 1, Age: 20}, {Id: 2, Age: 30}, {Id: 3, Age: 25}, {Id: 4, Age: 20}}
+	index := newSortIndex(rows, itemComparators["Age"])
+	if expected := []int{1, 4, 3, 0, 2}; !reflect.DeepEqual(index.asc, expected) {
+		t.Errorf("expected asc %v, got %v", expected, index.asc)
+	}
+	// равные остаются в исходном порядке, как у sort.SliceStable
+	if expected := []int{0, 2, 3, 1, 4}; !reflect.DeepEqual(index.desc, expected) {
+		t.Errorf("expected desc %v, got %v", expected, index.desc)
+	}
+	if expected := []int{2, 0, 2, 1, 0}; !reflect.DeepEqual(index.rank, expected) {
+		t.Errorf("expected rank %v, got %v", expected, index.rank)
+	}
+}
+
+// сортировка по индексам обязана давать ровно то же, что и SortFields
+func TestSnapshotSortedMatchesSortFields(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	var store Store
+	snapshot := store.Swap(root)
+
+	asc, desc := searchclient.OrderByAsc, searchclient.OrderByDesc
+	sorts := [][]SortField{
+		nil,
+		{{Field: "Id", Order: asc}},
+		{{Field: "Id", Order: desc}},
+		{{Field: "Age", Order: asc}},
+		{{Field: "Age", Order: desc}},
+		{{Field: "Name", Order: asc}},
+		{{Field: "Name", Order: desc}},
+		{{Field: "Age", Order: desc}, {Field: "Name", Order: asc}},
+		{{Field: "Age", Order: asc}, {Field: "Id", Order: desc}},
+	}
+	// пустой, почти весь датасет, немного и ничего
+	queries := []string{"", "e", "nulla", "boyd", "xyz"}
+	for _, fields := range sorts {
+		for _, query := range queries {
+			expected := snapshot.Search(query)
+			if err := expected.SortFields(fields); err != nil {
+				t.Fatal(err)
+			}
+			got, err := snapshot.Sorted(query, fields)
+			if err != nil {
+				t.Errorf("%v %q: unexpected error: %s", fields, query, err)
+				continue
+			}
+			if !reflect.DeepEqual(got.Row, expected.Row) {
+				t.Errorf("%v %q: sorted by index differs from SortFields", fields, query)
+			}
+		}
+	}
+
+	if _, err := snapshot.Sorted("", []SortField{{Field: "About", Order: asc}}); err == nil {
+		t.Error("expected error for unknown sort field")
+	}
+}
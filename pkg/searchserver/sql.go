@@ -0,0 +1,306 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// sqlDialect - чем отличаются базы при поиске
+type sqlDialect struct {
+	// плейсхолдер n-го аргумента, с единицы
+	placeholder func(n int) string
+	// как сортировать текст побайтно, как это делает поиск в памяти
+	collate string
+	// LIMIT, который ничего не ограничивает
+	noLimit string
+}
+
+var sqliteDialect = sqlDialect{
+	placeholder: func(int) string { return "?" },
+	noLimit:     "LIMIT -1",
+}
+
+var postgresDialect = sqlDialect{
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	collate:     ` COLLATE "C"`,
+	noLimit:     "LIMIT ALL",
+}
+
+// sqlColumns - в какие колонки смотреть при сортировке по полю
+var sqlColumns = map[string]string{"Id": "id", "Age": "age", "Name": "name"}
+
+// sqlCreateTable - таблица users. name_lower и about_lower хранят текст в нижнем регистре, приведённый в Go:
+// lower() в SQLite понимает только ASCII, а искать надо и по кириллице
+const sqlCreateTable = `CREATE TABLE IF NOT EXISTS users (
+	id BIGINT PRIMARY KEY,
+	guid TEXT NOT NULL DEFAULT '',
+	age INTEGER NOT NULL DEFAULT 0,
+	first_name TEXT NOT NULL DEFAULT '',
+	last_name TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL DEFAULT '',
+	about TEXT NOT NULL DEFAULT '',
+	gender TEXT NOT NULL DEFAULT '',
+	name_lower TEXT NOT NULL DEFAULT '',
+	about_lower TEXT NOT NULL DEFAULT ''
+)`
+
+func sqlInit(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, sqlCreateTable); err != nil {
+		return fmt.Errorf("cant create users table: %w", err)
+	}
+	return nil
+}
+
+func sqlCount(ctx context.Context, db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func sqlImport(ctx context.Context, db *sql.DB, dialect sqlDialect, root Root) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		return err
+	}
+	placeholders := make([]string, 10)
+	for i := range placeholders {
+		placeholders[i] = dialect.placeholder(i + 1)
+	}
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO users
+		(id, guid, age, first_name, last_name, name, about, gender, name_lower, about_lower)
+		VALUES (`+strings.Join(placeholders, ", ")+`)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, item := range root.Row {
+		name := item.FirstName + " " + item.LastName
+		_, err := insert.ExecContext(ctx, item.Id, item.Guid, item.Age, item.FirstName, item.LastName,
+			name, item.About, item.Gender, foldCase(name), foldCase(item.About))
+		if err != nil {
+			return fmt.Errorf("cant import user %d: %w", item.Id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlQueryCondition переводит дерево запроса в условие WHERE, arg добавляет аргумент и отдаёт его плейсхолдер
+func sqlQueryCondition(node *queryNode, arg func(value interface{}) string) string {
+	switch node.Op {
+	case queryAnd, queryOr:
+		children := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = sqlQueryCondition(child, arg)
+		}
+		return "(" + strings.Join(children, " "+node.Op+" ") + ")"
+	case queryNot:
+		return "NOT " + sqlQueryCondition(node.Children[0], arg)
+	}
+	pattern := "%" + escapeLike(node.Term.Text) + "%"
+	switch node.Term.Field {
+	case "Name":
+		return fmt.Sprintf(`name_lower LIKE %s ESCAPE '\'`, arg(pattern))
+	case "About":
+		return fmt.Sprintf(`about_lower LIKE %s ESCAPE '\'`, arg(pattern))
+	}
+	return fmt.Sprintf(`(name_lower LIKE %s ESCAPE '\' OR about_lower LIKE %s ESCAPE '\')`, arg(pattern), arg(pattern))
+}
+
+// sqlUserColumns - колонки, из которых собирается Item, в порядке sqlScanUsers
+const sqlUserColumns = "id, guid, age, first_name, last_name, name, about, gender"
+
+// sqlWhere собирает условие WHERE по фильтрам и строке поиска, пустое - ищутся все
+func sqlWhere(dialect sqlDialect, query Query) (where string, args []interface{}, err error) {
+	if query.Fuzziness > 0 {
+		// словаря для нечёткого поиска у базы нет
+		return "", nil, &ServerError{Code: searchclient.CodeBadQuery, Message: "fuzziness is not supported by sql storage", Field: "fuzziness"}
+	}
+	if query.IgnoreAccents {
+		// name_lower и about_lower хранятся с диакритикой, а убирать её в LIKE база не умеет
+		return "", nil, &ServerError{Code: searchclient.CodeBadQuery, Message: "ignore_accents is not supported by sql storage", Field: "ignore_accents"}
+	}
+	var conditions []string
+	// arg добавляет аргумент и отдаёт его плейсхолдер
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return dialect.placeholder(len(args))
+	}
+	if tree := query.searchTree(); tree != nil && tree.Op == queryAnd {
+		for _, child := range tree.Children {
+			conditions = append(conditions, sqlQueryCondition(child, arg))
+		}
+	} else if tree != nil {
+		conditions = append(conditions, sqlQueryCondition(tree, arg))
+	}
+	if query.Gender != "" {
+		conditions = append(conditions, "gender = "+arg(query.Gender))
+	}
+	if query.AgeMin != nil {
+		conditions = append(conditions, "age >= "+arg(*query.AgeMin))
+	}
+	if query.AgeMax != nil {
+		conditions = append(conditions, "age <= "+arg(*query.AgeMax))
+	}
+	if len(query.IDs) > 0 {
+		placeholders := make([]string, len(query.IDs))
+		for i, id := range query.IDs {
+			placeholders[i] = arg(id)
+		}
+		conditions = append(conditions, "id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if query.IdFrom != nil {
+		conditions = append(conditions, "id >= "+arg(*query.IdFrom))
+	}
+	if query.IdTo != nil {
+		conditions = append(conditions, "id <= "+arg(*query.IdTo))
+	}
+	if query.Guid != "" {
+		conditions = append(conditions, "guid = "+arg(query.Guid))
+	}
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return where, args, nil
+}
+
+// sqlSearchQueries собирает запрос за общим количеством и запрос за страницей
+func sqlSearchQueries(dialect sqlDialect, query Query) (countSQL string, countArgs []interface{}, pageSQL string, pageArgs []interface{}, err error) {
+	where, countArgs, err := sqlWhere(dialect, query)
+	if err != nil {
+		return "", nil, "", nil, err
+	}
+	countSQL = "SELECT count(*) FROM users" + where
+
+	var orderBy []string
+	for _, key := range query.Sort {
+		column, ok := sqlColumns[key.Field]
+		if !ok {
+			return "", nil, "", nil, errBadOrderField("sort", key.Field)
+		}
+		if column == "name" {
+			column += dialect.collate
+		}
+		if key.Order == searchclient.OrderByAsc {
+			orderBy = append(orderBy, column+" ASC")
+		} else {
+			orderBy = append(orderBy, column+" DESC")
+		}
+	}
+	pageSQL = "SELECT " + sqlUserColumns + " FROM users" + where
+	if len(orderBy) > 0 {
+		pageSQL += " ORDER BY " + strings.Join(orderBy, ", ")
+	}
+	pageArgs = append(pageArgs, countArgs...)
+	if query.Limit < 0 {
+		pageSQL += " " + dialect.noLimit
+	} else {
+		pageArgs = append(pageArgs, query.Limit)
+		pageSQL += " LIMIT " + dialect.placeholder(len(pageArgs))
+	}
+	pageArgs = append(pageArgs, query.Offset)
+	pageSQL += " OFFSET " + dialect.placeholder(len(pageArgs))
+	return countSQL, countArgs, pageSQL, pageArgs, nil
+}
+
+// sqlSearch выполняет поиск одним запросом за страницу и одним за общее количество
+func sqlSearch(ctx context.Context, db *sql.DB, dialect sqlDialect, query Query) (Page, error) {
+	var page Page
+	countSQL, countArgs, pageSQL, pageArgs, err := sqlSearchQueries(dialect, query)
+	if err != nil {
+		return page, err
+	}
+	if err := db.QueryRowContext(ctx, countSQL, countArgs...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("cant count users: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, pageSQL, pageArgs...)
+	if err != nil {
+		return page, fmt.Errorf("cant search users: %w", err)
+	}
+	page.Users, err = sqlScanUsers(rows)
+	return page, err
+}
+
+// sqlScanUsers читает пользователей из строк с колонками sqlUserColumns и закрывает rows
+func sqlScanUsers(rows *sql.Rows) ([]Item, error) {
+	defer rows.Close()
+	users := []Item{}
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Id, &item.Guid, &item.Age, &item.FirstName, &item.LastName, &item.Name, &item.About, &item.Gender); err != nil {
+			return nil, err
+		}
+		users = append(users, item)
+	}
+	return users, rows.Err()
+}
+
+// sqlSample выбирает n случайных среди найденных: один запрос за id всех найденных в порядке id
+// и один за выбранными. Выборка та же, что у MemoryStorage по тому же датасету, если в нём записи идут по Id
+func sqlSample(ctx context.Context, db *sql.DB, dialect sqlDialect, query Query, n int, seed int64) (Page, error) {
+	where, args, err := sqlWhere(dialect, query)
+	if err != nil {
+		return Page{}, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT id FROM users"+where+" ORDER BY id ASC", args...)
+	if err != nil {
+		return Page{}, fmt.Errorf("cant search users: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return Page{}, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+	page := Page{Users: []Item{}, Total: len(ids)}
+	picked := samplePositions(len(ids), n, seed)
+	if len(picked) == 0 {
+		return page, nil
+	}
+	pickedArgs := make([]interface{}, len(picked))
+	placeholders := make([]string, len(picked))
+	for i, pos := range picked {
+		pickedArgs[i] = ids[pos]
+		placeholders[i] = dialect.placeholder(i + 1)
+	}
+	rows, err = db.QueryContext(ctx, "SELECT "+sqlUserColumns+" FROM users WHERE id IN ("+strings.Join(placeholders, ", ")+")", pickedArgs...)
+	if err != nil {
+		return Page{}, fmt.Errorf("cant fetch sampled users: %w", err)
+	}
+	found, err := sqlScanUsers(rows)
+	if err != nil {
+		return Page{}, err
+	}
+	// база отдаёт выбранных в своём порядке, а выборка идёт в порядке samplePositions
+	byId := make(map[int]Item, len(found))
+	for _, item := range found {
+		byId[item.Id] = item
+	}
+	for _, pos := range picked {
+		if item, ok := byId[ids[pos]]; ok {
+			page.Users = append(page.Users, item)
+		}
+	}
+	return page, nil
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы подстрока искалась как есть
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,42 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLiteStorage ищет пользователей в таблице users базы SQLite: фильтрация, сортировка и пагинация
+// выполняются в базе, так что датасет не обязан помещаться в память. Драйвер (например, github.com/mattn/go-sqlite3)
+// подключает тот, кто открывает DB
+type SQLiteStorage struct {
+	DB *sql.DB
+}
+
+// Init создаёт таблицу, если её ещё нет
+func (s *SQLiteStorage) Init(ctx context.Context) error {
+	return sqlInit(ctx, s.DB)
+}
+
+// Count - сколько пользователей в базе
+func (s *SQLiteStorage) Count(ctx context.Context) (int, error) {
+	return sqlCount(ctx, s.DB)
+}
+
+// Import заменяет содержимое таблицы записями из root одной транзакцией
+func (s *SQLiteStorage) Import(ctx context.Context, root Root) error {
+	return sqlImport(ctx, s.DB, sqliteDialect, root)
+}
+
+func (s *SQLiteStorage) Search(ctx context.Context, query Query) (Page, error) {
+	return sqlSearch(ctx, s.DB, sqliteDialect, query)
+}
+
+// Sample выбирает n случайных найденных, не перебирая их по одному (см. sqlSample)
+func (s *SQLiteStorage) Sample(ctx context.Context, query Query, n int, seed int64) (Page, error) {
+	return sqlSample(ctx, s.DB, sqliteDialect, query, n, seed)
+}
+
+// Ping проверяет, что база отвечает
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
@@ -0,0 +1,115 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newSQLiteStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storage := &SQLiteStorage{DB: db}
+	ctx := context.Background()
+	if err := storage.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Import(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func TestSQLiteStorageMatchesMemory(t *testing.T) {
+	storage := newSQLiteStorage(t)
+	if count, err := storage.Count(context.Background()); err != nil || count != 35 {
+		t.Fatalf("expected 35 imported users, got %d (%v)", count, err)
+	}
+	checkStorageMatchesMemory(t, storage)
+}
+
+// checkStorageMatchesMemory проверяет, что хранилище с импортированным dataset.xml отвечает ровно так же, как поиск в памяти
+func checkStorageMatchesMemory(t *testing.T, storage Storage) {
+	t.Helper()
+	memory := &Server{DatasetPath: datasetPath}
+	backend := &Server{Storage: storage}
+	cases := []string{
+		"/?order_by=-1",
+		"/?order_by=1&order_field=Id&limit=5&offset=3",
+		"/?order_by=0&order_field=Id&limit=10",
+		"/?query=boyd&order_by=1",
+		"/?query=NULLA&order_by=1&order_field=Id",
+		"/?query=%25&order_by=1",
+		"/?query=nothing-like-this&order_by=1",
+		"/?sort=Age:1&sort=Id:-1&limit=20",
+		"/?sort=Age:0&sort=Id:1",
+		// равные по Age листаются в одном порядке во всех хранилищах
+		"/?order_by=1&order_field=Age&limit=5&offset=5",
+		"/?sort=Age:-1&limit=7&offset=14",
+		"/?order_by=1&offset=100",
+		"/v2/?query=an&order_by=-1&order_field=Id&limit=3&offset=2",
+		"/v2/?order_by=1&offset=100",
+		"/?order_by=2",
+		"/?order_by=x",
+		"/?order_by=1&order_field=About",
+		"/?sort=Gender:1",
+		"/?sort=Age:5",
+		"/?order_by=1&limit=x",
+		"/?order_by=1&offset=x",
+		"/?gender=female&order_by=1&order_field=Age&limit=5",
+		"/?query=nulla&gender=male&order_by=-1",
+		"/?gender=robot",
+		"/?age_min=30&age_max=35&order_by=1&order_field=Age&limit=7&offset=3",
+		"/?query=an&gender=female&age_max=30&order_by=-1",
+		"/?age_min=40&age_max=30",
+		"/?ids=3,1,4,1,5,9,26&order_by=1&order_field=Age",
+		"/?id_from=10&id_to=20&query=an&order_by=-1&limit=4&offset=1",
+		"/?ids=1,x",
+		"/?query=name:an%20about:nulla&order_by=1&order_field=Id",
+		"/?query=wolf%20name:Boyd&order_by=-1",
+		"/?query=about:%22nulla%20cillum%22&order_by=-1",
+		"/?query=name:%25&order_by=-1",
+		"/?query=nulla%20NOT%20name:an&order_by=-1&limit=20",
+		"/?query=name:boyd%20OR%20(name:hilda%20AND%20about:nulla)&order_by=-1",
+		"/?query=wolf%20AND%20(mayer&order_by=-1",
+		"/?query=cillum%20nulla&order_by=-1&limit=20",
+		"/?query=%22Wolf%20Boyd%22%20OR%20%22nulla%20cillum%22&order_by=-1",
+	}
+	for caseNum, target := range cases {
+		expected := httptest.NewRecorder()
+		memory.ServeHTTP(expected, authorizedRequest(target))
+		got := httptest.NewRecorder()
+		backend.ServeHTTP(got, authorizedRequest(target))
+		if got.Code != expected.Code || got.Body.String() != expected.Body.String() {
+			t.Errorf("[%d] %s: expected %d %s, got %d %s", caseNum, target, expected.Code, expected.Body, got.Code, got.Body)
+		}
+	}
+}
+
+func TestSQLiteStorageMaxLimit(t *testing.T) {
+	s := &Server{Storage: newSQLiteStorage(t), MaxLimit: 4}
+	code, users := search(t, s, "token", "order_by=1&order_field=Id&limit=30")
+	if code != http.StatusOK || len(users) != 4 {
+		t.Errorf("expected 4 users, got %d (status %d)", len(users), code)
+	}
+}
+
+func authorizedRequest(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("AccessToken", "token")
+	return req
+}
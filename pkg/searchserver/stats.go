@@ -0,0 +1,117 @@
+package searchserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"hw4/pkg/searchclient"
+)
+
+// StatsPath - ручка статистики по датасету
+const StatsPath = "/stats"
+
+// StatsResponse - тело ответа /stats: сколько данных, насколько они свежие и похожи ли на правду
+type StatsResponse struct {
+	Rows int `json:"rows"`
+	// nil - данные в стороннем хранилище, когда они менялись, серверу не известно
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	// sha256 файла датасета, пустой - данные в стороннем хранилище
+	Checksum string `json:"checksum,omitempty"`
+	// nil - записей нет
+	MinID *int `json:"min_id,omitempty"`
+	MaxID *int `json:"max_id,omitempty"`
+	// распределение возраста по всем записям, нет, если FieldMask прячет Age от токена
+	AgeHistogram []searchclient.AgeBucket `json:"age_histogram,omitempty"`
+	Age          *searchclient.AgeStats   `json:"age,omitempty"`
+	// nil - данные в стороннем хранилище, индексы у него свои
+	Indexes *IndexStats `json:"indexes,omitempty"`
+}
+
+// IndexStats - размеры индексов датасета в памяти
+type IndexStats struct {
+	// IndexWords или IndexTrigrams
+	Kind     string `json:"kind"`
+	Terms    int    `json:"terms"`
+	Postings int    `json:"postings"`
+	// по скольким полям записи отсортированы заранее
+	SortFields int `json:"sort_fields"`
+	// сколько разных имён в дереве подсказок /suggest
+	SuggestNames int `json:"suggest_names"`
+}
+
+// stats собирает статистику: число записей и возраст - через те же агрегаты, что у /aggregate,
+// границы Id - поиском по Id, поэтому работает для всех хранилищ
+func (s *Server) stats(ctx context.Context, ageInterval int) (StatsResponse, error) {
+	aggs, err := s.aggregate(ctx, Query{Limit: -1}, ageInterval)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	resp := StatsResponse{Rows: aggs.Total, AgeHistogram: aggs.AgeHistogram, Age: aggs.Age}
+	for _, order := range []int{searchclient.OrderByAsc, searchclient.OrderByDesc} {
+		page, err := s.search(ctx, Query{Sort: []SortField{{Field: "Id", Order: order}}, Limit: 1})
+		if err != nil {
+			return StatsResponse{}, err
+		}
+		if len(page.Users) == 0 {
+			break
+		}
+		id := page.Users[0].Id
+		if order == searchclient.OrderByAsc {
+			resp.MinID = &id
+		} else {
+			resp.MaxID = &id
+		}
+	}
+	if s.Storage != nil {
+		return resp, nil
+	}
+	snapshot := s.store.Snapshot()
+	if snapshot == nil {
+		return resp, nil
+	}
+	loadedAt := snapshot.LoadedAt.UTC()
+	resp.LoadedAt, resp.Checksum = &loadedAt, s.ReloadStatus().Checksum
+	kind := snapshot.kind
+	if kind == "" {
+		kind = IndexWords
+	}
+	resp.Indexes = &IndexStats{Kind: kind, SortFields: len(snapshot.sorts), SuggestNames: len(snapshot.suggestions().names)}
+	resp.Indexes.Terms, resp.Indexes.Postings = snapshot.index.size()
+	return resp, nil
+}
+
+// serveStats - GET /stats?age_interval=5: число записей, время загрузки, границы Id, распределение возраста
+// и размеры индексов, чтобы мониторинг видел, что данные свежие и в своём уме
+func (s *Server) serveStats(w http.ResponseWriter, r *http.Request, mask FieldMask) {
+	ageInterval, err := ParseAgeInterval(r.URL.Query().Get("age_interval"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	resp, err := s.stats(ctx, ageInterval)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			JSONError(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "stats timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	if mask["Age"] != "" {
+		resp.AgeHistogram, resp.Age = nil, nil
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,88 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeStats(t *testing.T, s *Server, target, token string) (int, StatsResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("AccessToken", token)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var resp StatsResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("cant decode stats %s: %s", rec.Body, err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestServerStats(t *testing.T) {
+	cases := []struct {
+		Server *Server
+		Kind   string
+	}{
+		{Server: &Server{DatasetPath: datasetPath}, Kind: IndexWords},
+		{Server: &Server{DatasetPath: datasetPath, Index: IndexTrigrams}, Kind: IndexTrigrams},
+	}
+	for caseNum, testCase := range cases {
+		code, stats := decodeStats(t, testCase.Server, "/stats", "token")
+		if code != http.StatusOK {
+			t.Fatalf("[%d] expected 200, got %d", caseNum, code)
+		}
+		if stats.Rows != 35 || stats.MinID == nil || *stats.MinID != 0 || stats.MaxID == nil || *stats.MaxID != 34 {
+			t.Errorf("[%d] expected 35 rows with ids 0..34, got %+v", caseNum, stats)
+		}
+		if stats.LoadedAt == nil || stats.LoadedAt.IsZero() || stats.Checksum == "" {
+			t.Errorf("[%d] expected load time and checksum, got %+v", caseNum, stats)
+		}
+		counted := 0
+		for _, bucket := range stats.AgeHistogram {
+			counted += bucket.Count
+		}
+		if counted != 35 || stats.Age == nil || stats.Age.Min > stats.Age.Max {
+			t.Errorf("[%d] expected age distribution of 35 rows, got %+v %+v", caseNum, stats.AgeHistogram, stats.Age)
+		}
+		indexes := stats.Indexes
+		if indexes == nil || indexes.Kind != testCase.Kind || indexes.Terms == 0 || indexes.Postings < indexes.Terms || indexes.SortFields == 0 || indexes.SuggestNames != 35 {
+			t.Errorf("[%d] unexpected index stats %+v", caseNum, indexes)
+		}
+	}
+
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret"},
+		FieldMask:   FieldMask{"Age": MaskHide},
+	}
+	code, stats := decodeStats(t, s, "/v2/stats?age_interval=5", "r-secret")
+	if code != http.StatusOK || stats.Rows != 35 || stats.AgeHistogram != nil || stats.Age != nil {
+		t.Errorf("expected stats without ages for masked token, got %d %+v", code, stats)
+	}
+	if code, _ := decodeStats(t, s, "/stats?age_interval=0", "r-secret"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad age_interval, got %d", code)
+	}
+	if code, _ := decodeStats(t, s, "/stats", "bad"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for bad token, got %d", code)
+	}
+}
+
+func TestSQLiteStats(t *testing.T) {
+	s := &Server{Storage: newSQLiteStorage(t)}
+	code, stats := decodeStats(t, s, "/stats", "token")
+	if code != http.StatusOK || stats.Rows != 35 || stats.MinID == nil || *stats.MinID != 0 || stats.MaxID == nil || *stats.MaxID != 34 {
+		t.Fatalf("expected 35 rows with ids 0..34, got %d %+v", code, stats)
+	}
+	// время загрузки и индексы стороннего хранилища серверу не известны
+	if stats.LoadedAt != nil || stats.Indexes != nil || stats.Checksum != "" {
+		t.Errorf("expected no load time and indexes, got %+v", stats)
+	}
+	_, memory := decodeStats(t, &Server{DatasetPath: datasetPath}, "/stats", "token")
+	if len(stats.AgeHistogram) != len(memory.AgeHistogram) || *stats.Age != *memory.Age {
+		t.Errorf("expected the same ages as in memory, got %+v, want %+v", stats.AgeHistogram, memory.AgeHistogram)
+	}
+}
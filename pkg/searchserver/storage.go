@@ -0,0 +1,82 @@
+package searchserver
+
+import (
+	"context"
+	"slices"
+)
+
+// Query - разобранные и проверенные параметры поиска
+type Query struct {
+	// строка поиска по имени и описанию без учёта регистра (см. ParseSearchQuery), пустая - все записи
+	Query string
+	// ключи сортировки по порядку важности, пустой - порядок хранилища
+	Sort   []SortField
+	Offset int
+	// меньше нуля - без ограничения
+	Limit int
+	// сколько опечаток прощать в словах Query без кавычек, до MaxFuzziness; 0 - искать как написано
+	Fuzziness int `json:",omitempty"`
+	// искать без учёта диакритики: "muller" находит "Müller", а "müller" - "Muller"
+	IgnoreAccents bool `json:",omitempty"`
+	// синонимы слов Query, nil - без них. В QueryKey попадают уже раскрытыми в дереве запроса
+	Synonyms *Synonyms `json:"-"`
+
+	// Фильтры проверяются вместе с Query, до сортировки и страниц. У них omitempty,
+	// чтобы QueryKey запросов без фильтров не зависел от того, какие фильтры вообще бывают
+
+	// searchclient.GenderMale или searchclient.GenderFemale, пустой - любой
+	Gender string `json:",omitempty"`
+	// границы возраста включительно, nil - без границы
+	AgeMin *int `json:",omitempty"`
+	AgeMax *int `json:",omitempty"`
+	// только записи с этими Id, по возрастанию и без повторов; пустой - любые
+	IDs []int `json:",omitempty"`
+	// границы Id включительно, nil - без границы
+	IdFrom *int `json:",omitempty"`
+	IdTo   *int `json:",omitempty"`
+	// только запись с этим Guid, пустой - любые. Параметра поиска для него нет, он для GET /users/guid/{guid}
+	Guid string `json:",omitempty"`
+}
+
+// filtered - задан ли хоть один фильтр
+func (q Query) filtered() bool {
+	return q.Gender != "" || q.AgeMin != nil || q.AgeMax != nil || len(q.IDs) > 0 || q.IdFrom != nil || q.IdTo != nil || q.Guid != ""
+}
+
+// matchFilters - подходит ли запись под фильтры, Query тут не проверяется
+func (q Query) matchFilters(item *Item) bool {
+	return (q.Gender == "" || item.Gender == q.Gender) &&
+		(q.AgeMin == nil || item.Age >= *q.AgeMin) &&
+		(q.AgeMax == nil || item.Age <= *q.AgeMax) &&
+		(q.IdFrom == nil || item.Id >= *q.IdFrom) &&
+		(q.IdTo == nil || item.Id <= *q.IdTo) &&
+		(len(q.IDs) == 0 || q.hasID(item.Id)) &&
+		(q.Guid == "" || item.Guid == q.Guid)
+}
+
+func (q Query) hasID(id int) bool {
+	_, ok := slices.BinarySearch(q.IDs, id)
+	return ok
+}
+
+// SortField - ключ сортировки: поле Id, Age или Name и searchclient.OrderByAsc или searchclient.OrderByDesc
+type SortField struct {
+	Field string
+	Order int
+}
+
+// Page - страница результатов и сколько всего записей нашлось
+type Page struct {
+	Users []Item
+	Total int
+}
+
+// Storage - хранилище, которое умеет выполнять поиск целиком на своей стороне
+type Storage interface {
+	Search(ctx context.Context, query Query) (Page, error)
+}
+
+// Pinger - хранилище или кэш, которые умеют проверить, что до них можно достучаться. Используется /readyz
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
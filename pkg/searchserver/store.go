@@ -0,0 +1,327 @@
+package searchserver
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Индексы, которые можно строить при загрузке датасета
+const (
+	// IndexWords - InvertedIndex по словам, индекс по умолчанию
+	IndexWords = "words"
+	// IndexTrigrams - TrigramIndex, быстрее на произвольных подстроках, но занимает больше памяти
+	IndexTrigrams = "trigrams"
+)
+
+// candidateIndex сужает круг записей, которые надо проверить на совпадение с запросом
+type candidateIndex interface {
+	Candidates(query string) ([]int, bool)
+	// сколько в индексе термов и ссылок на записи, для /stats
+	size() (terms, postings int)
+}
+
+func newIndex(kind string, rows []Item) (candidateIndex, error) {
+	switch kind {
+	case "", IndexWords:
+		return NewInvertedIndex(rows), nil
+	case IndexTrigrams:
+		return NewTrigramIndex(rows), nil
+	}
+	return nil, fmt.Errorf("unknown index %q, expected %s or %s", kind, IndexWords, IndexTrigrams)
+}
+
+// Snapshot - загруженный датасет. После загрузки не меняется, поэтому его можно отдавать
+// одновременно многим запросам
+type Snapshot struct {
+	rows     []Item
+	index    candidateIndex
+	sorts    map[string]*sortIndex
+	LoadedAt time.Time
+	// sha256 файла, из которого снимок загружен, пустой - снимок собран не из файла
+	checksum string
+	// строки rows смотрят в отображённый в память файл, наружу отдаются только их копии
+	mapped bool
+	// индексы по Name для Collation, по языку
+	collated   map[string]*sortIndex
+	collatedMu sync.Mutex
+	// слова датасета для Query.Fuzziness, строятся при первом нечётком поиске
+	words     *bkTree
+	wordsOnce sync.Once
+	// средняя длина Name и About в словах для ScoreField, считается при первой сортировке по релевантности
+	avgName, avgAbout float64
+	lengthsOnce       sync.Once
+	// какой индекс строился, IndexWords или IndexTrigrams
+	kind string
+	// тот же снимок без диакритики для Query.IgnoreAccents, строится при первом таком запросе
+	plain     *Snapshot
+	plainOnce sync.Once
+	// снимки с основами слов About для Analyzer, по языку
+	analyzedByLang map[string]*Snapshot
+	analyzedMu     sync.Mutex
+	// каким Analyzer разобран About, nil - никаким
+	analyzer *Analyzer
+	// префиксное дерево имён для /suggest
+	suggest     *suggestTrie
+	suggestOnce sync.Once
+}
+
+// Root отдаёт копию строк датасета, которую можно сортировать и фильтровать, не трогая снимок
+func (s *Snapshot) Root() Root {
+	rows := make([]Item, len(s.rows))
+	copy(rows, s.rows)
+	s.detach(rows)
+	return Root{Row: rows}
+}
+
+// Search отдаёт записи, в имени или описании которых есть query, как Root.SearchItems,
+// но проверяет только записи, подходящие по индексу, и не приводит их к нижнему регистру заново
+func (s *Snapshot) Search(query string) Root {
+	if query == "" {
+		return s.Root()
+	}
+	positions, _ := s.find(context.Background(), Query{Query: query}, 0)
+	return Root{Row: s.rowsAt(positions)}
+}
+
+// find - номера записей, подходящих под query.Query и фильтры query, в порядке датасета.
+// Большие датасеты проверяются параллельно шардами, workers - сколько шардов максимум, <= 0 - по числу процессоров.
+// Если ctx отменят, поиск бросается и возвращает ctx.Err()
+func (s *Snapshot) find(ctx context.Context, query Query, workers int) ([]int, error) {
+	// файл снимка нельзя отпустить, пока проверяются его строки
+	defer runtime.KeepAlive(s)
+	tree := s.searchTree(query)
+	match := func(item *Item) bool {
+		return (tree == nil || tree.match(item.nameLower, item.aboutLower)) && query.matchFilters(item)
+	}
+	if positions, ok := tree.candidates(s.index); ok {
+		return matchSharded(ctx, len(positions), workers, func(from, to int, results []int) []int {
+			for _, pos := range positions[from:to] {
+				if match(&s.rows[pos]) {
+					results = append(results, pos)
+				}
+			}
+			return results
+		})
+	}
+	return matchSharded(ctx, len(s.rows), workers, func(from, to int, results []int) []int {
+		for pos := from; pos < to; pos++ {
+			if match(&s.rows[pos]) {
+				results = append(results, pos)
+			}
+		}
+		return results
+	})
+}
+
+// searchTree - дерево query.Query, с Fuzziness - уже с похожими словами снимка, у снимка с Analyzer -
+// ещё и с основами слов
+func (s *Snapshot) searchTree(query Query) *queryNode {
+	tree := query.searchTree()
+	if query.Fuzziness > 0 {
+		tree = tree.fuzzy(query.Fuzziness, s.fuzzyWords().within)
+	}
+	if s.analyzer != nil {
+		tree = tree.analyzed(s.analyzer)
+	}
+	return tree
+}
+
+// unaccented - снимок для поиска без учёта диакритики: те же записи под теми же номерами,
+// но nameLower и aboutLower ещё и после stripAccents. Строки записей он берёт у s, поэтому
+// отображённый файл держит s: пока идёт поиск по такому снимку, s должен быть жив
+func (s *Snapshot) unaccented() *Snapshot {
+	s.plainOnce.Do(func() {
+		rows := make([]Item, len(s.rows))
+		copy(rows, s.rows)
+		for i := range rows {
+			rows[i].nameLower = stripAccents(rows[i].nameLower)
+			rows[i].aboutLower = stripAccents(rows[i].aboutLower)
+		}
+		s.plain = s.derived(rows, s.analyzer)
+	})
+	return s.plain
+}
+
+// analyzed - снимок для поиска с анализатором a: те же записи под теми же номерами, но в aboutLower
+// после analyzedSeparator ещё и основы слов About. Строится при первом обращении и живёт, пока жив s.
+// Строки записей, как и у unaccented, он берёт у s
+func (s *Snapshot) analyzed(a *Analyzer) *Snapshot {
+	s.analyzedMu.Lock()
+	defer s.analyzedMu.Unlock()
+	snapshot, ok := s.analyzedByLang[a.String()]
+	if !ok {
+		rows := make([]Item, len(s.rows))
+		copy(rows, s.rows)
+		for i := range rows {
+			rows[i].aboutLower += analyzedSeparator + a.analyze(rows[i].aboutLower)
+		}
+		snapshot = s.derived(rows, a)
+		if s.analyzedByLang == nil {
+			s.analyzedByLang = map[string]*Snapshot{}
+		}
+		s.analyzedByLang[a.String()] = snapshot
+	}
+	return snapshot
+}
+
+// derived - снимок с записями s под теми же номерами, но другими nameLower и aboutLower.
+// Порядки сортировки от них не зависят и берутся у s, индекс для поиска строится заново
+func (s *Snapshot) derived(rows []Item, analyzer *Analyzer) *Snapshot {
+	// kind уже проверен, когда строился s
+	index, _ := newIndex(s.kind, rows)
+	return &Snapshot{rows: rows, index: index, sorts: s.sorts, LoadedAt: s.LoadedAt, mapped: s.mapped, kind: s.kind, analyzer: analyzer}
+}
+
+// fuzzyWords - BK-дерево слов снимка
+func (s *Snapshot) fuzzyWords() *bkTree {
+	s.wordsOnce.Do(func() { s.words = newBKTree(s.rows) })
+	return s.words
+}
+
+// rowsAt копирует записи с номерами positions. Записи копируются только здесь, в самом конце,
+// до этого поиск, сортировка и страницы работают с номерами
+func (s *Snapshot) rowsAt(positions []int) []Item {
+	if positions == nil {
+		return nil
+	}
+	rows := make([]Item, len(positions))
+	for i, pos := range positions {
+		rows[i] = s.rows[pos]
+	}
+	s.detach(rows)
+	return rows
+}
+
+// detach отвязывает скопированные записи от отображённого файла снимка
+func (s *Snapshot) detach(rows []Item) {
+	if !s.mapped {
+		return
+	}
+	for i := range rows {
+		rows[i].detach()
+	}
+	runtime.KeepAlive(s)
+}
+
+// all - номера всех записей по порядку
+func (s *Snapshot) all() []int {
+	positions := make([]int, len(s.rows))
+	for i := range positions {
+		positions[i] = i
+	}
+	return positions
+}
+
+// Len - сколько записей в датасете
+func (s *Snapshot) Len() int {
+	return len(s.rows)
+}
+
+// Store хранит текущий снимок датасета. Поиски берут снимок через Snapshot, перезагрузка подменяет
+// его целиком через Swap - читатели и писатели не ждут друг друга и не гоняются за данными
+type Store struct {
+	current atomic.Pointer[Snapshot]
+}
+
+// Snapshot - текущий снимок, nil - датасет ещё не загружен
+func (s *Store) Snapshot() *Snapshot {
+	return s.current.Load()
+}
+
+// Swap делает root текущим датасетом с индексом по словам. Уже выданные снимки остаются прежними
+func (s *Store) Swap(root Root) *Snapshot {
+	snapshot, _ := s.SwapIndexed(root, IndexWords)
+	return snapshot
+}
+
+// SwapIndexed - Swap с индексом IndexWords или IndexTrigrams
+func (s *Store) SwapIndexed(root Root, kind string) (*Snapshot, error) {
+	return s.swapIndexed(root, kind, "")
+}
+
+// swapIndexed - SwapIndexed, который запоминает в снимке sha256 файла датасета
+func (s *Store) swapIndexed(root Root, kind, checksum string) (*Snapshot, error) {
+	rows := make([]Item, len(root.Row))
+	copy(rows, root.Row)
+	for i := range rows {
+		rows[i].prepare()
+		rows[i].pos = i
+	}
+	snapshot, err := newSnapshot(rows, kind)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.checksum = checksum
+	s.current.Store(snapshot)
+	return snapshot, nil
+}
+
+// SwapMapped делает текущим бинарный датасет (см. WriteBinaryDataset), отображая файл в память вместо чтения.
+// Процессы с одним файлом делят его страницы в page cache. Файл отпускается, когда старый снимок
+// больше никому не нужен; сам файл на месте менять нельзя, только подменять новым
+func (s *Store) SwapMapped(filename string, kind string) (*Snapshot, error) {
+	snapshot, err := openMapped(filename, kind, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(snapshot)
+	return snapshot, nil
+}
+
+// openMapped - снимок по отображённому бинарному датасету, ещё не ставший текущим.
+// check, если задан, проверяет и может отфильтровать записи до построения индексов
+func openMapped(filename string, kind string, check func([]Item) ([]Item, error)) (*Snapshot, error) {
+	data, unmap, err := mapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decodeBinary(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("failed to parse binary dataset: %w", err)
+	}
+	if len(rows) == 0 {
+		unmap()
+		return nil, fmt.Errorf("dataset %s is empty", filename)
+	}
+	if check != nil {
+		if rows, err = check(rows); err != nil {
+			unmap()
+			return nil, err
+		}
+		for i := range rows {
+			rows[i].pos = i
+		}
+	}
+	snapshot, err := newSnapshot(rows, kind)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	snapshot.mapped = true
+	runtime.SetFinalizer(snapshot, func(*Snapshot) { unmap() })
+	return snapshot, nil
+}
+
+// version - чем снимок отличается от других загрузок датасета: sha256 файла, а если его нет - время загрузки.
+// Одинаковый у реплик с одним и тем же файлом
+func (s *Snapshot) version() string {
+	if s.checksum != "" {
+		return s.checksum
+	}
+	return strconv.FormatInt(s.LoadedAt.UnixNano(), 10)
+}
+
+// newSnapshot строит индексы по записям после prepare
+func newSnapshot(rows []Item, kind string) (*Snapshot, error) {
+	index, err := newIndex(kind, rows)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{rows: rows, index: index, sorts: newSortIndexes(rows), LoadedAt: time.Now(), kind: kind}, nil
+}
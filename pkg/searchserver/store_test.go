@@ -0,0 +1,65 @@
+package searchserver
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStoreSnapshotIsImmutable(t *testing.T) {
+	var store Store
+	if store.Snapshot() != nil {
+		t.Fatal("expected nil snapshot before first swap")
+	}
+
+	root := Root{Row: []Item{{Id: 2}, {Id: 1}}}
+	snapshot := store.Swap(root)
+	// ни исходный Root, ни выданные копии не влияют на снимок
+	root.Row[0].Id = 100
+	copied := snapshot.Root()
+	copied.Row[0].Id = 200
+	copied.SortRootBy([]string{"Id:1"})
+
+	if got := store.Snapshot().Root().Row; got[0].Id != 2 || got[1].Id != 1 {
+		t.Errorf("snapshot was modified: %+v", got)
+	}
+
+	store.Swap(Root{Row: []Item{{Id: 3}}})
+	if snapshot.Len() != 2 || store.Snapshot().Len() != 1 {
+		t.Errorf("expected old snapshot to survive swap, got %d and %d rows", snapshot.Len(), store.Snapshot().Len())
+	}
+}
+
+func TestStoreConcurrentSwap(t *testing.T) {
+	var store Store
+	store.Swap(Root{Row: []Item{{Id: 0}}})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			store.Swap(Root{Row: []Item{{Id: id}, {Id: id}}})
+		}(i)
+		go func() {
+			defer wg.Done()
+			root := store.Snapshot().Root()
+			root.SearchItems("")
+			if len(root.Row) > 0 && root.Row[0].Id != root.Row[len(root.Row)-1].Id {
+				t.Errorf("snapshot mixes two datasets: %+v", root.Row)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStorePreparesItems(t *testing.T) {
+	var store Store
+	snapshot := store.Swap(Root{Row: []Item{{FirstName: "Иван", LastName: "Петров", About: "Любит GO"}}})
+	item := snapshot.Root().Row[0]
+	if item.Name != "Иван Петров" || item.nameLower != "иван петров" || item.aboutLower != "любит go" {
+		t.Errorf("expected prepared item, got %+v", item)
+	}
+	if found := snapshot.Search("ИВАН П"); len(found.Row) != 1 {
+		t.Errorf("expected case-insensitive match, got %+v", found.Row)
+	}
+}
@@ -0,0 +1,178 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// сколько подсказок отдавать без limit и сколько максимум
+const (
+	DefaultSuggestLimit = 10
+	MaxSuggestLimit     = 100
+)
+
+// suggestTrie - префиксное дерево по Name для подсказок: имя находится по началу любого своего слова
+// после foldCase: "bo", "wo" и "boyd w" находят "Boyd Wolf", а "olf" и "wolf b" - нет.
+// Одинаковые имена хранятся один раз вместе с числом записей с ними
+type suggestTrie struct {
+	root   *trieNode
+	names  []string
+	counts []int
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// имена, у которых здесь кончается хвост от начала слова
+	names []int
+}
+
+// newSuggestTrie строит дерево по записям после prepare
+func newSuggestTrie(rows []Item) *suggestTrie {
+	t := &suggestTrie{root: &trieNode{}}
+	byName := map[string]int{}
+	for i := range rows {
+		name := strings.Join(strings.Fields(rows[i].nameLower), " ")
+		if name == "" {
+			continue
+		}
+		if id, ok := byName[name]; ok {
+			t.counts[id]++
+			continue
+		}
+		id := len(t.names)
+		byName[name] = id
+		// строки отображённого снимка дерево переживают, поэтому копируются
+		t.names = append(t.names, strings.Clone(rows[i].Name))
+		t.counts = append(t.counts, 1)
+		for start := 0; start < len(name); {
+			t.add(name[start:], id)
+			next := strings.IndexByte(name[start:], ' ')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+	return t
+}
+
+func (t *suggestTrie) add(text string, id int) {
+	node := t.root
+	for _, r := range text {
+		child, ok := node.children[r]
+		if !ok {
+			if node.children == nil {
+				node.children = map[rune]*trieNode{}
+			}
+			child = &trieNode{}
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.names = append(node.names, id)
+}
+
+// suggest - до limit имён, у которых какое-то слово начинается с prefix, сначала те, что у большего числа записей,
+// равные - по алфавиту
+func (t *suggestTrie) suggest(prefix string, limit int) []searchclient.Suggestion {
+	node := t.root
+	for _, r := range prefix {
+		if node = node.children[r]; node == nil {
+			return []searchclient.Suggestion{}
+		}
+	}
+	found := map[int]bool{}
+	stack := []*trieNode{node}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, id := range node.names {
+			found[id] = true
+		}
+		for _, child := range node.children {
+			stack = append(stack, child)
+		}
+	}
+	ids := make([]int, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if t.counts[ids[i]] != t.counts[ids[j]] {
+			return t.counts[ids[i]] > t.counts[ids[j]]
+		}
+		return t.names[ids[i]] < t.names[ids[j]]
+	})
+	suggestions := make([]searchclient.Suggestion, 0, min(limit, len(ids)))
+	for _, id := range ids[:min(limit, len(ids))] {
+		suggestions = append(suggestions, searchclient.Suggestion{Name: t.names[id], Count: t.counts[id]})
+	}
+	return suggestions
+}
+
+// suggestPrefix - prefix после foldCase и с одиночными пробелами. Пробел в конце остаётся:
+// "boyd " ищет фамилии после Boyd, а не имена, которые начинаются с boyd
+func suggestPrefix(prefix string) string {
+	folded := strings.Join(strings.Fields(foldCase(prefix)), " ")
+	if folded != "" && strings.TrimRight(prefix, " \t") != prefix {
+		folded += " "
+	}
+	return folded
+}
+
+// ParseSuggestLimit разбирает limit подсказок, пустой - DefaultSuggestLimit, больше MaxSuggestLimit - MaxSuggestLimit
+func ParseSuggestLimit(value string) (int, error) {
+	if value == "" {
+		return DefaultSuggestLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, &ServerError{Code: searchclient.CodeBadLimit, Message: fmt.Sprintf("invalid limit: %s, expected positive number", value), Field: "limit"}
+	}
+	return min(limit, MaxSuggestLimit), nil
+}
+
+// suggestions - дерево подсказок снимка, строится один раз
+func (s *Snapshot) suggestions() *suggestTrie {
+	s.suggestOnce.Do(func() { s.suggest = newSuggestTrie(s.rows) })
+	return s.suggest
+}
+
+// serveSuggest - GET /suggest?prefix=bo&limit=5: имена для подсказок при вводе по датасету в памяти.
+// Имена, которые токен без pii:read не видит в поиске, он не видит и здесь
+func (s *Server) serveSuggest(w http.ResponseWriter, r *http.Request, mask FieldMask) {
+	if mask["Name"] != "" {
+		JSONError(w, r, "token has no "+ScopePIIRead+" scope", searchclient.CodeForbidden, http.StatusForbidden)
+		return
+	}
+	if s.Storage != nil {
+		JSONError(w, r, "suggest needs the dataset in memory", searchclient.CodeNotFound, http.StatusNotFound)
+		return
+	}
+	params := r.URL.Query()
+	prefix := suggestPrefix(params.Get("prefix"))
+	if prefix == "" {
+		JSONError(w, r, &ServerError{Code: searchclient.CodeBadQuery, Message: "prefix must not be empty", Field: "prefix"}, searchclient.CodeBadQuery, http.StatusBadRequest)
+		return
+	}
+	limit, err := ParseSuggestLimit(params.Get("limit"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadLimit, http.StatusBadRequest)
+		return
+	}
+	snapshot, err := s.loadDataset()
+	if err != nil {
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	suggestions := snapshot.suggestions().suggest(prefix, limit)
+	noteResults(r.Context(), len(suggestions), len(suggestions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
@@ -0,0 +1,142 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestSuggestTrie(t *testing.T) {
+	rows := []Item{
+		{FirstName: "Boyd", LastName: "Wolf"},
+		{FirstName: "Bob", LastName: "Jones"},
+		{FirstName: "Bob", LastName: "Jones"},
+		{FirstName: "Anna", LastName: "Bobrova"},
+		{FirstName: "Ölaf", LastName: "Straße"},
+	}
+	for i := range rows {
+		rows[i].prepare()
+	}
+	trie := newSuggestTrie(rows)
+	cases := []struct {
+		Prefix   string
+		Limit    int
+		Expected []searchclient.Suggestion
+	}{
+		{Prefix: "bo", Limit: 10, Expected: []searchclient.Suggestion{{Name: "Bob Jones", Count: 2}, {Name: "Anna Bobrova", Count: 1}, {Name: "Boyd Wolf", Count: 1}}},
+		{Prefix: "bo", Limit: 1, Expected: []searchclient.Suggestion{{Name: "Bob Jones", Count: 2}}},
+		{Prefix: "boyd w", Limit: 10, Expected: []searchclient.Suggestion{{Name: "Boyd Wolf", Count: 1}}},
+		{Prefix: "bob ", Limit: 10, Expected: []searchclient.Suggestion{{Name: "Bob Jones", Count: 2}}},
+		{Prefix: "olf", Limit: 10, Expected: []searchclient.Suggestion{}},
+		{Prefix: "wolf b", Limit: 10, Expected: []searchclient.Suggestion{}},
+		{Prefix: "öl", Limit: 10, Expected: []searchclient.Suggestion{{Name: "Ölaf Straße", Count: 1}}},
+		{Prefix: "strass", Limit: 10, Expected: []searchclient.Suggestion{{Name: "Ölaf Straße", Count: 1}}},
+	}
+	for caseNum, testCase := range cases {
+		if got := trie.suggest(testCase.Prefix, testCase.Limit); !reflect.DeepEqual(got, testCase.Expected) {
+			t.Errorf("[%d] %q: expected %v, got %v", caseNum, testCase.Prefix, testCase.Expected, got)
+		}
+	}
+}
+
+func TestSuggestPrefix(t *testing.T) {
+	cases := []struct {
+		Prefix   string
+		Expected string
+	}{
+		{Prefix: "Bo", Expected: "bo"},
+		{Prefix: "  BOYD   W", Expected: "boyd w"},
+		{Prefix: "boyd ", Expected: "boyd "},
+		{Prefix: "   ", Expected: ""},
+	}
+	for caseNum, testCase := range cases {
+		if got := suggestPrefix(testCase.Prefix); got != testCase.Expected {
+			t.Errorf("[%d] expected %q, got %q", caseNum, testCase.Expected, got)
+		}
+	}
+}
+
+func TestServerSuggest(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"About": MaskRedact},
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Expected []string
+	}{
+		{Target: "/suggest?prefix=bo", Token: "r-secret", Status: http.StatusOK, Expected: []string{"Boyd Wolf"}},
+		{Target: "/v2/suggest?prefix=MA", Token: "r-secret", Status: http.StatusOK, Expected: []string{"Henderson Maxwell", "Hilda Mayer", "Jennings Mays"}},
+		{Target: "/suggest?prefix=b&limit=2", Token: "r-secret", Status: http.StatusOK, Expected: []string{"Bell Bauer", "Beth Wynn"}},
+		{Target: "/suggest?prefix=zzz", Token: "r-secret", Status: http.StatusOK, Expected: []string{}},
+		{Target: "/suggest?prefix=", Token: "r-secret", Status: http.StatusBadRequest},
+		{Target: "/suggest?prefix=bo&limit=-1", Token: "r-secret", Status: http.StatusBadRequest},
+		{Target: "/suggest?prefix=bo", Token: "bad", Status: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", caseNum, testCase.Status, rec.Code, rec.Body)
+			continue
+		}
+		if testCase.Status != http.StatusOK {
+			continue
+		}
+		var suggestions []searchclient.Suggestion
+		if err := json.Unmarshal(rec.Body.Bytes(), &suggestions); err != nil {
+			t.Fatalf("[%d] cant decode suggestions: %s", caseNum, err)
+		}
+		names := []string{}
+		for _, suggestion := range suggestions {
+			names = append(names, suggestion.Name)
+		}
+		if !reflect.DeepEqual(names, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v", caseNum, testCase.Expected, names)
+		}
+	}
+
+	// имена под маской в подсказках не выдаются
+	masked := &Server{DatasetPath: datasetPath, FieldMask: FieldMask{"Name": MaskHide}}
+	req := httptest.NewRequest(http.MethodGet, "/suggest?prefix=bo", nil)
+	req.Header.Set("AccessToken", "token")
+	rec := httptest.NewRecorder()
+	masked.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected %d for masked names, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	external := &Server{Storage: slowStorage{}}
+	rec = httptest.NewRecorder()
+	external.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected %d for external storage, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestSnapshotSuggestionsAfterSwap(t *testing.T) {
+	var root Root
+	if err := root.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	var store Store
+	snapshot := store.Swap(root)
+	got := snapshot.suggestions().suggest("wo", 10)
+	if !reflect.DeepEqual(got, []searchclient.Suggestion{{Name: "Boyd Wolf", Count: 1}}) {
+		t.Errorf("expected Boyd Wolf, got %v", got)
+	}
+	// дерево строится один раз на снимок
+	if snapshot.suggestions() != snapshot.suggestions() {
+		t.Error("expected the same trie")
+	}
+}
@@ -0,0 +1,92 @@
+package searchserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Synonyms - словарь синонимов: слово запроса ищется вместе со всеми своими синонимами.
+// Раскрывается в дереве запроса, поэтому работает для всех Storage
+type Synonyms struct {
+	// терм после foldCase - все термы его групп, кроме него самого, по алфавиту
+	groups map[string][]string
+}
+
+// LoadSynonyms читает словарь синонимов из файла, формат - как у ParseSynonyms
+func LoadSynonyms(filename string) (*Synonyms, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cant open synonyms: %w", err)
+	}
+	defer file.Close()
+	return ParseSynonyms(file)
+}
+
+// ParseSynonyms разбирает словарь синонимов: в строке группа равнозначных термов через "=" или ",",
+// например "bob=robert" или "ny, new york". Слово из нескольких групп ищется вместе со всеми ними.
+// Пустые строки и строки с # пропускаются, регистр не важен
+func ParseSynonyms(r io.Reader) (*Synonyms, error) {
+	s := &Synonyms{groups: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var terms []string
+		for _, term := range strings.FieldsFunc(text, func(r rune) bool { return r == '=' || r == ',' }) {
+			if term = strings.Join(strings.Fields(foldCase(term)), " "); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) < 2 {
+			return nil, fmt.Errorf("synonyms line %d: expected at least two terms, got %q", line, text)
+		}
+		for _, term := range terms {
+			for _, synonym := range terms {
+				if synonym != term && !slices.Contains(s.groups[term], synonym) {
+					s.groups[term] = append(s.groups[term], synonym)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cant read synonyms: %w", err)
+	}
+	for _, synonyms := range s.groups {
+		sort.Strings(synonyms)
+	}
+	return s, nil
+}
+
+// withSynonyms - дерево, в котором терм из словаря заменён на OR из него самого и его синонимов в том же поле.
+// Синоним из нескольких слов ищется фразой, а сам такой терм находится только фразой в кавычках:
+// без кавычек каждое слово запроса - отдельный терм
+func (n *queryNode) withSynonyms(s *Synonyms) *queryNode {
+	if n == nil {
+		return nil
+	}
+	if n.Op != "" {
+		node := &queryNode{Op: n.Op, Children: make([]*queryNode, len(n.Children))}
+		for i, child := range n.Children {
+			node.Children[i] = child.withSynonyms(s)
+		}
+		return node
+	}
+	synonyms := s.groups[n.Term.Text]
+	if len(synonyms) == 0 {
+		return n
+	}
+	node := &queryNode{Op: queryOr, Children: []*queryNode{n}}
+	for _, synonym := range synonyms {
+		node.Children = append(node.Children, &queryNode{Term: queryTerm{Field: n.Term.Field, Text: synonym, Phrase: strings.Contains(synonym, " ")}})
+	}
+	return node
+}
@@ -0,0 +1,124 @@
+package searchserver
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSynonyms(t *testing.T) {
+	cases := []struct {
+		Text     string
+		Expected map[string][]string
+		IsError  bool
+	}{
+		{
+			Text:     "bob=robert",
+			Expected: map[string][]string{"bob": {"robert"}, "robert": {"bob"}},
+		},
+		{
+			Text: "# имена\n\nBob = Robert = Rob\nrob, bobby\n",
+			Expected: map[string][]string{
+				"bob":    {"rob", "robert"},
+				"robert": {"bob", "rob"},
+				"rob":    {"bob", "bobby", "robert"},
+				"bobby":  {"rob"},
+			},
+		},
+		{
+			Text:     "NY,  New   York",
+			Expected: map[string][]string{"ny": {"new york"}, "new york": {"ny"}},
+		},
+		{Text: "bob", IsError: true},
+		{Text: "bob=robert\n= ,", IsError: true},
+	}
+	for caseNum, testCase := range cases {
+		synonyms, err := ParseSynonyms(strings.NewReader(testCase.Text))
+		if testCase.IsError {
+			if err == nil {
+				t.Errorf("[%d] expected error", caseNum)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(synonyms.groups, testCase.Expected) {
+			t.Errorf("[%d] expected %v, got %v %v", caseNum, testCase.Expected, synonyms, err)
+		}
+	}
+
+	if _, err := LoadSynonyms(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestSynonymsTree(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("bob=robert\nny=new york"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{Query: "bob", Expected: `OR("bob", "robert")`},
+		{Query: "name:BOB", Expected: `OR(name:"bob", name:"robert")`},
+		{Query: "ny NOT bob", Expected: `AND(OR("ny", PHRASE("new york")), NOT(OR("bob", "robert")))`},
+		{Query: `"new york"`, Expected: `OR(PHRASE("new york"), "ny")`},
+		{Query: "new york", Expected: `AND("new", "york")`},
+	}
+	for caseNum, testCase := range cases {
+		if got := (Query{Query: testCase.Query, Synonyms: synonyms}).searchTree().String(); got != testCase.Expected {
+			t.Errorf("[%d] %s: expected %s, got %s", caseNum, testCase.Query, testCase.Expected, got)
+		}
+	}
+
+	// одинаковый запрос с синонимами и без - разные записи кэша
+	if QueryKey(Query{Query: "bob"}) == QueryKey(Query{Query: "bob", Synonyms: synonyms}) {
+		t.Error("expected synonyms in query key")
+	}
+}
+
+func TestServerSynonyms(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dataset.xml")
+	dataset := `<root>
+		<row><id>1</id><first_name>Robert</first_name><last_name>Smith</last_name><about>Lives in New York</about></row>
+		<row><id>2</id><first_name>Bob</first_name><last_name>Jones</last_name><about>Lives in NY</about></row>
+		<row><id>3</id><first_name>Anna</first_name><last_name>Brown</last_name><about>Lives in Boston</about></row>
+	</root>`
+	if err := os.WriteFile(path, []byte(dataset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	synonyms, err := ParseSynonyms(strings.NewReader("bob=robert\nny=new york"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Synonyms *Synonyms
+		Query    string
+		Expected []int
+	}{
+		{Synonyms: nil, Query: "bob", Expected: []int{2}},
+		{Synonyms: synonyms, Query: "bob", Expected: []int{1, 2}},
+		{Synonyms: synonyms, Query: "ROBERT", Expected: []int{1, 2}},
+		{Synonyms: synonyms, Query: "about:ny", Expected: []int{1, 2}},
+		{Synonyms: synonyms, Query: "lives NOT ny", Expected: []int{3}},
+	}
+	for caseNum, testCase := range cases {
+		s := &Server{DatasetPath: path, Synonyms: testCase.Synonyms}
+		params := url.Values{"query": {testCase.Query}, "order_field": {"Id"}, "order_by": {"-1"}}
+		code, users := search(t, s, "token", params.Encode())
+		if code != http.StatusOK || !reflect.DeepEqual(userIds(users), testCase.Expected) {
+			t.Errorf("[%d] %s: expected %v, got %v (status %d)", caseNum, testCase.Query, testCase.Expected, userIds(users), code)
+		}
+	}
+
+	s := &Server{DatasetPath: path, Synonyms: synonyms}
+	_, users := search(t, s, "token", "query=bob&highlight=true&order_field=Id&order_by=-1")
+	if len(users) != 2 || users[0].Highlight["Name"] != "<em>Robert</em> Smith" || users[1].Highlight["Name"] != "<em>Bob</em> Jones" {
+		t.Errorf("expected synonyms highlighted, got %+v", users)
+	}
+}
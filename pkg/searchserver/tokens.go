@@ -0,0 +1,86 @@
+package searchserver
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultClientName - имя клиента с единственным токеном Server.Token
+const DefaultClientName = "default"
+
+// LoadTokens читает файл токенов: по строке на клиента, сначала имя, потом через пробел токен
+// и, если нужно, scope через запятую - они попадают в scopes. Пустые строки и строки с # в начале пропускаются
+func LoadTokens(filename string) (tokens map[string]string, scopes map[string][]string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant open tokens file: %w", err)
+	}
+	defer file.Close()
+
+	tokens, scopes = map[string]string{}, map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, nil, fmt.Errorf("%s:%d: expected client name, token and optional scopes", filename, line)
+		}
+		if _, ok := tokens[fields[0]]; ok {
+			return nil, nil, fmt.Errorf("%s:%d: duplicate client %q", filename, line, fields[0])
+		}
+		tokens[fields[0]] = fields[1]
+		if len(fields) == 3 {
+			scopes[fields[0]] = ParseScopes(fields[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("cant read tokens file: %w", err)
+	}
+	return tokens, scopes, nil
+}
+
+// errBadToken - токен не подошёл
+var errBadToken = errors.New("Bad AccessToken")
+
+// authenticate - кто прислал токен: имя клиента (для JWT - его sub) и его scope.
+// Если ни Token, ни Tokens, ни JWT не заданы, подходит любой непустой токен, а имя пустое
+func (s *Server) authenticate(token string) (identity, error) {
+	if token == "" {
+		return identity{}, errBadToken
+	}
+	if s.Token == "" && len(s.Tokens) == 0 && s.JWT == nil {
+		return identity{scopes: DefaultScopes}, nil
+	}
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 {
+		return identity{client: DefaultClientName, scopes: s.clientScopes(DefaultClientName)}, nil
+	}
+	// проверяем все токены, чтобы по времени ответа нельзя было понять, с какого начинается подходящий
+	name, found := "", false
+	for client, clientToken := range s.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(clientToken)) == 1 {
+			name, found = client, true
+		}
+	}
+	if found {
+		return identity{client: name, scopes: s.clientScopes(name)}, nil
+	}
+	if s.JWT != nil && LooksLikeJWT(token) {
+		claims, err := s.JWT.Validate(token)
+		if err != nil {
+			return identity{}, fmt.Errorf("%w: %s", errBadToken, err)
+		}
+		id := identity{client: claims.Subject, scopes: claims.Scopes}
+		if len(id.scopes) == 0 {
+			id.scopes = DefaultScopes
+		}
+		return id, nil
+	}
+	return identity{}, errBadToken
+}
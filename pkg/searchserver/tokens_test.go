@@ -0,0 +1,86 @@
+package searchserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		Content        string
+		Expected       map[string]string
+		ExpectedScopes map[string][]string
+	}{
+		{Content: "# клиенты\nmobile  m-secret\n\nweb\tw-secret\n", Expected: map[string]string{"mobile": "m-secret", "web": "w-secret"}, ExpectedScopes: map[string][]string{}},
+		{Content: "", Expected: map[string]string{}, ExpectedScopes: map[string][]string{}},
+		{
+			Content:        "reader r-secret\nops o-secret admin,search:read\n",
+			Expected:       map[string]string{"reader": "r-secret", "ops": "o-secret"},
+			ExpectedScopes: map[string][]string{"ops": {"admin", "search:read"}},
+		},
+		{Content: "mobile\n"},
+		{Content: "mobile a b c\n"},
+		{Content: "mobile a\nmobile b\n"},
+	}
+	for caseNum, testCase := range cases {
+		filename := filepath.Join(dir, "tokens.txt")
+		if err := os.WriteFile(filename, []byte(testCase.Content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		tokens, scopes, err := LoadTokens(filename)
+		if testCase.Expected == nil {
+			if err == nil {
+				t.Errorf("[%d] expected error, got %v", caseNum, tokens)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(tokens, testCase.Expected) || !reflect.DeepEqual(scopes, testCase.ExpectedScopes) {
+			t.Errorf("[%d] expected %v %v, got %v %v (%v)", caseNum, testCase.Expected, testCase.ExpectedScopes, tokens, scopes, err)
+		}
+	}
+	if _, _, err := LoadTokens(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestServerTokens(t *testing.T) {
+	var out bytes.Buffer
+	s := &Server{DatasetPath: datasetPath, Token: "main", Tokens: map[string]string{"mobile": "m-secret", "web": "w-secret"}}
+	handler := &AccessLog{Handler: s, Logger: slog.New(slog.NewJSONHandler(&out, nil))}
+	cases := []struct {
+		Sent           string
+		ExpectedCode   int
+		ExpectedClient interface{}
+	}{
+		{Sent: "main", ExpectedCode: http.StatusOK, ExpectedClient: DefaultClientName},
+		{Sent: "m-secret", ExpectedCode: http.StatusOK, ExpectedClient: "mobile"},
+		{Sent: "w-secret", ExpectedCode: http.StatusOK, ExpectedClient: "web"},
+		{Sent: "anything", ExpectedCode: http.StatusUnauthorized},
+		{Sent: "m-secre", ExpectedCode: http.StatusUnauthorized},
+	}
+	for caseNum, testCase := range cases {
+		out.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/?limit=1&order_by=-1", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.Sent)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.ExpectedCode {
+			t.Errorf("[%d] expected %d, got %d", caseNum, testCase.ExpectedCode, rec.Code)
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["client"] != testCase.ExpectedClient {
+			t.Errorf("[%d] expected client %v in log, got %v", caseNum, testCase.ExpectedClient, record["client"])
+		}
+	}
+}
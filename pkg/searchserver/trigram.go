@@ -0,0 +1,85 @@
+package searchserver
+
+// TrigramIndex - тройки подряд идущих символов из Name и About после foldCase и номера записей с ними.
+// В отличие от InvertedIndex находит и подстроки через границы слов, но только для запросов от трёх символов
+type TrigramIndex struct {
+	postings map[string][]int
+}
+
+// NewTrigramIndex строит индекс по записям после prepare, номер записи - её позиция в rows
+func NewTrigramIndex(rows []Item) *TrigramIndex {
+	index := &TrigramIndex{postings: map[string][]int{}}
+	for pos, item := range rows {
+		// поля индексируются по отдельности: совпадение на стыке имени и описания не считается
+		for _, text := range []string{item.nameLower, item.aboutLower} {
+			for _, trigram := range trigrams(text) {
+				postings := index.postings[trigram]
+				if len(postings) > 0 && postings[len(postings)-1] == pos {
+					continue
+				}
+				index.postings[trigram] = append(postings, pos)
+			}
+		}
+	}
+	return index
+}
+
+func trigrams(text string) []string {
+	runes := []rune(text)
+	if len(runes) < 3 {
+		return nil
+	}
+	result := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		result = append(result, string(runes[i:i+3]))
+	}
+	return result
+}
+
+func (ix *TrigramIndex) size() (int, int) {
+	postings := 0
+	for _, positions := range ix.postings {
+		postings += len(positions)
+	}
+	return len(ix.postings), postings
+}
+
+// Candidates отдаёт по возрастанию номера записей, в которых есть все тройки символов запроса.
+// false - запрос короче трёх символов и индекс ничем не поможет
+func (ix *TrigramIndex) Candidates(query string) ([]int, bool) {
+	queryTrigrams := trigrams(foldCase(query))
+	if len(queryTrigrams) == 0 {
+		return nil, false
+	}
+	var candidates []int
+	for i, trigram := range queryTrigrams {
+		postings := ix.postings[trigram]
+		if i == 0 {
+			candidates = append([]int{}, postings...)
+		} else {
+			candidates = intersectSorted(candidates, postings)
+		}
+		if len(candidates) == 0 {
+			return []int{}, true
+		}
+	}
+	return candidates, true
+}
+
+// intersectSorted пересекает два возрастающих списка, результат пишется поверх a
+func intersectSorted(a, b []int) []int {
+	result := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package searchserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrigramIndexCandidates(t *testing.T) {
+	index := NewTrigramIndex(prepared(
+		Item{FirstName: "Boyd", LastName: "Wolf", About: "Nulla cillum"},
+		Item{FirstName: "Hilda", LastName: "Mayer", About: "Sit commodo, consectetur"},
+		Item{FirstName: "Иван", LastName: "Петров", About: "Любит Nulla"},
+	))
+	cases := []struct {
+		Query    string
+		Expected []int
+		Ok       bool
+	}{
+		{Query: "nulla", Expected: []int{0, 2}, Ok: true},
+		{Query: "ULL", Expected: []int{0, 2}, Ok: true},
+		{Query: "yd wo", Expected: []int{0}, Ok: true},
+		{Query: "o, c", Expected: []int{1}, Ok: true},
+		{Query: "ан п", Expected: []int{2}, Ok: true},
+		// на стыке имени и описания совпадений не бывает
+		{Query: "wolf nulla", Expected: []int{}, Ok: true},
+		{Query: "xyz", Expected: []int{}, Ok: true},
+		{Query: "ul", Ok: false},
+		{Query: "", Ok: false},
+	}
+	for caseNum, testCase := range cases {
+		got, ok := index.Candidates(testCase.Query)
+		if ok != testCase.Ok || (ok && !reflect.DeepEqual(got, testCase.Expected)) {
+			t.Errorf("[%d] %q: expected %v %v, got %v %v", caseNum, testCase.Query, testCase.Expected, testCase.Ok, got, ok)
+		}
+	}
+}
+
+func TestServerUnknownIndex(t *testing.T) {
+	s := &Server{DatasetPath: datasetPath, Index: "bloom"}
+	if err := s.Reload(); err == nil {
+		t.Error("expected error for unknown index")
+	}
+	s.Index = IndexTrigrams
+	if err := s.Reload(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
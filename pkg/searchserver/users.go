@@ -0,0 +1,69 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hw4/pkg/searchclient"
+)
+
+// serveUser - GET /users/{id} и /users/guid/{guid}: отдаёт одного пользователя объектом, таким же, как в списке поиска.
+// Ищет через то же хранилище и кэш, что и поиск, как фильтр по Id или Guid. Нет такого пользователя - 404 NOT_FOUND
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request, path string, mask FieldMask) {
+	query, name, ok := userQuery(path)
+	if !ok {
+		JSONError(w, r, fmt.Sprintf("user %s not found", name), searchclient.CodeNotFound, http.StatusNotFound)
+		return
+	}
+	fields, err := ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		JSONError(w, r, err, searchclient.CodeBadFields, http.StatusBadRequest)
+		return
+	}
+	mask = mask.only(fields)
+	ctx := r.Context()
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	page, err := s.search(ctx, query)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			JSONError(w, r, "search timed out", searchclient.CodeUnavailable, http.StatusServiceUnavailable)
+			return
+		}
+		JSONError(w, r, "Internal Server Error", searchclient.CodeInternal, http.StatusInternalServerError)
+		return
+	}
+	noteResults(r.Context(), len(page.Users), page.Total)
+	if len(page.Users) == 0 {
+		JSONError(w, r, fmt.Sprintf("user %s not found", name), searchclient.CodeNotFound, http.StatusNotFound)
+		return
+	}
+	item := &page.Users[0]
+	var user interface{} = UserJson{Id: item.Id, Guid: item.Guid, Name: item.Name, Age: item.Age, About: item.About, Gender: item.Gender}
+	if len(mask) > 0 {
+		user = mask.apply(item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// userQuery - поиск одного пользователя по пути /users/{id} или /users/guid/{guid} и как назвать его в ошибке
+func userQuery(path string) (Query, string, bool) {
+	if guid, ok := strings.CutPrefix(path, searchclient.UsersGuidPath); ok {
+		return Query{Guid: guid, Limit: 1}, "with guid " + guid, guid != ""
+	}
+	rawID := strings.TrimPrefix(path, searchclient.UsersPath)
+	userID, err := strconv.Atoi(rawID)
+	if err != nil || userID < 0 {
+		return Query{}, strconv.Quote(rawID), false
+	}
+	return Query{IDs: []int{userID}, Limit: 1}, rawID, true
+}
@@ -0,0 +1,56 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hw4/pkg/searchclient"
+)
+
+func TestServerUser(t *testing.T) {
+	s := &Server{
+		DatasetPath: datasetPath,
+		Tokens:      map[string]string{"reader": "r-secret", "support": "s-secret"},
+		Scopes:      map[string][]string{"support": {ScopeSearchRead, ScopePIIRead}},
+		FieldMask:   FieldMask{"About": MaskRedact},
+	}
+	cases := []struct {
+		Target   string
+		Token    string
+		Status   int
+		Expected string
+	}{
+		{Target: "/users/7", Token: "s-secret", Status: http.StatusOK, Expected: `"Name":"Leann Travis","Age":34`},
+		{Target: "/v2/users/0", Token: "s-secret", Status: http.StatusOK, Expected: `"Id":0,"Guid":"1a6fa827-62f1-45f6-b579-aaead2b47169","Name":"Boyd Wolf"`},
+		{Target: "/users/7", Token: "r-secret", Status: http.StatusOK, Expected: `"About":"***"`},
+		{Target: "/users/999", Token: "s-secret", Status: http.StatusNotFound, Expected: `"code":"NOT_FOUND"`},
+		{Target: "/users/abc", Token: "s-secret", Status: http.StatusNotFound, Expected: `"code":"NOT_FOUND"`},
+		{Target: "/users/", Token: "s-secret", Status: http.StatusNotFound, Expected: `"code":"NOT_FOUND"`},
+		{Target: "/users/7", Token: "bad", Status: http.StatusUnauthorized, Expected: `"code":"BAD_TOKEN"`},
+		{Target: "/users/guid/f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb", Token: "s-secret", Status: http.StatusOK, Expected: `"Id":7,"Guid":"f8f6bdc9-fc2a-4147-b0ad-29ae751da5bb"`},
+		{Target: "/v2/users/guid/1a6fa827-62f1-45f6-b579-aaead2b47169", Token: "r-secret", Status: http.StatusOK, Expected: `"Name":"Boyd Wolf"`},
+		{Target: "/users/guid/no-such-guid", Token: "s-secret", Status: http.StatusNotFound, Expected: `"message":"user with guid no-such-guid not found"`},
+		{Target: "/users/guid/", Token: "s-secret", Status: http.StatusNotFound, Expected: `"code":"NOT_FOUND"`},
+	}
+	for caseNum, testCase := range cases {
+		req := httptest.NewRequest(http.MethodGet, testCase.Target, nil)
+		req.Header.Set("AccessToken", testCase.Token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != testCase.Status || !strings.Contains(rec.Body.String(), testCase.Expected) {
+			t.Errorf("[%d] expected %d with %s, got %d %s", caseNum, testCase.Status, testCase.Expected, rec.Code, rec.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	req.Header.Set("AccessToken", "s-secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var user searchclient.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil || user.Id != 7 || user.Gender != "female" {
+		t.Errorf("expected user 7 object, got %s", rec.Body)
+	}
+}
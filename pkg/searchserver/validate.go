@@ -0,0 +1,140 @@
+package searchserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Genders - допустимые значения gender, пустой gender тоже допустим
+var Genders = []string{"male", "female"}
+
+// Problem - что не так с одной записью датасета
+type Problem struct {
+	// номер записи в файле, с 1
+	Row     int    `json:"row"`
+	Id      int    `json:"id"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("row %d: %s", p.Row, p.Message)
+}
+
+// ValidationReport - итог Validate: сколько записей проверено и что с ними не так
+type ValidationReport struct {
+	Rows     int       `json:"rows"`
+	Problems []Problem `json:"problems"`
+}
+
+// Err - ошибка со всем отчётом, nil - проблем нет
+func (r ValidationReport) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Report: r}
+}
+
+// ValidationError - датасет не прошёл Validate, подробности в Report
+type ValidationError struct {
+	Report ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	problems := e.Report.Problems
+	if len(problems) == 1 {
+		return fmt.Sprintf("invalid dataset: %s", problems[0])
+	}
+	return fmt.Sprintf("invalid dataset: %s and %d more problems", problems[0], len(problems)-1)
+}
+
+// Validate проверяет каждую запись: есть first_name или last_name, age не отрицательный, gender из Genders,
+// id и непустые guid не повторяются. Возвращает все найденные проблемы, а не только первую
+func (r *Root) Validate() ValidationReport {
+	return validateRows(r.Row)
+}
+
+func validateRows(rows []Item) ValidationReport {
+	report := ValidationReport{Rows: len(rows)}
+	add := func(i int, field, message string, args ...any) {
+		report.Problems = append(report.Problems, Problem{Row: i + 1, Id: rows[i].Id, Field: field, Message: fmt.Sprintf(message, args...)})
+	}
+	seen := make(map[int]int, len(rows))
+	guids := make(map[string]int, len(rows))
+	for i := range rows {
+		item := &rows[i]
+		if item.FirstName == "" && item.LastName == "" {
+			add(i, "first_name", "first_name and last_name are empty")
+		}
+		if item.Age < 0 {
+			add(i, "age", "age %d is negative", item.Age)
+		}
+		if item.Gender != "" && !validGender(item.Gender) {
+			add(i, "gender", "gender %q is not one of %s", item.Gender, strings.Join(Genders, ", "))
+		}
+		if first, ok := guids[item.Guid]; ok && item.Guid != "" {
+			add(i, "guid", "duplicate guid %s, first seen in row %d", item.Guid, first)
+		} else if item.Guid != "" {
+			guids[item.Guid] = i + 1
+		}
+		if first, ok := seen[item.Id]; ok {
+			add(i, "id", "duplicate id %d, first seen in row %d", item.Id, first)
+			continue
+		}
+		seen[item.Id] = i + 1
+	}
+	return report
+}
+
+func validGender(gender string) bool {
+	for _, valid := range Genders {
+		if gender == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadStatus - чем кончались перезагрузки датасета, для проверок здоровья и метрик
+type ReloadStatus struct {
+	// когда датасет последний раз успешно подменили и sha256 его файла
+	LastSuccess time.Time
+	Checksum    string
+	// последняя неудачная попытка и её ошибка, пустые - после неё была успешная
+	LastFailure time.Time
+	LastError   string
+	// сколько попыток подряд кончились ошибкой
+	Failures int
+	// проблемы в записях, если последняя попытка не прошла Validate
+	Problems []Problem
+	// повторы, выкинутые политикой Server.Duplicates при последней успешной загрузке
+	Dropped []Problem
+}
+
+// ReloadStatus - итог последних перезагрузок через Reload
+func (s *Server) ReloadStatus() ReloadStatus {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	return s.status
+}
+
+// recordReload запоминает итог перезагрузки
+func (s *Server) recordReload(checksum string, dropped []Problem, err error) error {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if err != nil {
+		s.status.LastFailure = time.Now()
+		s.status.LastError = strings.TrimSpace(err.Error())
+		s.status.Failures++
+		s.status.Problems = nil
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			s.status.Problems = validationErr.Report.Problems
+		}
+		return err
+	}
+	s.status = ReloadStatus{LastSuccess: time.Now(), Checksum: checksum, Dropped: dropped}
+	return nil
+}
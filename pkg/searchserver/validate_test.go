@@ -0,0 +1,115 @@
+package searchserver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRootValidate(t *testing.T) {
+	cases := []struct {
+		Rows     []Item
+		Expected []Problem
+	}{
+		{Rows: []Item{{Id: 0, FirstName: "Ann", Gender: "female"}, {Id: 1, LastName: "Lee", Age: 30}}},
+		{
+			Rows:     []Item{{Id: 1, FirstName: "Ann"}, {Id: 2}},
+			Expected: []Problem{{Row: 2, Id: 2, Field: "first_name", Message: "first_name and last_name are empty"}},
+		},
+		{
+			Rows: []Item{{Id: 1, FirstName: "Ann"}, {Id: 2, FirstName: "Bob", Age: -1, Gender: "Male"}, {Id: 1, FirstName: "Cid"}},
+			Expected: []Problem{
+				{Row: 2, Id: 2, Field: "age", Message: "age -1 is negative"},
+				{Row: 2, Id: 2, Field: "gender", Message: `gender "Male" is not one of male, female`},
+				{Row: 3, Id: 1, Field: "id", Message: "duplicate id 1, first seen in row 1"},
+			},
+		},
+	}
+	for caseNum, item := range cases {
+		root := Root{Row: item.Rows}
+		report := root.Validate()
+		if report.Rows != len(item.Rows) || !reflect.DeepEqual(report.Problems, item.Expected) {
+			t.Errorf("[%d] expected %+v, got %+v", caseNum, item.Expected, report)
+		}
+		if (report.Err() == nil) != (len(item.Expected) == 0) {
+			t.Errorf("[%d] unexpected error %v", caseNum, report.Err())
+		}
+	}
+
+	root := Root{Row: []Item{{Id: 1}, {Id: 1}, {Id: 1}}}
+	expected := "invalid dataset: row 1: first_name and last_name are empty and 4 more problems"
+	if err := root.Validate().Err(); err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	// настоящий датасет валиден
+	var full Root
+	if err := full.DecodeXML(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	if report := full.Validate(); len(report.Problems) != 0 || report.Rows != 35 {
+		t.Errorf("expected valid dataset.xml, got %+v", report)
+	}
+}
+
+// невалидный датасет не подменяет рабочий, а ошибка видна в ReloadStatus
+func TestServerReloadValidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<root><row><id>1</id><first_name>Ann</first_name></row></root>`)
+	s := &Server{DatasetPath: path}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.ReloadStatus(); status.LastSuccess.IsZero() || status.Failures != 0 {
+		t.Errorf("expected successful reload status, got %+v", status)
+	}
+
+	write(`<root><row><id>1</id><first_name>Ann</first_name></row><row><id>1</id><first_name>Bob</first_name></row></root>`)
+	for i := 1; i <= 2; i++ {
+		err := s.Reload()
+		if err == nil || !strings.Contains(err.Error(), "duplicate id 1") {
+			t.Errorf("expected duplicate id error, got %v", err)
+		}
+		status := s.ReloadStatus()
+		if status.Failures != i || status.LastFailure.IsZero() || status.LastError != err.Error() || len(status.Problems) != 1 {
+			t.Errorf("expected %d failures with the error, got %+v", i, status)
+		}
+	}
+	if got := s.Snapshot().Len(); got != 1 {
+		t.Errorf("expected old dataset with 1 user, got %d", got)
+	}
+
+	// то же для отображаемого в память датасета
+	var buf strings.Builder
+	if err := WriteBinaryDataset(&buf, Root{Row: []Item{{Id: 5}}}); err != nil {
+		t.Fatal(err)
+	}
+	binPath := filepath.Join(filepath.Dir(path), "dataset.bin")
+	if err := os.WriteFile(binPath, []byte(buf.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.DatasetPath, s.MapDataset = binPath, true
+	if err := s.Reload(); err == nil {
+		t.Error("expected error for nameless mapped dataset")
+	}
+	if got := s.Snapshot().Len(); got != 1 {
+		t.Errorf("expected old dataset with 1 user, got %d", got)
+	}
+
+	s.DatasetPath, s.MapDataset = path, false
+	write(`<root><row><id>2</id><first_name>Bob</first_name></row></root>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.ReloadStatus(); status.Failures != 0 || status.LastError != "" || status.Problems != nil {
+		t.Errorf("expected failures reset after success, got %+v", status)
+	}
+}
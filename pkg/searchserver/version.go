@@ -0,0 +1,80 @@
+package searchserver
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Версия сборки, задаётся при сборке:
+//
+//	go build -ldflags "-X hw4/pkg/searchserver.Version=v1.2.0 -X hw4/pkg/searchserver.Commit=$(git rev-parse HEAD)"
+//
+// Если не задана - берётся из информации о сборке, которую записывает go build
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// VersionResponse - тело ответа /version: что за сборка запущена и какой датасет она отдаёт
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+	// nil - датасет ещё не загружен
+	Dataset *DatasetVersion `json:"dataset,omitempty"`
+}
+
+// DatasetVersion - загруженный датасет
+type DatasetVersion struct {
+	// sha256 файла датасета, пустой - данные в стороннем хранилище
+	Checksum string `json:"checksum,omitempty"`
+	Rows     int    `json:"rows"`
+	// nil - данные в стороннем хранилище, когда они менялись, серверу не известно
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+}
+
+// BuildVersion - версия и коммит сборки: заданные через -ldflags, иначе записанные go build
+func BuildVersion() (version, commit string) {
+	version, commit = Version, Commit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if commit == "" && setting.Key == "vcs.revision" {
+				commit = setting.Value
+			}
+		}
+	}
+	if version == "" {
+		version = "dev"
+	}
+	return version, commit
+}
+
+// counter - хранилище, которое умеет посчитать свои записи
+type counter interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// serveVersion отвечает на /version. Датасет ради ответа не загружается
+func (s *Server) serveVersion(w http.ResponseWriter, r *http.Request) {
+	resp := VersionResponse{GoVersion: runtime.Version()}
+	resp.Version, resp.Commit = BuildVersion()
+	if s.Storage == nil {
+		if snapshot := s.store.Snapshot(); snapshot != nil {
+			loadedAt := snapshot.LoadedAt.UTC()
+			resp.Dataset = &DatasetVersion{Checksum: s.ReloadStatus().Checksum, Rows: snapshot.Len(), LoadedAt: &loadedAt}
+		}
+	} else if storage, ok := s.Storage.(counter); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if rows, err := storage.Count(ctx); err == nil {
+			resp.Dataset = &DatasetVersion{Rows: rows}
+		}
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,68 @@
+package searchserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestServerVersion(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "v1.2.0", "abc123"
+
+	data, err := os.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	s := &Server{DatasetPath: datasetPath}
+
+	version := func() VersionResponse {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp VersionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := version()
+	if resp.Version != "v1.2.0" || resp.Commit != "abc123" || resp.GoVersion == "" {
+		t.Errorf("unexpected build info %+v", resp)
+	}
+	// ради /version датасет не загружается
+	if resp.Dataset != nil || s.Snapshot() != nil {
+		t.Errorf("expected dataset not to be loaded, got %+v", resp.Dataset)
+	}
+
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	resp = version()
+	if resp.Dataset == nil {
+		t.Fatal("expected dataset info after reload")
+	}
+	if resp.Dataset.Rows != 35 || resp.Dataset.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected dataset info %+v", resp.Dataset)
+	}
+	if resp.Dataset.LoadedAt == nil || !resp.Dataset.LoadedAt.Equal(s.Snapshot().LoadedAt) {
+		t.Errorf("expected load time %s, got %v", s.Snapshot().LoadedAt, resp.Dataset.LoadedAt)
+	}
+}
+
+func TestBuildVersionDefault(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "", ""
+	// в тестовом бинарнике версии модуля нет
+	if version, _ := BuildVersion(); version != "dev" {
+		t.Errorf("expected dev version, got %q", version)
+	}
+}
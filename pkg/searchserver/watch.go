@@ -0,0 +1,71 @@
+package searchserver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch следит за файлом датасета и перечитывает его через Reload. Пайплайны часто пишут файл в несколько
+// приёмов, поэтому перезагрузка случается только через debounce после последнего изменения.
+// Результат каждой перезагрузки отдаётся в onReload. Работает, пока не отменят ctx
+func (s *Server) Watch(ctx context.Context, debounce time.Duration, onReload func(error)) error {
+	if IsRemoteDataset(s.DatasetFile()) {
+		return errRemoteWatch
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cant create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// следим за каталогом, а не за файлом: при подмене через rename вотчер на сам файл теряется
+	path := s.DatasetFile()
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("cant watch %s: %w", path, err)
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			onReload(fmt.Errorf("watcher error: %w", err))
+		case <-timer.C:
+			onReload(s.Reload())
+		}
+	}
+}
+
+// Refresh перечитывает датасет через Reload раз в interval, для файлов по ссылке и там, где за файлом
+// не уследить. Новый датасет подменяет старый, только если он прочитался и прошёл проверки Reload.
+// Результат каждой перезагрузки отдаётся в onReload. Работает, пока не отменят ctx
+func (s *Server) Refresh(ctx context.Context, interval time.Duration, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			onReload(s.Reload())
+		}
+	}
+}
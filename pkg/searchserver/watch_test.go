@@ -0,0 +1,144 @@
+package searchserver
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	write := func(content string) {
+		t.Helper()
+		// пишем во временный файл и подменяем через rename, как делают пайплайны
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	row := func(id string) string {
+		return `<row><id>` + id + `</id><first_name>Jane</first_name><last_name>Doe</last_name></row>`
+	}
+	write("<root>" + row("1") + "</root>")
+
+	s := &Server{DatasetPath: path}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %s", err)
+	}
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Watch(ctx, 50*time.Millisecond, func(err error) { reloads <- err })
+	}()
+	// даём вотчеру подписаться на каталог
+	time.Sleep(50 * time.Millisecond)
+
+	// несколько записей подряд склеиваются в одну перезагрузку
+	write("<root>" + row("2") + "</root>")
+	write("<root>" + row("3") + "</root>")
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatalf("unexpected reload error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dataset was not reloaded")
+	}
+	if _, users := search(t, s, "token", "order_by=0"); !reflect.DeepEqual(userIds(users), []int{3}) {
+		t.Errorf("expected reloaded dataset, got %v", userIds(users))
+	}
+	select {
+	case err := <-reloads:
+		t.Errorf("expected single reload, got another one: %v", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// битый файл не подменяет рабочий датасет
+	write("<root><row>")
+	select {
+	case err := <-reloads:
+		if err == nil {
+			t.Error("expected reload error for broken dataset")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broken dataset was not noticed")
+	}
+	if code, users := search(t, s, "token", "order_by=0"); code != http.StatusOK || !reflect.DeepEqual(userIds(users), []int{3}) {
+		t.Errorf("expected old dataset after failed reload, got %v (status %d)", userIds(users), code)
+	}
+
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Errorf("unexpected watch error: %s", err)
+	}
+}
+
+func TestServerRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	write := func(content string) {
+		t.Helper()
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`<root><row><id>1</id><first_name>Ann</first_name></row></root>`)
+	s := &Server{DatasetPath: path}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.Refresh(ctx, 10*time.Millisecond, func(err error) {
+			select {
+			case reloads <- err:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	// ждём перезагрузку, после которой выполнится done
+	waitReload := func(done func(error) bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case err := <-reloads:
+				if done(err) {
+					return
+				}
+			case <-timeout:
+				t.Fatal("timeout waiting for refresh")
+			}
+		}
+	}
+
+	write(`<root><row><id>1</id><first_name>Ann</first_name></row><row><id>2</id><first_name>Bob</first_name></row></root>`)
+	waitReload(func(err error) bool { return err == nil && s.Snapshot().Len() == 2 })
+
+	// битый файл не подменяет датасет
+	write(`<root><row>`)
+	waitReload(func(err error) bool { return err != nil })
+	if got := s.Snapshot().Len(); got != 2 {
+		t.Errorf("expected old 2 users to stay, got %d", got)
+	}
+}